@@ -2,17 +2,101 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"maps"
 	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
 	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/metrics"
 	"github.com/arduriki/sage-bitrix-sync/internal/sync"
+	"github.com/arduriki/sage-bitrix-sync/internal/syncstore"
 )
 
 func main() {
+	rediscover := flag.Bool("rediscover", false, "ignore cached entity type discovery and probe the portal again")
+	exportPath := flag.String("export", "", "export all Bitrix24 socios as CSV to this file (- for stdout) and exit")
+	fieldTemplate := flag.String("field-template", "", "print a field mapping guessed from the portal's fields (json or env) and exit")
+	dryRun := flag.Bool("dry-run", false, "compare Sage with Bitrix24 and print the planned changes without writing")
+	full := flag.Bool("full", false, "ignore the incremental sync state and reconcile every socio")
+	details := flag.Bool("details", false, "print what happened to each socio after the sync")
+	diffCSV := flag.String("diff-csv", "", "write the old and new value of every field the sync changed, or would change, as CSV to this file")
+	dnis := flag.String("dnis", "", "only sync the socios with these comma-separated DNIs, even if unchanged")
+	rebuildMapping := flag.Bool("rebuild-mapping", false, "rebuild the DNI → Bitrix24 item mapping of the sync state from a full listing and exit")
+	plan := flag.Bool("plan", false, "plan the socios sync like -dry-run and keep the plan for -approve and -apply")
+	approve := flag.String("approve", "", "approve the kept plan of this run ID and exit")
+	apply := flag.String("apply", "", "apply the approved plan of this run ID and exit")
+	rollback := flag.String("rollback", "", "undo the updates and deletions of this run ID and exit")
+	force := flag.Bool("force", false, "with -rollback, also overwrite items newer runs have written since")
+	checkSage := flag.Bool("check-sage", false, "check the Sage database has the tables and columns the socios sync reads and exit")
+	empresas := flag.Bool("empresas", false, "print how many socios each Sage empresa has and exit")
+	metricsFile := flag.String("metrics-file", "", "write the run metrics in the Prometheus text format to this file (node_exporter textfile collector)")
+	storePath := flag.String("store", "", "save the result of every sync run to the SQLite run history in this file")
+	flag.Parse()
+
+	if *fieldTemplate != "" {
+		if err := runFieldTemplate(*fieldTemplate); err != nil {
+			log.Fatal("❌ Field template failed: ", err)
+		}
+		return
+	}
+
+	if *exportPath != "" {
+		if err := runExport(*exportPath); err != nil {
+			log.Fatal("❌ Export failed: ", err)
+		}
+		return
+	}
+
+	if *checkSage {
+		if err := runCheckSage(); err != nil {
+			log.Fatal("❌ Sage check failed: ", err)
+		}
+		return
+	}
+
+	if *empresas {
+		if err := runEmpresas(); err != nil {
+			log.Fatal("❌ Empresa count failed: ", err)
+		}
+		return
+	}
+
+	if *rebuildMapping {
+		if err := runRebuildMapping(); err != nil {
+			log.Fatal("❌ Mapping rebuild failed: ", err)
+		}
+		return
+	}
+
+	if *approve != "" {
+		if err := runApprovePlan(*approve); err != nil {
+			log.Fatal("❌ Plan approval failed: ", err)
+		}
+		return
+	}
+
+	if *apply != "" {
+		if err := runApplyPlan(*apply); err != nil {
+			log.Fatal("❌ Plan apply failed: ", err)
+		}
+		return
+	}
+
+	if *rollback != "" {
+		if err := runRollback(*rollback, *force); err != nil {
+			log.Fatal("❌ Rollback failed: ", err)
+		}
+		return
+	}
+
 	fmt.Println("🚀 Sage-Bitrix Sync - Complete Integration Test")
 	fmt.Println("===============================================")
 	fmt.Println("Testing complete sync cycle: Sage → Bitrix24")
@@ -27,9 +111,28 @@ func main() {
 	if err != nil {
 		log.Fatal("❌ Failed to load configuration:", err)
 	}
+	if *dryRun {
+		cfg.Sync.DryRun = true
+	}
+	if *full {
+		cfg.Sync.ForceFull = true
+	}
+	if *details || *diffCSV != "" {
+		cfg.Sync.CollectDetails = true
+	}
+	var syncOpts []sync.SyncOption
+	if *dnis != "" {
+		cfg.Sync.Entities = []string{config.EntitySocios}
+		syncOpts = append(syncOpts, sync.WithDNIs(strings.Split(*dnis, ",")...))
+	}
+	if *plan {
+		cfg.Sync.DryRun = true
+		cfg.Sync.Entities = []string{config.EntitySocios}
+		syncOpts = append(syncOpts, sync.WithApproval())
+	}
 
 	fmt.Printf("✅ Configuration loaded successfully\n")
-	fmt.Printf("   🏢 Sage Database: %s@%s:%d/%s\n", cfg.SageDB.Username, cfg.SageDB.Host, cfg.SageDB.Port, cfg.SageDB.Database)
+	fmt.Printf("   🏢 Sage Database: %s@%s:%d/%s\n", cfg.SageDB.Login(), cfg.SageDB.Host, cfg.SageDB.Port, cfg.SageDB.Database)
 	fmt.Printf("   🔗 Bitrix24: %s\n", cfg.Bitrix.Endpoint)
 	fmt.Printf("   📋 License: %s\n", cfg.License.ID)
 	fmt.Printf("   🏭 Company Mapping: Bitrix '%s' ↔ Sage '%s'\n", cfg.Company.BitrixCode, cfg.Company.SageCode)
@@ -42,21 +145,46 @@ func main() {
 	fmt.Println()
 
 	// Create Bitrix client for discovery
-	bitrixClient := bitrix.NewClient(cfg.Bitrix.Endpoint, logger)
+	bitrixClient, err := bitrix.NewClientValidated(cfg.Bitrix.Endpoint, logger)
+	if err != nil {
+		log.Fatal("❌ Invalid Bitrix24 endpoint:", err)
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
 	// Test connection first
 	logger.Printf("🧪 Testing Bitrix24 connection...")
-	if err := bitrixClient.TestConnection(ctx); err != nil {
+	probe, err := bitrixClient.Probe(ctx)
+	printProbeResult(&probe)
+	if err != nil {
 		fmt.Printf("❌ Connection test failed: %v\n", err)
 		fmt.Println("💡 But let's continue with discovery anyway...")
 	}
 
-	// Discovery phase
+	// Discovery phase (cached per portal)
+	cache := bitrix.NewDiscoveryCache(cfg.Bitrix.DiscoveryCachePath)
+	if *rediscover {
+		fmt.Println("♻️  Discarding cached discovery results...")
+		if err := cache.Invalidate(bitrixClient.PortalHost()); err != nil {
+			fmt.Printf("⚠️  Could not invalidate cache: %v\n", err)
+		}
+	}
+
 	fmt.Println("🔎 Phase 1: Discovering Smart Process entity types...")
-	if err := bitrixClient.DiscoverEntityTypes(ctx); err != nil {
+	discovery, err := cache.Get(bitrixClient.PortalHost())
+	if err != nil {
+		fmt.Printf("⚠️  Could not read discovery cache: %v\n", err)
+	}
+	if discovery != nil {
+		fmt.Printf("📋 Using cached discovery from %s (run with -rediscover to refresh)\n",
+			discovery.DiscoveredAt.Format(time.RFC3339))
+	} else if discovery, err = bitrixClient.DiscoverEntityTypes(ctx); err != nil {
 		fmt.Printf("⚠️  Smart Process discovery failed: %v\n", err)
+	} else if err := cache.Put(discovery); err != nil {
+		fmt.Printf("⚠️  Could not save discovery cache: %v\n", err)
+	}
+	if discovery != nil {
+		printDiscoveryResult(discovery)
 	}
 	fmt.Println()
 
@@ -70,27 +198,37 @@ func main() {
 	fmt.Println("🎯 DISCOVERY COMPLETE!")
 	fmt.Println()
 	fmt.Println("Based on the results above:")
-	fmt.Println("1. If you found a working entity type ID, update the constant in client.go")
-	fmt.Println("2. If standard CRM entities work, we can modify the code to use those")
+	fmt.Println("1. If a socios entity type was identified, the sync will use it automatically")
+	fmt.Println("2. To force a specific one, set BITRIX_ENTITY_TYPE_ID in .env")
 	fmt.Println("3. If nothing works, you may need to create a Smart Process in Bitrix24 first")
 	fmt.Println()
-	fmt.Println("💡 To proceed with sync testing:")
-	fmt.Println("   - Update EntityTypeSocios in internal/bitrix/client.go")
-	fmt.Println("   - Or we can modify the approach based on what works")
-	fmt.Println()
 
 	// Optional: Try the full sync if user wants to
 	fmt.Print("🤔 Do you want to try the full sync anyway? (y/N): ")
 	var response string
 	fmt.Scanln(&response)
-	
+
 	if response == "y" || response == "Y" {
 		fmt.Println()
 		fmt.Println("🔄 Proceeding with full sync test...")
-		
+
 		// Step 3: Create sync service
 		fmt.Println("🔧 Initializing sync service...")
-		syncService := sync.NewService(logger)
+		var serviceOpts []sync.ServiceOption
+		recorder := metrics.NewPrometheus()
+		if *metricsFile != "" {
+			serviceOpts = append(serviceOpts, sync.WithMetrics(recorder))
+		}
+		if *storePath != "" {
+			store, err := syncstore.Open(ctx, *storePath)
+			if err != nil {
+				log.Fatal("❌ Failed to open the run history: ", err)
+			}
+			defer store.Close()
+			serviceOpts = append(serviceOpts, sync.WithAfterSync(store.AfterSync))
+			fmt.Printf("🗃️  Saving run results to %s\n", *storePath)
+		}
+		syncService := sync.NewService(logger, serviceOpts...)
 		fmt.Println("✅ Sync service initialized")
 		fmt.Println()
 
@@ -98,25 +236,54 @@ func main() {
 		fmt.Println("🔄 Starting complete sync cycle...")
 		fmt.Println("   This will:")
 		fmt.Println("   1. Connect to your Sage database")
-		fmt.Println("   2. Fetch all socios")
+		fmt.Printf("   2. Fetch all %s\n", strings.Join(cfg.Sync.Entities, ", "))
 		fmt.Println("   3. Connect to Bitrix24")
-		fmt.Println("   4. Sync socios to Bitrix24")
+		fmt.Printf("   4. Sync %s to Bitrix24\n", strings.Join(cfg.Sync.Entities, ", "))
 		fmt.Println()
 
-		// Perform the sync
-		result, err := syncService.SyncSocios(ctx, cfg)
+		// Perform the sync of every configured entity
+		multi, err := syncService.Orchestrate(ctx, cfg, syncOpts...)
+		if *metricsFile != "" {
+			if err := recorder.WriteFile(*metricsFile); err != nil {
+				fmt.Printf("⚠️  %v\n", err)
+			}
+		}
+		if multi == nil {
+			fmt.Printf("❌ Sync failed: %v\n", err)
+			os.Exit(1)
+		}
+		results := multi.Results()
+		if *diffCSV != "" {
+			if err := writeChangesCSV(*diffCSV, results); err != nil {
+				fmt.Printf("⚠️  %v\n", err)
+			} else {
+				fmt.Printf("🧾 Field changes written to %s\n", *diffCSV)
+			}
+		}
 		if err != nil {
 			fmt.Printf("❌ Sync failed: %v\n", err)
-			if result != nil {
+			for _, result := range results {
 				printSyncResult(result)
 			}
+			printEntityRuns(multi)
 			os.Exit(1)
 		}
 
 		// Display results
 		fmt.Println()
+		if cfg.Sync.DryRun {
+			fmt.Println("🧪 Dry run completed, nothing was written")
+			for _, result := range results {
+				printSyncResult(result)
+				printPlan(result.Plan)
+			}
+			return
+		}
 		fmt.Println("🎉 Sync completed successfully!")
-		printSyncResult(result)
+		for _, result := range results {
+			printSyncResult(result)
+		}
+		printEntityRuns(multi)
 
 		// Next steps
 		fmt.Println()
@@ -129,35 +296,364 @@ func main() {
 	} else {
 		fmt.Println()
 		fmt.Println("👍 No problem! Use the discovery results to:")
-		fmt.Println("1. Update the entity type ID in the code")
-		fmt.Println("2. Or let me know what entity types work and I'll help modify the approach")
+		fmt.Println("1. Set BITRIX_ENTITY_TYPE_ID if the detected type is wrong")
+		fmt.Println("2. Or run with -rediscover after changing the portal setup")
+	}
+}
+
+// runExport writes a CSV snapshot of the portal's socios. Logs go to stderr so
+// the CSV can be written to stdout.
+func runExport(path string) error {
+	logger := log.New(os.Stderr, "[EXPORT] ", log.LstdFlags)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	bitrixClient, err := cliClient(ctx, logger)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if path != "-" {
+		if out, err = os.Create(path); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	rows, err := bitrixClient.ExportSocios(ctx, out)
+	if err != nil {
+		return err
+	}
+	logger.Printf("✅ Wrote %d socios to %s", rows, path)
+	return nil
+}
+
+// runCheckSage checks the schema of each configured Sage database
+func runCheckSage() error {
+	logger := log.New(os.Stdout, "[SAGE] ", log.LstdFlags)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	databases := cfg.SageDB.Databases
+	if len(databases) == 0 {
+		databases = []string{cfg.SageDB.Database}
+	}
+	service := sync.NewService(logger)
+	unhealthy := 0
+	for _, database := range databases {
+		report, err := service.CheckSage(ctx, cfg.ForDatabase(database))
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", database, err)
+			unhealthy++
+			continue
+		}
+		if !report.Healthy() {
+			fmt.Printf("❌ %s\n", report)
+			unhealthy++
+			continue
+		}
+		fmt.Printf("✅ %s\n", report)
+	}
+	if unhealthy > 0 {
+		return fmt.Errorf("%d of %d Sage databases cannot be synced", unhealthy, len(databases))
+	}
+	return nil
+}
+
+// runEmpresas prints the socios of each empresa of each configured Sage
+// database, to choose the company mapping
+func runEmpresas() error {
+	logger := log.New(os.Stdout, "[SAGE] ", log.LstdFlags)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	databases := cfg.SageDB.Databases
+	if len(databases) == 0 {
+		databases = []string{cfg.SageDB.Database}
+	}
+	service := sync.NewService(logger)
+	for _, database := range databases {
+		empresas, err := service.SageEmpresas(ctx, cfg.ForDatabase(database))
+		if err != nil {
+			return fmt.Errorf("%s: %w", database, err)
+		}
+		total := 0
+		fmt.Printf("🗄️  %s: %d empresas with socios\n", database, len(empresas))
+		for _, empresa := range empresas {
+			fmt.Printf("   %6d  %6d socios  %s\n", empresa.CodigoEmpresa, empresa.Socios, empresa.Empresa)
+			total += empresa.Socios
+		}
+		fmt.Printf("   Total: %d socios\n", total)
+	}
+	if code, ok := cfg.Company.SageEmpresa(); ok {
+		fmt.Printf("📌 Mapped to empresa %d\n", code)
+	}
+	return nil
+}
+
+// runRebuildMapping rebuilds the DNI → item ID mapping the incremental sync
+// looks socios up by
+func runRebuildMapping() error {
+	logger := log.New(os.Stdout, "[MAPPING] ", log.LstdFlags)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	report, err := sync.NewService(logger).RebuildMapping(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🗺️  Mapping of client %s: %d socios listed\n", report.ClientID, report.Listed)
+	fmt.Printf("   Kept: %d, Added: %d, Repaired: %d, Removed: %d\n", report.Kept, report.Added, report.Repaired, report.Removed)
+	if report.Duplicates > 0 {
+		fmt.Printf("   ⚠️  %d DNIs are on several items; mapped to the newest\n", report.Duplicates)
+	}
+	return nil
+}
+
+// runApprovePlan approves the kept plan of a -plan run, on behalf of the
+// current user
+func runApprovePlan(runID string) error {
+	logger := log.New(os.Stdout, "[PLAN] ", log.LstdFlags)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	approver := os.Getenv("USER")
+	if approver == "" {
+		approver = "cli"
+	}
+
+	planned, err := sync.NewService(logger).ApprovePlan(cfg, runID, approver)
+	if err != nil {
+		return err
+	}
+	printPlan(planned.Plan)
+	fmt.Printf("✅ Approved; apply with -apply %s before %s\n", runID, planned.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// runApplyPlan applies the approved plan of a -plan run
+func runApplyPlan(runID string) error {
+	logger := log.New(os.Stdout, "[PLAN] ", log.LstdFlags)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	result, err := sync.NewService(logger).ApplyPlan(ctx, cfg, runID)
+	if result != nil {
+		printSyncResult(result)
+		if result.PlanConflicts > 0 {
+			fmt.Printf("   ⚔️  %d planned actions changed since planning and were left to the next sync\n", result.PlanConflicts)
+		}
+	}
+	return err
+}
+
+// runRollback undoes the updates and deletions of a socios run
+func runRollback(runID string, force bool) error {
+	logger := log.New(os.Stdout, "[ROLLBACK] ", log.LstdFlags)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	result, err := sync.NewService(logger).Rollback(ctx, cfg, runID, force)
+	if result != nil {
+		printSyncResult(result)
+	}
+	return err
+}
+
+// runFieldTemplate prints a field mapping guessed from the portal's fields, as
+// JSON or as .env lines, for onboarding a new portal.
+func runFieldTemplate(format string) error {
+	if format != "json" && format != "env" {
+		return fmt.Errorf("unknown format %q (use json or env)", format)
+	}
+	logger := log.New(os.Stderr, "[TEMPLATE] ", log.LstdFlags)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	bitrixClient, err := cliClient(ctx, logger)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := bitrixClient.GenerateFieldMappingTemplate(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range tmpl.Unmatched {
+		logger.Printf("⚠️  No field found for %s, fill it in by hand", name)
+	}
+
+	if format == "env" {
+		fmt.Print(tmpl.Env())
+		return nil
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tmpl)
+}
+
+// cliClient builds a Bitrix24 client from the configuration and resolves its
+// entity type, for the one-shot CLI modes.
+func cliClient(ctx context.Context, logger *log.Logger) (*bitrix.Client, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []bitrix.Option{bitrix.WithFieldMapping(cfg.Bitrix.Fields)}
+	if cfg.Bitrix.EntityTypeID > 0 {
+		opts = append(opts, bitrix.WithEntityTypeID(cfg.Bitrix.EntityTypeID))
+	}
+	bitrixClient, err := bitrix.NewClientValidated(cfg.Bitrix.Endpoint, logger, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Bitrix.EntityTypeID == 0 {
+		cache := bitrix.NewDiscoveryCache(cfg.Bitrix.DiscoveryCachePath)
+		if _, err := bitrixClient.ResolveEntityType(ctx, cache); err != nil {
+			return nil, err
+		}
+	}
+	return bitrixClient, nil
+}
+
+// printProbeResult displays the webhook probe summary
+func printProbeResult(probe *bitrix.ProbeResult) {
+	fmt.Printf("📡 Probe of %s:\n", probe.Portal)
+	fmt.Printf("   Reachable: %v (latency %s)\n", probe.Reachable, probe.Latency.Round(time.Millisecond))
+	if probe.Scopes != nil {
+		fmt.Printf("   Scopes: %s\n", strings.Join(probe.Scopes.Scopes, ", "))
+		if !probe.Scopes.OK() {
+			fmt.Printf("   ❌ Missing methods: %s\n", strings.Join(probe.Scopes.MissingMethods, ", "))
+		}
+	}
+	if probe.EntityTypeAvailable {
+		fmt.Printf("   Entity type %d: available\n", probe.EntityTypeID)
+	} else if probe.EntityTypeError != "" {
+		fmt.Printf("   Entity type %d: %s\n", probe.EntityTypeID, probe.EntityTypeError)
+	}
+	fmt.Println()
+}
+
+// printDiscoveryResult displays the entity types found on the portal
+func printDiscoveryResult(result *bitrix.DiscoveryResult) {
+	fmt.Printf("📊 Discovery for %s:\n", result.Portal)
+	for _, et := range result.EntityTypes {
+		marker := "  "
+		if et.ID == result.SociosTypeID {
+			marker = "👉"
+		}
+		fmt.Printf("   %s %d %-25s %d UF fields\n", marker, et.ID, et.Title, len(et.UFFields))
+	}
+	if result.SociosTypeID == 0 {
+		fmt.Println("   ⚠️  No entity type with the socios DNI field found")
 	}
 }
 
 // printSyncResult displays detailed sync results
 func printSyncResult(result *sync.SyncResult) {
-	fmt.Println("📊 Sync Results:")
+	if result.DryRun {
+		fmt.Printf("📊 Sync Results for %s, run %s (PLANNED, dry run):\n", result.Entity, result.RunID)
+	} else {
+		fmt.Printf("📊 Sync Results for %s, run %s:\n", result.Entity, result.RunID)
+	}
 	fmt.Println("   ╭─────────────────────────────────────╮")
 	fmt.Printf("   │ Client ID:       %-18s │\n", result.ClientID)
 	fmt.Printf("   │ Duration:        %-18s │\n", result.Duration)
+	if result.Incremental {
+		fmt.Printf("   │ Mode:            %-18s │\n", "incremental")
+	}
+	if result.DNIs != nil {
+		fmt.Printf("   │ Mode:            %-18s │\n", fmt.Sprintf("%d DNIs", len(result.DNIs)))
+	}
+	fmt.Printf("   │ Throttled:       %-18s │\n", result.ThrottleWait)
+	fmt.Printf("   │ API Calls:       %-18d │\n", result.APIStats.Requests)
+	if q := result.APIStats.Quota; q != nil {
+		fmt.Printf("   │ Quota Left:      %-18s │\n", q.Remaining.Round(time.Second))
+	}
 	fmt.Printf("   │ Success:         %-18v │\n", result.Success)
+	if result.TimedOut {
+		fmt.Printf("   │ Timed Out In:    %-18s │\n", result.TimedOutPhase)
+	}
 	fmt.Println("   ├─────────────────────────────────────┤")
 	fmt.Printf("   │ Socios Processed: %-17d │\n", result.SociosProcessed)
 	fmt.Printf("   │ Created:         %-18d │\n", result.SociosCreated)
 	fmt.Printf("   │ Updated:         %-18d │\n", result.SociosUpdated)
 	fmt.Printf("   │ Skipped:         %-18d │\n", result.SociosSkipped)
+	for _, reason := range slices.Sorted(maps.Keys(result.SkippedByReason)) {
+		fmt.Printf("   │   %-17s %-15d │\n", reason+":", result.SkippedByReason[reason])
+	}
+	fmt.Printf("   │ Deactivated:     %-18d │\n", result.SociosDeactivated)
+	fmt.Printf("   │ Deleted:         %-18d │\n", result.SociosDeleted)
+	fmt.Printf("   │ Failed:          %-18d │\n", result.SociosFailed)
+	if result.SociosInvalid > 0 {
+		fmt.Printf("   │ Invalid:         %-18d │\n", result.SociosInvalid)
+	}
+	if len(result.NotFound) > 0 {
+		fmt.Printf("   │ Not Found:       %-18d │\n", len(result.NotFound))
+	}
+	if result.ErrorsRecovered > 0 {
+		fmt.Printf("   │ Recovered:       %-18d │\n", result.ErrorsRecovered)
+	}
+	if result.SociosWrittenBack > 0 || result.Conflicts > 0 {
+		fmt.Printf("   │ Written Back:    %-18d │\n", result.SociosWrittenBack)
+		fmt.Printf("   │ Conflicts:       %-18d │\n", result.Conflicts)
+	}
 	fmt.Printf("   │ Errors:          %-18d │\n", len(result.Errors))
+	fmt.Printf("   │ Warnings:        %-18d │\n", len(result.Warnings))
 	fmt.Println("   ╰─────────────────────────────────────╯")
 
 	if len(result.Errors) > 0 {
 		fmt.Println()
-		fmt.Println("⚠️  Errors encountered:")
-		for i, err := range result.Errors {
-			fmt.Printf("   %d. %s\n", i+1, err)
+		fmt.Println("❌ Errors encountered:")
+		for i, issue := range result.Errors {
+			fmt.Printf("   %d. [%s] %s\n", i+1, issue.Code, issue.Message)
 		}
 	}
 
-	if result.Success {
+	if len(result.Warnings) > 0 {
+		fmt.Println()
+		fmt.Println("⚠️  Warnings:")
+		for _, issue := range result.Warnings {
+			fmt.Printf("   - [%s] %s\n", issue.Code, issue.Message)
+		}
+	}
+
+	printValidation(result.Validation)
+	printDetails(result.Details)
+
+	if !result.Aborted() && !result.DryRun {
 		fmt.Println()
 		if result.SociosCreated > 0 {
 			fmt.Printf("✨ %d new socios created in Bitrix24!\n", result.SociosCreated)
@@ -165,8 +661,105 @@ func printSyncResult(result *sync.SyncResult) {
 		if result.SociosUpdated > 0 {
 			fmt.Printf("📝 %d socios updated in Bitrix24!\n", result.SociosUpdated)
 		}
-		if result.SociosSkipped > 0 {
-			fmt.Printf("⏭️  %d socios were already up-to-date\n", result.SociosSkipped)
+		if n := result.SkippedByReason[sync.SkipUnchanged]; n > 0 {
+			fmt.Printf("⏭️  %d socios were already up-to-date\n", n)
+		}
+	}
+}
+
+// printValidation displays the socios that failed the data checks by rule
+func printValidation(report *sync.ValidationReport) {
+	if report == nil || report.Invalid == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Printf("🔎 %d of %d socios failed validation (policy: %s):\n", report.Invalid, report.Checked, report.Policy)
+	for _, rule := range []string{sync.RuleTaxID, sync.RuleParticipacion, sync.RuleRazonSocial} {
+		if v := report.Rules[rule]; v != nil {
+			fmt.Printf("   %s: %d (%s)\n", rule, v.Count, strings.Join(v.DNIs, ", "))
 		}
 	}
-}
\ No newline at end of file
+}
+
+// printEntityRuns displays the outcome of each entity of a multi-entity run
+func printEntityRuns(multi *sync.MultiEntityResult) {
+	if len(multi.Entities) < 2 {
+		return
+	}
+	fmt.Println()
+	fmt.Printf("🧭 Entities (%s in %s):\n", multi.Outcome, multi.Duration)
+	for _, run := range multi.Entities {
+		if run.Error != "" {
+			fmt.Printf("   %-10s %-8s %s\n", run.Entity, run.Outcome, run.Error)
+		} else {
+			fmt.Printf("   %-10s %s\n", run.Entity, run.Outcome)
+		}
+	}
+}
+
+// printDetails displays the per-socio outcomes, leaving out skipped socios
+// without conflicts
+func printDetails(details []sync.ItemResult) {
+	if len(details) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println("📋 Socio details:")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "   ACTION\tDNI\tBITRIX ID\tDETAILS")
+	for _, d := range details {
+		if d.Action == sync.ItemSkipped && len(d.Conflicts) == 0 {
+			continue
+		}
+		id := "-"
+		if d.BitrixID > 0 {
+			id = fmt.Sprint(d.BitrixID)
+		}
+		info := strings.Join(d.ChangedFields, ", ")
+		if len(d.Changes) > 0 {
+			parts := make([]string, len(d.Changes))
+			for i, c := range d.Changes {
+				parts[i] = fmt.Sprintf("%s: %q → %q", c.Field, c.Old, c.New)
+			}
+			info = strings.Join(parts, "; ")
+		}
+		for _, c := range d.Conflicts {
+			info += fmt.Sprintf("; %s: Sage %q / Bitrix24 %q, kept %s", c.Field, c.Sage, c.Bitrix, c.Winner)
+		}
+		if d.Error != "" {
+			info = d.Error
+		}
+		fmt.Fprintf(tw, "   %s\t%s\t%s\t%s\n", d.Action, d.DNI, id, info)
+	}
+	tw.Flush()
+}
+
+// writeChangesCSV writes the field changes of the socios runs to path
+func writeChangesCSV(path string, results []*sync.SyncResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create changes CSV: %w", err)
+	}
+	defer file.Close()
+	for _, result := range results {
+		if result.Entity != config.EntitySocios {
+			continue
+		}
+		if err := result.WriteChangesCSV(file); err != nil {
+			return fmt.Errorf("failed to write changes CSV: %w", err)
+		}
+	}
+	return nil
+}
+
+// printPlan displays the changes a dry run would make
+func printPlan(plan *sync.SyncPlan) {
+	if plan == nil {
+		return
+	}
+	fmt.Println()
+	fmt.Println("🧪 Planned changes:")
+	if err := plan.WriteTable(os.Stdout); err != nil {
+		fmt.Printf("❌ Failed to print plan: %v\n", err)
+	}
+}
@@ -0,0 +1,255 @@
+package bitrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// MaxBatchCommands is the most commands Bitrix24 accepts in one /batch call.
+const MaxBatchCommands = 50
+
+// BatchDeleteResult is the outcome of deleting one item in a batch.
+type BatchDeleteResult struct {
+	ID             int
+	AlreadyDeleted bool  // The item did not exist; counted as success
+	Err            error // Non-nil if this item could not be deleted
+}
+
+// batchResponse represents the /batch response. result and result_error are
+// objects keyed by command name, or empty arrays when no command succeeded or
+// failed.
+type batchResponse struct {
+	Result *struct {
+		Result      json.RawMessage `json:"result"`
+		ResultError json.RawMessage `json:"result_error"`
+	} `json:"result"`
+	Error *struct {
+		ErrorCode        string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	} `json:"error"`
+}
+
+// BatchDeleteSocios deletes items in /batch requests of up to
+// MaxBatchCommands commands, returning one result per ID in input order.
+// Items that are already gone count as deleted. Each batch goes through the
+// rate limiter and circuit breaker like any other request; the returned error
+// is only set when a whole batch fails, in which case results cover the
+// batches completed so far.
+func (c *Client) BatchDeleteSocios(ctx context.Context, ids []int) ([]BatchDeleteResult, error) {
+	c.logger.Printf("🗑️  Batch deleting %d socios in Bitrix24...", len(ids))
+
+	results := make([]BatchDeleteResult, 0, len(ids))
+	for start := 0; start < len(ids); start += MaxBatchCommands {
+		end := min(start+MaxBatchCommands, len(ids))
+
+		chunk, err := c.batchDelete(ctx, ids[start:end])
+		if err != nil {
+			return results, fmt.Errorf("failed to batch delete socios: %w", err)
+		}
+		results = append(results, chunk...)
+	}
+
+	deleted := 0
+	for _, r := range results {
+		if r.Err == nil {
+			deleted++
+		}
+	}
+	c.logger.Printf("✅ Batch delete finished: %d/%d deleted", deleted, len(ids))
+	return results, nil
+}
+
+// batchDelete sends a single /batch request deleting ids.
+func (c *Client) batchDelete(ctx context.Context, ids []int) ([]BatchDeleteResult, error) {
+	cmd := make(map[string]string, len(ids))
+	for _, id := range ids {
+		params := url.Values{}
+		params.Set("entityTypeId", strconv.Itoa(c.entityTypeID))
+		params.Set("id", strconv.Itoa(id))
+		cmd[batchKey(id)] = "crm.item.delete?" + params.Encode()
+	}
+
+	requestBody := map[string]interface{}{
+		"halt": 0,
+		"cmd":  cmd,
+	}
+
+	var response batchResponse
+	if err := c.doJSONRequest(ctx, "/batch", requestBody, &response); err != nil {
+		return nil, err
+	}
+	if response.Error != nil && response.Error.ErrorCode != "" {
+		return nil, &APIError{Code: response.Error.ErrorCode, Description: response.Error.ErrorDescription}
+	}
+
+	failures := make(map[string]*APIError)
+	if response.Result != nil {
+		raw := bytes.TrimSpace(response.Result.ResultError)
+		if len(raw) > 0 && raw[0] == '{' {
+			var errs map[string]struct {
+				Code        string `json:"error"`
+				Description string `json:"error_description"`
+			}
+			if err := json.Unmarshal(raw, &errs); err != nil {
+				return nil, fmt.Errorf("failed to decode batch errors: %w", err)
+			}
+			for key, e := range errs {
+				failures[key] = &APIError{Code: e.Code, Description: e.Description}
+			}
+		}
+	}
+
+	results := make([]BatchDeleteResult, len(ids))
+	for i, id := range ids {
+		results[i] = BatchDeleteResult{ID: id}
+		apiErr, failed := failures[batchKey(id)]
+		switch {
+		case !failed:
+		case apiErr.Code == "NOT_FOUND":
+			results[i].AlreadyDeleted = true
+		default:
+			results[i].Err = apiErr
+			c.logger.Printf("❌ Failed to delete socio %d: %v", id, apiErr)
+		}
+	}
+	return results, nil
+}
+
+// batchKey names the batch command for an item.
+func batchKey(id int) string {
+	return "delete_" + strconv.Itoa(id)
+}
+
+// CRMWrite is a create (ID 0) or update of a company or contact sent by
+// BatchWrite. Key identifies it in the results.
+type CRMWrite struct {
+	Key    string
+	ID     int
+	Fields map[string]interface{}
+}
+
+// CRMWriteResult is the outcome of one CRMWrite; ID is the created record's
+// ID for creates.
+type CRMWriteResult struct {
+	Key string
+	ID  int
+	Err error
+}
+
+// BatchWrite creates and updates companies or contacts in /batch requests of
+// up to MaxBatchCommands commands, returning one result per write in input
+// order. The returned error is only set when a whole batch fails, in which
+// case results cover the batches completed so far.
+func (c *Client) BatchWrite(ctx context.Context, entity string, writes []CRMWrite) ([]CRMWriteResult, error) {
+	results := make([]CRMWriteResult, 0, len(writes))
+	for start := 0; start < len(writes); start += MaxBatchCommands {
+		end := min(start+MaxBatchCommands, len(writes))
+
+		chunk, err := c.batchWrite(ctx, entity, writes[start:end])
+		if err != nil {
+			return results, fmt.Errorf("failed to batch write %s records: %w", entity, err)
+		}
+		results = append(results, chunk...)
+	}
+	return results, nil
+}
+
+// batchWrite sends a single /batch request with writes.
+func (c *Client) batchWrite(ctx context.Context, entity string, writes []CRMWrite) ([]CRMWriteResult, error) {
+	cmd := make(map[string]string, len(writes))
+	keys := make([]string, len(writes))
+	for i, w := range writes {
+		params := url.Values{}
+		method := "crm." + entity + ".add"
+		if w.ID > 0 {
+			method = "crm." + entity + ".update"
+			params.Set("id", strconv.Itoa(w.ID))
+		}
+		encodeBatchParams(params, "fields", w.Fields)
+		keys[i] = "write_" + strconv.Itoa(i)
+		cmd[keys[i]] = method + "?" + params.Encode()
+	}
+
+	requestBody := map[string]interface{}{
+		"halt": 0,
+		"cmd":  cmd,
+	}
+
+	var response batchResponse
+	if err := c.doJSONRequest(ctx, "/batch", requestBody, &response); err != nil {
+		return nil, err
+	}
+	if response.Error != nil && response.Error.ErrorCode != "" {
+		return nil, &APIError{Code: response.Error.ErrorCode, Description: response.Error.ErrorDescription}
+	}
+
+	succeeded := make(map[string]json.RawMessage)
+	failures := make(map[string]struct {
+		Code        string `json:"error"`
+		Description string `json:"error_description"`
+	})
+	if response.Result != nil {
+		if raw := bytes.TrimSpace(response.Result.Result); len(raw) > 0 && raw[0] == '{' {
+			if err := json.Unmarshal(raw, &succeeded); err != nil {
+				return nil, fmt.Errorf("failed to decode batch results: %w", err)
+			}
+		}
+		if raw := bytes.TrimSpace(response.Result.ResultError); len(raw) > 0 && raw[0] == '{' {
+			if err := json.Unmarshal(raw, &failures); err != nil {
+				return nil, fmt.Errorf("failed to decode batch errors: %w", err)
+			}
+		}
+	}
+
+	results := make([]CRMWriteResult, len(writes))
+	for i, w := range writes {
+		results[i] = CRMWriteResult{Key: w.Key, ID: w.ID}
+		if e, failed := failures[keys[i]]; failed {
+			results[i].Err = &APIError{Code: e.Code, Description: e.Description}
+			continue
+		}
+		raw, ok := succeeded[keys[i]]
+		if !ok {
+			results[i].Err = fmt.Errorf("no batch result for %s", w.Key)
+			continue
+		}
+		if w.ID == 0 {
+			var id json.Number
+			if err := json.Unmarshal(raw, &id); err != nil {
+				results[i].Err = fmt.Errorf("failed to decode created ID: %w", err)
+				continue
+			}
+			createdID, err := parseID(id)
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+			results[i].ID = createdID
+		}
+	}
+	return results, nil
+}
+
+// encodeBatchParams flattens value into params the way PHP's
+// http_build_query does (fields[PHONE][0][VALUE]=...), which is how /batch
+// commands carry nested parameters.
+func encodeBatchParams(params url.Values, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			encodeBatchParams(params, prefix+"["+key+"]", item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			encodeBatchParams(params, prefix+"["+strconv.Itoa(i)+"]", item)
+		}
+	case nil:
+		params.Set(prefix, "")
+	default:
+		params.Set(prefix, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,168 @@
+package bitrix
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting Bitrix24 while an endpoint's
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open: Bitrix24 endpoint unavailable")
+
+// Default circuit breaker settings.
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = time.Minute
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // Requests flow normally
+	BreakerOpen                         // Requests fail fast with ErrCircuitOpen
+	BreakerHalfOpen                     // A single probe request is allowed through
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerStatus is a snapshot of a breaker for stats and health reporting.
+type BreakerStatus struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenedAt            time.Time `json:"opened_at,omitempty"`
+}
+
+// CircuitBreaker opens after a number of consecutive failures and lets a
+// single probe through once the cooldown has elapsed.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+// NewCircuitBreaker creates a closed circuit breaker.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a request may be sent, returning ErrCircuitOpen if not.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		// Only one probe at a time.
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	}
+	return nil
+}
+
+// Record updates the breaker with the outcome of a request.
+func (b *CircuitBreaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Abandon releases a probe slot without recording an outcome, for requests
+// cancelled by the caller.
+func (b *CircuitBreaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Status returns a snapshot of the breaker.
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		State:               b.state.String(),
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != BreakerClosed {
+		status.OpenedAt = b.openedAt
+	}
+	return status
+}
+
+// breakers holds one circuit breaker per endpoint so that state survives
+// across the short-lived clients created for each sync run.
+var breakers = struct {
+	mu sync.Mutex
+	m  map[string]*CircuitBreaker
+}{m: make(map[string]*CircuitBreaker)}
+
+// breakerFor returns the shared breaker for an endpoint, creating it with the
+// given settings on first use.
+func breakerFor(endpoint string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	b, ok := breakers.m[endpoint]
+	if !ok {
+		b = NewCircuitBreaker(threshold, cooldown)
+		breakers.m[endpoint] = b
+	}
+	return b
+}
+
+// BreakerStatuses returns the breaker state of every endpoint used so far,
+// keyed like the breakers by webhook URL, with the token redacted (see
+// redactWebhook), so two webhooks on one portal are reported apart.
+func BreakerStatuses() map[string]BreakerStatus {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	statuses := make(map[string]BreakerStatus, len(breakers.m))
+	for endpoint, b := range breakers.m {
+		statuses[redactWebhook(endpoint)] = b.Status()
+	}
+	return statuses
+}
@@ -0,0 +1,45 @@
+package bitrix
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactWebhook(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"https://acme.bitrix24.es/rest/1/abcdefgh1234", "https://acme.bitrix24.es/rest/1/****1234"},
+		{"https://acme.bitrix24.es/rest/12/xyz", "https://acme.bitrix24.es/rest/12/****"},
+		{"https://crm.acme.local/bitrix/rest/1/abcdefgh1234", "https://crm.acme.local/bitrix/rest/1/****1234"},
+		{"https://acme.bitrix24.es/", "https://acme.bitrix24.es/"},
+	}
+	for _, tt := range tests {
+		if got := redactWebhook(tt.url); got != tt.want {
+			t.Errorf("redactWebhook(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+// TestBreakerStatusesPerWebhook checks two webhooks on one portal keep
+// their own breaker and status.
+func TestBreakerStatusesPerWebhook(t *testing.T) {
+	portal := "https://" + strings.ToLower(t.Name()) + ".bitrix24.es/rest/"
+	failing := breakerFor(portal+"1/failingtoken0001", 1, time.Minute)
+	breakerFor(portal+"7/healthytoken0002", 1, time.Minute)
+	failing.Record(false)
+
+	statuses := BreakerStatuses()
+	for key := range statuses {
+		if strings.Contains(key, "token") {
+			t.Errorf("status key %q holds the webhook token", key)
+		}
+	}
+	if got := statuses[portal+"1/****0001"].State; got != "open" {
+		t.Errorf("failing webhook breaker is %q, want open", got)
+	}
+	if got := statuses[portal+"7/****0002"].State; got != "closed" {
+		t.Errorf("healthy webhook breaker is %q, want closed", got)
+	}
+}
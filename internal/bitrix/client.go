@@ -1,15 +1,23 @@
 package bitrix
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/arduriki/sage-bitrix-sync/internal/models"
@@ -17,38 +25,122 @@ import (
 
 // Client handles Bitrix24 API operations using only standard library.
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
-	logger     *log.Logger
+	baseURL        string
+	httpClient     *http.Client
+	timeout        time.Duration
+	methodTimeouts map[string]time.Duration // Per REST method, overriding timeout
+	entityTypeID   int
+	verifyWrites   bool
+	fullItems      bool
+	transport      transportSettings
+
+	limiter       *RateLimiter
+	portalLimiter *RateLimiter // Shared by the portal's clients, see WithPortalCoordinator
+	throttled     atomic.Int64 // Total time spent waiting for the limiters
+	stats         apiCounters
+	quota         quotaTracker
+	warnings      warningLog
+
+	breaker          *CircuitBreaker
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	portals          *PortalCoordinator
+
+	companyLink     CompanyLink
+	companies       companyCache
+	companyCIFField string // Company UF field matching companies to Sage empresas by CIF
+
+	contactTaxIDField string // Contact UF field matching contacts to individual Sage clientes by NIF
+	dealInvoiceField  string // Deal UF field matching deals to Sage facturas by invoice number
+
+	productSKUProperty string // Product property (PROPERTY_<id>) matching products to Sage articulos by SKU
+
+	categoryID  int
+	stageID     string
+	updateStage bool // Whether updates may move items to stageID
+
+	assignedByID    int
+	enforceAssignee bool // Whether updates reassign items to assignedByID
+
+	timelineComments bool // Comment on items after updating them
+
+	activeField     string      // Y/N flag cleared on items removed from Sage
+	activeFlags     flagMapping // Representation of activeField, set by ValidateFields
+	inactiveStageID string      // Stage items removed from Sage are moved to
+
+	empresaField string // UF field holding the socio's Sage CodigoEmpresa
+	empresaCode  int    // Empresa whose items the client works on; 0 for all
+
+	fields FieldMapping
+	synced map[string]bool        // Logical fields updates compare and write; nil for all
+	flags  flagMapping            // Representation of the admin flag, set by ValidateFields
+	enums  map[string]enumMapping // Enumeration fields by code, see ensureEnums
+
+	enumsMu sync.Mutex // Guards enums, shared by the sync's workers
+
+	titleTemplate *template.Template
+	userAgent     string
+	logger        *log.Logger
 }
 
 // NewClient creates a new Bitrix24 client.
-func NewClient(webhookURL string, logger *log.Logger) *Client {
+func NewClient(webhookURL string, logger *log.Logger, opts ...Option) *Client {
 	// Clean up the webhook URL to get base URL
 	baseURL := strings.TrimSuffix(webhookURL, "/")
 
-	// Create HTTP client with sensible defaults.
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
+	c := &Client{
+		baseURL: baseURL,
+		// The timeout is applied per request through the context, so the
+		// HTTP client itself carries none and can be shared safely.
+		httpClient:   &http.Client{Transport: sharedTransport},
+		timeout:      DefaultTimeout,
+		limiter:      NewRateLimiter(DefaultRateLimit, DefaultBurst),
+		userAgent:    UserAgent(""),
+		fields:       DefaultFieldMapping,
+		flags:        defaultFlagMapping(),
+		entityTypeID: EntityTypeSocios,
+		logger:       logger,
 	}
 
-	return &Client{
-		baseURL:    baseURL,
-		httpClient: httpClient,
-		logger:     logger,
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	// Proxy and TLS settings need their own transport. An injected
+	// *http.Client is left untouched.
+	if !c.transport.isZero() && c.httpClient.Transport == sharedTransport {
+		c.httpClient = &http.Client{Transport: c.transport.build()}
+	}
+
+	if c.portals != nil {
+		budget := c.portals.budgetFor(c.PortalHost(), c.breakerThreshold, c.breakerCooldown)
+		c.portalLimiter, c.breaker = budget.limiter, budget.breaker
+	} else {
+		c.breaker = breakerFor(c.baseURL, c.breakerThreshold, c.breakerCooldown)
+	}
+
+	return c
 }
 
 // BitrixSocio represents a socio in Bitrix24 format.
 type BitrixSocio struct {
-	ID                  int    `json:"id,omitempty"`
-	Title               string `json:"title"`
-	EntityTypeID        int    `json:"entityTypeId"`
-	DNI                 string `json:"ufCrm55Dni"`
-	Cargo               string `json:"ufCrm55Cargo"`
-	Administrador       string `json:"ufCrm55Admin"` // "Y" or "N"
-	Participacion       string `json:"ufCrm55Participacion"`
-	RazonSocialEmpleado string `json:"ufCrm55RazonSocial"`
+	ID                  int        `json:"id,omitempty"`
+	Title               string     `json:"title"`
+	EntityTypeID        int        `json:"entityTypeId"`
+	CategoryID          int        `json:"categoryId,omitempty"`
+	StageID             string     `json:"stageId,omitempty"`
+	AssignedByID        int        `json:"assignedById,omitempty"`
+	CreatedTime         *time.Time `json:"createdTime,omitempty"`
+	UpdatedTime         *time.Time `json:"updatedTime,omitempty"`
+	DNI                 string     `json:"ufCrm55Dni"`
+	Cargo               string     `json:"ufCrm55Cargo"`
+	Administrador       string     `json:"ufCrm55Admin"` // "Y" or "N"
+	Participacion       string     `json:"ufCrm55Participacion"`
+	RazonSocialEmpleado string     `json:"ufCrm55RazonSocial"`
+	CompanyID           int        `json:"companyId,omitempty"`
+	ParentCompanyID     int        `json:"parentId4,omitempty"`
+	Active              string     `json:"active,omitempty"`  // "Y"/"N" from the configured active field, if any
+	Empresa             int        `json:"empresa,omitempty"` // Sage CodigoEmpresa from the configured empresa field, if any
 }
 
 // BitrixResponse represents Bitrix24 API response.
@@ -60,12 +152,24 @@ type BitrixResponse struct {
 	} `json:"error"`
 }
 
+// BitrixRawResponse keeps the result undecoded for responses whose shape varies.
+type BitrixRawResponse struct {
+	Result json.RawMessage `json:"result"`
+	Next   int             `json:"next,omitempty"` // Start of the next page of a list method
+	Error  *struct {
+		ErrorCode        string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	} `json:"error"`
+}
+
 // BitrixListResponse represents list response from Bitrix24.
 type BitrixListResponse struct {
 	Result *struct {
-		Items []BitrixSocio `json:"items"`
-		Total int           `json:"total"`
+		Items []json.RawMessage `json:"items"` // Decoded with listItems
+		Total int               `json:"total"`
 	} `json:"result"`
+	Next  *int `json:"next"` // Offset of the next page; nil on the last page
+	Total int  `json:"total"`
 	Error *struct {
 		ErrorCode        string `json:"error"`
 		ErrorDescription string `json:"error_description"`
@@ -73,8 +177,64 @@ type BitrixListResponse struct {
 }
 
 // Constants for Bitrix24
+// EntityTypeSocios is the default Smart Process used when none is configured
+// or discovered.
 const EntityTypeSocios = 1032
 
+// EntityTypeID returns the Smart Process entity type the client operates on.
+func (c *Client) EntityTypeID() int {
+	return c.entityTypeID
+}
+
+// PortalHost returns the hostname of the Bitrix24 portal, e.g. "acme.bitrix24.eu".
+func (c *Client) PortalHost() string {
+	return hostOf(c.baseURL)
+}
+
+// ThrottleWait returns the total time this client spent waiting for the rate
+// limiter.
+func (c *Client) ThrottleWait() time.Duration {
+	return time.Duration(c.throttled.Load())
+}
+
+// BreakerStatus returns the circuit breaker state for this client's endpoint.
+func (c *Client) BreakerStatus() BreakerStatus {
+	return c.breaker.Status()
+}
+
+// hostOf extracts the hostname from a URL, returning the input if it does not parse.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Hostname()
+}
+
+// redactWebhook masks the token of a webhook URL (.../rest/<user>/<token>)
+// but for its last 4 characters, so the URL can be shown without granting
+// access to the portal. Other URLs are returned unchanged.
+func redactWebhook(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return webhookURL
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 3 || parts[len(parts)-3] != "rest" {
+		return webhookURL
+	}
+	token := parts[len(parts)-1]
+	if len(token) > 4 {
+		token = "****" + token[len(token)-4:]
+	} else {
+		token = "****"
+	}
+	parts[len(parts)-1] = token
+	u.Path = "/" + strings.Join(parts, "/")
+	u.RawPath = u.Path // Keeps the asterisks unescaped
+	return u.String()
+}
+
 // doJSONRequest performs a JSON POST request and handles common patterns.
 func (c *Client) doJSONRequest(ctx context.Context, endpoint string, requestBody interface{}, response interface{}) error {
 	// 1. Marshal request body to JSON.
@@ -89,6 +249,9 @@ func (c *Client) doJSONRequest(ctx context.Context, endpoint string, requestBody
 	}
 
 	// 2. Create HTTP request.
+	ctx, cancel := c.requestContext(ctx, endpoint)
+	defer cancel()
+
 	url := c.baseURL + endpoint
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
@@ -99,31 +262,22 @@ func (c *Client) doJSONRequest(ctx context.Context, endpoint string, requestBody
 	req.Header.Set("Content-Type", "application/json")
 
 	// 4. Execute request
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.execute(req)
 	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// 5. Check status code.
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// 6. Parse response.
-	if response != nil {
-		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
-			return fmt.Errorf("failed to decode response: %w", err)
-		}
+		return err
 	}
+	defer drainAndClose(resp.Body)
 
-	return nil
+	// 5. Check status and parse response.
+	return c.decodeResponse(resp, restMethod(req), response)
 }
 
 // doGETRequest performs a GET request for simple endpoints.
 func (c *Client) doGETRequest(ctx context.Context, endpoint string, response interface{}) error {
 	// 1. Create HTTP request.
+	ctx, cancel := c.requestContext(ctx, endpoint)
+	defer cancel()
+
 	url := c.baseURL + endpoint
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -131,21 +285,168 @@ func (c *Client) doGETRequest(ctx context.Context, endpoint string, response int
 	}
 
 	// 2. Execute request.
+	resp, err := c.execute(req)
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(resp.Body)
+
+	// 3. Check status and parse response.
+	return c.decodeResponse(resp, restMethod(req), response)
+}
+
+// execute sends a request, retrying it once when the portal answers 503 with
+// a Retry-After that fits within the request deadline.
+func (c *Client) execute(req *http.Request) (*http.Response, error) {
+	resp, err := c.send(req)
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		return resp, err
+	}
+
+	wait, ok := retryAfter(resp.Header.Get("Retry-After"))
+	if !ok || wait > MaxRetryAfter {
+		return resp, nil
+	}
+	if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < wait {
+		return resp, nil
+	}
+
+	retry, err := rewind(req)
+	if err != nil {
+		return resp, nil
+	}
+	drainAndClose(resp.Body)
+
+	c.stats.retries.Add(1)
+	c.logger.Printf("🚧 Bitrix24 unavailable, retrying in %s", wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-timer.C:
+	}
+	return c.send(retry)
+}
+
+// send sends a request through the rate limiters (the client's, its
+// portal's and any shared one in the context) and the endpoint's circuit
+// breaker, adding the identification headers. Transport errors and 5xx responses count as
+// endpoint failures.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	method := restMethod(req)
+	if err := c.waitForQuota(req.Context(), method); err != nil {
+		return nil, fmt.Errorf("quota wait: %w", err)
+	}
+
+	for _, limiter := range append([]*RateLimiter{c.limiter, c.portalLimiter}, sharedLimitersFromContext(req.Context())...) {
+		if limiter == nil {
+			continue
+		}
+		waited, err := limiter.Wait(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("rate limiter: %w", err)
+		}
+		c.throttled.Add(int64(waited))
+	}
+
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", c.userAgent)
+	if runID := RunIDFromContext(req.Context()); runID != "" {
+		req.Header.Set(RunIDHeader, runID)
+	}
+
+	c.stats.countRequest(method, req.ContentLength)
+
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
+		if errors.Is(err, context.Canceled) {
+			c.breaker.Abandon()
+		} else {
+			c.breaker.Record(false)
+		}
+		return nil, fmt.Errorf("failed to execute request: %w", classifyTransportError(err))
+	}
+
+	resp.Body = countingBody{resp.Body, &c.stats.bytesReceived}
+
+	// An HTML page with status 200 is an endpoint failure too.
+	if resp.StatusCode == http.StatusOK {
+		if err := checkJSONBody(resp); err != nil {
+			c.breaker.Record(false)
+			drainAndClose(resp.Body)
+			return nil, err
+		}
+	}
+
+	c.breaker.Record(resp.StatusCode < http.StatusInternalServerError)
+	return resp, nil
+}
+
+// checkJSONBody peeks at the start of a response body and returns an
+// UnexpectedResponseError if it is not JSON. The body remains fully readable.
+func checkJSONBody(resp *http.Response) error {
+	br := bufio.NewReaderSize(resp.Body, 512)
+	head, _ := br.Peek(512)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{br, resp.Body}
+
+	contentType := resp.Header.Get("Content-Type")
+	if looksLikeJSON(contentType, head) {
+		return nil
+	}
+	return newUnexpectedResponse(resp.StatusCode, contentType, head)
+}
+
+// restMethod returns the REST method a request calls, e.g. "crm.item.list".
+func restMethod(req *http.Request) string {
+	return path.Base(req.URL.Path)
+}
+
+// decodeResponse checks the status code and decodes the JSON body of a call
+// to the REST method. The method is passed in rather than read from
+// resp.Request, which a custom RoundTripper may leave unset.
+func (c *Client) decodeResponse(resp *http.Response, method string, response interface{}) error {
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return fmt.Errorf("%w: proxy returned status %d", ErrProxyAuth, resp.StatusCode)
+	}
+
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		// The body is an HTML maintenance page; don't repeat it in every error.
+		return fmt.Errorf("%w: status %d", ErrPortalUnavailable, resp.StatusCode)
 	}
-	defer resp.Body.Close()
 
-	// 3. Check status code.
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+
+		// Bitrix24 reports API errors as {"error": "...", "error_description": "..."}
+		// with a 4xx status.
+		var apiErr struct {
+			Code        string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Code != "" {
+			return &APIError{StatusCode: resp.StatusCode, Code: apiErr.Code, Description: apiErr.Description}
+		}
+		if contentType := resp.Header.Get("Content-Type"); !looksLikeJSON(contentType, body) {
+			return newUnexpectedResponse(resp.StatusCode, contentType, body)
+		}
 		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
 	}
 
-	// 4. Parse response.
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	c.quota.record(method, body)
+
 	if response != nil {
-		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		if err := json.Unmarshal(body, response); err != nil {
 			return fmt.Errorf("failed to decode response: %w", err)
 		}
 	}
@@ -153,17 +454,35 @@ func (c *Client) doGETRequest(ctx context.Context, endpoint string, response int
 	return nil
 }
 
+// drainAndClose discards any unread body so the connection can be reused.
+func drainAndClose(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, body)
+	body.Close()
+}
+
 // checkBitrixError checks for Bitrix24 API errors in the response.
 func (c *Client) checkBitrixError(response interface{}) error {
 	// Use type assertion to check for error fields
 	switch r := response.(type) {
 	case *BitrixResponse:
 		if r.Error != nil && r.Error.ErrorCode != "" {
-			return fmt.Errorf("Bitrix24 API error: %s - %s", r.Error.ErrorCode, r.Error.ErrorDescription)
+			return &APIError{Code: r.Error.ErrorCode, Description: r.Error.ErrorDescription}
+		}
+	case *BitrixRawResponse:
+		if r.Error != nil && r.Error.ErrorCode != "" {
+			return &APIError{Code: r.Error.ErrorCode, Description: r.Error.ErrorDescription}
+		}
+	case *BitrixItemResponse:
+		if r.Error != nil && r.Error.ErrorCode != "" {
+			return &APIError{Code: r.Error.ErrorCode, Description: r.Error.ErrorDescription}
 		}
 	case *BitrixListResponse:
 		if r.Error != nil && r.Error.ErrorCode != "" {
-			return fmt.Errorf("Bitrix24 API error: %s - %s", r.Error.ErrorCode, r.Error.ErrorDescription)
+			return &APIError{Code: r.Error.ErrorCode, Description: r.Error.ErrorDescription}
+		}
+	case *BitrixFieldsResponse:
+		if r.Error != nil && r.Error.ErrorCode != "" {
+			return &APIError{Code: r.Error.ErrorCode, Description: r.Error.ErrorDescription}
 		}
 	}
 	return nil
@@ -174,15 +493,24 @@ func (c *Client) checkBitrixError(response interface{}) error {
 func (c *Client) TestConnection(ctx context.Context) error {
 	c.logger.Printf("🧪 Testing Bitrix24 connection to: %s", c.baseURL)
 
+	// Catch webhooks created without the crm scope before the first write.
+	report, err := c.CheckScopes(ctx)
+	if err != nil {
+		c.logger.Printf("⚠️  Could not check webhook permissions: %v", err)
+	} else if err := report.Err(); err != nil {
+		return err
+	}
+
 	// Option 1: Try a simple CRM method instead of user.current
 	var result BitrixResponse
 	testBody := map[string]interface{}{
-		"entityTypeId": EntityTypeSocios,
+		"entityTypeId": c.entityTypeID,
+		"order":        defaultOrder(),
 		"start":        0,
 		"limit":        1, // Just get 1 record to test
 	}
 
-	err := c.doJSONRequest(ctx, "/crm.item.list", testBody, &result)
+	err = c.doJSONRequest(ctx, "/crm.item.list", testBody, &result)
 	if err != nil {
 		// If CRM method also fails, try the simplest possible test
 		c.logger.Printf("⚠️  CRM test failed, trying basic connection test...")
@@ -220,78 +548,353 @@ func (c *Client) testBasicConnection(ctx context.Context) error {
 	return nil
 }
 
-// ListSocios retrieves all existing socios from Bitrix24.
-func (c *Client) ListSocios(ctx context.Context) ([]BitrixSocio, error) {
+// ListSocios retrieves all existing socios from Bitrix24, following
+// pagination. Items are ordered by ID ascending unless overridden; an item
+// seen on an earlier page is never returned twice.
+func (c *Client) ListSocios(ctx context.Context, opts ...ListOption) ([]BitrixSocio, error) {
 	c.logger.Printf("📥 Fetching existing socios from Bitrix24...")
 
-	// Prepare request.
+	socios := []BitrixSocio{}
+	err := c.eachSocioPage(ctx, newListParams(opts), func(page []BitrixSocio) error {
+		socios = append(socios, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Printf("✅ Found %d existing socios in Bitrix24", len(socios))
+	return socios, nil
+}
+
+// eachSocioPage lists socios page by page, calling fn with the items of each
+// page not already seen on an earlier one. An error from fn stops the listing.
+func (c *Client) eachSocioPage(ctx context.Context, params *listParams, fn func([]BitrixSocio) error) error {
+	seen := make(map[int]bool)
+	cursor := params.resume
+	start := cursor.Start
+
+	// When listing by ID, resume after the last ID seen rather than at an
+	// offset, which would skip items if earlier ones were deleted meanwhile.
+	var filter map[string]interface{}
+	if cursor.LastID > 0 && params.byIDAscending() {
+		filter = map[string]interface{}{">id": cursor.LastID}
+		start = 0
+	}
+
+	for {
+		// Prepare request.
+		requestBody := map[string]interface{}{
+			"entityTypeId": c.entityTypeID,
+			"order":        params.order(),
+			"start":        start,
+		}
+		if filter != nil {
+			requestBody["filter"] = filter
+		}
+		if fields := c.listSelect(); fields != nil {
+			requestBody["select"] = fields
+		}
+
+		// Execute request.
+		var result BitrixListResponse
+		err := c.doJSONRequest(ctx, "/crm.item.list", requestBody, &result)
+		if err != nil {
+			return fmt.Errorf("failed to list socios: %w", err)
+		}
+
+		// Check for API errors.
+		if err := c.checkBitrixError(&result); err != nil {
+			return err
+		}
+
+		var page []BitrixSocio
+		for _, socio := range c.listItems(&result) {
+			if !seen[socio.ID] {
+				seen[socio.ID] = true
+				page = append(page, socio)
+			}
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+
+		if result.Next == nil || *result.Next <= start {
+			return nil
+		}
+		start = *result.Next
+
+		if params.progress != nil {
+			cursor.Start = start
+			cursor.Fetched += len(page)
+			for _, socio := range page {
+				cursor.LastID = max(cursor.LastID, socio.ID)
+			}
+			cursor.At = time.Now()
+			params.progress(page, cursor)
+		}
+	}
+}
+
+// BitrixItemResponse represents a single-item response (crm.item.get/add/update).
+type BitrixItemResponse struct {
+	Result *struct {
+		Item json.RawMessage `json:"item"` // Decoded with decodeSocio
+	} `json:"result"`
+	Error *struct {
+		ErrorCode        string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	} `json:"error"`
+}
+
+// GetSocioByID retrieves a single socio by its Bitrix24 item ID. Missing
+// items are reported as ErrNotFound.
+func (c *Client) GetSocioByID(ctx context.Context, id int) (*BitrixSocio, error) {
 	requestBody := map[string]interface{}{
-		"entityTypeId": EntityTypeSocios,
+		"entityTypeId": c.entityTypeID,
+		"id":           id,
+	}
+
+	var result BitrixItemResponse
+	err := c.doJSONRequest(ctx, "/crm.item.get", requestBody, &result)
+	if err == nil {
+		err = c.checkBitrixError(&result)
+	}
+	if err != nil {
+		if isAPIErrorCode(err, "NOT_FOUND") {
+			return nil, fmt.Errorf("socio %d: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get socio %d: %w", id, err)
+	}
+
+	if result.Result == nil || result.Result.Item == nil {
+		return nil, fmt.Errorf("socio %d: %w", id, ErrNotFound)
+	}
+
+	socio, err := c.decodeSocio(result.Result.Item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode socio %d: %w", id, err)
+	}
+	return &socio, nil
+}
+
+// GetSocioByDNI looks up a socio by DNI using a server-side filter, so it
+// does not depend on a previously fetched list. The DNI is looked up
+// normalized as well as as given. Missing socios are reported as
+// ErrNotFound; if several items share the DNI the oldest is returned.
+func (c *Client) GetSocioByDNI(ctx context.Context, dni string) (*BitrixSocio, error) {
+	// The filter matches exactly, so look for the value as given too.
+	normalized := models.NormalizeDNI(dni)
+	var filter interface{} = normalized
+	if dni != normalized {
+		filter = []string{normalized, dni}
+	}
+	requestBody := map[string]interface{}{
+		"entityTypeId": c.entityTypeID,
+		"filter": map[string]interface{}{
+			c.fields.DNI: filter,
+		},
+		"order": defaultOrder(),
+	}
+	if fields := c.listSelect(); fields != nil {
+		requestBody["select"] = fields
 	}
 
-	// Execute request.
 	var result BitrixListResponse
 	err := c.doJSONRequest(ctx, "/crm.item.list", requestBody, &result)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list socios: %w", err)
+		return nil, fmt.Errorf("failed to search socio %s: %w", dni, err)
 	}
 
-	// Check for API errors.
 	if err := c.checkBitrixError(&result); err != nil {
 		return nil, err
 	}
 
-	// Handle nil result.
-	if result.Result == nil {
-		c.logger.Printf("✅ Found 0 existing socios in Bitrix24")
-		return []BitrixSocio{}, nil
+	socio := c.ownedSocio(c.listItems(&result))
+	if socio == nil {
+		return nil, fmt.Errorf("socio %s: %w", dni, ErrNotFound)
 	}
-
-	c.logger.Printf("✅ Found %d existing socios in Bitrix24", len(result.Result.Items))
-	return result.Result.Items, nil
+	return socio, nil
 }
 
-// CreateSocio creates a new socio in Bitrix24.
-func (c *Client) CreateSocio(ctx context.Context, socio *models.Socio) error {
+// CreateSocio creates a new socio in Bitrix24 and returns its item ID.
+func (c *Client) CreateSocio(ctx context.Context, socio *models.Socio) (int, error) {
+	if _, err := c.companyFor(ctx, socio); err != nil {
+		return 0, err
+	}
+	if err := c.ensureEnums(ctx); err != nil {
+		return 0, err
+	}
+
 	bitrixSocio := c.convertSageToBitrix(socio)
 	c.logger.Printf("📤 Creating socio in Bitrix24: DNI=%s, Name=%s", socio.DNI, socio.RazonSocialEmpleado)
 
 	// Prepare request.
+	fields, err := c.convertToFields(bitrixSocio, true)
+	if err != nil {
+		return 0, fmt.Errorf("socio %s: %w", socio.DNI, err)
+	}
 	requestBody := map[string]interface{}{
-		"entityTypeId": EntityTypeSocios,
-		"fields":       c.convertToFields(bitrixSocio),
+		"entityTypeId": c.entityTypeID,
+		"fields":       fields,
 	}
 
 	// Execute request.
-	var result BitrixResponse
-	err := c.doJSONRequest(ctx, "/crm.item.add", requestBody, &result)
+	id, err := c.addItem(ctx, socio.DNI, requestBody)
 	if err != nil {
-		return fmt.Errorf("failed to create socio: %w", err)
+		return 0, err
 	}
 
-	// Check for API errors.
-	if err := c.checkBitrixError(&result); err != nil {
-		return err
+	c.logger.Printf("✅ Successfully created socio: DNI=%s, ID=%d", socio.DNI, id)
+
+	// Optionally read the item back to check what Bitrix24 actually stored.
+	if c.verifyWrites {
+		c.verifyStored(ctx, id, bitrixSocio)
 	}
+	return id, nil
+}
 
-	c.logger.Printf("✅ Successfully created socio: DNI=%s", socio.DNI)
-	return nil
+// addItem sends crm.item.add for the socio with the given DNI. If the call
+// fails in a way that leaves its outcome unknown, such as a timeout, the item
+// is looked up by DNI first: an existing item counts as created, otherwise
+// the add is retried once. A blind retry would create duplicates.
+func (c *Client) addItem(ctx context.Context, dni string, requestBody map[string]interface{}) (int, error) {
+	for attempt := 1; ; attempt++ {
+		var result BitrixRawResponse
+		err := c.doJSONRequest(ctx, "/crm.item.add", requestBody, &result)
+		if err == nil {
+			if err := c.checkBitrixError(&result); err != nil {
+				return 0, err
+			}
+			id, err := parseItemID(result.Result)
+			if err != nil {
+				return 0, fmt.Errorf("socio %s created but response unreadable: %w", dni, err)
+			}
+			return id, nil
+		}
+
+		if attempt == 2 || !isAmbiguous(ctx, err) {
+			return 0, fmt.Errorf("failed to create socio: %w", err)
+		}
+
+		c.logger.Printf("⚠️  Create of socio %s failed ambiguously (%v), checking whether it exists", dni, err)
+		existing, lookupErr := c.GetSocioByDNI(ctx, dni)
+		switch {
+		case lookupErr == nil:
+			c.logger.Printf("✅ Socio %s was created despite the error (ID=%d)", dni, existing.ID)
+			return existing.ID, nil
+		case !errors.Is(lookupErr, ErrNotFound):
+			return 0, fmt.Errorf("failed to create socio: %w (existence check failed: %v)", err, lookupErr)
+		}
+
+		c.stats.retries.Add(1)
+		c.logger.Printf("🔁 Socio %s not found, retrying create", dni)
+	}
+}
+
+// parseItemID extracts the item ID from an add response. Bitrix24 normally
+// returns {"item": {"id": 1}}, but older methods return {"id": 1} or a bare
+// ID, sometimes as a string.
+func parseItemID(raw json.RawMessage) (int, error) {
+	var nested struct {
+		Item *struct {
+			ID json.Number `json:"id"`
+		} `json:"item"`
+		ID json.Number `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &nested); err == nil {
+		if nested.Item != nil && nested.Item.ID != "" {
+			return parseID(nested.Item.ID)
+		}
+		if nested.ID != "" {
+			return parseID(nested.ID)
+		}
+	}
+
+	var bare json.Number
+	if err := json.Unmarshal(raw, &bare); err == nil && bare != "" {
+		return parseID(bare)
+	}
+
+	return 0, fmt.Errorf("no item ID in result: %s", string(raw))
+}
+
+// parseID converts a JSON number or numeric string into a positive ID.
+func parseID(n json.Number) (int, error) {
+	id, err := strconv.Atoi(n.String())
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid item ID %q", n.String())
+	}
+	return id, nil
+}
+
+// verifyStored reads an item back and records a warning for every mapped field
+// whose stored value differs from what was sent.
+func (c *Client) verifyStored(ctx context.Context, id int, sent *BitrixSocio) []string {
+	stored, err := c.GetSocioByID(ctx, id)
+	if err != nil {
+		c.logger.Printf("⚠️  Could not verify socio %d: %v", id, err)
+		return nil
+	}
+
+	stored.Administrador = c.normalizeFlag(stored.Administrador)
+	stored.Cargo = c.enumLabel(c.fields.Cargo, stored.Cargo)
+	discrepancies := CompareSocios(sent, stored)
+	for _, d := range discrepancies {
+		c.warn(WarnStoredDifferently, sent.DNI, "Socio %d (DNI=%s) stored differently: %s", id, sent.DNI, d)
+	}
+	return discrepancies
+}
+
+// CompareSocios describes every mapped field that differs between two items.
+func CompareSocios(expected, actual *BitrixSocio) []string {
+	pairs := []struct {
+		field            string
+		expected, actual string
+	}{
+		{"title", expected.Title, actual.Title},
+		{"ufCrm55Dni", expected.DNI, actual.DNI},
+		{"ufCrm55Cargo", expected.Cargo, actual.Cargo},
+		{"ufCrm55Admin", expected.Administrador, actual.Administrador},
+		{"ufCrm55Participacion", expected.Participacion, actual.Participacion},
+		{"ufCrm55RazonSocial", expected.RazonSocialEmpleado, actual.RazonSocialEmpleado},
+	}
+
+	var diffs []string
+	for _, p := range pairs {
+		if p.expected != p.actual {
+			diffs = append(diffs, fmt.Sprintf("%s: sent %q, stored %q", p.field, p.expected, p.actual))
+		}
+	}
+	return diffs
 }
 
 // UpdateSocio updates an existing socio in Bitrix24.
 func (c *Client) UpdateSocio(ctx context.Context, bitrixID int, socio *models.Socio) error {
+	if _, err := c.companyFor(ctx, socio); err != nil {
+		return err
+	}
+	if err := c.ensureEnums(ctx); err != nil {
+		return err
+	}
+
 	bitrixSocio := c.convertSageToBitrix(socio)
 	c.logger.Printf("📝 Updating socio in Bitrix24: ID=%d, DNI=%s", bitrixID, socio.DNI)
 
 	// Prepare request.
+	fields, err := c.convertToFields(bitrixSocio, false)
+	if err != nil {
+		return fmt.Errorf("socio %s: %w", socio.DNI, err)
+	}
 	requestBody := map[string]interface{}{
-		"id":     bitrixID,
-		"fields": c.convertToFields(bitrixSocio),
+		"entityTypeId": c.entityTypeID,
+		"id":           bitrixID,
+		"fields":       fields,
 	}
 
 	// Execute request.
 	var result BitrixResponse
-	err := c.doJSONRequest(ctx, "/crm.item.update", requestBody, &result)
+	err = c.doJSONRequest(ctx, "/crm.item.update", requestBody, &result)
 	if err != nil {
 		return fmt.Errorf("failed to update socio: %w", err)
 	}
@@ -305,6 +908,72 @@ func (c *Client) UpdateSocio(ctx context.Context, bitrixID int, socio *models.So
 	return nil
 }
 
+// DeleteSocio deletes a socio from Bitrix24. Missing items are reported as
+// ErrNotFound.
+func (c *Client) DeleteSocio(ctx context.Context, bitrixID int) error {
+	c.logger.Printf("🗑️  Deleting socio in Bitrix24: ID=%d", bitrixID)
+
+	requestBody := map[string]interface{}{
+		"entityTypeId": c.entityTypeID,
+		"id":           bitrixID,
+	}
+
+	var result BitrixResponse
+	err := c.doJSONRequest(ctx, "/crm.item.delete", requestBody, &result)
+	if err == nil {
+		err = c.checkBitrixError(&result)
+	}
+	if err != nil {
+		if isAPIErrorCode(err, "NOT_FOUND") {
+			return fmt.Errorf("socio %d: %w", bitrixID, ErrNotFound)
+		}
+		return fmt.Errorf("failed to delete socio %d: %w", bitrixID, err)
+	}
+
+	c.logger.Printf("✅ Successfully deleted socio: ID=%d", bitrixID)
+	return nil
+}
+
+// UpsertAction describes what UpsertSocio did.
+type UpsertAction string
+
+const (
+	ActionCreated UpsertAction = "created"
+	ActionUpdated UpsertAction = "updated"
+	ActionSkipped UpsertAction = "skipped" // Already up to date
+)
+
+// UpsertSocio creates or updates a single socio, checking for an existing
+// item by DNI on the server instead of relying on a full listing. It returns
+// the action taken and the Bitrix24 item ID.
+func (c *Client) UpsertSocio(ctx context.Context, socio *models.Socio) (UpsertAction, int, error) {
+	existing, err := c.GetSocioByDNI(ctx, socio.DNI)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", 0, err
+	}
+
+	if existing == nil {
+		id, err := c.CreateSocio(ctx, socio)
+		if err != nil {
+			return "", 0, err
+		}
+		return ActionCreated, id, nil
+	}
+
+	changes := c.Changes(existing, socio)
+	if len(changes) == 0 {
+		return ActionSkipped, existing.ID, nil
+	}
+
+	if err := c.UpdateSocio(ctx, existing.ID, socio); err != nil {
+		return "", existing.ID, err
+	}
+	if err := c.CommentChanges(ctx, existing.ID, changes); err != nil {
+		c.logger.Printf("⚠️  %v", err)
+	}
+	return ActionUpdated, existing.ID, nil
+}
+
 // convertSageToBitrix converts a Sage Socio to Bitrix24 format.
 func (c *Client) convertSageToBitrix(socio *models.Socio) *BitrixSocio {
 	// Convert boolean to Y/N string.
@@ -319,139 +988,215 @@ func (c *Client) convertSageToBitrix(socio *models.Socio) *BitrixSocio {
 		cargo = "No especificado"
 	}
 
-	// Build title from RazonSocialEmpleado if available, otherwise use DNI.
-	title := socio.RazonSocialEmpleado
-	if title == "" {
-		title = socio.DNI
-	}
-
 	// Format participation as string.
 	participacion := strconv.FormatFloat(socio.PorParticipacion, 'f', 2, 64)
 
-	return &BitrixSocio{
-		Title:               title,
-		EntityTypeID:        EntityTypeSocios,
-		DNI:                 socio.DNI,
+	bitrixSocio := &BitrixSocio{
+		Title:               c.buildTitle(socio),
+		EntityTypeID:        c.entityTypeID,
+		DNI:                 models.NormalizeDNI(socio.DNI),
 		Cargo:               cargo,
 		Administrador:       admin,
 		Participacion:       participacion,
 		RazonSocialEmpleado: socio.RazonSocialEmpleado,
+		Empresa:             socio.CodigoEmpresa,
 	}
-}
 
-// convertToFields converts BitrixSocio to fields map for API requests.
-func (c *Client) convertToFields(bitrixSocio *BitrixSocio) map[string]interface{} {
-	return map[string]interface{}{
-		"title":                bitrixSocio.Title,
-		"ufCrm55Dni":           bitrixSocio.DNI,
-		"ufCrm55Cargo":         bitrixSocio.Cargo,
-		"ufCrm55Admin":         bitrixSocio.Administrador,
-		"ufCrm55Participacion": bitrixSocio.Participacion,
-		"ufCrm55RazonSocial":   bitrixSocio.RazonSocialEmpleado,
+	// Link to the empresa's company if it has already been resolved.
+	if companyID, ok := c.cachedCompanyFor(socio); ok {
+		if c.companyLink.Field == LinkFieldParent {
+			bitrixSocio.ParentCompanyID = companyID
+		} else {
+			bitrixSocio.CompanyID = companyID
+		}
 	}
+	return bitrixSocio
 }
 
-// NeedsUpdate checks if a Bitrix socio needs to be updated with Sage data.
-func (c *Client) NeedsUpdate(bitrixSocio *BitrixSocio, sageSocio *models.Socio) bool {
-	expectedBitrix := c.convertSageToBitrix(sageSocio)
+// buildTitle renders the configured title template, falling back to
+// RazonSocialEmpleado, or the DNI when that is empty.
+func (c *Client) buildTitle(socio *models.Socio) string {
+	if c.titleTemplate != nil {
+		title, err := models.RenderTitle(c.titleTemplate, socio)
+		if err == nil && title != "" {
+			return title
+		}
+		if err != nil {
+			c.warn(WarnDefaultTitle, socio.DNI, "%v, using default title for DNI=%s", err, socio.DNI)
+		}
+	}
 
-	return bitrixSocio.Cargo != expectedBitrix.Cargo ||
-		bitrixSocio.Administrador != expectedBitrix.Administrador ||
-		bitrixSocio.Participacion != expectedBitrix.Participacion ||
-		bitrixSocio.RazonSocialEmpleado != expectedBitrix.RazonSocialEmpleado
+	title := socio.RazonSocialEmpleado
+	if title == "" {
+		title = socio.DNI
+	}
+	return title
 }
 
-// FindSocioByDNI finds a Bitrix socio by DNI.
-func (c *Client) FindSocioByDNI(socios []BitrixSocio, dni string) *BitrixSocio {
-	for _, socio := range socios {
-		if socio.DNI == dni {
-			return &socio
+// convertToFields converts BitrixSocio to fields map for API requests. The
+// pipeline category and stage depend on whether the item is being created.
+// Labels with no item in an enumeration field are reported as
+// ErrUnknownEnumValue.
+func (c *Client) convertToFields(bitrixSocio *BitrixSocio, create bool) (map[string]interface{}, error) {
+	cargo, err := c.enumValue(c.fields.Cargo, bitrixSocio.Cargo)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{
+		"title":                bitrixSocio.Title,
+		c.fields.DNI:           bitrixSocio.DNI,
+		c.fields.Cargo:         cargo,
+		c.fields.Admin:         c.encodeFlag(bitrixSocio.Administrador),
+		c.fields.Participacion: bitrixSocio.Participacion,
+		c.fields.RazonSocial:   bitrixSocio.RazonSocialEmpleado,
+	}
+	// Updates leave the fields not synced alone; creates fill them all.
+	if !create {
+		for field, code := range map[string]string{
+			SyncFieldTitle:         "title",
+			SyncFieldCargo:         c.fields.Cargo,
+			SyncFieldAdministrador: c.fields.Admin,
+			SyncFieldParticipacion: c.fields.Participacion,
+			SyncFieldRazonSocial:   c.fields.RazonSocial,
+		} {
+			if !c.syncs(field) {
+				delete(fields, code)
+			}
 		}
 	}
-	return nil
+	if companyID := c.linkedCompany(bitrixSocio); c.companyLink.Field != "" && companyID > 0 {
+		fields[c.companyLink.Field] = companyID
+	}
+	c.pipelineFields(fields, create)
+	if c.activeField != "" {
+		fields[c.activeField] = c.activeFlags.encode("Y")
+	}
+	if c.empresaField != "" && bitrixSocio.Empresa > 0 {
+		fields[c.empresaField] = bitrixSocio.Empresa
+	}
+	if c.assignedByID > 0 && (create || c.enforceAssignee) {
+		fields["assignedById"] = c.assignedByID
+	}
+	return fields, nil
 }
 
-// DiscoverEntityTypes tries to discover available CRM entity types
-func (c *Client) DiscoverEntityTypes(ctx context.Context) error {
-	c.logger.Printf("🔍 Discovering available Bitrix24 entity types...")
+// syncs reports whether updates compare and write a logical field.
+func (c *Client) syncs(field string) bool {
+	return c.synced == nil || c.synced[field]
+}
 
-	// Try to get available entity types
-	var result BitrixResponse
-	err := c.doJSONRequest(ctx, "/crm.enum.entitytype", map[string]interface{}{}, &result)
-	if err != nil {
-		c.logger.Printf("⚠️  Could not get entity types via API: %v", err)
-		return c.tryCommonEntityTypes(ctx)
-	}
+// NeedsUpdate checks if a Bitrix socio needs to be updated with Sage data.
+func (c *Client) NeedsUpdate(bitrixSocio *BitrixSocio, sageSocio *models.Socio) bool {
+	return len(c.Changes(bitrixSocio, sageSocio)) > 0
+}
 
-	c.logger.Printf("✅ Entity types discovery result: %+v", result)
-	return nil
+// FieldChange is a field whose Bitrix value differs from what Sage would write.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
 }
 
-// tryCommonEntityTypes tests common entity type IDs
-func (c *Client) tryCommonEntityTypes(ctx context.Context) error {
-	c.logger.Printf("🔍 Testing common entity type IDs...")
+// Changes lists the fields an update with Sage data would change.
+func (c *Client) Changes(bitrixSocio *BitrixSocio, sageSocio *models.Socio) []FieldChange {
+	expectedBitrix := c.convertSageToBitrix(sageSocio)
 
-	// Common entity type IDs for different Bitrix24 setups
-	commonEntityTypes := []int{
-		// Smart Process IDs (most common)
-		128, 130, 132, 134, 136, 138, 140, 142, 144, 146, 148, 150,
+	// Items are matched by normalized DNI; one stored otherwise is rewritten.
+	pairs := []FieldChange{{"dni", bitrixSocio.DNI, expectedBitrix.DNI}}
+	for _, p := range []struct {
+		field  string
+		change FieldChange
+	}{
+		{SyncFieldTitle, FieldChange{"title", bitrixSocio.Title, expectedBitrix.Title}},
+		{SyncFieldCargo, FieldChange{"cargo", c.enumLabel(c.fields.Cargo, bitrixSocio.Cargo), c.enumCanonical(c.fields.Cargo, expectedBitrix.Cargo)}},
+		{SyncFieldAdministrador, FieldChange{"administrador", c.normalizeFlag(bitrixSocio.Administrador), expectedBitrix.Administrador}},
+		{SyncFieldParticipacion, FieldChange{"participación", bitrixSocio.Participacion, expectedBitrix.Participacion}},
+		{SyncFieldRazonSocial, FieldChange{"razón social", bitrixSocio.RazonSocialEmpleado, expectedBitrix.RazonSocialEmpleado}},
+	} {
+		if c.syncs(p.field) {
+			pairs = append(pairs, p.change)
+		}
+	}
 
-		// Some installations use lower numbers
-		1, 2, 3, 4, 5, 10, 15, 20, 25, 30, 35, 40, 45, 50, 55, 60,
+	// A missing company leaves any existing link alone rather than clearing it.
+	if companyID := c.linkedCompany(expectedBitrix); companyID > 0 {
+		pairs = append(pairs, FieldChange{"company",
+			strconv.Itoa(c.linkedCompany(bitrixSocio)), strconv.Itoa(companyID)})
+	}
 
-		// Try some higher numbers
-		100, 102, 104, 106, 108, 110, 112, 114, 116, 118, 120, 122, 124, 126,
+	if c.enforceAssignee && c.assignedByID > 0 {
+		pairs = append(pairs, FieldChange{"assignee",
+			strconv.Itoa(bitrixSocio.AssignedByID), strconv.Itoa(c.assignedByID)})
 	}
 
-	for _, entityTypeID := range commonEntityTypes {
-		c.logger.Printf("🧪 Testing entity type ID: %d", entityTypeID)
+	if c.empresaField != "" && expectedBitrix.Empresa > 0 {
+		pairs = append(pairs, FieldChange{"empresa",
+			strconv.Itoa(bitrixSocio.Empresa), strconv.Itoa(expectedBitrix.Empresa)})
+	}
 
-		testBody := map[string]interface{}{
-			"entityTypeId": entityTypeID,
-			"start":        0,
-			"limit":        1,
-		}
+	// A socio back in Sage reactivates its item.
+	if c.IsInactive(bitrixSocio) {
+		pairs = append(pairs, FieldChange{"active", "N", "Y"})
+	}
 
-		var result BitrixListResponse
-		err := c.doJSONRequest(ctx, "/crm.item.list", testBody, &result)
+	var changes []FieldChange
+	for _, p := range pairs {
+		if p.Old != p.New {
+			changes = append(changes, p)
+		}
+	}
+	return changes
+}
 
-		if err != nil {
-			if strings.Contains(err.Error(), "ENTITY_TYPE_NOT_SUPPORTED") {
-				c.logger.Printf("❌ Entity type %d not supported", entityTypeID)
-				continue
-			}
-			c.logger.Printf("⚠️  Entity type %d error: %v", entityTypeID, err)
-			continue
+// FindDuplicates groups socios sharing a DNI once normalized, so "12345678z"
+// and "12345678-Z" are duplicates too. Only DNIs with more than one item are
+// returned, by normalized DNI; each group is ordered newest first (by
+// updatedTime, then by ID).
+func FindDuplicates(socios []BitrixSocio) map[string][]BitrixSocio {
+	byDNI := make(map[string][]BitrixSocio)
+	for _, socio := range socios {
+		if dni := models.NormalizeDNI(socio.DNI); dni != "" {
+			byDNI[dni] = append(byDNI[dni], socio)
 		}
+	}
 
-		// Check for API errors
-		if err := c.checkBitrixError(&result); err != nil {
-			if strings.Contains(err.Error(), "ENTITY_TYPE_NOT_SUPPORTED") {
-				c.logger.Printf("❌ Entity type %d not supported", entityTypeID)
-				continue
-			}
-			c.logger.Printf("⚠️  Entity type %d API error: %v", entityTypeID, err)
+	duplicates := make(map[string][]BitrixSocio)
+	for dni, group := range byDNI {
+		if len(group) < 2 {
 			continue
 		}
+		sort.Slice(group, func(i, j int) bool {
+			return isNewer(&group[i], &group[j])
+		})
+		duplicates[dni] = group
+	}
+	return duplicates
+}
 
-		// Success! This entity type works
-		c.logger.Printf("✅ FOUND WORKING ENTITY TYPE: %d", entityTypeID)
-		c.logger.Printf("   Response: %+v", result)
+// isNewer reports whether a was modified after b. Items without a timestamp
+// are older than those with one; ties go to the higher ID.
+func isNewer(a, b *BitrixSocio) bool {
+	switch {
+	case a.UpdatedTime != nil && b.UpdatedTime != nil && !a.UpdatedTime.Equal(*b.UpdatedTime):
+		return a.UpdatedTime.After(*b.UpdatedTime)
+	case a.UpdatedTime != nil && b.UpdatedTime == nil:
+		return true
+	case a.UpdatedTime == nil && b.UpdatedTime != nil:
+		return false
+	}
+	return a.ID > b.ID
+}
 
-		// If we found any items, show them
-		if result.Result != nil && len(result.Result.Items) > 0 {
-			c.logger.Printf("   Sample item: %+v", result.Result.Items[0])
+// FindSocioByDNI finds a Bitrix socio by normalized DNI.
+func (c *Client) FindSocioByDNI(socios []BitrixSocio, dni string) *BitrixSocio {
+	dni = models.NormalizeDNI(dni)
+	for _, socio := range socios {
+		if models.NormalizeDNI(socio.DNI) == dni {
+			return &socio
 		}
-
-		return nil
 	}
-
-	c.logger.Printf("❌ No working entity types found. You may need to:")
-	c.logger.Printf("   1. Create a Smart Process in Bitrix24 first")
-	c.logger.Printf("   2. Use standard CRM entities (contacts, companies)")
-	c.logger.Printf("   3. Check your webhook permissions")
-
-	return fmt.Errorf("no supported entity types found")
+	return nil
 }
 
 // TestStandardCRMEntities tries standard CRM entities with cleaner output
@@ -505,6 +1250,7 @@ func (c *Client) DebugEntityType130(ctx context.Context) error {
 	// Get list of items in entity type 130
 	testBody := map[string]interface{}{
 		"entityTypeId": 130,
+		"order":        defaultOrder(),
 		"start":        0,
 		"limit":        10, // Get a few items to see the structure
 	}
@@ -523,10 +1269,10 @@ func (c *Client) DebugEntityType130(ctx context.Context) error {
 	if result.Result != nil {
 		c.logger.Printf("   📊 Total items: %d", result.Result.Total)
 		c.logger.Printf("   📝 Items returned: %d", len(result.Result.Items))
-		
+
 		if len(result.Result.Items) > 0 {
 			c.logger.Printf("   📋 Sample item structure:")
-			for i, item := range result.Result.Items {
+			for i, item := range c.listItems(&result) {
 				if i >= 2 { // Only show first 2 items
 					break
 				}
@@ -574,13 +1320,14 @@ func (c *Client) SearchForOurSocios(ctx context.Context) error {
 
 	// Search by DNI in entity type 130
 	testDNIs := []string{"123456789A", "345345332C", "99999999R", "B65799900"}
-	
+
 	for _, dni := range testDNIs {
 		c.logger.Printf("🔎 Searching for DNI: %s", dni)
-		
+
 		// Search with filter
 		searchBody := map[string]interface{}{
 			"entityTypeId": 130,
+			"order":        defaultOrder(),
 			"filter": map[string]interface{}{
 				"ufCrm55Dni": dni,
 			},
@@ -598,8 +1345,8 @@ func (c *Client) SearchForOurSocios(ctx context.Context) error {
 			continue
 		}
 
-		if result.Result != nil && len(result.Result.Items) > 0 {
-			item := result.Result.Items[0]
+		if items := c.listItems(&result); len(items) > 0 {
+			item := items[0]
 			c.logger.Printf("✅ FOUND %s: ID=%d, Title='%s'", dni, item.ID, item.Title)
 		} else {
 			c.logger.Printf("❌ NOT FOUND: %s", dni)
@@ -607,4 +1354,4 @@ func (c *Client) SearchForOurSocios(ctx context.Context) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,353 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// roundTripFunc is an http.RoundTripper answering with a function.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTestClient returns a client for a portal of its own, sending its
+// requests to rt.
+func newTestClient(t testing.TB, rt http.RoundTripper, opts ...Option) *Client {
+	t.Helper()
+	opts = append([]Option{WithHTTPClient(&http.Client{Transport: rt})}, opts...)
+	return NewClient("https://"+strings.ToLower(t.Name())+".bitrix24.es/rest/1/key", log.New(io.Discard, "", 0), opts...)
+}
+
+// jsonResponse returns a 200 response with body, without Request set, as a
+// custom RoundTripper may.
+func jsonResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestDecodeResponseWithoutRequest(t *testing.T) {
+	reset := time.Now().Add(time.Minute).Unix()
+	client := newTestClient(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return jsonResponse(`{"result":{},"time":{"operating":12.5,"operating_reset_at":` + strconv.FormatInt(reset, 10) + `}}`), nil
+	}))
+
+	var response BitrixResponse
+	if err := client.doJSONRequest(context.Background(), "/crm.item.get", map[string]int{"id": 1}, &response); err != nil {
+		t.Fatalf("doJSONRequest: %v", err)
+	}
+
+	status := client.QuotaStatus()
+	if status == nil {
+		t.Fatal("QuotaStatus() = nil, want the operating time of crm.item.get")
+	}
+	if status.Method != "crm.item.get" || status.Operating != 12500*time.Millisecond {
+		t.Errorf("QuotaStatus() = %s %s, want crm.item.get 12.5s", status.Method, status.Operating)
+	}
+}
+
+// TestSyncedFieldsChange edits the cargo of one of many items in Bitrix24
+// and checks that leaving cargo out of the synced fields, then adding it
+// back, only ever updates that item.
+func TestSyncedFieldsChange(t *testing.T) {
+	withoutCargo := []string{SyncFieldTitle, SyncFieldAdministrador, SyncFieldParticipacion, SyncFieldRazonSocial}
+
+	socios := make([]*models.Socio, 10)
+	items := make([]*BitrixSocio, len(socios))
+	full := newTestClient(t, nil)
+	for i := range socios {
+		socios[i] = &models.Socio{CodigoEmpresa: 1, DNI: fmt.Sprintf("%08dZ", i), Administrador: true,
+			CargoAdministrador: "Consejero", PorParticipacion: 10, RazonSocialEmpleado: fmt.Sprintf("Socio %d", i)}
+		items[i] = full.convertSageToBitrix(socios[i])
+	}
+	items[3].Cargo = "Presidente"
+
+	// updates returns the items the client would update.
+	updates := func(client *Client) []int {
+		var updated []int
+		for i := range items {
+			if client.NeedsUpdate(items[i], socios[i]) {
+				updated = append(updated, i)
+			}
+		}
+		return updated
+	}
+
+	if got := updates(full); !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("syncing every field updates items %v, want [3]", got)
+	}
+
+	removed := newTestClient(t, nil, WithSyncedFields(withoutCargo))
+	if got := updates(removed); got != nil {
+		t.Errorf("after removing cargo, items %v need updates, want none", got)
+	}
+	fields, err := removed.convertToFields(items[0], false)
+	if err != nil {
+		t.Fatalf("convertToFields: %v", err)
+	}
+	if _, ok := fields[removed.fields.Cargo]; ok {
+		t.Errorf("update payload without cargo synced writes it: %v", fields)
+	}
+	if _, ok := fields["title"]; !ok {
+		t.Errorf("update payload without cargo synced leaves out the title: %v", fields)
+	}
+	if fields, _ := removed.convertToFields(items[0], true); fields[removed.fields.Cargo] != "Consejero" {
+		t.Errorf("create without cargo synced writes cargo %v, want Consejero", fields[removed.fields.Cargo])
+	}
+
+	readded := newTestClient(t, nil, WithSyncedFields(SyncableFields))
+	if got := updates(readded); !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("after adding cargo back, items %v need updates, want [3]", got)
+	}
+	changes := readded.Changes(items[3], socios[3])
+	if len(changes) != 1 || changes[0].Field != "cargo" {
+		t.Errorf("changes after adding cargo back = %+v, want only cargo", changes)
+	}
+}
+
+func TestFindSocioByDNI(t *testing.T) {
+	client := newTestClient(t, nil)
+	socios := []BitrixSocio{{ID: 1, DNI: "X1234567L"}, {ID: 2, DNI: " 12345678z "}}
+
+	for _, dni := range []string{"12345678Z", "12345678z", "12.345.678-Z", "\t12345678 Z"} {
+		if got := client.FindSocioByDNI(socios, dni); got == nil || got.ID != 2 {
+			t.Errorf("FindSocioByDNI(%q) = %+v, want item 2", dni, got)
+		}
+	}
+	if got := client.FindSocioByDNI(socios, "87654321X"); got != nil {
+		t.Errorf("FindSocioByDNI of a DNI not in Bitrix24 = %+v, want nil", got)
+	}
+}
+
+// TestFindDuplicatesNormalized checks items whose DNIs only differ in
+// formatting are flagged as duplicates, not merged.
+func TestFindDuplicatesNormalized(t *testing.T) {
+	duplicates := FindDuplicates([]BitrixSocio{
+		{ID: 1, DNI: "12345678Z"},
+		{ID: 2, DNI: "12345678-z"},
+		{ID: 3, DNI: "X1234567L"},
+		{ID: 4, DNI: " 12.345.678 Z"},
+		{ID: 5, DNI: ""},
+	})
+	if len(duplicates) != 1 {
+		t.Fatalf("FindDuplicates = %v, want one group", duplicates)
+	}
+	var ids []int
+	for _, item := range duplicates["12345678Z"] {
+		ids = append(ids, item.ID)
+	}
+	if !reflect.DeepEqual(ids, []int{4, 2, 1}) {
+		t.Errorf("items of 12345678Z = %v, want [4 2 1]", ids)
+	}
+}
+
+func TestGetSocioByDNIFilter(t *testing.T) {
+	tests := []struct {
+		dni  string
+		want interface{}
+	}{
+		{"12345678Z", "12345678Z"},
+		{" 12345678z ", []interface{}{"12345678Z", " 12345678z "}},
+		{"12.345.678-Z", []interface{}{"12345678Z", "12.345.678-Z"}},
+	}
+	for _, tt := range tests {
+		var filter interface{}
+		client := newTestClient(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			var body struct {
+				Filter map[string]interface{} `json:"filter"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			filter = body.Filter["ufCrm55Dni"]
+			return jsonResponse(`{"result":{"items":[{"id":7,"ufCrm55Dni":"12345678Z"}]}}`), nil
+		}), WithRateLimit(0, 0))
+
+		socio, err := client.GetSocioByDNI(context.Background(), tt.dni)
+		if err != nil || socio.ID != 7 {
+			t.Errorf("GetSocioByDNI(%q) = %+v, %v, want item 7", tt.dni, socio, err)
+		}
+		if !reflect.DeepEqual(filter, tt.want) {
+			t.Errorf("GetSocioByDNI(%q) filters on %#v, want %#v", tt.dni, filter, tt.want)
+		}
+	}
+}
+
+// selectPortal is a portal answering crm.item.list with one item holding
+// its standard fields, the socio fields and many unrelated custom fields,
+// keeping only the selected ones when a select is sent.
+type selectPortal struct {
+	selects  [][]string // Of each request; nil without select
+	received []int      // Response sizes, in bytes
+}
+
+func (p *selectPortal) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body struct {
+		Select []string `json:"select"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	p.selects = append(p.selects, body.Select)
+
+	item := map[string]interface{}{
+		"id": 7, "title": "Ana", "updatedTime": "2024-05-03T12:30:00+02:00", "stageId": "DT1032_8:NEW",
+		"ufCrm55Dni": "12345678Z", "ufCrm55Cargo": "Consejero", "ufCrm55Admin": "Y",
+		"ufCrm55Participacion": "25.50", "ufCrm55RazonSocial": "Ana", "ufCrm9Nif": "12345678Z",
+	}
+	for i := 0; i < 200; i++ {
+		item[fmt.Sprintf("ufCrm55Otro%d", i)] = strings.Repeat("x", 40)
+	}
+	if body.Select != nil {
+		selected := make(map[string]interface{}, len(body.Select))
+		for _, field := range body.Select {
+			if value, ok := item[field]; ok {
+				selected[field] = value
+			}
+		}
+		item = selected
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"result": map[string]interface{}{"items": []interface{}{item}}, "total": 1})
+	if err != nil {
+		return nil, err
+	}
+	p.received = append(p.received, len(payload))
+	return jsonResponse(string(payload)), nil
+}
+
+func TestListSelect(t *testing.T) {
+	mapped := []string{"id", "title", "updatedTime", "ufCrm55Dni", "ufCrm55Cargo", "ufCrm55Admin", "ufCrm55Participacion", "ufCrm55RazonSocial"}
+	remapped := append(append([]string(nil), mapped[:3]...), "ufCrm9Nif", "ufCrm55Cargo", "ufCrm55Admin", "ufCrm55Participacion", "ufCrm55RazonSocial")
+
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{"default", nil, mapped},
+		{"field mapping", []Option{WithFieldMapping(FieldMapping{DNI: "ufCrm9Nif"})}, remapped},
+		{"full items", []Option{WithFullItems()}, nil},
+	}
+	var sizes []int
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portal := &selectPortal{}
+			client := newTestClient(t, portal, append(tt.opts, WithRateLimit(0, 0))...)
+
+			socios, err := client.ListSocios(context.Background())
+			if err != nil {
+				t.Fatalf("ListSocios: %v", err)
+			}
+			socio, err := client.GetSocioByDNI(context.Background(), "12345678Z")
+			if err != nil {
+				t.Fatalf("GetSocioByDNI: %v", err)
+			}
+			for i, method := range []string{"ListSocios", "GetSocioByDNI"} {
+				if !reflect.DeepEqual(portal.selects[i], tt.want) {
+					t.Errorf("%s selects %v, want %v", method, portal.selects[i], tt.want)
+				}
+			}
+
+			// The reduced item still decodes in full.
+			for _, got := range []*BitrixSocio{&socios[0], socio} {
+				if got.ID != 7 || got.DNI != "12345678Z" || got.Participacion != "25.50" || got.UpdatedTime == nil {
+					t.Errorf("decoded %+v, want item 7 with its socio fields", got)
+				}
+			}
+			sizes = append(sizes, portal.received[0])
+		})
+	}
+
+	// Only the socio fields are sent, a fraction of the full item.
+	if full := sizes[len(sizes)-1]; sizes[0]*10 > full {
+		t.Errorf("selected item is %d bytes, full item %d, want it under a tenth", sizes[0], full)
+	}
+}
+
+// TestRequestHeaders checks the User-Agent and run ID reach the portal on
+// POST requests, single and batched, and on GET requests.
+func TestRequestHeaders(t *testing.T) {
+	type sent struct{ method, path, userAgent, runID string }
+	var requests []sent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, sent{r.Method, r.URL.Path[strings.LastIndex(r.URL.Path, "/"):], r.UserAgent(), r.Header.Get(RunIDHeader)})
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/crm.item.fields"):
+			io.WriteString(w, `{"result":{"fields":{}}}`)
+		case strings.HasSuffix(r.URL.Path, "/crm.item.add"):
+			io.WriteString(w, `{"result":{"item":{"id":7}}}`)
+		case strings.HasSuffix(r.URL.Path, "/batch"):
+			io.WriteString(w, `{"result":{"result":{"delete_7":[]},"result_error":[]}}`)
+		default:
+			io.WriteString(w, `{}`)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		runID     string
+		userAgent string
+	}{
+		{"defaults", nil, "", UserAgent("")},
+		{"run", []Option{WithUserAgent(UserAgent("acme"))}, "20240503-123000-acme", "sage-bitrix-sync/" + Version + " (client=acme)"},
+		{"custom agent", []Option{WithUserAgent("acme-sync/2.1")}, "run-2", "acme-sync/2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			client := NewClient(server.URL+"/rest/1/key", log.New(io.Discard, "", 0), append(tt.opts, WithRateLimit(0, 0))...)
+			ctx := context.Background()
+			if tt.runID != "" {
+				ctx = WithRunID(ctx, tt.runID)
+			}
+
+			if _, err := client.CreateSocio(ctx, &models.Socio{CodigoEmpresa: 1, DNI: "12345678Z", RazonSocialEmpleado: "Ana"}); err != nil {
+				t.Fatalf("CreateSocio: %v", err)
+			}
+			if _, err := client.BatchDeleteSocios(ctx, []int{7}); err != nil {
+				t.Fatalf("BatchDeleteSocios: %v", err)
+			}
+			if err := client.testBasicConnection(ctx); err != nil {
+				t.Fatalf("testBasicConnection: %v", err)
+			}
+
+			// crm.item.fields is cached after the first subtest; whatever was sent
+			// must carry the headers, and the add, batch and GET paths must be there.
+			seen := map[string]bool{}
+			for _, r := range requests {
+				seen[r.method+" "+r.path] = true
+				if r.userAgent != tt.userAgent {
+					t.Errorf("%s %s: User-Agent %q, want %q", r.method, r.path, r.userAgent, tt.userAgent)
+				}
+				if r.runID != tt.runID {
+					t.Errorf("%s %s: %s %q, want %q", r.method, r.path, RunIDHeader, r.runID, tt.runID)
+				}
+			}
+			for _, want := range []string{"POST /crm.item.add", "POST /batch", "GET /"} {
+				if !seen[want] {
+					t.Errorf("no %s request among %+v", want, requests)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package bitrix
+
+import (
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// ClienteEntity returns the CRM entity a Sage cliente is synced to:
+// individuals become contacts when a contact NIF field is configured,
+// everyone else a company.
+func (c *Client) ClienteEntity(cliente *models.Cliente) string {
+	if cliente.IsIndividual() && c.contactTaxIDField != "" {
+		return EntityContact
+	}
+	return EntityCompany
+}
+
+// convertCliente maps a Sage cliente to the values the sync writes.
+func convertCliente(cliente *models.Cliente) *BitrixCompany {
+	return &BitrixCompany{
+		Title:      cliente.RazonSocial,
+		CIF:        NormalizeCIF(cliente.CIF),
+		Address:    cliente.Domicilio,
+		PostalCode: cliente.CodigoPostal,
+		City:       cliente.Municipio,
+		Province:   cliente.Provincia,
+		Phone:      cliente.Telefono,
+		Email:      cliente.Email,
+	}
+}
+
+// ClienteChanges lists the fields an update with Sage data would change.
+func (c *Client) ClienteChanges(existing *BitrixCompany, cliente *models.Cliente) []FieldChange {
+	return companyChanges(existing, convertCliente(cliente))
+}
+
+// ClienteFields builds the crm.company or crm.contact fields for a cliente.
+// With an existing record its phone and email are overwritten rather than
+// added to.
+func (c *Client) ClienteFields(entity string, cliente *models.Cliente, existing *BitrixCompany) map[string]interface{} {
+	values := convertCliente(cliente)
+	fields := map[string]interface{}{
+		"ADDRESS":             values.Address,
+		"ADDRESS_POSTAL_CODE": values.PostalCode,
+		"ADDRESS_CITY":        values.City,
+		"ADDRESS_PROVINCE":    values.Province,
+	}
+	if entity == EntityContact {
+		fields["NAME"] = values.Title
+		fields["LAST_NAME"] = ""
+		fields[c.contactTaxIDField] = values.CIF
+	} else {
+		fields["TITLE"] = values.Title
+		fields[c.companyCIFField] = values.CIF
+	}
+
+	var phoneID, emailID int
+	if existing != nil {
+		phoneID, emailID = existing.PhoneID, existing.EmailID
+	}
+	if values.Phone != "" {
+		fields["PHONE"] = multiField(values.Phone, phoneID)
+	}
+	if values.Email != "" {
+		fields["EMAIL"] = multiField(values.Email, emailID)
+	}
+	return fields
+}
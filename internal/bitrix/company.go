@@ -0,0 +1,168 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// Fields that can bind a Smart Process item to a Company. Companies are
+// entity type 4 in Bitrix24.
+const (
+	LinkFieldCompanyID = "companyId"
+	LinkFieldParent    = "parentId4"
+)
+
+// ErrCompanyNotFound is returned when no Bitrix24 company matches a Sage empresa.
+var ErrCompanyNotFound = errors.New("company not found")
+
+// CompanyLink configures how socios are linked to the Bitrix24 company
+// representing their Sage empresa.
+type CompanyLink struct {
+	Field         string // LinkFieldCompanyID or LinkFieldParent
+	CodeField     string // Company UF field holding the Sage CodigoEmpresa, e.g. UF_CRM_SAGE_EMPRESA
+	CreateMissing bool   // Create the company when none matches instead of skipping the link
+}
+
+// companyCache remembers resolved company IDs per CodigoEmpresa; 0 means the
+// company is known to be missing.
+type companyCache struct {
+	mu  sync.Mutex
+	ids map[int]int
+}
+
+func (cc *companyCache) get(codigo int) (int, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	id, ok := cc.ids[codigo]
+	return id, ok
+}
+
+func (cc *companyCache) put(codigo, id int) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.ids == nil {
+		cc.ids = make(map[int]int)
+	}
+	cc.ids[codigo] = id
+}
+
+// FindCompanyByCode looks up the Bitrix24 company whose code field holds the
+// given Sage CodigoEmpresa.
+func (c *Client) FindCompanyByCode(ctx context.Context, codigoEmpresa int) (int, error) {
+	requestBody := map[string]interface{}{
+		"filter": map[string]interface{}{
+			c.companyLink.CodeField: strconv.Itoa(codigoEmpresa),
+		},
+		"select": []string{"ID"},
+		"order":  map[string]string{"ID": "ASC"},
+	}
+
+	var result BitrixRawResponse
+	err := c.doJSONRequest(ctx, "/crm.company.list", requestBody, &result)
+	if err != nil {
+		return 0, fmt.Errorf("failed to search company %d: %w", codigoEmpresa, err)
+	}
+	if err := c.checkBitrixError(&result); err != nil {
+		return 0, err
+	}
+
+	var companies []struct {
+		ID json.Number `json:"ID"`
+	}
+	if err := json.Unmarshal(result.Result, &companies); err != nil {
+		return 0, fmt.Errorf("failed to decode companies: %w", err)
+	}
+	if len(companies) == 0 {
+		return 0, fmt.Errorf("empresa %d: %w", codigoEmpresa, ErrCompanyNotFound)
+	}
+	return parseID(companies[0].ID)
+}
+
+// CreateCompany creates a minimal Bitrix24 company for a Sage empresa.
+func (c *Client) CreateCompany(ctx context.Context, codigoEmpresa int, title string) (int, error) {
+	c.logger.Printf("🏢 Creating company in Bitrix24: empresa=%d, title=%s", codigoEmpresa, title)
+
+	requestBody := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"TITLE":                 title,
+			c.companyLink.CodeField: strconv.Itoa(codigoEmpresa),
+		},
+	}
+
+	var result BitrixRawResponse
+	err := c.doJSONRequest(ctx, "/crm.company.add", requestBody, &result)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create company %d: %w", codigoEmpresa, err)
+	}
+	if err := c.checkBitrixError(&result); err != nil {
+		return 0, err
+	}
+	return parseItemID(result.Result)
+}
+
+// ResolveCompanies looks up (and, if configured, creates) the companies for
+// every empresa among socios, so that conversions and NeedsUpdate can use the
+// cached IDs. It is a no-op when company linking is disabled.
+func (c *Client) ResolveCompanies(ctx context.Context, socios []*models.Socio) error {
+	if c.companyLink.Field == "" {
+		return nil
+	}
+
+	for _, socio := range socios {
+		if _, err := c.companyFor(ctx, socio); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// companyFor returns the company ID for a socio's empresa, resolving it on
+// first use. Missing companies yield 0 unless CreateMissing is set.
+func (c *Client) companyFor(ctx context.Context, socio *models.Socio) (int, error) {
+	if c.companyLink.Field == "" {
+		return 0, nil
+	}
+	if id, ok := c.companies.get(socio.CodigoEmpresa); ok {
+		return id, nil
+	}
+
+	id, err := c.FindCompanyByCode(ctx, socio.CodigoEmpresa)
+	if errors.Is(err, ErrCompanyNotFound) {
+		if !c.companyLink.CreateMissing {
+			c.warn(WarnNoCompany, "", "No Bitrix24 company for empresa %d, socios won't be linked", socio.CodigoEmpresa)
+			c.companies.put(socio.CodigoEmpresa, 0)
+			return 0, nil
+		}
+		id, err = c.CreateCompany(ctx, socio.CodigoEmpresa, fmt.Sprintf("Empresa %d", socio.CodigoEmpresa))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	c.companies.put(socio.CodigoEmpresa, id)
+	return id, nil
+}
+
+// cachedCompanyFor returns the already resolved company ID for a socio, and
+// whether it is known.
+func (c *Client) cachedCompanyFor(socio *models.Socio) (int, bool) {
+	if c.companyLink.Field == "" {
+		return 0, false
+	}
+	return c.companies.get(socio.CodigoEmpresa)
+}
+
+// linkedCompany returns the company an item is bound to through the
+// configured link field.
+func (c *Client) linkedCompany(bs *BitrixSocio) int {
+	if c.companyLink.Field == LinkFieldParent {
+		return bs.ParentCompanyID
+	}
+	return bs.CompanyID
+}
@@ -0,0 +1,317 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// ErrCompanyCIFFieldNotConfigured is returned by the company sync methods
+// when no CIF field was set with WithCompanyCIFField.
+var ErrCompanyCIFFieldNotConfigured = errors.New("no company CIF field configured")
+
+// ErrContactTaxIDFieldNotConfigured is returned by ListContacts when no NIF
+// field was set with WithContactTaxIDField.
+var ErrContactTaxIDFieldNotConfigured = errors.New("no contact NIF field configured")
+
+// CRM entities Sage empresas and clientes are synced to.
+const (
+	EntityCompany = "company"
+	EntityContact = "contact"
+)
+
+// BitrixCompany is a Bitrix24 company as mapped from a Sage empresa or
+// cliente. Contacts use it too, with their full name as Title.
+type BitrixCompany struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	CIF        string `json:"cif"`
+	Address    string `json:"address"`
+	PostalCode string `json:"postal_code"`
+	City       string `json:"city"`
+	Province   string `json:"province"`
+	Phone      string `json:"phone"`
+	PhoneID    int    `json:"phone_id,omitempty"` // Multifield value ID, so updates replace the phone
+	Email      string `json:"email"`
+	EmailID    int    `json:"email_id,omitempty"`
+}
+
+// multiValue is a value of a PHONE or EMAIL multifield.
+type multiValue struct {
+	ID    json.Number `json:"ID"`
+	Value string      `json:"VALUE"`
+}
+
+// companyRecord is a crm.company.list or crm.contact.list row.
+type companyRecord struct {
+	ID         json.Number  `json:"ID"`
+	Title      string       `json:"TITLE"`
+	Name       string       `json:"NAME"`
+	LastName   string       `json:"LAST_NAME"`
+	Address    string       `json:"ADDRESS"`
+	PostalCode string       `json:"ADDRESS_POSTAL_CODE"`
+	City       string       `json:"ADDRESS_CITY"`
+	Province   string       `json:"ADDRESS_PROVINCE"`
+	Phone      []multiValue `json:"PHONE"`
+	Email      []multiValue `json:"EMAIL"`
+}
+
+// ListCompanies returns every Bitrix24 company that has a CIF, keyed by the
+// normalized CIF. When several share a CIF the oldest wins.
+func (c *Client) ListCompanies(ctx context.Context) (map[string]*BitrixCompany, error) {
+	if c.companyCIFField == "" {
+		return nil, ErrCompanyCIFFieldNotConfigured
+	}
+	return c.listByTaxID(ctx, EntityCompany, c.companyCIFField)
+}
+
+// ListContacts returns every Bitrix24 contact that has a NIF, keyed like
+// ListCompanies.
+func (c *Client) ListContacts(ctx context.Context) (map[string]*BitrixCompany, error) {
+	if c.contactTaxIDField == "" {
+		return nil, ErrContactTaxIDFieldNotConfigured
+	}
+	return c.listByTaxID(ctx, EntityContact, c.contactTaxIDField)
+}
+
+// listByTaxID pages through the companies or contacts whose taxField is set.
+func (c *Client) listByTaxID(ctx context.Context, entity, taxField string) (map[string]*BitrixCompany, error) {
+	selectFields := []string{"ID", "TITLE", "ADDRESS", "ADDRESS_POSTAL_CODE", "ADDRESS_CITY",
+		"ADDRESS_PROVINCE", "PHONE", "EMAIL", taxField}
+	if entity == EntityContact {
+		selectFields[1] = "NAME"
+		selectFields = append(selectFields, "LAST_NAME")
+	}
+
+	companies := make(map[string]*BitrixCompany)
+	for start := 0; ; {
+		requestBody := map[string]interface{}{
+			"filter": map[string]interface{}{"!" + taxField: ""},
+			"select": selectFields,
+			"order":  map[string]string{"ID": "ASC"},
+			"start":  start,
+		}
+
+		var result BitrixRawResponse
+		if err := c.doJSONRequest(ctx, "/crm."+entity+".list", requestBody, &result); err != nil {
+			return nil, fmt.Errorf("failed to list %s records: %w", entity, err)
+		}
+		if err := c.checkBitrixError(&result); err != nil {
+			return nil, err
+		}
+
+		var rows []json.RawMessage
+		if err := json.Unmarshal(result.Result, &rows); err != nil {
+			return nil, fmt.Errorf("failed to decode %s records: %w", entity, err)
+		}
+		for _, row := range rows {
+			company, err := decodeCompany(row, taxField)
+			if err != nil {
+				c.warn(WarnUndecodable, "", "Skipping undecodable Bitrix %s: %v", entity, err)
+				continue
+			}
+			key := NormalizeCIF(company.CIF)
+			if _, seen := companies[key]; key != "" && !seen {
+				companies[key] = company
+			}
+		}
+
+		if result.Next == 0 || len(rows) == 0 {
+			return companies, nil
+		}
+		start = result.Next
+	}
+}
+
+// decodeCompany decodes a company or contact list row, reading the tax ID
+// from taxField.
+func decodeCompany(raw json.RawMessage, taxField string) (*BitrixCompany, error) {
+	var record companyRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	id, err := parseID(record.ID)
+	if err != nil {
+		return nil, err
+	}
+	cif, err := decodeString(fields[taxField])
+	if err != nil {
+		return nil, fmt.Errorf("record %d: %s: %w", id, taxField, err)
+	}
+
+	title := record.Title
+	if title == "" {
+		title = strings.TrimSpace(record.Name + " " + record.LastName)
+	}
+	company := &BitrixCompany{
+		ID:         id,
+		Title:      title,
+		CIF:        cif,
+		Address:    record.Address,
+		PostalCode: record.PostalCode,
+		City:       record.City,
+		Province:   record.Province,
+	}
+	if len(record.Phone) > 0 {
+		company.Phone = record.Phone[0].Value
+		company.PhoneID, _ = strconv.Atoi(record.Phone[0].ID.String())
+	}
+	if len(record.Email) > 0 {
+		company.Email = record.Email[0].Value
+		company.EmailID, _ = strconv.Atoi(record.Email[0].ID.String())
+	}
+	return company, nil
+}
+
+// NormalizeCIF strips spaces, dashes and dots and upper-cases a CIF, so the
+// Sage and Bitrix24 spellings of the same CIF match.
+func NormalizeCIF(cif string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(cif)))
+}
+
+// convertEmpresa maps a Sage empresa to the company values the sync writes.
+func convertEmpresa(empresa *models.Empresa) *BitrixCompany {
+	return &BitrixCompany{
+		Title:      empresa.RazonSocial,
+		CIF:        NormalizeCIF(empresa.CIF),
+		Address:    empresa.Domicilio,
+		PostalCode: empresa.CodigoPostal,
+		City:       empresa.Municipio,
+		Province:   empresa.Provincia,
+		Phone:      empresa.Telefono,
+		Email:      empresa.Email,
+	}
+}
+
+// CompanyChanges lists the fields an update with Sage data would change.
+func (c *Client) CompanyChanges(company *BitrixCompany, empresa *models.Empresa) []FieldChange {
+	return companyChanges(company, convertEmpresa(empresa))
+}
+
+// companyChanges compares a company or contact with the values Sage would
+// write. A phone or email missing in Sage leaves the Bitrix one alone.
+func companyChanges(company, expected *BitrixCompany) []FieldChange {
+	pairs := []FieldChange{
+		{"title", company.Title, expected.Title},
+		{"address", company.Address, expected.Address},
+		{"postal code", company.PostalCode, expected.PostalCode},
+		{"city", company.City, expected.City},
+		{"province", company.Province, expected.Province},
+	}
+	if expected.Phone != "" {
+		pairs = append(pairs, FieldChange{"phone", company.Phone, expected.Phone})
+	}
+	if expected.Email != "" {
+		pairs = append(pairs, FieldChange{"email", company.Email, expected.Email})
+	}
+
+	var changes []FieldChange
+	for _, p := range pairs {
+		if p.Old != p.New {
+			changes = append(changes, p)
+		}
+	}
+	return changes
+}
+
+// companyFields builds the crm.company fields for an empresa. Giving the
+// existing phone's and email's IDs overwrites them instead of adding a
+// second number or address.
+func (c *Client) companyFields(empresa *models.Empresa, phoneID, emailID int) map[string]interface{} {
+	company := convertEmpresa(empresa)
+	fields := map[string]interface{}{
+		"TITLE":               company.Title,
+		c.companyCIFField:     company.CIF,
+		"ADDRESS":             company.Address,
+		"ADDRESS_POSTAL_CODE": company.PostalCode,
+		"ADDRESS_CITY":        company.City,
+		"ADDRESS_PROVINCE":    company.Province,
+	}
+	if company.Phone != "" {
+		fields["PHONE"] = multiField(company.Phone, phoneID)
+	}
+	if company.Email != "" {
+		fields["EMAIL"] = multiField(company.Email, emailID)
+	}
+	// Let socios of this empresa find the company through the link code field.
+	if c.companyLink.CodeField != "" {
+		fields[c.companyLink.CodeField] = strconv.Itoa(empresa.CodigoEmpresa)
+	}
+	return fields
+}
+
+// multiField sets a PHONE or EMAIL multifield to value, overwriting the
+// existing value with the given ID if any.
+func multiField(value string, id int) []interface{} {
+	entry := map[string]interface{}{"VALUE": value, "VALUE_TYPE": "WORK"}
+	if id > 0 {
+		entry["ID"] = id
+	}
+	return []interface{}{entry}
+}
+
+// CreateCompanyFromEmpresa creates the Bitrix24 company of a Sage empresa and
+// returns its ID.
+func (c *Client) CreateCompanyFromEmpresa(ctx context.Context, empresa *models.Empresa) (int, error) {
+	if c.companyCIFField == "" {
+		return 0, ErrCompanyCIFFieldNotConfigured
+	}
+	c.logger.Printf("🏢 Creating company in Bitrix24: CIF=%s, title=%s", empresa.CIF, empresa.RazonSocial)
+
+	requestBody := map[string]interface{}{
+		"fields": c.companyFields(empresa, 0, 0),
+	}
+
+	var result BitrixRawResponse
+	if err := c.doJSONRequest(ctx, "/crm.company.add", requestBody, &result); err != nil {
+		return 0, fmt.Errorf("failed to create company %s: %w", empresa.CIF, err)
+	}
+	if err := c.checkBitrixError(&result); err != nil {
+		return 0, err
+	}
+	id, err := parseItemID(result.Result)
+	if err == nil {
+		c.companies.put(empresa.CodigoEmpresa, id)
+	}
+	return id, err
+}
+
+// UpdateCompanyFromEmpresa overwrites a Bitrix24 company with its Sage
+// empresa's data.
+func (c *Client) UpdateCompanyFromEmpresa(ctx context.Context, company *BitrixCompany, empresa *models.Empresa) error {
+	if c.companyCIFField == "" {
+		return ErrCompanyCIFFieldNotConfigured
+	}
+	c.logger.Printf("🏢 Updating company %d in Bitrix24: CIF=%s", company.ID, empresa.CIF)
+
+	requestBody := map[string]interface{}{
+		"id":     company.ID,
+		"fields": c.companyFields(empresa, company.PhoneID, company.EmailID),
+	}
+
+	var result BitrixRawResponse
+	if err := c.doJSONRequest(ctx, "/crm.company.update", requestBody, &result); err != nil {
+		return fmt.Errorf("failed to update company %d: %w", company.ID, err)
+	}
+	if err := c.checkBitrixError(&result); err != nil {
+		return err
+	}
+	c.companies.put(empresa.CodigoEmpresa, company.ID)
+	return nil
+}
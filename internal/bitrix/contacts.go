@@ -0,0 +1,71 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// FindContactByComm looks for an existing contact with the given email or
+// phone via crm.duplicate.findbycomm, trying the email first. It returns the
+// lowest matching contact ID, or ErrNotFound.
+func (c *Client) FindContactByComm(ctx context.Context, email, phone string) (int, error) {
+	lookups := []struct{ commType, value string }{
+		{"EMAIL", email},
+		{"PHONE", phone},
+	}
+
+	for _, l := range lookups {
+		if l.value == "" {
+			continue
+		}
+
+		id, err := c.findContactBy(ctx, l.commType, l.value)
+		if err != nil {
+			return 0, err
+		}
+		if id > 0 {
+			c.logger.Printf("🔗 Found existing contact %d by %s", id, l.commType)
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("contact with email %q or phone %q: %w", email, phone, ErrNotFound)
+}
+
+// findContactBy runs a single crm.duplicate.findbycomm lookup, returning 0
+// when nothing matches.
+func (c *Client) findContactBy(ctx context.Context, commType, value string) (int, error) {
+	requestBody := map[string]interface{}{
+		"entity_type": "CONTACT",
+		"type":        commType,
+		"values":      []string{value},
+	}
+
+	var result BitrixRawResponse
+	if err := c.doJSONRequest(ctx, "/crm.duplicate.findbycomm", requestBody, &result); err != nil {
+		return 0, fmt.Errorf("failed to search contacts by %s: %w", commType, err)
+	}
+	if err := c.checkBitrixError(&result); err != nil {
+		return 0, err
+	}
+
+	// Matches come back as {"CONTACT": [ids]}, or an empty array when none.
+	var matches struct {
+		Contact []json.Number `json:"CONTACT"`
+	}
+	if json.Unmarshal(result.Result, &matches) != nil {
+		return 0, nil
+	}
+
+	best := 0
+	for _, n := range matches.Contact {
+		id, err := parseID(n)
+		if err != nil {
+			continue
+		}
+		if best == 0 || id < best {
+			best = id
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,80 @@
+package bitrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDeactivationNotConfigured is returned by DeactivateSocio when neither an
+// active field nor an inactive stage was set with WithDeactivation.
+var ErrDeactivationNotConfigured = errors.New("no active field or inactive stage configured")
+
+// activeFieldTypes are the field types the active flag can be stored in.
+var activeFieldTypes = []string{"string", "boolean", "enumeration"}
+
+// validateActiveField checks the active field's definition and records how
+// its flag is stored, returning a problem description or "".
+func (c *Client) validateActiveField(fields map[string]FieldInfo) string {
+	info, exists := fields[c.activeField]
+	if !exists {
+		return fmt.Sprintf("%s (missing)", c.activeField)
+	}
+	if !containsString(activeFieldTypes, info.Type) {
+		return fmt.Sprintf("%s (type %q, expected one of %s)",
+			c.activeField, info.Type, strings.Join(activeFieldTypes, "/"))
+	}
+
+	mapping, err := parseFlagMapping(info)
+	if err != nil {
+		return fmt.Sprintf("%s (%v)", c.activeField, err)
+	}
+	c.activeFlags = mapping
+	return ""
+}
+
+// IsInactive reports whether an item was marked as removed from Sage by
+// DeactivateSocio.
+func (c *Client) IsInactive(bs *BitrixSocio) bool {
+	if c.activeField != "" && bs.Active == "N" {
+		return true
+	}
+	return c.inactiveStageID != "" && bs.StageID == c.inactiveStageID
+}
+
+// DeactivateSocio marks an item whose socio was removed from Sage, as
+// configured with WithDeactivation. The item itself is kept.
+func (c *Client) DeactivateSocio(ctx context.Context, bitrixID int) error {
+	if c.activeField == "" && c.inactiveStageID == "" {
+		return ErrDeactivationNotConfigured
+	}
+
+	c.logger.Printf("💤 Deactivating socio in Bitrix24: ID=%d", bitrixID)
+
+	fields := map[string]interface{}{}
+	if c.activeField != "" {
+		fields[c.activeField] = c.activeFlags.encode("N")
+	}
+	if c.inactiveStageID != "" {
+		fields["stageId"] = c.inactiveStageID
+	}
+	requestBody := map[string]interface{}{
+		"entityTypeId": c.entityTypeID,
+		"id":           bitrixID,
+		"fields":       fields,
+	}
+
+	var result BitrixResponse
+	err := c.doJSONRequest(ctx, "/crm.item.update", requestBody, &result)
+	if err == nil {
+		err = c.checkBitrixError(&result)
+	}
+	if err != nil {
+		if isAPIErrorCode(err, "NOT_FOUND") {
+			return fmt.Errorf("socio %d: %w", bitrixID, ErrNotFound)
+		}
+		return fmt.Errorf("failed to deactivate socio %d: %w", bitrixID, err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// ErrDealInvoiceFieldNotConfigured is returned by the deal sync methods when
+// no invoice number field was set with WithDealInvoiceField.
+var ErrDealInvoiceFieldNotConfigured = errors.New("no deal invoice field configured")
+
+// EntityDeal is the CRM entity Sage facturas are synced to.
+const EntityDeal = "deal"
+
+// defaultCurrency is used for facturas without a currency in Sage.
+const defaultCurrency = "EUR"
+
+// BitrixDeal is a Bitrix24 deal as mapped from a Sage factura.
+type BitrixDeal struct {
+	ID        int    `json:"id"`
+	Invoice   string `json:"invoice"` // models.Factura.Number
+	Title     string `json:"title"`
+	Amount    string `json:"amount"` // OPPORTUNITY with two decimals
+	Currency  string `json:"currency"`
+	CloseDate string `json:"close_date"` // YYYY-MM-DD
+	CompanyID int    `json:"company_id,omitempty"`
+	ContactID int    `json:"contact_id,omitempty"`
+}
+
+// dealRecord is a crm.deal.list row.
+type dealRecord struct {
+	ID        json.Number `json:"ID"`
+	Title     string      `json:"TITLE"`
+	Amount    string      `json:"OPPORTUNITY"`
+	Currency  string      `json:"CURRENCY_ID"`
+	CloseDate string      `json:"CLOSEDATE"`
+	CompanyID json.Number `json:"COMPANY_ID"`
+	ContactID json.Number `json:"CONTACT_ID"`
+}
+
+// GetDealsByInvoice returns the deals holding any of the given invoice
+// numbers, keyed by invoice number. Numbers are looked up 50 at a time.
+func (c *Client) GetDealsByInvoice(ctx context.Context, invoices []string) (map[string]*BitrixDeal, error) {
+	if c.dealInvoiceField == "" {
+		return nil, ErrDealInvoiceFieldNotConfigured
+	}
+
+	deals := make(map[string]*BitrixDeal, len(invoices))
+	for start := 0; start < len(invoices); start += MaxBatchCommands {
+		end := min(start+MaxBatchCommands, len(invoices))
+
+		requestBody := map[string]interface{}{
+			"filter": map[string]interface{}{c.dealInvoiceField: invoices[start:end]},
+			"select": []string{"ID", "TITLE", "OPPORTUNITY", "CURRENCY_ID", "CLOSEDATE",
+				"COMPANY_ID", "CONTACT_ID", c.dealInvoiceField},
+			"order": map[string]string{"ID": "ASC"},
+		}
+
+		var result BitrixRawResponse
+		if err := c.doJSONRequest(ctx, "/crm.deal.list", requestBody, &result); err != nil {
+			return nil, fmt.Errorf("failed to list deals: %w", err)
+		}
+		if err := c.checkBitrixError(&result); err != nil {
+			return nil, err
+		}
+
+		var rows []json.RawMessage
+		if err := json.Unmarshal(result.Result, &rows); err != nil {
+			return nil, fmt.Errorf("failed to decode deals: %w", err)
+		}
+		for _, row := range rows {
+			deal, err := c.decodeDeal(row)
+			if err != nil {
+				c.warn(WarnUndecodable, "", "Skipping undecodable Bitrix deal: %v", err)
+				continue
+			}
+			// When several deals share an invoice number the oldest wins.
+			if _, seen := deals[deal.Invoice]; deal.Invoice != "" && !seen {
+				deals[deal.Invoice] = deal
+			}
+		}
+	}
+	return deals, nil
+}
+
+// decodeDeal decodes a crm.deal.list row.
+func (c *Client) decodeDeal(raw json.RawMessage) (*BitrixDeal, error) {
+	var record dealRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	id, err := parseID(record.ID)
+	if err != nil {
+		return nil, err
+	}
+	invoice, err := decodeString(fields[c.dealInvoiceField])
+	if err != nil {
+		return nil, fmt.Errorf("deal %d: %s: %w", id, c.dealInvoiceField, err)
+	}
+
+	deal := &BitrixDeal{
+		ID:        id,
+		Invoice:   invoice,
+		Title:     record.Title,
+		Amount:    formatAmountString(record.Amount),
+		Currency:  record.Currency,
+		CloseDate: record.CloseDate,
+	}
+	if len(deal.CloseDate) > len("2006-01-02") {
+		deal.CloseDate = deal.CloseDate[:len("2006-01-02")]
+	}
+	deal.CompanyID, _ = strconv.Atoi(record.CompanyID.String())
+	deal.ContactID, _ = strconv.Atoi(record.ContactID.String())
+	return deal, nil
+}
+
+// formatAmountString normalizes a Bitrix24 amount to two decimals so it
+// compares equal to the Sage one; unparsable values are kept as they are.
+func formatAmountString(amount string) string {
+	f, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return amount
+	}
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+// convertFactura maps a Sage factura to the deal values the sync writes,
+// bound to the given company or contact.
+func convertFactura(factura *models.Factura, companyID, contactID int) *BitrixDeal {
+	currency := factura.Divisa
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	return &BitrixDeal{
+		Invoice:   factura.Number(),
+		Title:     fmt.Sprintf("Factura %s%d/%d - %s", factura.SerieFactura, factura.NumeroFactura, factura.EjercicioFactura, factura.RazonSocial),
+		Amount:    strconv.FormatFloat(factura.Importe, 'f', 2, 64),
+		Currency:  currency,
+		CloseDate: factura.FechaFactura.Format("2006-01-02"),
+		CompanyID: companyID,
+		ContactID: contactID,
+	}
+}
+
+// DealChanges lists the fields an update with Sage data would change. A
+// binding the sync could not resolve leaves the deal's one alone.
+func (c *Client) DealChanges(deal *BitrixDeal, factura *models.Factura, companyID, contactID int) []FieldChange {
+	expected := convertFactura(factura, companyID, contactID)
+	pairs := []FieldChange{
+		{"title", deal.Title, expected.Title},
+		{"amount", deal.Amount, expected.Amount},
+		{"currency", deal.Currency, expected.Currency},
+		{"close date", deal.CloseDate, expected.CloseDate},
+	}
+	if companyID > 0 {
+		pairs = append(pairs, FieldChange{"company", strconv.Itoa(deal.CompanyID), strconv.Itoa(companyID)})
+	}
+	if contactID > 0 {
+		pairs = append(pairs, FieldChange{"contact", strconv.Itoa(deal.ContactID), strconv.Itoa(contactID)})
+	}
+
+	var changes []FieldChange
+	for _, p := range pairs {
+		if p.Old != p.New {
+			changes = append(changes, p)
+		}
+	}
+	return changes
+}
+
+// DealFields builds the crm.deal fields for a factura, bound to the given
+// company or contact when their ID is set.
+func (c *Client) DealFields(factura *models.Factura, companyID, contactID int) map[string]interface{} {
+	deal := convertFactura(factura, companyID, contactID)
+	fields := map[string]interface{}{
+		"TITLE":            deal.Title,
+		c.dealInvoiceField: deal.Invoice,
+		"OPPORTUNITY":      deal.Amount,
+		"CURRENCY_ID":      deal.Currency,
+		"CLOSEDATE":        deal.CloseDate,
+	}
+	if companyID > 0 {
+		fields["COMPANY_ID"] = companyID
+	}
+	if contactID > 0 {
+		fields["CONTACT_ID"] = contactID
+	}
+	return fields
+}
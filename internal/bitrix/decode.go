@@ -0,0 +1,199 @@
+package bitrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// UnmarshalJSON decodes a BitrixSocio tolerating the representations
+// Bitrix24 uses depending on field type: IDs as numbers or strings,
+// participación as a number or string, the admin flag as Y/N, 1/0 or
+// true/false, and timestamps in any format models.ParseBitrixTime accepts.
+func (bs *BitrixSocio) UnmarshalJSON(data []byte) error {
+	type plain BitrixSocio
+	aux := struct {
+		*plain
+		ID                  json.RawMessage `json:"id"`
+		EntityTypeID        json.RawMessage `json:"entityTypeId"`
+		CategoryID          json.RawMessage `json:"categoryId"`
+		CreatedTime         json.RawMessage `json:"createdTime"`
+		UpdatedTime         json.RawMessage `json:"updatedTime"`
+		DNI                 json.RawMessage `json:"ufCrm55Dni"`
+		Cargo               json.RawMessage `json:"ufCrm55Cargo"`
+		Administrador       json.RawMessage `json:"ufCrm55Admin"`
+		Participacion       json.RawMessage `json:"ufCrm55Participacion"`
+		RazonSocialEmpleado json.RawMessage `json:"ufCrm55RazonSocial"`
+		CompanyID           json.RawMessage `json:"companyId"`
+		ParentCompanyID     json.RawMessage `json:"parentId4"`
+		AssignedByID        json.RawMessage `json:"assignedById"`
+	}{plain: (*plain)(bs)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	var err error
+	if bs.ID, err = decodeInt(aux.ID); err != nil {
+		return fmt.Errorf("id: %w", err)
+	}
+	if bs.EntityTypeID, err = decodeInt(aux.EntityTypeID); err != nil {
+		return fmt.Errorf("entityTypeId: %w", err)
+	}
+	if bs.CategoryID, err = decodeInt(aux.CategoryID); err != nil {
+		return fmt.Errorf("categoryId: %w", err)
+	}
+	if bs.CompanyID, err = decodeInt(aux.CompanyID); err != nil {
+		return fmt.Errorf("companyId: %w", err)
+	}
+	if bs.ParentCompanyID, err = decodeInt(aux.ParentCompanyID); err != nil {
+		return fmt.Errorf("parentId4: %w", err)
+	}
+	if bs.AssignedByID, err = decodeInt(aux.AssignedByID); err != nil {
+		return fmt.Errorf("assignedById: %w", err)
+	}
+	if bs.CreatedTime, err = models.ParseBitrixTime(aux.CreatedTime); err != nil {
+		return fmt.Errorf("createdTime: %w", err)
+	}
+	if bs.UpdatedTime, err = models.ParseBitrixTime(aux.UpdatedTime); err != nil {
+		return fmt.Errorf("updatedTime: %w", err)
+	}
+
+	textFields := []struct {
+		raw  json.RawMessage
+		dest *string
+		name string
+	}{
+		{aux.DNI, &bs.DNI, "ufCrm55Dni"},
+		{aux.Cargo, &bs.Cargo, "ufCrm55Cargo"},
+		{aux.Administrador, &bs.Administrador, "ufCrm55Admin"},
+		{aux.Participacion, &bs.Participacion, "ufCrm55Participacion"},
+		{aux.RazonSocialEmpleado, &bs.RazonSocialEmpleado, "ufCrm55RazonSocial"},
+	}
+	for _, f := range textFields {
+		if *f.dest, err = decodeString(f.raw); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+
+	bs.Administrador = normalizeYN(bs.Administrador)
+	bs.Participacion = normalizeDecimal(bs.Participacion)
+	return nil
+}
+
+// listItems decodes the items of a list response one by one, skipping (with
+// a warning) any item that fails to decode instead of failing the whole list.
+func (c *Client) listItems(result *BitrixListResponse) []BitrixSocio {
+	if result.Result == nil {
+		return nil
+	}
+
+	socios := make([]BitrixSocio, 0, len(result.Result.Items))
+	for i, raw := range result.Result.Items {
+		socio, err := c.decodeSocio(raw)
+		if err != nil {
+			c.warn(WarnUndecodable, "", "Skipping undecodable Bitrix item #%d: %v", i, err)
+			continue
+		}
+		socios = append(socios, socio)
+	}
+	return socios
+}
+
+// decodeSocio decodes an item using the client's field mapping.
+func (c *Client) decodeSocio(raw json.RawMessage) (BitrixSocio, error) {
+	var socio BitrixSocio
+	raw, err := c.fields.canonical(raw)
+	if err != nil {
+		return socio, err
+	}
+	if err := json.Unmarshal(raw, &socio); err != nil {
+		return socio, err
+	}
+
+	if c.activeField == "" && c.empresaField == "" {
+		return socio, nil
+	}
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return socio, err
+	}
+
+	if c.activeField != "" {
+		value, err := decodeString(item[c.activeField])
+		if err != nil {
+			return socio, fmt.Errorf("%s: %w", c.activeField, err)
+		}
+		if value != "" {
+			socio.Active = c.activeFlags.normalize(value)
+		}
+	}
+	if c.empresaField != "" {
+		socio.Empresa, err = decodeInt(item[c.empresaField])
+		if err != nil {
+			return socio, fmt.Errorf("%s: %w", c.empresaField, err)
+		}
+	}
+	return socio, nil
+}
+
+// decodeInt decodes a JSON number or numeric string; missing, null and empty
+// values decode to 0.
+func decodeInt(raw json.RawMessage) (int, error) {
+	s, err := decodeString(raw)
+	if err != nil || s == "" {
+		return 0, err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("not an integer: %q", s)
+	}
+	return n, nil
+}
+
+// decodeString decodes any JSON scalar into its string form. Booleans become
+// "true"/"false"; null and missing values become "".
+func decodeString(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case '{', '[':
+		return "", fmt.Errorf("unexpected structured value %s", string(raw))
+	default:
+		// Numbers and booleans keep their literal text.
+		return string(raw), nil
+	}
+}
+
+// normalizeYN maps the boolean representations Bitrix24 uses to "Y"/"N".
+// Values that aren't recognizably boolean are returned unchanged.
+func normalizeYN(v string) string {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "y", "yes", "1", "true", "s", "si", "sí":
+		return "Y"
+	case "n", "no", "0", "false", "":
+		return "N"
+	}
+	return v
+}
+
+// normalizeDecimal formats numeric values with two decimals, matching what
+// the sync sends. Non-numeric values are returned unchanged.
+func normalizeDecimal(v string) string {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return v
+	}
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
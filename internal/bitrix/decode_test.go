@@ -0,0 +1,104 @@
+package bitrix
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDecodeSocioTimes(t *testing.T) {
+	client := newTestClient(t, nil)
+	tests := []struct {
+		raw              string
+		created, updated *time.Time
+	}{
+		{`{"id":1,"createdTime":"2024-05-03T12:30:00+02:00","updatedTime":"2024-06-01T08:00:00+02:00"}`,
+			ptrTime(time.Date(2024, 5, 3, 10, 30, 0, 0, time.UTC)), ptrTime(time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC))},
+		{`{"id":1,"createdTime":"2024-05-03 10:30:00"}`, ptrTime(time.Date(2024, 5, 3, 10, 30, 0, 0, time.UTC)), nil},
+		{`{"id":1,"createdTime":null,"updatedTime":""}`, nil, nil},
+		{`{"id":1}`, nil, nil},
+	}
+	for _, tt := range tests {
+		socio, err := client.decodeSocio(json.RawMessage(tt.raw))
+		if err != nil {
+			t.Errorf("decodeSocio(%s): %v", tt.raw, err)
+			continue
+		}
+		if !sameTime(socio.CreatedTime, tt.created) || !sameTime(socio.UpdatedTime, tt.updated) {
+			t.Errorf("decodeSocio(%s) times = %v, %v, want %v, %v", tt.raw, socio.CreatedTime, socio.UpdatedTime, tt.created, tt.updated)
+		}
+	}
+}
+
+func ptrTime(t time.Time) *time.Time { return &t }
+
+// sameTime reports whether a and b are both nil or the same instant.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func TestDecodeSocioVariants(t *testing.T) {
+	client := newTestClient(t, nil)
+	tests := []struct {
+		name string
+		raw  string
+		want BitrixSocio
+	}{
+		{"numbers", `{"id":12,"entityTypeId":130,"categoryId":0,"ufCrm55Admin":"Y","ufCrm55Participacion":25.5,"companyId":4}`,
+			BitrixSocio{ID: 12, EntityTypeID: 130, Administrador: "Y", Participacion: "25.50", CompanyID: 4}},
+		{"strings", `{"id":"12","entityTypeId":"130","categoryId":"3","ufCrm55Admin":"N","ufCrm55Participacion":"25.5","companyId":"4"}`,
+			BitrixSocio{ID: 12, EntityTypeID: 130, CategoryID: 3, Administrador: "N", Participacion: "25.50", CompanyID: 4}},
+		{"admin true", `{"id":1,"ufCrm55Admin":true}`, BitrixSocio{ID: 1, Administrador: "Y"}},
+		{"admin false", `{"id":1,"ufCrm55Admin":false}`, BitrixSocio{ID: 1, Administrador: "N"}},
+		{"admin 1", `{"id":1,"ufCrm55Admin":1}`, BitrixSocio{ID: 1, Administrador: "Y"}},
+		{"admin \"0\"", `{"id":1,"ufCrm55Admin":"0"}`, BitrixSocio{ID: 1, Administrador: "N"}},
+		{"nulls", `{"id":1,"companyId":null,"ufCrm55Admin":null,"ufCrm55Participacion":null,"ufCrm55Dni":null}`,
+			BitrixSocio{ID: 1, Administrador: "N"}},
+		{"empty strings", `{"id":1,"companyId":"","ufCrm55Participacion":""}`, BitrixSocio{ID: 1, Administrador: "N"}},
+		{"text", `{"id":1,"ufCrm55Dni":"12345678Z","ufCrm55Cargo":"Consejero","ufCrm55RazonSocial":"García López, Ana"}`,
+			BitrixSocio{ID: 1, DNI: "12345678Z", Cargo: "Consejero", RazonSocialEmpleado: "García López, Ana", Administrador: "N"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.decodeSocio(json.RawMessage(tt.raw))
+			if err != nil {
+				t.Fatalf("decodeSocio(%s): %v", tt.raw, err)
+			}
+			if got.ID != tt.want.ID || got.EntityTypeID != tt.want.EntityTypeID || got.CategoryID != tt.want.CategoryID ||
+				got.CompanyID != tt.want.CompanyID || got.Administrador != tt.want.Administrador ||
+				got.Participacion != tt.want.Participacion || got.DNI != tt.want.DNI || got.Cargo != tt.want.Cargo ||
+				got.RazonSocialEmpleado != tt.want.RazonSocialEmpleado {
+				t.Errorf("decodeSocio(%s) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSocioInvalid(t *testing.T) {
+	client := newTestClient(t, nil)
+	for _, raw := range []string{`{"id":"twelve"}`, `{"id":1.5}`, `{"id":1,"companyId":{"id":4}}`, `{"id":1,"ufCrm55Dni":["12345678Z"]}`} {
+		if _, err := client.decodeSocio(json.RawMessage(raw)); err == nil {
+			t.Errorf("decodeSocio(%s) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestListItemsSkipsUndecodable(t *testing.T) {
+	client := newTestClient(t, nil)
+	var response BitrixListResponse
+	if err := json.Unmarshal([]byte(`{"result":{"items":[{"id":1},{"id":"broken"},{"id":"3"}]}}`), &response); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	socios := client.listItems(&response)
+	if len(socios) != 2 || socios[0].ID != 1 || socios[1].ID != 3 {
+		t.Errorf("listItems = %+v, want items 1 and 3", socios)
+	}
+	warnings := client.Warnings()
+	if len(warnings) != 1 || warnings[0].Code != WarnUndecodable {
+		t.Errorf("Warnings() = %+v, want one %s", warnings, WarnUndecodable)
+	}
+}
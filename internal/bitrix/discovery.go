@@ -0,0 +1,280 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EntityType describes a Smart Process found during discovery.
+type EntityType struct {
+	ID       int      `json:"entity_type_id"`
+	Title    string   `json:"title"`
+	UFFields []string `json:"uf_fields"`
+}
+
+// DiscoveryResult holds what discovery learned about a portal.
+type DiscoveryResult struct {
+	Portal       string       `json:"portal"`
+	EntityTypes  []EntityType `json:"entity_types"`
+	SociosTypeID int          `json:"socios_entity_type_id"` // 0 if no type has our DNI field
+	DiscoveredAt time.Time    `json:"discovered_at"`
+}
+
+// bitrixTypeListResponse represents the crm.type.list response.
+type bitrixTypeListResponse struct {
+	Result *struct {
+		Types []struct {
+			EntityTypeID int    `json:"entityTypeId"`
+			Title        string `json:"title"`
+		} `json:"types"`
+	} `json:"result"`
+	Error *struct {
+		ErrorCode        string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	} `json:"error"`
+}
+
+// DiscoverEntityTypes lists the portal's Smart Processes with their UF fields
+// and identifies the one holding socios.
+func (c *Client) DiscoverEntityTypes(ctx context.Context) (*DiscoveryResult, error) {
+	c.logger.Printf("🔍 Discovering available Bitrix24 entity types...")
+
+	result := &DiscoveryResult{
+		Portal:       c.PortalHost(),
+		DiscoveredAt: time.Now(),
+	}
+
+	var types bitrixTypeListResponse
+	err := c.doJSONRequest(ctx, "/crm.type.list", map[string]interface{}{}, &types)
+	if err == nil && (types.Error == nil || types.Error.ErrorCode == "") && types.Result != nil {
+		for _, t := range types.Result.Types {
+			result.EntityTypes = append(result.EntityTypes, EntityType{ID: t.EntityTypeID, Title: t.Title})
+		}
+	} else {
+		if err == nil && types.Error != nil {
+			err = &APIError{Code: types.Error.ErrorCode, Description: types.Error.ErrorDescription}
+		}
+		c.logger.Printf("⚠️  Could not list entity types via API: %v", err)
+
+		id, err := c.tryCommonEntityTypes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result.EntityTypes = append(result.EntityTypes, EntityType{ID: id})
+	}
+
+	// Collect UF fields so we can tell which type is the socios one.
+	dniField := c.fields.DNI
+	for i := range result.EntityTypes {
+		et := &result.EntityTypes[i]
+
+		fields, err := c.getFieldsFor(ctx, et.ID)
+		if err != nil {
+			c.logger.Printf("⚠️  Could not get fields for entity type %d: %v", et.ID, err)
+			continue
+		}
+
+		for code := range fields {
+			if strings.HasPrefix(code, "ufCrm") {
+				et.UFFields = append(et.UFFields, code)
+			}
+		}
+		sort.Strings(et.UFFields)
+
+		if result.SociosTypeID == 0 && containsString(et.UFFields, dniField) {
+			result.SociosTypeID = et.ID
+		}
+
+		c.logger.Printf("✅ Entity type %d (%s): %d UF fields", et.ID, et.Title, len(et.UFFields))
+	}
+
+	if result.SociosTypeID != 0 {
+		c.logger.Printf("✅ Socios entity type identified: %d", result.SociosTypeID)
+	} else {
+		c.logger.Printf("⚠️  No entity type has the %s field", dniField)
+	}
+
+	return result, nil
+}
+
+// tryCommonEntityTypes tests common entity type IDs and returns the first
+// one the portal accepts.
+func (c *Client) tryCommonEntityTypes(ctx context.Context) (int, error) {
+	c.logger.Printf("🔍 Testing common entity type IDs...")
+
+	// Common entity type IDs for different Bitrix24 setups
+	commonEntityTypes := []int{
+		// Smart Process IDs (most common)
+		128, 130, 132, 134, 136, 138, 140, 142, 144, 146, 148, 150,
+
+		// Some installations use lower numbers
+		1, 2, 3, 4, 5, 10, 15, 20, 25, 30, 35, 40, 45, 50, 55, 60,
+
+		// Try some higher numbers
+		100, 102, 104, 106, 108, 110, 112, 114, 116, 118, 120, 122, 124, 126,
+	}
+
+	for _, entityTypeID := range commonEntityTypes {
+		c.logger.Printf("🧪 Testing entity type ID: %d", entityTypeID)
+
+		testBody := map[string]interface{}{
+			"entityTypeId": entityTypeID,
+			"order":        defaultOrder(),
+			"start":        0,
+			"limit":        1,
+		}
+
+		var result BitrixListResponse
+		err := c.doJSONRequest(ctx, "/crm.item.list", testBody, &result)
+
+		if err != nil {
+			if strings.Contains(err.Error(), "ENTITY_TYPE_NOT_SUPPORTED") {
+				c.logger.Printf("❌ Entity type %d not supported", entityTypeID)
+				continue
+			}
+			c.logger.Printf("⚠️  Entity type %d error: %v", entityTypeID, err)
+			continue
+		}
+
+		// Check for API errors
+		if err := c.checkBitrixError(&result); err != nil {
+			if strings.Contains(err.Error(), "ENTITY_TYPE_NOT_SUPPORTED") {
+				c.logger.Printf("❌ Entity type %d not supported", entityTypeID)
+				continue
+			}
+			c.logger.Printf("⚠️  Entity type %d API error: %v", entityTypeID, err)
+			continue
+		}
+
+		// Success! This entity type works
+		c.logger.Printf("✅ FOUND WORKING ENTITY TYPE: %d", entityTypeID)
+		return entityTypeID, nil
+	}
+
+	c.logger.Printf("❌ No working entity types found. You may need to:")
+	c.logger.Printf("   1. Create a Smart Process in Bitrix24 first")
+	c.logger.Printf("   2. Use standard CRM entities (contacts, companies)")
+	c.logger.Printf("   3. Check your webhook permissions")
+
+	return 0, fmt.Errorf("no supported entity types found")
+}
+
+// DiscoveryCache persists discovery results per portal hostname in a JSON file.
+type DiscoveryCache struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewDiscoveryCache creates a cache backed by the file at path.
+func NewDiscoveryCache(path string) *DiscoveryCache {
+	return &DiscoveryCache{path: path}
+}
+
+// Get returns the cached result for a portal, or nil if none is stored.
+func (dc *DiscoveryCache) Get(portal string) (*DiscoveryResult, error) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	entries, err := dc.load()
+	if err != nil {
+		return nil, err
+	}
+	return entries[portal], nil
+}
+
+// Put stores a discovery result under its portal hostname.
+func (dc *DiscoveryCache) Put(result *DiscoveryResult) error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	entries, err := dc.load()
+	if err != nil {
+		return err
+	}
+	entries[result.Portal] = result
+	return dc.save(entries)
+}
+
+// Invalidate removes the cached result for a portal.
+func (dc *DiscoveryCache) Invalidate(portal string) error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	entries, err := dc.load()
+	if err != nil {
+		return err
+	}
+	delete(entries, portal)
+	return dc.save(entries)
+}
+
+// load reads the cache file; a missing file is an empty cache.
+func (dc *DiscoveryCache) load() (map[string]*DiscoveryResult, error) {
+	entries := make(map[string]*DiscoveryResult)
+
+	data, err := os.ReadFile(dc.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return entries, nil
+		}
+		return nil, fmt.Errorf("failed to read discovery cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse discovery cache %s: %w", dc.path, err)
+	}
+	return entries, nil
+}
+
+// save writes the cache file atomically.
+func (dc *DiscoveryCache) save(entries map[string]*DiscoveryResult) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal discovery cache: %w", err)
+	}
+
+	tmp := dc.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write discovery cache: %w", err)
+	}
+	return os.Rename(tmp, dc.path)
+}
+
+// ResolveEntityType picks the socios entity type from the cache, running
+// discovery and caching the result on a miss. The client keeps its current
+// entity type if discovery cannot identify one.
+func (c *Client) ResolveEntityType(ctx context.Context, cache *DiscoveryCache) (int, error) {
+	portal := c.PortalHost()
+
+	cached, err := cache.Get(portal)
+	if err != nil {
+		return 0, err
+	}
+	if cached != nil && cached.SociosTypeID != 0 {
+		c.logger.Printf("📋 Using cached entity type %d for %s", cached.SociosTypeID, portal)
+		c.entityTypeID = cached.SociosTypeID
+		return c.entityTypeID, nil
+	}
+
+	result, err := c.DiscoverEntityTypes(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("entity type discovery failed: %w", err)
+	}
+	if err := cache.Put(result); err != nil {
+		c.logger.Printf("⚠️  Could not save discovery cache: %v", err)
+	}
+
+	if result.SociosTypeID != 0 {
+		c.entityTypeID = result.SociosTypeID
+	} else {
+		c.logger.Printf("⚠️  Falling back to entity type %d", c.entityTypeID)
+	}
+	return c.entityTypeID, nil
+}
@@ -0,0 +1,48 @@
+package bitrix
+
+import (
+	"fmt"
+	"strings"
+)
+
+// empresaFieldTypes are the field types the Sage CodigoEmpresa can be stored in.
+var empresaFieldTypes = []string{"integer", "string"}
+
+// validateEmpresaField checks the empresa field's definition, returning a
+// problem description or "".
+func (c *Client) validateEmpresaField(fields map[string]FieldInfo) string {
+	info, exists := fields[c.empresaField]
+	if !exists {
+		return fmt.Sprintf("%s (missing)", c.empresaField)
+	}
+	if !containsString(empresaFieldTypes, info.Type) {
+		return fmt.Sprintf("%s (type %q, expected one of %s)",
+			c.empresaField, info.Type, strings.Join(empresaFieldTypes, "/"))
+	}
+	return ""
+}
+
+// OwnsSocio reports whether an item belongs to the empresa this client syncs.
+// Items without a recorded empresa, synced before the field was configured,
+// are claimed by any empresa.
+func (c *Client) OwnsSocio(bs *BitrixSocio) bool {
+	return c.empresaCode == 0 || bs.Empresa == 0 || bs.Empresa == c.empresaCode
+}
+
+// ownedSocio picks the item of this client's empresa among items sharing a
+// DNI, preferring one that records the empresa over an unclaimed one.
+func (c *Client) ownedSocio(socios []BitrixSocio) *BitrixSocio {
+	var unclaimed *BitrixSocio
+	for i := range socios {
+		if !c.OwnsSocio(&socios[i]) {
+			continue
+		}
+		if socios[i].Empresa != 0 || c.empresaCode == 0 {
+			return &socios[i]
+		}
+		if unclaimed == nil {
+			unclaimed = &socios[i]
+		}
+	}
+	return unclaimed
+}
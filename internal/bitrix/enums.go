@@ -0,0 +1,171 @@
+package bitrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownEnumValue is returned when a value has no matching item in an
+// enumeration field. Items can't be added through the webhook, so the list
+// has to be extended in Bitrix24.
+var ErrUnknownEnumValue = errors.New("value not in enumeration field")
+
+// enumMapping translates between the labels and item IDs of one enumeration field.
+type enumMapping struct {
+	labelByID map[string]string
+	idByLabel map[string]string // Keyed by lowercased label
+}
+
+// newEnumMapping builds the mapping from a field's list items.
+func newEnumMapping(items []EnumItem) enumMapping {
+	m := enumMapping{
+		labelByID: make(map[string]string, len(items)),
+		idByLabel: make(map[string]string, len(items)),
+	}
+	for _, item := range items {
+		id := item.ID.String()
+		m.labelByID[id] = item.Value
+		m.idByLabel[strings.ToLower(strings.TrimSpace(item.Value))] = id
+	}
+	return m
+}
+
+// labels returns the field's labels, sorted, for error messages.
+func (m enumMapping) labels() []string {
+	labels := make([]string, 0, len(m.labelByID))
+	for _, label := range m.labelByID {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// enumCacheTTL is how long enumCache serves a portal's mappings before they
+// are fetched again, so items added in Bitrix24 reach a long-running service.
+const enumCacheTTL = time.Hour
+
+// enumCache keeps the enumeration mappings per portal and entity type, so
+// clients created for later runs don't need to fetch field definitions again.
+var enumCache = struct {
+	mu sync.Mutex
+	m  map[string]cachedEnums
+}{m: make(map[string]cachedEnums)}
+
+// cachedEnums is an enumCache entry.
+type cachedEnums struct {
+	enums    map[string]enumMapping
+	loadedAt time.Time
+}
+
+// ResetEnumCache drops the enumeration mappings cached for every portal, so
+// the next client fetches them from the field definitions again.
+func ResetEnumCache() {
+	enumCache.mu.Lock()
+	defer enumCache.mu.Unlock()
+	enumCache.m = make(map[string]cachedEnums)
+}
+
+// enumCacheKey identifies the client's portal and entity type in enumCache.
+func (c *Client) enumCacheKey() string {
+	return c.PortalHost() + "/" + strconv.Itoa(c.entityTypeID)
+}
+
+// setEnums records the enumeration mappings of the mapped fields (other than
+// the admin flag, see setFlagMapping) from their definitions.
+func (c *Client) setEnums(fields map[string]FieldInfo) {
+	c.enumsMu.Lock()
+	defer c.enumsMu.Unlock()
+	c.storeEnums(fields)
+}
+
+// storeEnums is setEnums for callers holding enumsMu.
+func (c *Client) storeEnums(fields map[string]FieldInfo) {
+	enums := make(map[string]enumMapping)
+	for _, code := range c.fields.codes() {
+		info, ok := fields[code]
+		if !ok || FieldKind(info.Type) != KindEnum || code == c.fields.Admin {
+			continue
+		}
+		enums[code] = newEnumMapping(info.Items)
+	}
+
+	c.enums = enums
+	enumCache.mu.Lock()
+	enumCache.m[c.enumCacheKey()] = cachedEnums{enums: enums, loadedAt: time.Now()}
+	enumCache.mu.Unlock()
+}
+
+// ensureEnums loads the enumeration mappings from the cache, or from the
+// portal's field definitions, if ValidateFields hasn't set them yet. Workers
+// calling it at once on a cold cache wait for a single fetch.
+func (c *Client) ensureEnums(ctx context.Context) error {
+	c.enumsMu.Lock()
+	defer c.enumsMu.Unlock()
+	if c.enums != nil {
+		return nil
+	}
+
+	enumCache.mu.Lock()
+	cached, ok := enumCache.m[c.enumCacheKey()]
+	enumCache.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < enumCacheTTL {
+		c.enums = cached.enums
+		return nil
+	}
+
+	fields, err := c.GetFields(ctx)
+	if err != nil {
+		return err
+	}
+	c.storeEnums(fields)
+	return nil
+}
+
+// enumsFor returns the mapping of an enumeration field, if code is one.
+func (c *Client) enumsFor(code string) (enumMapping, bool) {
+	c.enumsMu.Lock()
+	defer c.enumsMu.Unlock()
+	m, ok := c.enums[code]
+	return m, ok
+}
+
+// enumLabel translates a stored enumeration item ID to its label; other
+// values are returned unchanged.
+func (c *Client) enumLabel(code, value string) string {
+	if m, ok := c.enumsFor(code); ok {
+		if label, ok := m.labelByID[value]; ok {
+			return label
+		}
+	}
+	return value
+}
+
+// enumValue translates a label to the item ID to send for an enumeration
+// field. Values of other fields are returned unchanged.
+func (c *Client) enumValue(code, label string) (string, error) {
+	m, ok := c.enumsFor(code)
+	if !ok {
+		return label, nil
+	}
+	if id, ok := m.idByLabel[strings.ToLower(strings.TrimSpace(label))]; ok {
+		return id, nil
+	}
+	return "", fmt.Errorf("%w %s: %q (available: %s)",
+		ErrUnknownEnumValue, code, label, strings.Join(m.labels(), ", "))
+}
+
+// enumCanonical returns the enumeration's own spelling of a label, so that
+// labels differing only in case or spacing compare equal.
+func (c *Client) enumCanonical(code, label string) string {
+	id, err := c.enumValue(code, label)
+	if err != nil {
+		return label
+	}
+	return c.enumLabel(code, id)
+}
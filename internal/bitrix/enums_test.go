@@ -0,0 +1,124 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// enumPortal is a portal whose cargo field is an enumeration, recording the
+// field definition fetches and the cargo values written.
+type enumPortal struct {
+	fieldFetches atomic.Int32
+
+	mu     sync.Mutex
+	cargos []string
+}
+
+func (p *enumPortal) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch method := strings.TrimPrefix(req.URL.Path[strings.LastIndex(req.URL.Path, "/"):], "/"); method {
+	case "crm.item.fields":
+		p.fieldFetches.Add(1)
+		return jsonResponse(`{"result":{"fields":{"ufCrm55Cargo":{"type":"enumeration","items":[` +
+			`{"ID":"71","VALUE":"Administrador Único"},{"ID":"72","VALUE":"Consejero"}]}}}}`), nil
+
+	case "crm.item.add", "crm.item.update":
+		var body struct {
+			Fields map[string]interface{} `json:"fields"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		p.cargos = append(p.cargos, fmt.Sprint(body.Fields["ufCrm55Cargo"]))
+		p.mu.Unlock()
+		return jsonResponse(`{"result":{"item":{"id":1}}}`), nil
+
+	default:
+		return nil, fmt.Errorf("unexpected request to %s", method)
+	}
+}
+
+// TestEnumsConcurrentWorkers runs creating and updating workers on a cold
+// enumeration cache; run with -race to check the mappings are shared safely.
+func TestEnumsConcurrentWorkers(t *testing.T) {
+	portal := &enumPortal{}
+	client := newTestClient(t, portal, WithRateLimit(0, 0))
+	ctx := context.Background()
+
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			socio := &models.Socio{CodigoEmpresa: 1, DNI: fmt.Sprintf("%08dZ", i), CargoAdministrador: "administrador único"}
+			if _, err := client.CreateSocio(ctx, socio); err != nil {
+				errs <- err
+			}
+			if err := client.UpdateSocio(ctx, i+1, socio); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if got := portal.fieldFetches.Load(); got != 1 {
+		t.Errorf("field definitions fetched %d times, want once for all workers", got)
+	}
+	if len(portal.cargos) != 2*workers {
+		t.Fatalf("%d socios written, want %d", len(portal.cargos), 2*workers)
+	}
+	for _, cargo := range portal.cargos {
+		if cargo != "71" {
+			t.Errorf("cargo written as %q, want the item ID 71", cargo)
+		}
+	}
+}
+
+func TestEnumCacheExpiry(t *testing.T) {
+	portal := &enumPortal{}
+	ctx := context.Background()
+	ensure := func() {
+		t.Helper()
+		if err := newTestClient(t, portal, WithRateLimit(0, 0)).ensureEnums(ctx); err != nil {
+			t.Fatalf("ensureEnums: %v", err)
+		}
+	}
+
+	ensure()
+	ensure()
+	if got := portal.fieldFetches.Load(); got != 1 {
+		t.Fatalf("field definitions fetched %d times, want once: the second client uses the cache", got)
+	}
+
+	key := newTestClient(t, portal).enumCacheKey()
+	enumCache.mu.Lock()
+	entry := enumCache.m[key]
+	entry.loadedAt = time.Now().Add(-enumCacheTTL)
+	enumCache.m[key] = entry
+	enumCache.mu.Unlock()
+	ensure()
+	if got := portal.fieldFetches.Load(); got != 2 {
+		t.Errorf("field definitions fetched %d times, want a refetch of the expired mappings", got)
+	}
+
+	ResetEnumCache()
+	ensure()
+	if got := portal.fieldFetches.Load(); got != 3 {
+		t.Errorf("field definitions fetched %d times, want a refetch after ResetEnumCache", got)
+	}
+}
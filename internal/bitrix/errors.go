@@ -0,0 +1,139 @@
+package bitrix
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// Errors caused by the network path rather than the portal itself, so support
+// can tell a misconfigured proxy or firewall apart from a Bitrix24 failure.
+var (
+	ErrProxyAuth       = errors.New("proxy authentication failed")
+	ErrProxyConnect    = errors.New("proxy connection failed")
+	ErrTLSVerification = errors.New("TLS certificate verification failed")
+)
+
+// ErrPortalUnavailable is returned when the portal answers 503 (usually a
+// maintenance window) or resets the connection. It is transient: the whole run
+// should be retried later rather than continued item by item.
+var ErrPortalUnavailable = errors.New("Bitrix24 portal unavailable")
+
+// ErrUnexpectedResponse is returned when the endpoint answers with something
+// other than JSON, typically an HTML page from a firewall or edge node.
+var ErrUnexpectedResponse = errors.New("unexpected non-JSON response")
+
+// maxSnippet is how much of an unexpected body is kept for the error message.
+const maxSnippet = 200
+
+// UnexpectedResponseError describes a non-JSON response.
+type UnexpectedResponseError struct {
+	StatusCode  int
+	ContentType string
+	Snippet     string // Start of the body, truncated to maxSnippet bytes
+}
+
+func (e *UnexpectedResponseError) Error() string {
+	return fmt.Sprintf("%v: status %d, content type %q: %s",
+		ErrUnexpectedResponse, e.StatusCode, e.ContentType, e.Snippet)
+}
+
+// Is makes errors.Is(err, ErrUnexpectedResponse) match.
+func (e *UnexpectedResponseError) Is(target error) bool {
+	return target == ErrUnexpectedResponse
+}
+
+// newUnexpectedResponse builds an UnexpectedResponseError from the start of a body.
+func newUnexpectedResponse(statusCode int, contentType string, body []byte) *UnexpectedResponseError {
+	snippet := strings.Join(strings.Fields(string(body)), " ")
+	if len(snippet) > maxSnippet {
+		snippet = strings.ToValidUTF8(snippet[:maxSnippet], "") + "..."
+	}
+	return &UnexpectedResponseError{StatusCode: statusCode, ContentType: contentType, Snippet: snippet}
+}
+
+// looksLikeJSON reports whether a response with this content type and body
+// start can be JSON. Bitrix24 sometimes omits or mislabels the content type,
+// so only an explicit HTML type or a body starting with '<' rules it out.
+func looksLikeJSON(contentType string, body []byte) bool {
+	if strings.Contains(strings.ToLower(contentType), "html") {
+		return false
+	}
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) == 0 || trimmed[0] != '<'
+}
+
+// ErrNotFound is returned when a requested item does not exist in Bitrix24.
+var ErrNotFound = errors.New("item not found")
+
+// APIError is an error reported by the Bitrix24 REST API itself.
+type APIError struct {
+	StatusCode  int
+	Code        string // e.g. "NOT_FOUND", "QUERY_LIMIT_EXCEEDED"
+	Description string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Bitrix24 API error: %s - %s", e.Code, e.Description)
+}
+
+// isAPIErrorCode reports whether err is an APIError with the given code.
+func isAPIErrorCode(err error, code string) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// IsRetryable reports whether a failed call may succeed if made again shortly:
+// timeouts, dropped connections, non-JSON pages from edge nodes, server errors
+// and exhausted limits. Validation errors, missing items and fields are not.
+func IsRetryable(err error) bool {
+	var netErr net.Error
+	var apiErr *APIError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, ErrPortalUnavailable),
+		errors.Is(err, ErrUnexpectedResponse):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	case errors.As(err, &apiErr):
+		return apiErr.StatusCode >= http.StatusInternalServerError ||
+			apiErr.Code == "QUERY_LIMIT_EXCEEDED" || apiErr.Code == "OPERATION_TIME_LIMIT"
+	}
+	return false
+}
+
+// classifyTransportError wraps errors returned by http.Client.Do with one of
+// the sentinel errors above when the cause can be identified.
+func classifyTransportError(err error) error {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		invalidCert      x509.CertificateInvalidError
+		hostnameErr      x509.HostnameError
+		verifyErr        *tls.CertificateVerificationError
+	)
+
+	switch {
+	case errors.As(err, &unknownAuthority), errors.As(err, &invalidCert),
+		errors.As(err, &hostnameErr), errors.As(err, &verifyErr):
+		return fmt.Errorf("%w: %v", ErrTLSVerification, err)
+	case strings.Contains(err.Error(), "Proxy Authentication Required"):
+		return fmt.Errorf("%w: %v", ErrProxyAuth, err)
+	case strings.Contains(err.Error(), "proxyconnect"):
+		return fmt.Errorf("%w: %v", ErrProxyConnect, err)
+	case errors.Is(err, syscall.ECONNRESET):
+		return fmt.Errorf("%w: %v", ErrPortalUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// exportHeader is the header row written by ExportSocios.
+var exportHeader = []string{
+	"bitrix_id", "title", "dni", "cargo", "administrador", "participacion",
+	"created_time", "updated_time",
+}
+
+// ExportSocios pages through every socio in Bitrix24 and writes them to w as
+// CSV, one page at a time rather than buffering the whole portal. It returns
+// the number of rows written, excluding the header.
+func (c *Client) ExportSocios(ctx context.Context, w io.Writer, opts ...ListOption) (int, error) {
+	c.logger.Printf("📤 Exporting socios from Bitrix24 as CSV...")
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportHeader); err != nil {
+		return 0, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	rows := 0
+	err := c.eachSocioPage(ctx, newListParams(opts), func(page []BitrixSocio) error {
+		for _, socio := range page {
+			record := []string{
+				strconv.Itoa(socio.ID),
+				socio.Title,
+				socio.DNI,
+				socio.Cargo,
+				socio.Administrador,
+				socio.Participacion,
+				formatExportTime(socio.CreatedTime),
+				formatExportTime(socio.UpdatedTime),
+			}
+			if err := cw.Write(record); err != nil {
+				return fmt.Errorf("failed to write CSV row: %w", err)
+			}
+			rows++
+		}
+
+		// Flush per page so the output streams.
+		cw.Flush()
+		return cw.Error()
+	})
+	if err != nil {
+		return rows, err
+	}
+
+	c.logger.Printf("✅ Exported %d socios", rows)
+	return rows, nil
+}
+
+// formatExportTime formats an optional timestamp as RFC 3339, or "" if unset.
+func formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,266 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// FieldKind is how a field's value is represented in Bitrix24.
+type FieldKind string
+
+const (
+	KindString  FieldKind = "string"
+	KindBoolean FieldKind = "boolean"     // Stored as 1/0, read back as "1"/"0" or "Y"/"N"
+	KindEnum    FieldKind = "enumeration" // Stored as the ID of a list item
+)
+
+// FieldSpec describes a Bitrix24 field the sync writes to.
+type FieldSpec struct {
+	Code  string    // Bitrix field code as used in crm.item.* requests
+	Types []string  // Bitrix field types we know how to write
+	Kind  FieldKind // Assumed representation until ValidateFields reads the portal's
+}
+
+// FieldMapping holds the Bitrix24 field codes socio attributes are stored in.
+type FieldMapping struct {
+	DNI           string `json:"dni"`
+	Cargo         string `json:"cargo"`
+	Admin         string `json:"admin"`
+	Participacion string `json:"participacion"`
+	RazonSocial   string `json:"razon_social"`
+}
+
+// DefaultFieldMapping is the layout of the original socios Smart Process.
+var DefaultFieldMapping = FieldMapping{
+	DNI:           "ufCrm55Dni",
+	Cargo:         "ufCrm55Cargo",
+	Admin:         "ufCrm55Admin",
+	Participacion: "ufCrm55Participacion",
+	RazonSocial:   "ufCrm55RazonSocial",
+}
+
+// Logical socio fields an update compares and writes, for WithSyncedFields.
+const (
+	SyncFieldTitle         = "title"
+	SyncFieldCargo         = models.FieldCargo
+	SyncFieldAdministrador = models.FieldAdministrador
+	SyncFieldParticipacion = models.FieldParticipacion
+	SyncFieldRazonSocial   = "razon_social"
+)
+
+// SyncableFields lists every logical field, the default set.
+var SyncableFields = []string{SyncFieldTitle, SyncFieldCargo, SyncFieldAdministrador, SyncFieldParticipacion, SyncFieldRazonSocial}
+
+// codes returns the field codes in SocioFields order.
+func (m FieldMapping) codes() []string {
+	return []string{m.DNI, m.Cargo, m.Admin, m.Participacion, m.RazonSocial}
+}
+
+// withDefaults fills empty codes from DefaultFieldMapping.
+func (m FieldMapping) withDefaults() FieldMapping {
+	codes := m.codes()
+	defaults := DefaultFieldMapping.codes()
+	for i := range codes {
+		if codes[i] == "" {
+			codes[i] = defaults[i]
+		}
+	}
+	return FieldMapping{codes[0], codes[1], codes[2], codes[3], codes[4]}
+}
+
+// canonical rewrites an item's mapped field codes to the default ones, so
+// that BitrixSocio can decode items from portals with a custom mapping.
+func (m FieldMapping) canonical(raw json.RawMessage) (json.RawMessage, error) {
+	if m == DefaultFieldMapping {
+		return raw, nil
+	}
+
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return nil, err
+	}
+
+	defaults := DefaultFieldMapping.codes()
+	mapped := m.codes()
+	values := make([]json.RawMessage, len(mapped))
+	for i, code := range mapped {
+		values[i] = item[code]
+	}
+	for i, code := range defaults {
+		delete(item, code)
+		if values[i] != nil {
+			item[code] = values[i]
+		}
+	}
+	return json.Marshal(item)
+}
+
+// SocioFields lists the UF fields mapped from Sage socios, with the codes of
+// DefaultFieldMapping.
+var SocioFields = []FieldSpec{
+	{Code: "ufCrm55Dni", Types: []string{"string"}, Kind: KindString},
+	{Code: "ufCrm55Cargo", Types: []string{"string", "enumeration"}, Kind: KindString},
+	{Code: "ufCrm55Admin", Types: []string{"string", "boolean", "enumeration"}, Kind: KindString},
+	{Code: "ufCrm55Participacion", Types: []string{"string", "double", "integer"}, Kind: KindString},
+	{Code: "ufCrm55RazonSocial", Types: []string{"string"}, Kind: KindString},
+}
+
+// listSelect returns the field codes requested from crm.item.list: only the
+// ID, title, update time, company link and mapped UF fields, unless full items were requested.
+func (c *Client) listSelect() []string {
+	if c.fullItems {
+		return nil
+	}
+
+	fields := []string{"id", "title", "updatedTime"}
+	fields = append(fields, c.fields.codes()...)
+	if c.companyLink.Field != "" {
+		fields = append(fields, c.companyLink.Field)
+	}
+	if c.enforceAssignee {
+		fields = append(fields, "assignedById")
+	}
+	if c.activeField != "" {
+		fields = append(fields, c.activeField)
+	}
+	if c.empresaField != "" {
+		fields = append(fields, c.empresaField)
+	}
+	if c.inactiveStageID != "" {
+		fields = append(fields, "stageId")
+	}
+	return fields
+}
+
+// fieldSpecs returns SocioFields with the client's field codes.
+func (c *Client) fieldSpecs() []FieldSpec {
+	specs := make([]FieldSpec, len(SocioFields))
+	copy(specs, SocioFields)
+	for i, code := range c.fields.codes() {
+		specs[i].Code = code
+	}
+	return specs
+}
+
+// FieldInfo represents a field definition returned by crm.item.fields.
+type FieldInfo struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	IsRequired bool   `json:"isRequired"`
+	IsReadOnly bool   `json:"isReadOnly"`
+	IsMultiple bool   `json:"isMultiple"`
+
+	Items []EnumItem `json:"items"` // List items of enumeration fields
+}
+
+// EnumItem is one option of an enumeration field.
+type EnumItem struct {
+	ID    json.Number `json:"ID"`
+	Value string      `json:"VALUE"`
+}
+
+// BitrixFieldsResponse represents the crm.item.fields response.
+type BitrixFieldsResponse struct {
+	Result *struct {
+		Fields map[string]FieldInfo `json:"fields"`
+	} `json:"result"`
+	Error *struct {
+		ErrorCode        string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	} `json:"error"`
+}
+
+// GetFields retrieves the field definitions for the socios entity type.
+func (c *Client) GetFields(ctx context.Context) (map[string]FieldInfo, error) {
+	return c.getFieldsFor(ctx, c.entityTypeID)
+}
+
+// getFieldsFor retrieves the field definitions for any entity type.
+func (c *Client) getFieldsFor(ctx context.Context, entityTypeID int) (map[string]FieldInfo, error) {
+	requestBody := map[string]interface{}{
+		"entityTypeId": entityTypeID,
+	}
+
+	var result BitrixFieldsResponse
+	if err := c.doJSONRequest(ctx, "/crm.item.fields", requestBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to get fields: %w", err)
+	}
+
+	if err := c.checkBitrixError(&result); err != nil {
+		return nil, err
+	}
+
+	if result.Result == nil {
+		return map[string]FieldInfo{}, nil
+	}
+	return result.Result.Fields, nil
+}
+
+// ValidateFields checks that every mapped UF field exists in Bitrix24 with a
+// compatible type. Without this, writes to a missing field are silently
+// dropped and the next sync can no longer match items by DNI.
+func (c *Client) ValidateFields(ctx context.Context) error {
+	c.logger.Printf("🔍 Validating Bitrix24 fields for entity type %d...", c.entityTypeID)
+
+	fields, err := c.GetFields(ctx)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	specs := c.fieldSpecs()
+	for _, spec := range specs {
+		info, exists := fields[spec.Code]
+		if !exists {
+			problems = append(problems, fmt.Sprintf("%s (missing)", spec.Code))
+			continue
+		}
+		if !containsString(spec.Types, info.Type) {
+			problems = append(problems, fmt.Sprintf("%s (type %q, expected one of %s)",
+				spec.Code, info.Type, strings.Join(spec.Types, "/")))
+			continue
+		}
+		if spec.Code == c.fields.Admin {
+			if err := c.setFlagMapping(info); err != nil {
+				problems = append(problems, fmt.Sprintf("%s (%v)", spec.Code, err))
+			}
+		}
+	}
+
+	if c.activeField != "" {
+		if problem := c.validateActiveField(fields); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if c.empresaField != "" {
+		if problem := c.validateEmpresaField(fields); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	c.setEnums(fields)
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("entity type %d has invalid field mapping: %s",
+			c.entityTypeID, strings.Join(problems, ", "))
+	}
+
+	c.logger.Printf("✅ All %d mapped fields present in Bitrix24", len(specs))
+	return nil
+}
+
+// containsString reports whether s is in list.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package bitrix
+
+import (
+	"fmt"
+)
+
+// flagMapping describes how a Y/N flag field, such as the admin flag, is
+// stored on the portal.
+type flagMapping struct {
+	kind     FieldKind
+	enumFlag map[string]string // Enumeration item ID -> "Y"/"N"
+	enumID   map[string]string // "Y"/"N" -> enumeration item ID
+}
+
+// defaultFlagMapping uses the kind hinted in SocioFields until the portal's
+// field definition is known.
+func defaultFlagMapping() flagMapping {
+	for _, spec := range SocioFields {
+		if spec.Code == DefaultFieldMapping.Admin {
+			return flagMapping{kind: spec.Kind}
+		}
+	}
+	return flagMapping{kind: KindString}
+}
+
+// setFlagMapping records the portal's representation of the admin flag from
+// its field definition.
+func (c *Client) setFlagMapping(info FieldInfo) error {
+	mapping, err := parseFlagMapping(info)
+	if err != nil {
+		return err
+	}
+	c.flags = mapping
+	return nil
+}
+
+// parseFlagMapping reads how a Y/N flag field is stored from its definition.
+// Enumerations need a "yes" and a "no" item.
+func parseFlagMapping(info FieldInfo) (flagMapping, error) {
+	mapping := flagMapping{kind: FieldKind(info.Type)}
+
+	if mapping.kind == KindEnum {
+		mapping.enumFlag = make(map[string]string)
+		mapping.enumID = make(map[string]string)
+		for _, item := range info.Items {
+			flag := normalizeYN(item.Value)
+			if flag != "Y" && flag != "N" {
+				continue
+			}
+			mapping.enumFlag[item.ID.String()] = flag
+			if _, ok := mapping.enumID[flag]; !ok {
+				mapping.enumID[flag] = item.ID.String()
+			}
+		}
+		if mapping.enumID["Y"] == "" || mapping.enumID["N"] == "" {
+			return mapping, fmt.Errorf("enumeration needs a yes and a no item")
+		}
+	}
+	return mapping, nil
+}
+
+// encodeFlag converts a "Y"/"N" admin flag to the value the portal expects.
+func (c *Client) encodeFlag(flag string) interface{} {
+	return c.flags.encode(flag)
+}
+
+// encode converts a "Y"/"N" flag to the value the field expects.
+func (m flagMapping) encode(flag string) interface{} {
+	switch m.kind {
+	case KindBoolean:
+		if flag == "Y" {
+			return 1
+		}
+		return 0
+	case KindEnum:
+		if id, ok := m.enumID[flag]; ok {
+			return id
+		}
+	}
+	return flag
+}
+
+// normalize converts a stored flag value to "Y"/"N".
+func (m flagMapping) normalize(value string) string {
+	if flag, ok := m.enumFlag[value]; ok {
+		return flag
+	}
+	return normalizeYN(value)
+}
+
+// normalizeFlag converts a stored flag value (Y/N, 1/0, true/false or an
+// enumeration item ID) to "Y"/"N" so it can be compared with Sage data.
+func (c *Client) normalizeFlag(value string) string {
+	return c.flags.normalize(value)
+}
@@ -0,0 +1,112 @@
+package bitrix
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// enumAdmin is an admin flag field defined as an enumeration.
+var enumAdmin = FieldInfo{Type: string(KindEnum), Items: []EnumItem{
+	{ID: "45", Value: "Sí"},
+	{ID: "46", Value: "No"},
+	{ID: "47", Value: "Pendiente"},
+}}
+
+func TestParseFlagMapping(t *testing.T) {
+	mapping, err := parseFlagMapping(enumAdmin)
+	if err != nil {
+		t.Fatalf("parseFlagMapping: %v", err)
+	}
+	if mapping.enumID["Y"] != "45" || mapping.enumID["N"] != "46" {
+		t.Errorf("enumeration IDs = %v, want Y 45 and N 46", mapping.enumID)
+	}
+
+	onlyYes := FieldInfo{Type: string(KindEnum), Items: []EnumItem{{ID: "45", Value: "Sí"}}}
+	if _, err := parseFlagMapping(onlyYes); err == nil {
+		t.Error("parseFlagMapping of an enumeration without a no item succeeded, want an error")
+	}
+}
+
+// TestFlagRoundTrip writes each flag as the field kind stores it and reads
+// it back in every representation the portal returns for it.
+func TestFlagRoundTrip(t *testing.T) {
+	tests := []struct {
+		field    FieldInfo
+		written  map[string]interface{} // By flag
+		readBack map[string][]string    // By flag
+	}{
+		{FieldInfo{Type: string(KindString)},
+			map[string]interface{}{"Y": "Y", "N": "N"},
+			map[string][]string{"Y": {"Y", "y"}, "N": {"N", ""}}},
+		{FieldInfo{Type: string(KindBoolean)},
+			map[string]interface{}{"Y": 1, "N": 0},
+			map[string][]string{"Y": {"1", "Y", "true"}, "N": {"0", "N", "false", ""}}},
+		{enumAdmin,
+			map[string]interface{}{"Y": "45", "N": "46"},
+			map[string][]string{"Y": {"45"}, "N": {"46"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field.Type, func(t *testing.T) {
+			mapping, err := parseFlagMapping(tt.field)
+			if err != nil {
+				t.Fatalf("parseFlagMapping: %v", err)
+			}
+			for flag, want := range tt.written {
+				if got := mapping.encode(flag); got != want {
+					t.Errorf("encode(%s) = %#v, want %#v", flag, got, want)
+				}
+			}
+			for flag, values := range tt.readBack {
+				for _, value := range values {
+					if got := mapping.normalize(value); got != flag {
+						t.Errorf("normalize(%q) = %s, want %s", value, got, flag)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestChangesNormalizesFlag checks an admin flag stored as a boolean or an
+// enumeration item does not read as a change on every sync.
+func TestChangesNormalizesFlag(t *testing.T) {
+	socio := &models.Socio{CodigoEmpresa: 1, DNI: "12345678Z", Administrador: true, CargoAdministrador: "Consejero", PorParticipacion: 10, RazonSocialEmpleado: "Ana"}
+
+	for _, tt := range []struct {
+		field  FieldInfo
+		stored string
+	}{
+		{FieldInfo{Type: string(KindBoolean)}, "1"},
+		{enumAdmin, "45"},
+	} {
+		client := newTestClient(t, nil)
+		if err := client.setFlagMapping(tt.field); err != nil {
+			t.Fatalf("setFlagMapping: %v", err)
+		}
+		item := client.convertSageToBitrix(socio)
+		fields, err := client.convertToFields(item, true)
+		if err != nil {
+			t.Fatalf("convertToFields: %v", err)
+		}
+		if want := client.encodeFlag("Y"); fields[client.fields.Admin] != want {
+			t.Errorf("%s field written as %#v, want %#v", tt.field.Type, fields[client.fields.Admin], want)
+		}
+
+		item.Administrador = tt.stored
+		for _, change := range client.Changes(item, socio) {
+			if change.Field == "administrador" {
+				t.Errorf("%s flag stored as %q reads as a change: %+v", tt.field.Type, tt.stored, change)
+			}
+		}
+		if client.NeedsUpdate(item, socio) {
+			t.Errorf("%s flag stored as %q needs an update", tt.field.Type, tt.stored)
+		}
+
+		item.Administrador = fmt.Sprint(client.encodeFlag("N"))
+		if !client.NeedsUpdate(item, socio) {
+			t.Errorf("%s flag stored as no does not need an update", tt.field.Type)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package bitrix
+
+import (
+	"context"
+	"fmt"
+)
+
+// Version identifies this integration in the User-Agent. Override at build
+// time with -ldflags "-X github.com/arduriki/sage-bitrix-sync/internal/bitrix.Version=1.2.3".
+var Version = "dev"
+
+// RunIDHeader carries the sync run identifier so Bitrix24 support can
+// correlate requests with our logs.
+const RunIDHeader = "X-Sync-Run-ID"
+
+// UserAgent builds the default User-Agent for a client code.
+func UserAgent(clientCode string) string {
+	if clientCode == "" {
+		return fmt.Sprintf("sage-bitrix-sync/%s", Version)
+	}
+	return fmt.Sprintf("sage-bitrix-sync/%s (client=%s)", Version, clientCode)
+}
+
+// runIDKey is the context key for the sync run identifier.
+type runIDKey struct{}
+
+// WithRunID returns a context whose Bitrix24 requests carry the run ID.
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, runID)
+}
+
+// RunIDFromContext returns the run ID stored in ctx, if any.
+func RunIDFromContext(ctx context.Context) string {
+	runID, _ := ctx.Value(runIDKey{}).(string)
+	return runID
+}
@@ -0,0 +1,77 @@
+package bitrix
+
+import (
+	"strings"
+	"time"
+)
+
+// ListOption customizes a crm.item.list request.
+type ListOption func(*listParams)
+
+// listParams holds the settings applied to list requests.
+type listParams struct {
+	orderField     string
+	orderDirection string
+	resume         ListCursor
+	progress       func([]BitrixSocio, ListCursor)
+}
+
+// ListCursor records how far a paged listing got, so an interrupted listing
+// can be resumed with ResumeFrom.
+type ListCursor struct {
+	Start   int       `json:"start"`   // "start" of the next page
+	LastID  int       `json:"last_id"` // Highest item ID fetched so far
+	Fetched int       `json:"fetched"` // Items fetched so far
+	At      time.Time `json:"at"`      // When the cursor was taken
+}
+
+// OrderBy sorts listed items by a field, "ASC" or "DESC". The default is by
+// ID ascending, which keeps pagination stable while items are being added.
+func OrderBy(field, direction string) ListOption {
+	return func(p *listParams) {
+		p.orderField = field
+		p.orderDirection = direction
+	}
+}
+
+// ResumeFrom continues a listing from a cursor reported by WithProgress.
+// Items fetched before the cursor are not returned again. With the default
+// order the listing resumes after the cursor's last ID, otherwise at its
+// offset.
+func ResumeFrom(cursor ListCursor) ListOption {
+	return func(p *listParams) {
+		p.resume = cursor
+	}
+}
+
+// WithProgress calls fn after every page that is followed by another, with
+// the page's items and the cursor to resume from after it.
+func WithProgress(fn func(page []BitrixSocio, cursor ListCursor)) ListOption {
+	return func(p *listParams) {
+		p.progress = fn
+	}
+}
+
+// newListParams applies list options over the defaults.
+func newListParams(opts []ListOption) *listParams {
+	p := &listParams{orderField: "id", orderDirection: "ASC"}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// order returns the value for the request's "order" parameter.
+func (p *listParams) order() map[string]string {
+	return map[string]string{p.orderField: p.orderDirection}
+}
+
+// defaultOrder is the order used by list requests without options.
+func defaultOrder() map[string]string {
+	return newListParams(nil).order()
+}
+
+// byIDAscending reports whether items are listed in ascending ID order.
+func (p *listParams) byIDAscending() bool {
+	return strings.EqualFold(p.orderField, "id") && strings.EqualFold(p.orderDirection, "ASC")
+}
@@ -0,0 +1,134 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeListPortal serves crm.item.list over a set of items, 50 per page, in
+// the requested order, calling beforePage before serving each page.
+type fakeListPortal struct {
+	mu         sync.Mutex
+	ids        []int
+	orders     []map[string]string // Of each request
+	beforePage func(start int)
+}
+
+func (p *fakeListPortal) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body struct {
+		Order map[string]string `json:"order"`
+		Start int               `json:"start"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if p.beforePage != nil {
+		p.beforePage(body.Start)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.orders = append(p.orders, body.Order)
+	ids := append([]int(nil), p.ids...)
+	if strings.EqualFold(body.Order["id"], "DESC") {
+		sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	} else {
+		sort.Ints(ids)
+	}
+
+	end := min(body.Start+50, len(ids))
+	items := make([]string, 0, 50)
+	for _, id := range ids[body.Start:end] {
+		items = append(items, fmt.Sprintf(`{"id":%d,"ufCrm55Dni":"%08dZ"}`, id, id))
+	}
+	next := ""
+	if end < len(ids) {
+		next = fmt.Sprintf(`,"next":%d`, end)
+	}
+	return jsonResponse(fmt.Sprintf(`{"result":{"items":[%s]},"total":%d%s}`, strings.Join(items, ","), len(ids), next)), nil
+}
+
+// add inserts an item, as a user creating one in the portal would.
+func (p *fakeListPortal) add(id int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ids = append(p.ids, id)
+}
+
+func newFakeListPortal(n int) *fakeListPortal {
+	p := &fakeListPortal{}
+	for i := 1; i <= n; i++ {
+		p.ids = append(p.ids, i)
+	}
+	return p
+}
+
+// checkListed fails the test if an item was listed twice or want is missing.
+func checkListed(t *testing.T, socios []BitrixSocio, want []int) {
+	t.Helper()
+	seen := make(map[int]bool)
+	for _, socio := range socios {
+		if seen[socio.ID] {
+			t.Errorf("item %d listed twice", socio.ID)
+		}
+		seen[socio.ID] = true
+	}
+	for _, id := range want {
+		if !seen[id] {
+			t.Errorf("item %d not listed", id)
+		}
+	}
+}
+
+func TestListSociosOrdersByID(t *testing.T) {
+	portal := newFakeListPortal(120)
+	client := newTestClient(t, portal, WithRateLimit(0, 0))
+
+	socios, err := client.ListSocios(context.Background())
+	if err != nil {
+		t.Fatalf("ListSocios: %v", err)
+	}
+	if len(socios) != 120 {
+		t.Errorf("ListSocios returned %d items, want 120", len(socios))
+	}
+	if len(portal.orders) != 3 {
+		t.Fatalf("ListSocios sent %d requests, want 3 pages", len(portal.orders))
+	}
+	for i, order := range portal.orders {
+		if len(order) != 1 || order["id"] != "ASC" {
+			t.Errorf("page %d ordered by %v, want id ASC", i+1, order)
+		}
+	}
+}
+
+// TestListSociosItemAddedBetweenPages adds an item to the portal while it
+// is being listed, which shifts the pages listed in descending order.
+func TestListSociosItemAddedBetweenPages(t *testing.T) {
+	for _, direction := range []string{"ASC", "DESC"} {
+		t.Run(direction, func(t *testing.T) {
+			portal := newFakeListPortal(120)
+			portal.beforePage = func(start int) {
+				if start == 50 {
+					portal.add(121)
+				}
+			}
+			client := newTestClient(t, portal, WithRateLimit(0, 0))
+
+			socios, err := client.ListSocios(context.Background(), OrderBy("id", direction))
+			if err != nil {
+				t.Fatalf("ListSocios: %v", err)
+			}
+			want := make([]int, 120)
+			for i := range want {
+				want[i] = i + 1
+			}
+			checkListed(t, socios, want)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package bitrix
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MappingTemplate is a starting point for a portal's FieldMapping, guessed
+// from its field titles. It is meant to be reviewed and edited by hand.
+type MappingTemplate struct {
+	EntityTypeID int                 `json:"entity_type_id"`
+	Mapping      FieldMapping        `json:"mapping"`
+	Candidates   map[string][]string `json:"candidates,omitempty"` // Other codes that matched, by logical field
+	Unmatched    []string            `json:"unmatched,omitempty"`  // Logical fields with no matching code
+}
+
+// mappingKeywords are the title fragments identifying each logical field, in
+// FieldMapping.codes order. Titles are compared lowercased and without accents.
+var mappingKeywords = []struct {
+	name     string
+	keywords []string
+}{
+	{"dni", []string{"dni", "nif", "nie"}},
+	{"cargo", []string{"cargo"}},
+	{"admin", []string{"admin"}},
+	{"participacion", []string{"particip"}},
+	{"razon_social", []string{"razon social", "razonsocial", "nombre"}},
+}
+
+// foldAccents lowercases s and strips Spanish accents.
+var foldAccents = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u")
+
+// GenerateFieldMappingTemplate fetches the configured entity type's fields
+// and matches its UF fields to the logical socio fields by title. A code that
+// already matches DefaultFieldMapping wins; otherwise the first match in code
+// order is used and the rest are listed as candidates.
+func (c *Client) GenerateFieldMappingTemplate(ctx context.Context) (*MappingTemplate, error) {
+	fields, err := c.GetFields(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, len(fields))
+	for code := range fields {
+		if strings.HasPrefix(strings.ToLower(code), "ufcrm") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+
+	tmpl := &MappingTemplate{EntityTypeID: c.entityTypeID, Candidates: make(map[string][]string)}
+	defaults := DefaultFieldMapping.codes()
+	mapped := make([]string, len(mappingKeywords))
+	for i, logical := range mappingKeywords {
+		var matches []string
+		for _, code := range codes {
+			text := foldAccents.Replace(strings.ToLower(fields[code].Title + " " + code))
+			for _, kw := range logical.keywords {
+				if strings.Contains(text, kw) {
+					matches = append(matches, code)
+					break
+				}
+			}
+		}
+
+		if len(matches) == 0 {
+			tmpl.Unmatched = append(tmpl.Unmatched, logical.name)
+			continue
+		}
+		mapped[i] = matches[0]
+		if containsString(matches, defaults[i]) {
+			mapped[i] = defaults[i]
+		}
+		for _, code := range matches {
+			if code != mapped[i] {
+				tmpl.Candidates[logical.name] = append(tmpl.Candidates[logical.name], code)
+			}
+		}
+	}
+	tmpl.Mapping = FieldMapping{mapped[0], mapped[1], mapped[2], mapped[3], mapped[4]}
+
+	c.logger.Printf("🧩 Matched %d/%d logical fields from %d UF fields",
+		len(mappingKeywords)-len(tmpl.Unmatched), len(mappingKeywords), len(codes))
+	return tmpl, nil
+}
+
+// Env renders the template as .env lines. Unmatched fields are left
+// commented out.
+func (t *MappingTemplate) Env() string {
+	names := []string{"DNI", "CARGO", "ADMIN", "PARTICIPACION", "RAZON_SOCIAL"}
+	var b strings.Builder
+	fmt.Fprintf(&b, "BITRIX_ENTITY_TYPE_ID=%d\n", t.EntityTypeID)
+	for i, code := range t.Mapping.codes() {
+		if code == "" {
+			fmt.Fprintf(&b, "# BITRIX_FIELD_%s=  (no match, fill in by hand)\n", names[i])
+			continue
+		}
+		fmt.Fprintf(&b, "BITRIX_FIELD_%s=%s\n", names[i], code)
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package bitrix
+
+import (
+	"sync"
+	"time"
+)
+
+// PortalCoordinator shares one rate limiter and one circuit breaker among all
+// the clients of a Bitrix24 portal, whatever their webhook. Clients of
+// different departments of one portal then keep to the portal-wide request
+// limit together, on top of their own limits, and stop together when the
+// portal is down. Pass it to every client with WithPortalCoordinator.
+type PortalCoordinator struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	portals map[string]*portalBudget // By portal hostname
+}
+
+// portalBudget is what the clients of one portal share.
+type portalBudget struct {
+	limiter *RateLimiter
+	breaker *CircuitBreaker
+}
+
+// NewPortalCoordinator creates a coordinator allowing each portal rps
+// requests per second with the given burst. A non-positive rps only shares
+// the circuit breaker.
+func NewPortalCoordinator(rps float64, burst int) *PortalCoordinator {
+	return &PortalCoordinator{rate: rps, burst: burst, portals: make(map[string]*portalBudget)}
+}
+
+// WithPortalCoordinator makes the client share the rate limit and circuit
+// breaker of its portal through p. The breaker takes the WithCircuitBreaker
+// settings of the first client of the portal.
+func WithPortalCoordinator(p *PortalCoordinator) Option {
+	return func(c *Client) {
+		c.portals = p
+	}
+}
+
+// budgetFor returns the budget of a portal, creating it on first use.
+func (p *PortalCoordinator) budgetFor(host string, threshold int, cooldown time.Duration) *portalBudget {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	budget, ok := p.portals[host]
+	if !ok {
+		budget = &portalBudget{breaker: NewCircuitBreaker(threshold, cooldown)}
+		if p.rate > 0 {
+			budget.limiter = NewRateLimiter(p.rate, p.burst)
+		}
+		p.portals[host] = budget
+	}
+	return budget
+}
+
+// BreakerStatuses returns the breaker state of every portal coordinated so
+// far, keyed by hostname.
+func (p *PortalCoordinator) BreakerStatuses() map[string]BreakerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make(map[string]BreakerStatus, len(p.portals))
+	for host, budget := range p.portals {
+		statuses[host] = budget.breaker.Status()
+	}
+	return statuses
+}
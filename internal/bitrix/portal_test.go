@@ -0,0 +1,111 @@
+package bitrix
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPortalCoordinatorCombinedRate sends requests from two clients of one
+// portal at once, with webhooks of their own and no limits of their own,
+// and checks that together they keep to the portal's rate.
+func TestPortalCoordinatorCombinedRate(t *testing.T) {
+	const (
+		rps      = 100.0
+		burst    = 2
+		requests = 20 // Per client
+	)
+
+	var (
+		mu    sync.Mutex
+		sent  []time.Time
+		hosts = make(map[string]int)
+	)
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		sent = append(sent, time.Now())
+		hosts[req.URL.Host]++
+		mu.Unlock()
+		return jsonResponse(`{"result":{}}`), nil
+	})
+
+	portals := NewPortalCoordinator(rps, burst)
+	newClient := func(webhook string) *Client {
+		return NewClient(webhook, log.New(io.Discard, "", 0),
+			WithHTTPClient(&http.Client{Transport: rt}), WithRateLimit(0, 0), WithPortalCoordinator(portals))
+	}
+	clients := []*Client{
+		newClient("https://acme.bitrix24.es/rest/1/sales"),
+		newClient("https://acme.bitrix24.es/rest/7/accounting"),
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range requests {
+				var response BitrixResponse
+				if err := client.doJSONRequest(context.Background(), "/crm.item.get", map[string]int{"id": 1}, &response); err != nil {
+					t.Errorf("request: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	total := 2 * requests
+	if hosts["acme.bitrix24.es"] != total {
+		t.Fatalf("portal received %d requests, want %d", hosts["acme.bitrix24.es"], total)
+	}
+	if floor := time.Duration(float64(total-burst) / rps * float64(time.Second)); elapsed < floor*9/10 {
+		t.Errorf("%d requests took %s, want at least %s at %.0f per second for the portal", total, elapsed, floor, rps)
+	}
+
+	// No window holds more requests than the burst plus what the rate
+	// refills during it.
+	sort.Slice(sent, func(i, j int) bool { return sent[i].Before(sent[j]) })
+	window := 100 * time.Millisecond
+	limit := burst + int(rps*window.Seconds()) + 1
+	for i := range sent {
+		n := sort.Search(len(sent), func(j int) bool { return sent[j].Sub(sent[i]) >= window })
+		if n-i > limit {
+			t.Errorf("%d requests within %s from request %d, want at most %d", n-i, window, i, limit)
+			break
+		}
+	}
+}
+
+// TestPortalCoordinatorSeparatePortals checks that clients of different
+// portals do not share a budget.
+func TestPortalCoordinatorSeparatePortals(t *testing.T) {
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return jsonResponse(`{"result":{}}`), nil
+	})
+	portals := NewPortalCoordinator(1, 2)
+	newClient := func(webhook string) *Client {
+		return NewClient(webhook, log.New(io.Discard, "", 0),
+			WithHTTPClient(&http.Client{Transport: rt}), WithRateLimit(0, 0), WithPortalCoordinator(portals))
+	}
+
+	start := time.Now()
+	for _, client := range []*Client{newClient("https://acme.bitrix24.es/rest/1/key"), newClient("https://globex.bitrix24.es/rest/1/key")} {
+		for range 2 {
+			var response BitrixResponse
+			if err := client.doJSONRequest(context.Background(), "/crm.item.get", map[string]int{"id": 1}, &response); err != nil {
+				t.Fatalf("request: %v", err)
+			}
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("each portal's burst took %s in total, want no wait", elapsed)
+	}
+}
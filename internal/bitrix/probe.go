@@ -0,0 +1,63 @@
+package bitrix
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ProbeTimeout is the total time budget of Probe.
+const ProbeTimeout = 5 * time.Second
+
+// ProbeResult summarizes what a webhook can reach and do, without writing.
+type ProbeResult struct {
+	Portal              string        `json:"portal"`
+	Reachable           bool          `json:"reachable"`
+	Latency             time.Duration `json:"latency"` // Round trip of the first call
+	EntityTypeID        int           `json:"entity_type_id"`
+	EntityTypeAvailable bool          `json:"entity_type_available"`
+	EntityTypeError     string        `json:"entity_type_error,omitempty"`
+	Scopes              *ScopeReport  `json:"scopes,omitempty"`
+}
+
+// Probe checks the webhook with read-only calls within ProbeTimeout: it
+// measures the round trip of server.time, reads the granted scopes and
+// methods, and checks that the configured entity type exists. The returned
+// result is filled in as far as the probe got; the error is set when the
+// portal could not be reached or the budget ran out.
+func (c *Client) Probe(ctx context.Context) (ProbeResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+
+	result := ProbeResult{Portal: c.PortalHost(), EntityTypeID: c.entityTypeID}
+
+	start := time.Now()
+	var serverTime struct {
+		Result string `json:"result"`
+	}
+	if err := c.doJSONRequest(ctx, "/server.time", nil, &serverTime); err != nil {
+		return result, fmt.Errorf("portal unreachable: %w", err)
+	}
+	result.Reachable = true
+	result.Latency = time.Since(start)
+
+	report, err := c.CheckScopes(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.Scopes = report
+
+	if c.entityTypeID == 0 {
+		result.EntityTypeError = "no entity type configured"
+		return result, nil
+	}
+	if _, err := c.GetFields(ctx); err != nil {
+		if ctx.Err() != nil {
+			return result, err
+		}
+		result.EntityTypeError = err.Error()
+		return result, nil
+	}
+	result.EntityTypeAvailable = true
+	return result, nil
+}
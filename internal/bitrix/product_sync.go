@@ -0,0 +1,260 @@
+package bitrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// ErrProductSKUPropertyNotConfigured is returned by the product sync methods
+// when no SKU property was set with WithProductSKUProperty.
+var ErrProductSKUPropertyNotConfigured = errors.New("no product SKU property configured")
+
+// EntityProduct is the CRM entity Sage articulos are synced to.
+const EntityProduct = "product"
+
+// BitrixProduct is a Bitrix24 catalog product as mapped from a Sage articulo.
+type BitrixProduct struct {
+	ID       int    `json:"id"`
+	SKU      string `json:"sku"`
+	Name     string `json:"name"`
+	Price    string `json:"price"` // Two decimals
+	Currency string `json:"currency"`
+	VATID    int    `json:"vat_id,omitempty"`
+	Active   bool   `json:"active"`
+}
+
+// productRecord is a crm.product.list row.
+type productRecord struct {
+	ID       json.Number `json:"ID"`
+	Name     string      `json:"NAME"`
+	Price    string      `json:"PRICE"`
+	Currency string      `json:"CURRENCY_ID"`
+	VATID    json.Number `json:"VAT_ID"`
+	Active   string      `json:"ACTIVE"`
+}
+
+// ListProducts returns every Bitrix24 product that has a SKU, keyed by SKU.
+// When several share a SKU the oldest wins.
+func (c *Client) ListProducts(ctx context.Context) (map[string]*BitrixProduct, error) {
+	if c.productSKUProperty == "" {
+		return nil, ErrProductSKUPropertyNotConfigured
+	}
+
+	products := make(map[string]*BitrixProduct)
+	for start := 0; ; {
+		requestBody := map[string]interface{}{
+			"select": []string{"ID", "NAME", "PRICE", "CURRENCY_ID", "VAT_ID", "ACTIVE", c.productSKUProperty},
+			"order":  map[string]string{"ID": "ASC"},
+			"start":  start,
+		}
+
+		var result BitrixRawResponse
+		if err := c.doJSONRequest(ctx, "/crm.product.list", requestBody, &result); err != nil {
+			return nil, fmt.Errorf("failed to list products: %w", err)
+		}
+		if err := c.checkBitrixError(&result); err != nil {
+			return nil, err
+		}
+
+		var rows []json.RawMessage
+		if err := json.Unmarshal(result.Result, &rows); err != nil {
+			return nil, fmt.Errorf("failed to decode products: %w", err)
+		}
+		for _, row := range rows {
+			product, err := c.decodeProduct(row)
+			if err != nil {
+				c.warn(WarnUndecodable, "", "Skipping undecodable Bitrix product: %v", err)
+				continue
+			}
+			if _, seen := products[product.SKU]; product.SKU != "" && !seen {
+				products[product.SKU] = product
+			}
+		}
+
+		if result.Next == 0 || len(rows) == 0 {
+			return products, nil
+		}
+		start = result.Next
+	}
+}
+
+// decodeProduct decodes a crm.product.list row.
+func (c *Client) decodeProduct(raw json.RawMessage) (*BitrixProduct, error) {
+	var record productRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	id, err := parseID(record.ID)
+	if err != nil {
+		return nil, err
+	}
+	sku, err := decodeProductProperty(fields[c.productSKUProperty])
+	if err != nil {
+		return nil, fmt.Errorf("product %d: %s: %w", id, c.productSKUProperty, err)
+	}
+
+	product := &BitrixProduct{
+		ID:       id,
+		SKU:      sku,
+		Name:     record.Name,
+		Price:    formatAmountString(record.Price),
+		Currency: record.Currency,
+		Active:   record.Active != "N",
+	}
+	product.VATID, _ = strconv.Atoi(record.VATID.String())
+	return product, nil
+}
+
+// decodeProductProperty reads a product property value, which crm.product.list
+// returns as null, {"valueId": ..., "value": ...} or a list of those for
+// multiple properties, of which the first is used.
+func decodeProductProperty(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "", nil
+	}
+	switch raw[0] {
+	case '{':
+		var prop struct {
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &prop); err != nil {
+			return "", err
+		}
+		return decodeString(prop.Value)
+	case '[':
+		var props []json.RawMessage
+		if err := json.Unmarshal(raw, &props); err != nil {
+			return "", err
+		}
+		if len(props) == 0 {
+			return "", nil
+		}
+		return decodeProductProperty(props[0])
+	}
+	return decodeString(raw)
+}
+
+// VATRates returns the IDs of the portal's VAT rates, keyed by the rate
+// formatted with two decimals ("21.00").
+func (c *Client) VATRates(ctx context.Context) (map[string]int, error) {
+	var result BitrixRawResponse
+	if err := c.doJSONRequest(ctx, "/crm.vat.list", map[string]interface{}{}, &result); err != nil {
+		return nil, fmt.Errorf("failed to list VAT rates: %w", err)
+	}
+	if err := c.checkBitrixError(&result); err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ID   json.Number `json:"ID"`
+		Rate string      `json:"RATE"`
+	}
+	if err := json.Unmarshal(result.Result, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode VAT rates: %w", err)
+	}
+
+	rates := make(map[string]int, len(rows))
+	for _, row := range rows {
+		id, err := parseID(row.ID)
+		if err != nil {
+			continue
+		}
+		rates[formatAmountString(row.Rate)] = id
+	}
+	return rates, nil
+}
+
+// VATKey formats a Sage VAT rate the way VATRates keys it.
+func VATKey(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', 2, 64)
+}
+
+// convertArticulo maps a Sage articulo to the product values the sync
+// writes, with the given VAT rate ID (0 leaves the VAT alone).
+func convertArticulo(articulo *models.Articulo, vatID int) *BitrixProduct {
+	return &BitrixProduct{
+		SKU:      articulo.CodigoArticulo,
+		Name:     articulo.Descripcion,
+		Price:    roundPrice(articulo.Precio),
+		Currency: defaultCurrency,
+		VATID:    vatID,
+		Active:   articulo.Activo,
+	}
+}
+
+// roundPrice rounds a Sage decimal price to the two decimals Bitrix24 keeps,
+// halves away from zero. It works on the decimal itself, so a price such as
+// 1.005 is not rounded down through its float64 approximation.
+func roundPrice(price string) string {
+	r, ok := new(big.Rat).SetString(price)
+	if !ok {
+		return formatAmountString(price)
+	}
+	return r.FloatString(2)
+}
+
+// ProductChanges lists the fields an update with Sage data would change.
+func (c *Client) ProductChanges(product *BitrixProduct, articulo *models.Articulo, vatID int) []FieldChange {
+	expected := convertArticulo(articulo, vatID)
+	pairs := []FieldChange{
+		{"name", product.Name, expected.Name},
+		{"price", product.Price, expected.Price},
+		{"currency", product.Currency, expected.Currency},
+		{"active", strconv.FormatBool(product.Active), strconv.FormatBool(expected.Active)},
+	}
+	if vatID > 0 {
+		pairs = append(pairs, FieldChange{"vat", strconv.Itoa(product.VATID), strconv.Itoa(vatID)})
+	}
+
+	var changes []FieldChange
+	for _, p := range pairs {
+		if p.Old != p.New {
+			changes = append(changes, p)
+		}
+	}
+	return changes
+}
+
+// ProductFields builds the crm.product fields for an articulo.
+func (c *Client) ProductFields(articulo *models.Articulo, vatID int) map[string]interface{} {
+	product := convertArticulo(articulo, vatID)
+	fields := map[string]interface{}{
+		"NAME":               product.Name,
+		"PRICE":              product.Price,
+		"CURRENCY_ID":        product.Currency,
+		"ACTIVE":             yesNo(product.Active),
+		c.productSKUProperty: map[string]interface{}{"value": product.SKU},
+	}
+	if vatID > 0 {
+		fields["VAT_ID"] = vatID
+		fields["VAT_INCLUDED"] = "N"
+	}
+	return fields
+}
+
+// DeactivateProductFields are the crm.product fields that deactivate a
+// product no longer in Sage.
+func DeactivateProductFields() map[string]interface{} {
+	return map[string]interface{}{"ACTIVE": "N"}
+}
+
+// yesNo formats a boolean the way Bitrix24 Y/N fields expect.
+func yesNo(b bool) string {
+	if b {
+		return "Y"
+	}
+	return "N"
+}
@@ -0,0 +1,116 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Bitrix24 blocks a REST method for a webhook user once it has spent
+// OperatingLimit of server time on it within the rolling window.
+const (
+	OperatingLimit = 480 * time.Second
+	// QuotaCritical is the remaining operating time below which the client
+	// pauses calls to a method until its counter resets.
+	QuotaCritical = 30 * time.Second
+)
+
+// QuotaStatus reports how close the webhook is to being blocked on the
+// method that has consumed the most operating time.
+type QuotaStatus struct {
+	Method    string        `json:"method"`
+	Operating time.Duration `json:"operating"` // Server time used in the current window
+	Remaining time.Duration `json:"remaining"`
+	ResetAt   time.Time     `json:"reset_at"`
+}
+
+// responseTime is the "time" block Bitrix24 adds to every response.
+type responseTime struct {
+	Time *struct {
+		Operating        float64 `json:"operating"`          // Seconds
+		OperatingResetAt int64   `json:"operating_reset_at"` // Unix time
+	} `json:"time"`
+}
+
+// quotaTracker keeps the latest operating time reported for each method.
+type quotaTracker struct {
+	mu       sync.Mutex
+	byMethod map[string]QuotaStatus
+}
+
+// record stores the operating time reported in a response body.
+func (qt *quotaTracker) record(method string, body []byte) {
+	var rt responseTime
+	if json.Unmarshal(body, &rt) != nil || rt.Time == nil || rt.Time.OperatingResetAt == 0 {
+		return
+	}
+
+	operating := time.Duration(rt.Time.Operating * float64(time.Second))
+	status := QuotaStatus{
+		Method:    method,
+		Operating: operating,
+		Remaining: max(OperatingLimit-operating, 0),
+		ResetAt:   time.Unix(rt.Time.OperatingResetAt, 0),
+	}
+
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	if qt.byMethod == nil {
+		qt.byMethod = make(map[string]QuotaStatus)
+	}
+	qt.byMethod[method] = status
+}
+
+// get returns the current status for a method, ignoring expired windows.
+func (qt *quotaTracker) get(method string) (QuotaStatus, bool) {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	status, ok := qt.byMethod[method]
+	if !ok || time.Now().After(status.ResetAt) {
+		return QuotaStatus{}, false
+	}
+	return status, true
+}
+
+// QuotaStatus returns the operating-time status of the method closest to its
+// limit, or nil if no response reported one in the current window.
+func (c *Client) QuotaStatus() *QuotaStatus {
+	c.quota.mu.Lock()
+	defer c.quota.mu.Unlock()
+
+	var worst *QuotaStatus
+	now := time.Now()
+	for _, status := range c.quota.byMethod {
+		if now.After(status.ResetAt) {
+			continue
+		}
+		if worst == nil || status.Remaining < worst.Remaining {
+			s := status
+			worst = &s
+		}
+	}
+	return worst
+}
+
+// waitForQuota pauses before calling a method whose remaining operating time
+// is critically low, until Bitrix24 resets its counter.
+func (c *Client) waitForQuota(ctx context.Context, method string) error {
+	status, ok := c.quota.get(method)
+	if !ok || status.Remaining >= QuotaCritical {
+		return nil
+	}
+
+	wait := time.Until(status.ResetAt)
+	c.logger.Printf("⚠️  Operating time for %s nearly exhausted (%s left), pausing %s until reset",
+		method, status.Remaining.Round(time.Second), wait.Round(time.Second))
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+package bitrix
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bitrix24 allows about 2 requests per second per webhook, with short bursts.
+const (
+	DefaultRateLimit = 2.0
+	DefaultBurst     = 5
+)
+
+// RateLimiter is a token bucket shared by all requests of a client.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens added per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing rps requests per second with the
+// given burst. The bucket starts full.
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done, and returns how long
+// it waited.
+func (l *RateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	delay := l.reserve()
+	if delay <= 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		l.cancelReservation()
+		return 0, ctx.Err()
+	}
+}
+
+// reserve takes a token, possibly going into debt, and returns how long the
+// caller must wait before using it.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancelReservation returns a token taken by a Wait that was cancelled.
+func (l *RateLimiter) cancelReservation() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+}
+
+// sharedLimiterKey is the context key for a rate budget shared by clients.
+type sharedLimiterKey struct{}
+
+// WithSharedLimiter returns a context whose Bitrix24 requests also wait on l,
+// so every client working under it shares one rate budget on top of its own.
+// Limiters shared by enclosing contexts still apply.
+func WithSharedLimiter(ctx context.Context, l *RateLimiter) context.Context {
+	limiters := sharedLimitersFromContext(ctx)
+	return context.WithValue(ctx, sharedLimiterKey{}, append(limiters[:len(limiters):len(limiters)], l))
+}
+
+// sharedLimitersFromContext returns the shared limiters stored in ctx.
+func sharedLimitersFromContext(ctx context.Context) []*RateLimiter {
+	l, _ := ctx.Value(sharedLimiterKey{}).([]*RateLimiter)
+	return l
+}
@@ -0,0 +1,65 @@
+package bitrix
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterBurstThenRate(t *testing.T) {
+	l := NewRateLimiter(100, 3)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if waited, err := l.Wait(ctx); err != nil || waited != 0 {
+			t.Fatalf("Wait %d within the burst = %s, %v, want no wait", i, waited, err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := l.Wait(ctx); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Errorf("5 requests past the burst took %s, want about 50ms at 100 per second", elapsed)
+	}
+}
+
+func TestLimiterCancelReturnsToken(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	l.Wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Wait(ctx); err == nil {
+		t.Fatal("Wait on an empty bucket succeeded before its deadline")
+	}
+	// The cancelled reservation is given back, so the next token is due in
+	// about a second rather than two.
+	if delay := l.reserve(); delay > 1100*time.Millisecond {
+		t.Errorf("next reservation waits %s, want at most about 1s", delay)
+	}
+}
+
+// BenchmarkLimiter measures the cost of taking a token that is available,
+// which every Bitrix24 request pays.
+func BenchmarkLimiter(b *testing.B) {
+	ctx := context.Background()
+
+	b.Run("sequential", func(b *testing.B) {
+		l := NewRateLimiter(1e12, 1<<30)
+		for i := 0; i < b.N; i++ {
+			l.Wait(ctx)
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		l := NewRateLimiter(1e12, 1<<30)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				l.Wait(ctx)
+			}
+		})
+	})
+}
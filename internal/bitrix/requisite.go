@@ -0,0 +1,162 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// Bitrix24 constants for requisites.
+const (
+	entityTypeCompany     = 4 // Owner type for requisites of a company
+	addressTypeRegistered = 6 // Legal (fiscal) address
+)
+
+// Requisite is the fiscal record of a Bitrix24 company as mapped from Sage.
+type Requisite struct {
+	ID          int
+	CompanyID   int
+	PresetID    int
+	Name        string
+	CompanyName string // RQ_COMPANY_NAME
+	CIF         string // RQ_VAT_ID
+}
+
+// requisiteRecord is a crm.requisite.list row; the API returns every value as a string.
+type requisiteRecord struct {
+	ID          json.Number `json:"ID"`
+	EntityID    json.Number `json:"ENTITY_ID"`
+	PresetID    json.Number `json:"PRESET_ID"`
+	Name        string      `json:"NAME"`
+	CompanyName string      `json:"RQ_COMPANY_NAME"`
+	VatID       string      `json:"RQ_VAT_ID"`
+}
+
+// ListRequisites returns the requisites of a company.
+func (c *Client) ListRequisites(ctx context.Context, companyID int) ([]Requisite, error) {
+	requestBody := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"ENTITY_TYPE_ID": entityTypeCompany,
+			"ENTITY_ID":      companyID,
+		},
+		"select": []string{"ID", "ENTITY_ID", "PRESET_ID", "NAME", "RQ_COMPANY_NAME", "RQ_VAT_ID"},
+		"order":  map[string]string{"ID": "ASC"},
+	}
+
+	var result BitrixRawResponse
+	if err := c.doJSONRequest(ctx, "/crm.requisite.list", requestBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to list requisites of company %d: %w", companyID, err)
+	}
+	if err := c.checkBitrixError(&result); err != nil {
+		return nil, err
+	}
+
+	var records []requisiteRecord
+	if err := json.Unmarshal(result.Result, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode requisites: %w", err)
+	}
+
+	requisites := make([]Requisite, 0, len(records))
+	for _, r := range records {
+		id, err := parseID(r.ID)
+		if err != nil {
+			return nil, fmt.Errorf("requisite of company %d: %w", companyID, err)
+		}
+		entityID, _ := r.EntityID.Int64()
+		presetID, _ := r.PresetID.Int64()
+		requisites = append(requisites, Requisite{
+			ID:          id,
+			CompanyID:   int(entityID),
+			PresetID:    int(presetID),
+			Name:        r.Name,
+			CompanyName: r.CompanyName,
+			CIF:         r.VatID,
+		})
+	}
+	return requisites, nil
+}
+
+// CreateRequisite creates a requisite for a company from a Sage empresa using
+// the given preset (the portal's Spanish company preset) and returns its ID.
+func (c *Client) CreateRequisite(ctx context.Context, companyID, presetID int, empresa *models.Empresa) (int, error) {
+	c.logger.Printf("🧾 Creating requisite for company %d: CIF=%s", companyID, empresa.CIF)
+
+	fields := requisiteFields(empresa)
+	fields["ENTITY_TYPE_ID"] = entityTypeCompany
+	fields["ENTITY_ID"] = companyID
+	fields["PRESET_ID"] = presetID
+
+	var result BitrixRawResponse
+	err := c.doJSONRequest(ctx, "/crm.requisite.add", map[string]interface{}{"fields": fields}, &result)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create requisite for company %d: %w", companyID, err)
+	}
+	if err := c.checkBitrixError(&result); err != nil {
+		return 0, err
+	}
+	return parseItemID(result.Result)
+}
+
+// UpdateRequisite overwrites a requisite's fiscal data with a Sage empresa's.
+func (c *Client) UpdateRequisite(ctx context.Context, requisiteID int, empresa *models.Empresa) error {
+	c.logger.Printf("🧾 Updating requisite %d: CIF=%s", requisiteID, empresa.CIF)
+
+	requestBody := map[string]interface{}{
+		"id":     requisiteID,
+		"fields": requisiteFields(empresa),
+	}
+
+	var result BitrixResponse
+	if err := c.doJSONRequest(ctx, "/crm.requisite.update", requestBody, &result); err != nil {
+		return fmt.Errorf("failed to update requisite %d: %w", requisiteID, err)
+	}
+	return c.checkBitrixError(&result)
+}
+
+// UpsertRequisite creates the company's requisite, or updates its first one
+// when the name or CIF differ. It is meant to run right after the company
+// itself has been upserted.
+func (c *Client) UpsertRequisite(ctx context.Context, companyID, presetID int, empresa *models.Empresa) (UpsertAction, int, error) {
+	requisites, err := c.ListRequisites(ctx, companyID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if len(requisites) == 0 {
+		id, err := c.CreateRequisite(ctx, companyID, presetID, empresa)
+		if err != nil {
+			return "", 0, err
+		}
+		return ActionCreated, id, nil
+	}
+
+	existing := requisites[0]
+	if existing.CompanyName == empresa.RazonSocial && existing.CIF == empresa.CIF {
+		return ActionSkipped, existing.ID, nil
+	}
+	if err := c.UpdateRequisite(ctx, existing.ID, empresa); err != nil {
+		return "", existing.ID, err
+	}
+	return ActionUpdated, existing.ID, nil
+}
+
+// requisiteFields maps a Sage empresa to requisite fields, including the
+// fiscal address.
+func requisiteFields(empresa *models.Empresa) map[string]interface{} {
+	return map[string]interface{}{
+		"NAME":            empresa.RazonSocial,
+		"RQ_COMPANY_NAME": empresa.RazonSocial,
+		"RQ_VAT_ID":       empresa.CIF,
+		"RQ_ADDR": map[int]map[string]string{
+			addressTypeRegistered: {
+				"ADDRESS_1":   empresa.Domicilio,
+				"POSTAL_CODE": empresa.CodigoPostal,
+				"CITY":        empresa.Municipio,
+				"PROVINCE":    empresa.Provincia,
+				"COUNTRY":     "España",
+			},
+		},
+	}
+}
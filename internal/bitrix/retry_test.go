@@ -0,0 +1,104 @@
+package bitrix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// createPortal serves the requests of CreateSocio. Each crm.item.add runs
+// the next step of adds: it may store the item, then answer or hang until
+// the client gives up.
+type createPortal struct {
+	mu     sync.Mutex
+	adds   []addStep
+	added  int // crm.item.add calls
+	lists  int // crm.item.list calls
+	stored []int
+}
+
+type addStep struct {
+	store  bool
+	hang   bool
+	status int // Of the answer when not hanging; 0 means 200
+}
+
+func (p *createPortal) RoundTrip(req *http.Request) (*http.Response, error) {
+	p.mu.Lock()
+	switch method := strings.TrimPrefix(req.URL.Path[strings.LastIndex(req.URL.Path, "/"):], "/"); method {
+	case "crm.item.fields":
+		p.mu.Unlock()
+		return jsonResponse(`{"result":{"fields":{}}}`), nil
+
+	case "crm.item.list":
+		p.lists++
+		items := make([]string, len(p.stored))
+		for i, id := range p.stored {
+			items[i] = fmt.Sprintf(`{"id":%d,"ufCrm55Dni":"12345678Z"}`, id)
+		}
+		p.mu.Unlock()
+		return jsonResponse(`{"result":{"items":[` + strings.Join(items, ",") + `]}}`), nil
+
+	case "crm.item.add":
+		step := p.adds[p.added]
+		p.added++
+		id := 100 + p.added
+		if step.store {
+			p.stored = append(p.stored, id)
+		}
+		p.mu.Unlock()
+
+		if step.hang {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		if step.status != 0 {
+			resp := jsonResponse(`{"error":"ERROR_CORE","error_description":"rejected"}`)
+			resp.StatusCode = step.status
+			return resp, nil
+		}
+		return jsonResponse(fmt.Sprintf(`{"result":{"item":{"id":%d}}}`, id)), nil
+
+	default:
+		p.mu.Unlock()
+		return nil, fmt.Errorf("unexpected request to %s", method)
+	}
+}
+
+func TestCreateSocioAfterTimeout(t *testing.T) {
+	socio := &models.Socio{CodigoEmpresa: 1, DNI: "12345678Z", RazonSocialEmpleado: "Ana"}
+	tests := []struct {
+		name         string
+		adds         []addStep
+		wantID       int
+		wantErr      bool
+		added, lists int
+		stored       int
+	}{
+		{"created despite the timeout", []addStep{{store: true, hang: true}}, 101, false, 1, 1, 1},
+		{"not created, retried", []addStep{{hang: true}, {store: true}}, 102, false, 2, 1, 1},
+		{"timed out twice", []addStep{{hang: true}, {hang: true}}, 0, true, 2, 1, 0},
+		{"rejected, not retried", []addStep{{status: http.StatusBadRequest}}, 0, true, 1, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portal := &createPortal{adds: tt.adds}
+			client := newTestClient(t, portal, WithRateLimit(0, 0), WithMethodTimeout("crm.item.add", 20*time.Millisecond))
+
+			id, err := client.CreateSocio(context.Background(), socio)
+			if (err != nil) != tt.wantErr || id != tt.wantID {
+				t.Errorf("CreateSocio = %d, %v, want %d and error %v", id, err, tt.wantID, tt.wantErr)
+			}
+			if portal.added != tt.added || portal.lists != tt.lists || len(portal.stored) != tt.stored {
+				t.Errorf("portal got %d adds and %d lookups and holds %d items, want %d, %d and %d",
+					portal.added, portal.lists, len(portal.stored), tt.added, tt.lists, tt.stored)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package bitrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInsufficientScope is returned when the webhook lacks permissions the
+// sync needs.
+var ErrInsufficientScope = errors.New("webhook is missing required permissions")
+
+// RequiredMethods are the REST methods the sync calls on every run.
+var RequiredMethods = []string{
+	"crm.item.list",
+	"crm.item.add",
+	"crm.item.update",
+	"crm.item.delete",
+}
+
+// ScopeReport describes what a webhook is allowed to do.
+type ScopeReport struct {
+	Scopes         []string `json:"scopes"`          // Scopes granted to the webhook, e.g. "crm"
+	MissingMethods []string `json:"missing_methods"` // Required methods the webhook cannot call
+}
+
+// OK reports whether every required method is available.
+func (r *ScopeReport) OK() bool {
+	return len(r.MissingMethods) == 0
+}
+
+// Err returns ErrInsufficientScope describing the missing methods, or nil.
+func (r *ScopeReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	return fmt.Errorf("%w: cannot call %s (granted scopes: %s); add the crm scope to the webhook",
+		ErrInsufficientScope, strings.Join(r.MissingMethods, ", "), strings.Join(r.Scopes, ", "))
+}
+
+// CheckScopes asks the portal which scopes and methods the webhook may use
+// and reports the required methods it cannot call.
+func (c *Client) CheckScopes(ctx context.Context) (*ScopeReport, error) {
+	c.logger.Printf("🔐 Checking webhook permissions...")
+
+	var scopes struct {
+		Result []string `json:"result"`
+	}
+	if err := c.doJSONRequest(ctx, "/scope", nil, &scopes); err != nil {
+		return nil, fmt.Errorf("failed to get webhook scopes: %w", err)
+	}
+
+	var methods struct {
+		Result []string `json:"result"`
+	}
+	if err := c.doJSONRequest(ctx, "/methods", nil, &methods); err != nil {
+		return nil, fmt.Errorf("failed to get webhook methods: %w", err)
+	}
+
+	// Method names come back lowercase.
+	available := make(map[string]bool, len(methods.Result))
+	for _, m := range methods.Result {
+		available[strings.ToLower(m)] = true
+	}
+
+	report := &ScopeReport{Scopes: scopes.Result}
+	for _, m := range RequiredMethods {
+		if !available[strings.ToLower(m)] {
+			report.MissingMethods = append(report.MissingMethods, m)
+		}
+	}
+
+	if report.OK() {
+		c.logger.Printf("✅ Webhook has all required permissions")
+	} else {
+		c.logger.Printf("❌ Webhook cannot call: %s", strings.Join(report.MissingMethods, ", "))
+	}
+	return report, nil
+}
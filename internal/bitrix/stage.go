@@ -0,0 +1,92 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pipelineFields adds the configured category and stage to a fields map.
+// Both are set on create; on update only the stage is, and only when updates
+// are allowed to move items, so manual kanban moves survive the next sync.
+func (c *Client) pipelineFields(fields map[string]interface{}, create bool) {
+	if create && c.categoryID > 0 {
+		fields["categoryId"] = c.categoryID
+	}
+	if c.stageID != "" && (create || c.updateStage) {
+		fields["stageId"] = c.stageID
+	}
+}
+
+// stageCategory returns the category the configured stage belongs to: the
+// configured category, or the one encoded in a stage ID like "DT1032_8:NEW".
+func (c *Client) stageCategory() (int, error) {
+	if c.categoryID > 0 {
+		return c.categoryID, nil
+	}
+
+	prefix, _, found := strings.Cut(c.stageID, ":")
+	_, category, hasCategory := strings.Cut(prefix, "_")
+	if !found || !hasCategory {
+		return 0, fmt.Errorf("stage %q has no category; set the category ID explicitly", c.stageID)
+	}
+	id, err := strconv.Atoi(category)
+	if err != nil {
+		return 0, fmt.Errorf("stage %q has an invalid category: %w", c.stageID, err)
+	}
+	return id, nil
+}
+
+// ValidateStage checks that the configured stage exists in the configured
+// category of the socios entity type. It is a no-op when no stage is set.
+func (c *Client) ValidateStage(ctx context.Context) error {
+	if c.stageID == "" {
+		return nil
+	}
+
+	categoryID, err := c.stageCategory()
+	if err != nil {
+		return err
+	}
+
+	c.logger.Printf("🔍 Validating Bitrix24 stage %s (category %d)...", c.stageID, categoryID)
+
+	requestBody := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"ENTITY_ID": fmt.Sprintf("DYNAMIC_%d_STAGE_%d", c.entityTypeID, categoryID),
+		},
+	}
+
+	var result BitrixRawResponse
+	if err := c.doJSONRequest(ctx, "/crm.status.list", requestBody, &result); err != nil {
+		return fmt.Errorf("failed to get stages: %w", err)
+	}
+	if err := c.checkBitrixError(&result); err != nil {
+		return err
+	}
+
+	var stages []struct {
+		StatusID string `json:"STATUS_ID"`
+	}
+	if err := json.Unmarshal(result.Result, &stages); err != nil {
+		return fmt.Errorf("failed to decode stages: %w", err)
+	}
+
+	available := make([]string, 0, len(stages))
+	for _, stage := range stages {
+		if stage.StatusID == c.stageID {
+			c.logger.Printf("✅ Stage %s exists", c.stageID)
+			return nil
+		}
+		available = append(available, stage.StatusID)
+	}
+
+	if len(available) == 0 {
+		return fmt.Errorf("category %d of entity type %d has no stages; check the category ID",
+			categoryID, c.entityTypeID)
+	}
+	return fmt.Errorf("stage %q not found in category %d of entity type %d (available: %s)",
+		c.stageID, categoryID, c.entityTypeID, strings.Join(available, ", "))
+}
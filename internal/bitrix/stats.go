@@ -0,0 +1,92 @@
+package bitrix
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// APIStats summarizes the REST calls a client made, to predict when a portal
+// will hit Bitrix24's daily limits.
+type APIStats struct {
+	Requests      int64            `json:"requests"`  // HTTP requests sent, including retries
+	ByMethod      map[string]int64 `json:"by_method"` // Requests per REST method, e.g. "crm.item.list"
+	Retries       int64            `json:"retries"`
+	ThrottleWait  string           `json:"throttle_wait"` // Time spent waiting for the rate limiter
+	BytesSent     int64            `json:"bytes_sent"`
+	BytesReceived int64            `json:"bytes_received"`
+	Quota         *QuotaStatus     `json:"quota,omitempty"` // Method closest to its operating-time limit
+}
+
+// apiCounters holds the live counters behind APIStats. They are safe for
+// concurrent use.
+type apiCounters struct {
+	mu       sync.Mutex
+	byMethod map[string]int64
+
+	requests      atomic.Int64
+	retries       atomic.Int64
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+}
+
+// countRequest records a request to method with a body of size bytes.
+func (ac *apiCounters) countRequest(method string, size int64) {
+	ac.requests.Add(1)
+	if size > 0 {
+		ac.bytesSent.Add(size)
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.byMethod == nil {
+		ac.byMethod = make(map[string]int64)
+	}
+	ac.byMethod[method]++
+}
+
+// countingBody counts the bytes read from a response body.
+type countingBody struct {
+	io.ReadCloser
+	counter *atomic.Int64
+}
+
+func (cb countingBody) Read(p []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(p)
+	cb.counter.Add(int64(n))
+	return n, err
+}
+
+// Stats returns a snapshot of the client's API call counters.
+func (c *Client) Stats() APIStats {
+	c.stats.mu.Lock()
+	byMethod := make(map[string]int64, len(c.stats.byMethod))
+	for method, n := range c.stats.byMethod {
+		byMethod[method] = n
+	}
+	c.stats.mu.Unlock()
+
+	return APIStats{
+		Requests:      c.stats.requests.Load(),
+		ByMethod:      byMethod,
+		Retries:       c.stats.retries.Load(),
+		ThrottleWait:  c.ThrottleWait().String(),
+		BytesSent:     c.stats.bytesSent.Load(),
+		BytesReceived: c.stats.bytesReceived.Load(),
+		Quota:         c.QuotaStatus(),
+	}
+}
+
+// ResetStats zeroes the API call counters and the throttle wait, e.g. at the
+// start of a sync run on a reused client.
+func (c *Client) ResetStats() {
+	c.stats.mu.Lock()
+	c.stats.byMethod = nil
+	c.stats.mu.Unlock()
+
+	c.stats.requests.Store(0)
+	c.stats.retries.Store(0)
+	c.stats.bytesSent.Store(0)
+	c.stats.bytesReceived.Store(0)
+	c.throttled.Store(0)
+}
@@ -0,0 +1,47 @@
+package bitrix
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CommentChanges posts a timeline comment on an item summarizing the fields a
+// sync update changed. It is a no-op unless timeline comments are enabled.
+// Comments go through the same rate limiter as every other request, so they
+// slow the sync down rather than exceed the portal's limits.
+func (c *Client) CommentChanges(ctx context.Context, bitrixID int, changes []FieldChange) error {
+	if !c.timelineComments || len(changes) == 0 {
+		return nil
+	}
+
+	requestBody := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"ENTITY_ID":   bitrixID,
+			"ENTITY_TYPE": fmt.Sprintf("dynamic_%d", c.entityTypeID),
+			"COMMENT":     changeComment(ctx, changes),
+		},
+	}
+
+	var result BitrixResponse
+	if err := c.doJSONRequest(ctx, "/crm.timeline.comment.add", requestBody, &result); err != nil {
+		return fmt.Errorf("failed to add timeline comment to %d: %w", bitrixID, err)
+	}
+	return c.checkBitrixError(&result)
+}
+
+// changeComment formats changes as e.g. "Updated from Sage on 2024-06-01
+// (run 1a2b3c): participación 25.00 → 30.00".
+func changeComment(ctx context.Context, changes []FieldChange) string {
+	parts := make([]string, len(changes))
+	for i, ch := range changes {
+		parts[i] = fmt.Sprintf("%s %s → %s", ch.Field, ch.Old, ch.New)
+	}
+
+	header := "Updated from Sage on " + time.Now().Format("2006-01-02")
+	if runID := RunIDFromContext(ctx); runID != "" {
+		header += fmt.Sprintf(" (run %s)", runID)
+	}
+	return header + ": " + strings.Join(parts, "; ")
+}
@@ -0,0 +1,168 @@
+package bitrix
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// BenchmarkSequentialRequests sends requests one after another through the
+// tuned transport, reporting the TLS connections opened per request: with
+// keep-alive it stays near zero.
+func BenchmarkSequentialRequests(b *testing.B) {
+	var conns atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"result":{"item":{"id":1}}}`)
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	client := NewClient(server.URL+"/rest/1/key", log.New(io.Discard, "", 0),
+		WithRootCAs(pool), WithRateLimit(0, 0))
+
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var response BitrixResponse
+		if err := client.doJSONRequest(ctx, "/crm.item.get", map[string]int{"id": 1}, &response); err != nil {
+			b.Fatalf("request %d: %v", i, err)
+		}
+	}
+	b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+}
+
+// slowPortal answers every request after delay, unless the request's
+// context is done first.
+func slowPortal(delay time.Duration) roundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		select {
+		case <-time.After(delay):
+			return jsonResponse(`{"result":{}}`), nil
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+func TestMethodTimeouts(t *testing.T) {
+	client := newTestClient(t, slowPortal(50*time.Millisecond), WithRateLimit(0, 0),
+		WithTimeout(time.Second),
+		WithMethodTimeout("crm.item.list", time.Second),
+		WithMethodTimeout("crm.item.add", 10*time.Millisecond))
+	ctx := context.Background()
+
+	var response BitrixResponse
+	if err := client.doJSONRequest(ctx, "/crm.item.add", map[string]int{"entityTypeId": 130}, &response); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow crm.item.add error = %v, want its short deadline exceeded", err)
+	}
+	if err := client.doJSONRequest(ctx, "/crm.item.list", map[string]int{"entityTypeId": 130}, &response); err != nil {
+		t.Errorf("slow crm.item.list error = %v, want it within its long deadline", err)
+	}
+	// Methods without a timeout of their own use the client's.
+	if err := client.doJSONRequest(ctx, "/crm.item.get", map[string]int{"id": 1}, &response); err != nil {
+		t.Errorf("slow crm.item.get error = %v, want it within the client timeout", err)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	client := newTestClient(t, slowPortal(50*time.Millisecond), WithRateLimit(0, 0),
+		WithMethodTimeout("crm.item.list", time.Second))
+
+	var response BitrixResponse
+	ctx := WithCallTimeout(context.Background(), 10*time.Millisecond)
+	if err := client.doJSONRequest(ctx, "/crm.item.list", map[string]int{"entityTypeId": 130}, &response); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("crm.item.list with a short call timeout error = %v, want its deadline exceeded", err)
+	}
+
+	client = newTestClient(t, slowPortal(50*time.Millisecond), WithRateLimit(0, 0),
+		WithMethodTimeout("crm.item.add", 10*time.Millisecond))
+	ctx = WithCallTimeout(context.Background(), time.Second)
+	if err := client.doJSONRequest(ctx, "/crm.item.add", map[string]int{"entityTypeId": 130}, &response); err != nil {
+		t.Errorf("crm.item.add with a long call timeout error = %v, want it within the call's deadline", err)
+	}
+}
+
+// tlsPortal starts a portal over TLS with its own self-signed certificate,
+// answering every request with an empty result.
+func tlsPortal(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"result":{}}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writeCAFile writes the certificate of server to a PEM file, as a
+// customer would save their firewall's CA for BITRIX_CA_FILE.
+func writeCAFile(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+	return path
+}
+
+func TestTLSVerification(t *testing.T) {
+	server := tlsPortal(t)
+	pool, err := LoadCAPool(writeCAFile(t, server))
+	if err != nil {
+		t.Fatalf("LoadCAPool: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr error
+	}{
+		{"CA file", []Option{WithRootCAs(pool)}, nil},
+		{"untrusted", nil, ErrTLSVerification},
+		{"verification skipped", []Option{WithInsecureSkipVerify()}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(server.URL+"/rest/1/key", log.New(io.Discard, "", 0), append(tt.opts, WithRateLimit(0, 0))...)
+			var response BitrixResponse
+			err := client.doJSONRequest(context.Background(), "/crm.item.get", map[string]int{"id": 1}, &response)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("request error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadCAPoolErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "missing.pem"), notPEM} {
+		if _, err := LoadCAPool(path); err == nil {
+			t.Errorf("LoadCAPool(%s) succeeded, want an error", filepath.Base(path))
+		}
+	}
+}
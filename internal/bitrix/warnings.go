@@ -0,0 +1,46 @@
+package bitrix
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Codes of the warnings a client records.
+const (
+	WarnUndecodable       = "undecodable_item"   // A listed record was skipped
+	WarnStoredDifferently = "stored_differently" // A verified write came back different
+	WarnDefaultTitle      = "default_title"      // The title template failed for a socio
+	WarnNoCompany         = "no_company"         // An empresa has no company to link socios to
+)
+
+// Warning is a problem the client worked around without failing the
+// request, for the run to report next to its errors.
+type Warning struct {
+	Code    string `json:"code"`
+	DNI     string `json:"dni,omitempty"`
+	Message string `json:"message"`
+}
+
+// warningLog collects the warnings of a client; its workers record them
+// concurrently.
+type warningLog struct {
+	mu       sync.Mutex
+	warnings []Warning
+}
+
+// warn logs a warning and records it for Warnings.
+func (c *Client) warn(code, dni, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	c.logger.Printf("⚠️  %s", msg)
+
+	c.warnings.mu.Lock()
+	defer c.warnings.mu.Unlock()
+	c.warnings.warnings = append(c.warnings.warnings, Warning{Code: code, DNI: dni, Message: msg})
+}
+
+// Warnings returns the warnings recorded so far.
+func (c *Client) Warnings() []Warning {
+	c.warnings.mu.Lock()
+	defer c.warnings.mu.Unlock()
+	return append([]Warning(nil), c.warnings.warnings...)
+}
@@ -0,0 +1,48 @@
+package bitrix
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// webhookPath matches /rest/<user id>/<token> plus anything after it, which
+// is usually a REST method pasted along with the webhook.
+var webhookPath = regexp.MustCompile(`^/rest/(\d+)/([A-Za-z0-9]+)(/.*)?$`)
+
+// NormalizeWebhookURL checks that rawURL is an inbound webhook of the form
+// https://<portal>.bitrix24.<tld>/rest/<user>/<token>/ and returns it in that
+// canonical form, dropping any method suffix such as "crm.item.list".
+func NormalizeWebhookURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook URL: %w", err)
+	}
+
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("invalid webhook URL %q: must use https", rawURL)
+	}
+	if !strings.Contains(u.Hostname(), ".bitrix24.") {
+		return "", fmt.Errorf("invalid webhook URL %q: host must be a *.bitrix24.* portal", rawURL)
+	}
+
+	m := webhookPath.FindStringSubmatch(strings.TrimRight(u.Path, "/"))
+	if m == nil {
+		return "", fmt.Errorf("invalid webhook URL %q: path must be /rest/<user>/<token>/", rawURL)
+	}
+
+	return fmt.Sprintf("https://%s/rest/%s/%s/", u.Host, m[1], m[2]), nil
+}
+
+// NewClientValidated is like NewClient but validates and normalizes the
+// webhook URL first, so malformed inputs fail at construction rather than
+// as confusing 404s during a sync.
+func NewClientValidated(webhookURL string, logger *log.Logger, opts ...Option) (*Client, error) {
+	normalized, err := NormalizeWebhookURL(webhookURL)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(normalized, logger, opts...), nil
+}
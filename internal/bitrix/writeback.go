@@ -0,0 +1,25 @@
+package bitrix
+
+import "github.com/arduriki/sage-bitrix-sync/internal/models"
+
+// SocioFieldValues returns the values of the fields that may be written back
+// to Sage (models.WritableFields) as an item holds them, in the form Changes
+// compares them: the cargo label, the participación and "Y"/"N".
+func (c *Client) SocioFieldValues(item *BitrixSocio) map[string]string {
+	return map[string]string{
+		models.FieldCargo:         c.enumLabel(c.fields.Cargo, item.Cargo),
+		models.FieldParticipacion: item.Participacion,
+		models.FieldAdministrador: c.normalizeFlag(item.Administrador),
+	}
+}
+
+// ExpectedFieldValues returns the values of the same fields that syncing
+// the Sage socio would write, comparable with SocioFieldValues.
+func (c *Client) ExpectedFieldValues(socio *models.Socio) map[string]string {
+	expected := c.convertSageToBitrix(socio)
+	return map[string]string{
+		models.FieldCargo:         c.enumCanonical(c.fields.Cargo, expected.Cargo),
+		models.FieldParticipacion: expected.Participacion,
+		models.FieldAdministrador: expected.Administrador,
+	}
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/repository"
+)
+
+// loadWith loads the configuration from the minimal valid environment
+// plus env.
+func loadWith(t *testing.T, env map[string]string) (*Config, error) {
+	t.Helper()
+	t.Setenv("SAGE_DB_PASSWORD", "secret")
+	t.Setenv("BITRIX_ENDPOINT", "https://test.bitrix24.es/rest/1/key/")
+	t.Setenv("LICENSE_ID", "test")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	return Load()
+}
+
+func TestSchema(t *testing.T) {
+	cfg, err := loadWith(t, nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := cfg.SageDB.Tables().Name("Personas"); got != "[dbo].[Personas]" {
+		t.Errorf("default schema names %s, want [dbo].[Personas]", got)
+	}
+
+	cfg, err = loadWith(t, map[string]string{"SAGE_DB_SCHEMA": "Sage_2024"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := cfg.SageDB.Tables().Name("Personas"); got != "[Sage_2024].[Personas]" {
+		t.Errorf("SAGE_DB_SCHEMA=Sage_2024 names %s, want [Sage_2024].[Personas]", got)
+	}
+
+	for _, schema := range []string{"sage]; DROP TABLE x; --", "dbo.x", "1sage"} {
+		_, err := loadWith(t, map[string]string{"SAGE_DB_SCHEMA": schema})
+		if err == nil || !strings.Contains(err.Error(), "SAGE_DB_SCHEMA") {
+			t.Errorf("SAGE_DB_SCHEMA=%q: error = %v, want it rejected", schema, err)
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	for _, profile := range repository.Profiles {
+		cfg, err := loadWith(t, map[string]string{"SAGE_DB_PROFILE": profile})
+		if err != nil {
+			t.Fatalf("SAGE_DB_PROFILE=%s: %v", profile, err)
+		}
+		if got := cfg.SageDB.Tables().Profile(); got != profile {
+			t.Errorf("SAGE_DB_PROFILE=%s reads the %s tables", profile, got)
+		}
+	}
+
+	_, err := loadWith(t, map[string]string{"SAGE_DB_PROFILE": "sage100"})
+	if err == nil {
+		t.Fatal("SAGE_DB_PROFILE=sage100 loaded, want it rejected")
+	}
+	for _, profile := range repository.Profiles {
+		if !strings.Contains(err.Error(), profile) {
+			t.Errorf("error %q does not list the supported profile %s", err, profile)
+		}
+	}
+}
+
+func TestSyncedFields(t *testing.T) {
+	cfg, err := loadWith(t, map[string]string{"BITRIX_SYNCED_FIELDS": "title,administrador"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := strings.Join(cfg.Bitrix.SyncedFields, ","); got != "title,administrador" {
+		t.Errorf("BITRIX_SYNCED_FIELDS=title,administrador syncs %s", got)
+	}
+
+	_, err = loadWith(t, map[string]string{"BITRIX_SYNCED_FIELDS": "title,puesto"})
+	if err == nil || !strings.Contains(err.Error(), "puesto") {
+		t.Errorf("BITRIX_SYNCED_FIELDS=title,puesto: error = %v, want puesto rejected", err)
+	}
+}
+
+func TestQueryRetries(t *testing.T) {
+	cfg, err := loadWith(t, nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.SageDB.QueryRetries != 2 {
+		t.Errorf("default query retries = %d, want 2", cfg.SageDB.QueryRetries)
+	}
+
+	if _, err := loadWith(t, map[string]string{"SAGE_DB_QUERY_RETRIES": "-1"}); err == nil || !strings.Contains(err.Error(), "SAGE_DB_QUERY_RETRIES") {
+		t.Errorf("SAGE_DB_QUERY_RETRIES=-1: error = %v, want it rejected", err)
+	}
+}
+
+// TestConnectionString checks the DSN of each SAGE_DB_AUTH mode.
+func TestConnectionString(t *testing.T) {
+	const server = `server=sage\SAGEEXPRESS;port=1433;database=EMPRESA;encrypt=disable;trustServerCertificate=true;dial timeout=15`
+	base := map[string]string{
+		"SAGE_DB_HOST": `sage\SAGEEXPRESS`,
+		"SAGE_DB_PORT": "1433",
+		"SAGE_DB_NAME": "EMPRESA",
+		"SAGE_DB_USER": "sync",
+	}
+	tests := []struct {
+		name  string
+		env   map[string]string
+		want  string
+		login string
+	}{
+		{"SQL login", map[string]string{}, server + ";user id=sync;password=secret", "sync"},
+		{"explicit SQL login", map[string]string{"SAGE_DB_AUTH": "sql"}, server + ";user id=sync;password=secret", "sync"},
+		{"NTLM with domain", map[string]string{"SAGE_DB_AUTH": "windows", "SAGE_DB_DOMAIN": "ACME"},
+			server + `;user id=ACME\sync;password=secret`, `ACME\sync`},
+		{"NTLM with qualified user", map[string]string{"SAGE_DB_AUTH": "windows", "SAGE_DB_USER": `ACME\sync`, "SAGE_DB_DOMAIN": "OTHER"},
+			server + `;user id=ACME\sync;password=secret`, `ACME\sync`},
+		{"trusted", map[string]string{"SAGE_DB_AUTH": "windows", "SAGE_DB_PASSWORD": ""}, server, "(Windows account)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			for key, value := range base {
+				env[key] = value
+			}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cfg, err := loadWith(t, env)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if got := cfg.GetConnectionString(); got != tt.want {
+				t.Errorf("GetConnectionString() =\n%s\nwant\n%s", got, tt.want)
+			}
+			if got := cfg.SageDB.Login(); got != tt.login {
+				t.Errorf("Login() = %s, want %s", got, tt.login)
+			}
+		})
+	}
+}
+
+func TestValidateAuth(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want string // In the error; empty for none
+	}{
+		{map[string]string{"SAGE_DB_AUTH": "windows"}, "SAGE_DB_DOMAIN"},
+		{map[string]string{"SAGE_DB_AUTH": "windows", "SAGE_DB_DOMAIN": "ACME"}, ""},
+		{map[string]string{"SAGE_DB_AUTH": "windows", "SAGE_DB_USER": `ACME\sync`}, ""},
+		{map[string]string{"SAGE_DB_AUTH": "windows", "SAGE_DB_PASSWORD": ""}, ""},
+		{map[string]string{"SAGE_DB_AUTH": "sql", "SAGE_DB_PASSWORD": ""}, "SAGE_DB_PASSWORD"},
+		{map[string]string{"SAGE_DB_AUTH": "kerberos"}, "SAGE_DB_AUTH"},
+	}
+	for _, tt := range tests {
+		_, err := loadWith(t, tt.env)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%v: %v, want it loaded", tt.env, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%v: error = %v, want it rejected over %s", tt.env, err, tt.want)
+		}
+	}
+}
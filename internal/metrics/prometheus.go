@@ -0,0 +1,198 @@
+// Package metrics exposes the business metrics of sync runs to Prometheus.
+// It writes the Prometheus text format itself, so the sync engine does not
+// depend on the Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	syncsvc "github.com/arduriki/sage-bitrix-sync/internal/sync"
+)
+
+// DurationBuckets are the upper bounds, in seconds, of the run duration
+// histogram.
+var DurationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+
+// series is what is known of the runs of one client and entity.
+type series struct {
+	lastRun     float64 // Unix time
+	lastSuccess float64 // 0 or 1
+
+	created, updated, skipped, failed float64
+	apiRequests                       float64
+	throttleWait                      float64 // Seconds
+	sageQueries                       float64
+	sageQueryTime                     float64 // Seconds
+
+	buckets       []uint64 // Runs per DurationBuckets bound, not cumulative
+	durationSum   float64
+	durationCount uint64
+}
+
+// key identifies a series by its labels.
+type key struct {
+	client string
+	entity string
+}
+
+// Prometheus is a sync.MetricsRecorder keeping per-client and per-entity
+// metrics for Prometheus to scrape, through ServeHTTP, or for the
+// node_exporter textfile collector, through WriteFile.
+type Prometheus struct {
+	mu     sync.Mutex
+	series map[key]*series
+}
+
+// NewPrometheus creates an empty recorder.
+func NewPrometheus() *Prometheus {
+	return &Prometheus{series: make(map[key]*series)}
+}
+
+// RecordRun implements sync.MetricsRecorder.
+func (p *Prometheus) RecordRun(run syncsvc.RunMetrics) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k := key{client: run.ClientID, entity: run.Entity}
+	s, ok := p.series[k]
+	if !ok {
+		s = &series{buckets: make([]uint64, len(DurationBuckets))}
+		p.series[k] = s
+	}
+
+	s.lastRun = float64(run.Finished.Unix())
+	s.lastSuccess = 0
+	if run.Success {
+		s.lastSuccess = 1
+	}
+	s.created += float64(run.Created)
+	s.updated += float64(run.Updated)
+	s.skipped += float64(run.Skipped)
+	s.failed += float64(run.Failed)
+	s.apiRequests += float64(run.APIRequests)
+	s.throttleWait += run.ThrottleWait.Seconds()
+	s.sageQueries += float64(run.SageQueries)
+	s.sageQueryTime += run.SageQueryTime.Seconds()
+
+	seconds := run.Duration.Seconds()
+	for i, bound := range DurationBuckets {
+		if seconds <= bound {
+			s.buckets[i]++
+			break
+		}
+	}
+	s.durationSum += seconds
+	s.durationCount++
+}
+
+// metric is one metric family of the exposition.
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(*series) float64
+}
+
+var metricFamilies = []metric{
+	{"sage_bitrix_sync_last_run_timestamp_seconds", "gauge", "When the last run finished.", func(s *series) float64 { return s.lastRun }},
+	{"sage_bitrix_sync_last_run_success", "gauge", "Whether the last run finished without errors.", func(s *series) float64 { return s.lastSuccess }},
+	{"sage_bitrix_sync_created_total", "counter", "Items created in Bitrix24.", func(s *series) float64 { return s.created }},
+	{"sage_bitrix_sync_updated_total", "counter", "Items updated in Bitrix24.", func(s *series) float64 { return s.updated }},
+	{"sage_bitrix_sync_skipped_total", "counter", "Items left alone.", func(s *series) float64 { return s.skipped }},
+	{"sage_bitrix_sync_failed_total", "counter", "Items that failed to sync.", func(s *series) float64 { return s.failed }},
+	{"sage_bitrix_sync_bitrix_api_calls_total", "counter", "Bitrix24 REST calls, including retries.", func(s *series) float64 { return s.apiRequests }},
+	{"sage_bitrix_sync_throttle_wait_seconds_total", "counter", "Time spent waiting for the Bitrix24 rate limiter.", func(s *series) float64 { return s.throttleWait }},
+	{"sage_bitrix_sync_sage_queries_total", "counter", "Sage queries, including retries.", func(s *series) float64 { return s.sageQueries }},
+	{"sage_bitrix_sync_sage_query_seconds_total", "counter", "Time spent in Sage queries.", func(s *series) float64 { return s.sageQueryTime }},
+}
+
+// durationMetric is the name of the run duration histogram.
+const durationMetric = "sage_bitrix_sync_run_duration_seconds"
+
+// Write writes the metrics in the Prometheus text format.
+func (p *Prometheus) Write(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := make([]key, 0, len(p.series))
+	for k := range p.series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].client != keys[j].client {
+			return keys[i].client < keys[j].client
+		}
+		return keys[i].entity < keys[j].entity
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metricFamilies {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, k := range keys {
+			fmt.Fprintf(bw, "%s{%s} %s\n", m.name, labels(k), formatValue(m.value(p.series[k])))
+		}
+	}
+
+	fmt.Fprintf(bw, "# HELP %s Duration of the runs.\n# TYPE %s histogram\n", durationMetric, durationMetric)
+	for _, k := range keys {
+		s := p.series[k]
+		var cumulative uint64
+		for i, bound := range DurationBuckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(bw, "%s_bucket{%s,le=\"%s\"} %d\n", durationMetric, labels(k), formatValue(bound), cumulative)
+		}
+		fmt.Fprintf(bw, "%s_bucket{%s,le=\"+Inf\"} %d\n", durationMetric, labels(k), s.durationCount)
+		fmt.Fprintf(bw, "%s_sum{%s} %s\n", durationMetric, labels(k), formatValue(s.durationSum))
+		fmt.Fprintf(bw, "%s_count{%s} %d\n", durationMetric, labels(k), s.durationCount)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := p.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// WriteFile writes the metrics to path, replacing it at once so the
+// textfile collector never reads a partial file.
+func (p *Prometheus) WriteFile(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	if err := p.Write(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// labels formats the labels of a series.
+func labels(k key) string {
+	return `client="` + escapeLabel(k.client) + `",entity="` + escapeLabel(k.entity) + `"`
+}
+
+// escapeLabel escapes a label value for the text format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatValue formats a sample value.
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// Articulo represents a product in the Sage system.
+type Articulo struct {
+	CodigoEmpresa  int     `json:"codigo_empresa" db:"CodigoEmpresa"`
+	CodigoArticulo string  `json:"codigo_articulo" db:"CodigoArticulo"` // The SKU
+	Descripcion    string  `json:"descripcion" db:"DescripcionArticulo"`
+	Precio         string  `json:"precio" db:"PrecioVenta"` // Exact decimal as stored in Sage, e.g. "12.3450000000"
+	CodigoIva      int     `json:"codigo_iva" db:"CodigoIva"`
+	IVA            float64 `json:"iva" db:"Iva"`                      // VAT rate in percent, e.g. 21
+	UnidadMedida   string  `json:"unidad_medida" db:"UnidadMedida2_"` // Sales unit, e.g. "UN" or "KG"
+	Activo         bool    `json:"activo"`                            // False once the articulo is obsolete
+}
+
+// IsValid checks if the articulo has the SKU it is matched by.
+func (a *Articulo) IsValid() bool {
+	return a.CodigoArticulo != ""
+}
+
+// ScanFromDB scans a database row into the Articulo struct. The price is
+// scanned as a string so it keeps every decimal Sage stores.
+func (a *Articulo) ScanFromDB(rows *sql.Rows) error {
+	return rows.Scan(
+		&a.CodigoEmpresa,
+		&a.CodigoArticulo,
+		&a.Descripcion,
+		&a.Precio,
+		&a.CodigoIva,
+		&a.IVA,
+		&a.UnidadMedida,
+		&a.Activo,
+	)
+}
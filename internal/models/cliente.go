@@ -0,0 +1,53 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Cliente represents a customer account in the Sage system.
+type Cliente struct {
+	CodigoEmpresa int    `json:"codigo_empresa" db:"CodigoEmpresa"`
+	CodigoCliente string `json:"codigo_cliente" db:"CodigoCliente"`
+	RazonSocial   string `json:"razon_social" db:"RazonSocial"`
+	CIF           string `json:"cif" db:"CifDni"` // CIF of a company or NIF/NIE of an individual
+	Email         string `json:"email" db:"EMail1"`
+	Telefono      string `json:"telefono" db:"Telefono"`
+	Domicilio     string `json:"domicilio" db:"Domicilio"`
+	CodigoPostal  string `json:"codigo_postal" db:"CodigoPostal"`
+	Municipio     string `json:"municipio" db:"Municipio"`
+	Provincia     string `json:"provincia" db:"Provincia"`
+}
+
+// IsValid checks if the cliente has the tax ID it is matched by.
+func (c *Cliente) IsValid() bool {
+	return c.CIF != ""
+}
+
+// IsIndividual reports whether the tax ID is a person's NIF or NIE rather
+// than a company CIF. NIFs start with a digit, NIEs with X, Y or Z and
+// special NIFs with K, L or M; CIFs start with the letter of the legal form.
+func (c *Cliente) IsIndividual() bool {
+	cif := strings.ToUpper(strings.TrimSpace(c.CIF))
+	if cif == "" {
+		return false
+	}
+	first := cif[0]
+	return (first >= '0' && first <= '9') || strings.IndexByte("XYZKLM", first) >= 0
+}
+
+// ScanFromDB scans a database row into the Cliente struct.
+func (c *Cliente) ScanFromDB(rows *sql.Rows) error {
+	return rows.Scan(
+		&c.CodigoEmpresa,
+		&c.CodigoCliente,
+		&c.RazonSocial,
+		&c.CIF,
+		&c.Email,
+		&c.Telefono,
+		&c.Domicilio,
+		&c.CodigoPostal,
+		&c.Municipio,
+		&c.Provincia,
+	)
+}
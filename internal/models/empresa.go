@@ -0,0 +1,72 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrEmpresaWithoutCIF is returned by Validate for an empresa without the
+// CIF it is matched by.
+var ErrEmpresaWithoutCIF = errors.New("empresa has no CIF")
+
+// Empresa represents a company in the Sage system, with the fiscal data
+// needed for its Bitrix24 requisite.
+type Empresa struct {
+	CodigoEmpresa int    `json:"codigo_empresa" db:"CodigoEmpresa"`
+	RazonSocial   string `json:"razon_social" db:"RazonSocial"`
+	CIF           string `json:"cif" db:"CifDni"`
+	Domicilio     string `json:"domicilio" db:"Domicilio"`
+	CodigoPostal  string `json:"codigo_postal" db:"CodigoPostal"`
+	Municipio     string `json:"municipio" db:"Municipio"`
+	Provincia     string `json:"provincia" db:"Provincia"`
+	Telefono      string `json:"telefono" db:"Telefono"`
+	Email         string `json:"email" db:"EMail1"`
+}
+
+// IsValid checks if the empresa has the CIF it is matched by.
+func (e *Empresa) IsValid() bool {
+	return e.CIF != ""
+}
+
+// Validate reports why the empresa cannot be synced: it has no CIF, or the
+// CIF is not a well-formed Spanish tax ID.
+func (e *Empresa) Validate() error {
+	if !e.IsValid() {
+		return fmt.Errorf("empresa %d: %w", e.CodigoEmpresa, ErrEmpresaWithoutCIF)
+	}
+	if !ValidTaxID(e.CIF) {
+		return fmt.Errorf("empresa %d: invalid CIF %q", e.CodigoEmpresa, e.CIF)
+	}
+	return nil
+}
+
+// ScanFromDB scans a database row into the Empresa struct. Every column
+// but CodigoEmpresa may be NULL and is read as an empty string.
+func (e *Empresa) ScanFromDB(rows *sql.Rows) error {
+	var razonSocial, cif, domicilio, codigoPostal, municipio, provincia, telefono, email sql.NullString
+	err := rows.Scan(
+		&e.CodigoEmpresa,
+		&razonSocial,
+		&cif,
+		&domicilio,
+		&codigoPostal,
+		&municipio,
+		&provincia,
+		&telefono,
+		&email,
+	)
+	if err != nil {
+		return err
+	}
+
+	e.RazonSocial = razonSocial.String
+	e.CIF = cif.String
+	e.Domicilio = domicilio.String
+	e.CodigoPostal = codigoPostal.String
+	e.Municipio = municipio.String
+	e.Provincia = provincia.String
+	e.Telefono = telefono.String
+	e.Email = email.String
+	return nil
+}
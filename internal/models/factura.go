@@ -0,0 +1,54 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Factura represents an issued invoice header in the Sage system.
+type Factura struct {
+	CodigoEmpresa    int       `json:"codigo_empresa" db:"CodigoEmpresa"`
+	EjercicioFactura int       `json:"ejercicio_factura" db:"EjercicioFactura"`
+	SerieFactura     string    `json:"serie_factura" db:"SerieFactura"`
+	NumeroFactura    int       `json:"numero_factura" db:"NumeroFactura"`
+	FechaFactura     time.Time `json:"fecha_factura" db:"FechaFactura"`
+	CodigoCliente    string    `json:"codigo_cliente" db:"CodigoCliente"`
+	RazonSocial      string    `json:"razon_social" db:"RazonSocial"`
+	CIF              string    `json:"cif" db:"CifDni"` // Tax ID of the cliente
+	BaseImponible    float64   `json:"base_imponible" db:"BaseImponible"`
+	TotalIva         float64   `json:"total_iva" db:"TotalIva"`
+	Importe          float64   `json:"importe" db:"ImporteLiquido"` // Invoice total
+	Divisa           string    `json:"divisa" db:"CodigoDivisa"`
+	Estado           int       `json:"estado" db:"StatusContabilizado"` // 0 until posted to accounting, then -1
+}
+
+// Number is the invoice number the Bitrix24 deal is matched by. It includes
+// the empresa, since each empresa numbers its invoices independently.
+func (f *Factura) Number() string {
+	return fmt.Sprintf("%d-%d-%s%d", f.CodigoEmpresa, f.EjercicioFactura, f.SerieFactura, f.NumeroFactura)
+}
+
+// IsValid checks if the factura has been numbered.
+func (f *Factura) IsValid() bool {
+	return f.NumeroFactura > 0
+}
+
+// ScanFromDB scans a database row into the Factura struct.
+func (f *Factura) ScanFromDB(rows *sql.Rows) error {
+	return rows.Scan(
+		&f.CodigoEmpresa,
+		&f.EjercicioFactura,
+		&f.SerieFactura,
+		&f.NumeroFactura,
+		&f.FechaFactura,
+		&f.CodigoCliente,
+		&f.RazonSocial,
+		&f.CIF,
+		&f.BaseImponible,
+		&f.TotalIva,
+		&f.Importe,
+		&f.Divisa,
+		&f.Estado,
+	)
+}
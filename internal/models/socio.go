@@ -1,8 +1,13 @@
 package models
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"fmt"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
 )
 
@@ -15,6 +20,18 @@ type Socio struct {
 	DNI                 string  `json:"dni" db:"DNI"`
 	RazonSocialEmpleado string  `json:"razon_social_empleado" db:"RazonSocialEmpleado"`
 
+	// Ejercicio is the year of the SociosHistorico row, so the latest of a
+	// persona's rows can be told apart from older ones.
+	Ejercicio int `json:"ejercicio" db:"Ejercicio"`
+
+	// Database is the Sage database the socio was read from, set when the
+	// socios of several databases are synced together.
+	Database string `json:"database,omitempty" db:"-"`
+
+	// NullColumns lists the columns that were NULL in Sage, read as zero
+	// values, so they can be reported.
+	NullColumns []string `json:"null_columns,omitempty" db:"-"`
+
 	CreatedAt *time.Time `json:"created_at,omitempty" db:"created_at"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty" db:"updated_at"`
 }
@@ -23,7 +40,7 @@ type BitrixSocio struct {
 	ID           int        `json:"id"`
 	Title        string     `json:"title"`
 	CreatedTime  *time.Time `json:"createdTime,omitempty"`
-	UpdatedTime  *time.Time `json:"updatedTIme,omitempty"`
+	UpdatedTime  *time.Time `json:"updatedTime,omitempty"`
 	CategoryId   *int       `json:"categoryId,omitempty"`
 	EntityTypeId *int       `json:"entityTypeId,omitempty"`
 
@@ -97,11 +114,85 @@ func (s *Socio) IsValid() bool {
 	return s.DNI != ""
 }
 
+// ContentHash returns a hash of the values synced to Bitrix24, so a run can
+// tell whether a socio changed since it was last synced. Timestamps are left
+// out: touching a row without changing it does not need a sync, and so is
+// the DNI's formatting, hashed normalized.
+func (s *Socio) ContentHash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|%t|%s|%s|%s",
+		s.CodigoEmpresa, formatFloat(s.PorParticipacion), s.Administrador,
+		s.CargoAdministrador, NormalizeDNI(s.DNI), s.RazonSocialEmpleado)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Socio fields that Bitrix24 edits may be written back to Sage for.
+const (
+	FieldCargo         = "cargo"
+	FieldParticipacion = "participacion"
+	FieldAdministrador = "administrador"
+)
+
+// WritableFields lists the fields SetField accepts.
+var WritableFields = []string{FieldCargo, FieldParticipacion, FieldAdministrador}
+
+// SetField sets a writable field from its Bitrix24 representation: the cargo
+// label, the participation percentage or "Y"/"N".
+func (s *Socio) SetField(field, value string) error {
+	switch field {
+	case FieldCargo:
+		s.CargoAdministrador = value
+	case FieldParticipacion:
+		f, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(value), ",", ".", 1), 64)
+		if err != nil {
+			return fmt.Errorf("invalid participación %q: %w", value, err)
+		}
+		s.PorParticipacion = f
+	case FieldAdministrador:
+		switch value {
+		case "Y":
+			s.Administrador = true
+		case "N":
+			s.Administrador = false
+		default:
+			return fmt.Errorf("invalid administrador flag %q", value)
+		}
+	default:
+		return fmt.Errorf("field %q cannot be written back to Sage", field)
+	}
+	return nil
+}
+
 // String returns a string representation of the Socio.
 func (s *Socio) String() string {
 	return "Socio{DNI: " + s.DNI + ", RazonSocial: " + s.RazonSocialEmpleado + "}"
 }
 
+// ParseTitleTemplate parses a text/template used to build Bitrix item titles
+// from a Socio, e.g. "SOCIO – {{.RazonSocialEmpleado}} ({{.DNI}})". The
+// template is executed once against a sample socio so that references to
+// unknown fields are caught at config load time.
+func ParseTitleTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("title").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid title template: %w", err)
+	}
+
+	sample := &Socio{DNI: "00000000T", RazonSocialEmpleado: "Sample"}
+	if _, err := RenderTitle(tmpl, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// RenderTitle executes a title template for a socio.
+func RenderTitle(tmpl *template.Template, socio *Socio) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, socio); err != nil {
+		return "", fmt.Errorf("invalid title template: %w", err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
 // formatFloat converts float64 to string for Bitrix API.
 func formatFloat(f float64) string {
 	return strconv.FormatFloat(f, 'f', 2, 64)
@@ -115,15 +206,59 @@ func parseFloat(s string) float64 {
 	return 0.0
 }
 
+// RowScanner is a database row, *sql.Rows or *sql.Row.
+type RowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 // ScanFromDB scans database row into Socio struct
 // this helps with sql.Rows.Scan() when reading from database.
-func (s *Socio) ScanFromDB(rows *sql.Rows) error {
-	return rows.Scan(
-		&s.CodigoEmpresa,
-		&s.PorParticipacion,
-		&s.Administrador,
-		&s.CargoAdministrador,
-		&s.DNI,
-		&s.RazonSocialEmpleado,
+// NULL columns are read as zero values and listed in NullColumns, so a
+// socio missing its cargo or razón social still syncs.
+func (s *Socio) ScanFromDB(rows RowScanner) error {
+	var (
+		codigoEmpresa, ejercicio sql.NullInt64
+		participacion            sql.NullFloat64
+		administrador            sql.NullBool
+		cargo, dni, razonSocial  sql.NullString
+	)
+	err := rows.Scan(
+		&codigoEmpresa,
+		&participacion,
+		&administrador,
+		&cargo,
+		&dni,
+		&razonSocial,
+		&ejercicio,
 	)
+	if err != nil {
+		return err
+	}
+
+	s.CodigoEmpresa = int(codigoEmpresa.Int64)
+	s.PorParticipacion = participacion.Float64
+	s.Administrador = administrador.Bool
+	s.CargoAdministrador = cargo.String
+	s.DNI = dni.String
+	s.RazonSocialEmpleado = razonSocial.String
+	s.Ejercicio = int(ejercicio.Int64)
+
+	s.NullColumns = nil
+	for _, column := range []struct {
+		name  string
+		valid bool
+	}{
+		{"CodigoEmpresa", codigoEmpresa.Valid},
+		{"PorParticipacion", participacion.Valid},
+		{"Administrador", administrador.Valid},
+		{"CargoAdministrador", cargo.Valid},
+		{"DNI", dni.Valid},
+		{"RazonSocialEmpleado", razonSocial.Valid},
+		{"Ejercicio", ejercicio.Valid},
+	} {
+		if !column.valid {
+			s.NullColumns = append(s.NullColumns, column.name)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// nifLetters are the NIF control letters, indexed by the number modulo 23.
+const nifLetters = "TRWAGMYFPDXBNJZSQVHLCKE"
+
+// cifControlLetters are the CIF control letters, indexed by control digit.
+const cifControlLetters = "JABCDEFGHI"
+
+// NormalizeDNI returns the canonical form of a DNI or other tax ID, the
+// form Sage and Bitrix24 records are matched by: uppercase, without
+// whitespace, dashes or dots, so " 12345678-z " becomes "12345678Z".
+func NormalizeDNI(dni string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r), r == '-', r == '.':
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, dni)
+}
+
+// ValidTaxID reports whether id is a well-formed Spanish tax ID with a
+// correct control character: a NIF (DNI), an NIE, a K/L/M NIF or a CIF.
+// It is checked in its NormalizeDNI form.
+func ValidTaxID(id string) bool {
+	id = NormalizeDNI(id)
+	if len(id) != 9 {
+		return false
+	}
+
+	switch first := id[0]; {
+	case isDigit(first):
+		return validNIF(id[:8], id[8])
+	case first == 'X' || first == 'Y' || first == 'Z':
+		return validNIF(strconv.Itoa(strings.IndexByte("XYZ", first))+id[1:8], id[8])
+	case first == 'K' || first == 'L' || first == 'M':
+		return validNIF(id[1:8], id[8])
+	default:
+		return validCIF(id)
+	}
+}
+
+// validNIF checks the control letter of a NIF number.
+func validNIF(digits string, letter byte) bool {
+	n := 0
+	for i := 0; i < len(digits); i++ {
+		if !isDigit(digits[i]) {
+			return false
+		}
+		n = n*10 + int(digits[i]-'0')
+	}
+	return nifLetters[n%23] == letter
+}
+
+// validCIF checks the organisation letter and control character of a CIF.
+// Some organisation types take a control letter, some a digit, the rest
+// either.
+func validCIF(id string) bool {
+	kind := id[0]
+	if !strings.ContainsRune("ABCDEFGHJNPQRSUVW", rune(kind)) {
+		return false
+	}
+
+	sum := 0
+	for i := 1; i <= 7; i++ {
+		if !isDigit(id[i]) {
+			return false
+		}
+		d := int(id[i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			d = d/10 + d%10
+		}
+		sum += d
+	}
+	digit := (10 - sum%10) % 10
+	control := id[8]
+
+	switch {
+	case strings.ContainsRune("NPQRSW", rune(kind)):
+		return control == cifControlLetters[digit]
+	case strings.ContainsRune("ABEH", rune(kind)):
+		return control == byte('0'+digit)
+	default:
+		return control == cifControlLetters[digit] || control == byte('0'+digit)
+	}
+}
+
+// isDigit reports whether b is an ASCII digit.
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
@@ -0,0 +1,44 @@
+package models
+
+import "testing"
+
+// messyDNIs are tax IDs as they turn up in Sage and Bitrix24, by the form
+// they are matched by.
+var messyDNIs = map[string][]string{
+	"12345678Z": {"12345678Z", "12345678z", " 12345678Z ", "\t12345678z\n", "12345678-Z", "12.345.678-Z", "12 345 678 z", "1234 5678Z"},
+	"X1234567L": {"X1234567L", "x1234567l", "X-1234567-L", " x 1234567 L", "X.1234567.L"},
+	"B12345674": {"B12345674", "b-12345674", "B 1234567 4", " B.12.345.674 "},
+}
+
+func TestNormalizeDNI(t *testing.T) {
+	for want, inputs := range messyDNIs {
+		for _, dni := range inputs {
+			if got := NormalizeDNI(dni); got != want {
+				t.Errorf("NormalizeDNI(%q) = %q, want %q", dni, got, want)
+			}
+			if !ValidTaxID(dni) {
+				t.Errorf("ValidTaxID(%q) = false, want true", dni)
+			}
+		}
+	}
+	for _, dni := range []string{"", " ", " - . "} {
+		if got := NormalizeDNI(dni); got != "" {
+			t.Errorf("NormalizeDNI(%q) = %q, want empty", dni, got)
+		}
+	}
+}
+
+// TestContentHashNormalizesDNI checks reformatting a DNI in Sage does not
+// read as a change of the socio.
+func TestContentHashNormalizesDNI(t *testing.T) {
+	for want, inputs := range messyDNIs {
+		socio := Socio{CodigoEmpresa: 1, DNI: want, RazonSocialEmpleado: "Ana"}
+		hash := socio.ContentHash()
+		for _, dni := range inputs {
+			socio.DNI = dni
+			if got := socio.ContentHash(); got != hash {
+				t.Errorf("ContentHash with DNI %q = %s, want %s as with %s", dni, got, hash, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// bitrixTimeLayouts lists the date-time formats Bitrix24 is known to emit.
+// crm.item.* methods use RFC 3339; older crm.* methods and some portals use
+// the others.
+var bitrixTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"02.01.2006 15:04:05",
+	"2006-01-02",
+}
+
+// ParseBitrixTime decodes a JSON date-time value from Bitrix24. Missing,
+// null and empty values return nil. Values without a timezone are taken as UTC.
+func ParseBitrixTime(raw json.RawMessage) (*time.Time, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("invalid Bitrix time %s: %w", string(raw), err)
+	}
+	if s == "" {
+		return nil, nil
+	}
+
+	for _, layout := range bitrixTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("unrecognized Bitrix time format %q", s)
+}
+
+// UnmarshalJSON decodes a BitrixSocio, parsing createdTime/updatedTime with
+// ParseBitrixTime.
+func (bs *BitrixSocio) UnmarshalJSON(data []byte) error {
+	type plain BitrixSocio
+	aux := struct {
+		*plain
+		CreatedTime json.RawMessage `json:"createdTime"`
+		UpdatedTime json.RawMessage `json:"updatedTime"`
+	}{plain: (*plain)(bs)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	var err error
+	if bs.CreatedTime, err = ParseBitrixTime(aux.CreatedTime); err != nil {
+		return err
+	}
+	if bs.UpdatedTime, err = ParseBitrixTime(aux.UpdatedTime); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseBitrixTime(t *testing.T) {
+	madrid := time.FixedZone("", 2*60*60)
+	tests := []struct {
+		raw  string
+		want time.Time
+	}{
+		{`"2024-05-03T12:30:00+02:00"`, time.Date(2024, 5, 3, 12, 30, 0, 0, madrid)},
+		{`"2024-05-03T10:30:00Z"`, time.Date(2024, 5, 3, 10, 30, 0, 0, time.UTC)},
+		{`"2024-05-03T12:30:00+0200"`, time.Date(2024, 5, 3, 12, 30, 0, 0, madrid)},
+		{`"2024-05-03T10:30:00"`, time.Date(2024, 5, 3, 10, 30, 0, 0, time.UTC)},
+		{`"2024-05-03 10:30:00"`, time.Date(2024, 5, 3, 10, 30, 0, 0, time.UTC)},
+		{`"03.05.2024 10:30:00"`, time.Date(2024, 5, 3, 10, 30, 0, 0, time.UTC)},
+		{`"2024-05-03"`, time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseBitrixTime(json.RawMessage(tt.raw))
+		if err != nil {
+			t.Errorf("ParseBitrixTime(%s): %v", tt.raw, err)
+			continue
+		}
+		if got == nil || !got.Equal(tt.want) {
+			t.Errorf("ParseBitrixTime(%s) = %v, want %s", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestParseBitrixTimeEmpty(t *testing.T) {
+	for _, raw := range []string{"", "null", `""`} {
+		got, err := ParseBitrixTime(json.RawMessage(raw))
+		if err != nil || got != nil {
+			t.Errorf("ParseBitrixTime(%q) = %v, %v, want nil and no error", raw, got, err)
+		}
+	}
+}
+
+func TestParseBitrixTimeInvalid(t *testing.T) {
+	for _, raw := range []string{`"yesterday"`, `"2024-13-45T00:00:00Z"`, `1714732200`, `{}`} {
+		if got, err := ParseBitrixTime(json.RawMessage(raw)); err == nil {
+			t.Errorf("ParseBitrixTime(%s) = %v, want an error", raw, got)
+		}
+	}
+}
+
+func TestBitrixSocioTimes(t *testing.T) {
+	var socio BitrixSocio
+	err := json.Unmarshal([]byte(`{"id":7,"createdTime":"2024-05-03T12:30:00+02:00","updatedTime":null,"ufCrm55Dni":"12345678Z"}`), &socio)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if socio.CreatedTime == nil || !socio.CreatedTime.Equal(time.Date(2024, 5, 3, 10, 30, 0, 0, time.UTC)) {
+		t.Errorf("CreatedTime = %v, want 2024-05-03 10:30 UTC", socio.CreatedTime)
+	}
+	if socio.UpdatedTime != nil {
+		t.Errorf("UpdatedTime = %v for null, want nil", socio.UpdatedTime)
+	}
+	if socio.ID != 7 || socio.DNI != "12345678Z" {
+		t.Errorf("other fields = %d %q, want 7 12345678Z", socio.ID, socio.DNI)
+	}
+
+	if err := json.Unmarshal([]byte(`{"id":7,"updatedTime":"soon"}`), &socio); err == nil {
+		t.Error("Unmarshal with an unparsable updatedTime succeeded, want an error")
+	}
+}
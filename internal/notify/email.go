@@ -0,0 +1,233 @@
+// Package notify emails the summary of a sync run to the client's admins.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+)
+
+// MaxErrors is how many errors, and how many warnings, a summary lists.
+const MaxErrors = 5
+
+// Summary is what the email says about a run.
+type Summary struct {
+	ClientID  string
+	Entity    string
+	RunID     string
+	StartTime time.Time
+	Duration  string
+	Success   bool // No errors; warnings are allowed
+	Aborted   bool // Stopped early, rather than finished with failed items
+	TimedOut  bool // Stopped for exceeding its maximum duration
+	DryRun    bool
+
+	Created int
+	Updated int
+	Skipped int
+	Failed  int
+
+	// Errors holds at most MaxErrors errors out of TotalErrors, and Warnings
+	// at most MaxErrors warnings out of TotalWarnings.
+	Errors        []string
+	TotalErrors   int
+	Warnings      []string
+	TotalWarnings int
+}
+
+// HasFailures reports whether the run failed or had failed items.
+func (s Summary) HasFailures() bool {
+	return !s.Success || s.Failed > 0
+}
+
+// Status is the one-word outcome of the run.
+func (s Summary) Status() string {
+	switch {
+	case s.TimedOut:
+		return "timeout"
+	case s.Aborted:
+		return "failed"
+	case !s.Success || s.Failed > 0:
+		return "partial"
+	default:
+		return "success"
+	}
+}
+
+// MoreErrors is how many errors the summary leaves out.
+func (s Summary) MoreErrors() int {
+	return s.TotalErrors - len(s.Errors)
+}
+
+// MoreWarnings is how many warnings the summary leaves out.
+func (s Summary) MoreWarnings() int {
+	return s.TotalWarnings - len(s.Warnings)
+}
+
+var subjectTemplate = texttemplate.Must(texttemplate.New("subject").Parse(
+	`[{{.ClientID}}] Sync {{.Entity}} {{.StartTime.Format "02/01 15:04"}}: {{.Status}}, ` +
+		`{{.Created}} created, {{.Updated}} updated, {{.Failed}} failed`))
+
+var textTemplate = texttemplate.Must(texttemplate.New("text").Parse(`Sync of {{.Entity}} for client {{.ClientID}}
+Started {{.StartTime.Format "02/01/2006 15:04"}}, took {{.Duration}}{{if .DryRun}} (dry run, nothing written){{end}}
+
+Result:  {{.Status}}
+Created: {{.Created}}
+Updated: {{.Updated}}
+Skipped: {{.Skipped}}
+Failed:  {{.Failed}}
+{{if .Errors}}
+Errors:
+{{range .Errors}}- {{.}}
+{{end}}{{if .MoreErrors}}... and {{.MoreErrors}} more
+{{end}}{{end}}{{if .Warnings}}
+Warnings:
+{{range .Warnings}}- {{.}}
+{{end}}{{if .MoreWarnings}}... and {{.MoreWarnings}} more
+{{end}}{{end}}
+Run {{.RunID}}
+`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif">
+<h2>Sync of {{.Entity}} for client {{.ClientID}}</h2>
+<p>Started {{.StartTime.Format "02/01/2006 15:04"}}, took {{.Duration}}{{if .DryRun}} <em>(dry run, nothing written)</em>{{end}}</p>
+<table cellpadding="4">
+<tr><th align="left">Result</th><td><strong>{{.Status}}</strong></td></tr>
+<tr><th align="left">Created</th><td>{{.Created}}</td></tr>
+<tr><th align="left">Updated</th><td>{{.Updated}}</td></tr>
+<tr><th align="left">Skipped</th><td>{{.Skipped}}</td></tr>
+<tr><th align="left">Failed</th><td>{{.Failed}}</td></tr>
+</table>
+{{if .Errors}}<h3 style="color: #c00">Errors</h3>
+<ul>{{range .Errors}}<li>{{.}}</li>{{end}}</ul>
+{{if .MoreErrors}}<p>... and {{.MoreErrors}} more</p>{{end}}{{end}}
+{{if .Warnings}}<h3 style="color: #a60">Warnings</h3>
+<ul style="color: #a60">{{range .Warnings}}<li>{{.}}</li>{{end}}</ul>
+{{if .MoreWarnings}}<p>... and {{.MoreWarnings}} more</p>{{end}}{{end}}
+<p style="color: #888">Run {{.RunID}}</p>
+</body></html>
+`))
+
+// Render builds the subject and the plain-text and HTML bodies of a summary.
+func Render(summary Summary) (subject, text, html string, err error) {
+	var buf bytes.Buffer
+	if err := subjectTemplate.Execute(&buf, summary); err != nil {
+		return "", "", "", fmt.Errorf("failed to render subject: %w", err)
+	}
+	subject = buf.String()
+
+	buf.Reset()
+	if err := textTemplate.Execute(&buf, summary); err != nil {
+		return "", "", "", fmt.Errorf("failed to render text body: %w", err)
+	}
+	text = buf.String()
+
+	buf.Reset()
+	if err := htmlTemplate.Execute(&buf, summary); err != nil {
+		return "", "", "", fmt.Errorf("failed to render HTML body: %w", err)
+	}
+	return subject, text, buf.String(), nil
+}
+
+// Send emails the summary through the SMTP server of cfg, giving up when ctx
+// is done.
+func Send(ctx context.Context, cfg config.NotifyConfig, summary Summary) error {
+	subject, text, html, err := Render(summary)
+	if err != nil {
+		return err
+	}
+	msg := buildMessage(cfg.From, cfg.To, subject, text, html)
+
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if cfg.SMTPPort == 465 {
+		conn = tls.Client(conn, &tls.Config{ServerName: cfg.SMTPHost})
+	}
+
+	client, err := smtp.NewClient(conn, cfg.SMTPHost)
+	if err != nil {
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && cfg.SMTPPort != 465 {
+		if err := client.StartTLS(&tls.Config{ServerName: cfg.SMTPHost}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if cfg.SMTPUsername != "" {
+		auth := smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(cfg.From); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	for _, to := range cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("failed to add recipient %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildMessage builds a multipart/alternative message with both bodies.
+func buildMessage(from string, to []string, subject, text, html string) []byte {
+	var b [12]byte
+	rand.Read(b[:])
+	boundary := "sync-" + hex.EncodeToString(b[:])
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", text},
+		{"text/html", html},
+	} {
+		fmt.Fprintf(&msg, "--%s\r\n", boundary)
+		fmt.Fprintf(&msg, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		fmt.Fprintf(&msg, "Content-Transfer-Encoding: 8bit\r\n\r\n")
+		msg.WriteString(strings.ReplaceAll(part.body, "\n", "\r\n"))
+		msg.WriteString("\r\n")
+	}
+	fmt.Fprintf(&msg, "--%s--\r\n", boundary)
+	return msg.Bytes()
+}
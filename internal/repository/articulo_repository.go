@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// ErrArticuloNotFound is returned by GetByCodigo for an articulo that does
+// not exist.
+var ErrArticuloNotFound = errors.New("articulo not found")
+
+// ArticuloRepository handles database operations for Articulo entities
+type ArticuloRepository struct {
+	db     *sql.DB
+	tables Tables
+}
+
+// NewArticuloRepository creates a new repository instance, reading the tables
+// named by tables
+func NewArticuloRepository(db *sql.DB, tables Tables) *ArticuloRepository {
+	return &ArticuloRepository{
+		db:     db,
+		tables: tables,
+	}
+}
+
+// articuloColumns selects the Articulos columns in ScanFromDB order, with the
+// VAT rate of the articulo's sales VAT code. Obsolete articulos are inactive.
+// The price stays a decimal, which the driver scans into a string.
+const articuloColumns = `
+			a.CodigoEmpresa,
+			a.CodigoArticulo,
+			ISNULL(a.DescripcionArticulo, ''),
+			ISNULL(a.PrecioVenta, 0),
+			ISNULL(a.CodigoIva, 0),
+			ISNULL(t.[%Iva], 0),
+			ISNULL(a.UnidadMedida2_, ''),
+			CASE WHEN ISNULL(a.ObsoletoLc, 0) = 0 THEN 1 ELSE 0 END`
+
+// from joins the VAT rates to the articulos.
+func (r *ArticuloRepository) from() string {
+	return `
+		FROM ` + r.tables.Name("Articulos") + ` a
+		LEFT JOIN ` + r.tables.Name("TiposIva") + ` t ON t.CodigoIva = a.CodigoIva AND t.CodigoTerritorio = 0`
+}
+
+// GetAll retrieves every articulo from the Sage database
+func (r *ArticuloRepository) GetAll(ctx context.Context) ([]*models.Articulo, error) {
+	query := `
+		SELECT` + articuloColumns + r.from() + `
+		ORDER BY a.CodigoEmpresa, a.CodigoArticulo
+	`
+	return r.query(ctx, query)
+}
+
+// GetByEmpresa retrieves the articulos of one empresa
+func (r *ArticuloRepository) GetByEmpresa(ctx context.Context, codigoEmpresa int) ([]*models.Articulo, error) {
+	query := `
+		SELECT` + articuloColumns + r.from() + `
+		WHERE a.CodigoEmpresa = @sageCode
+		ORDER BY a.CodigoArticulo
+	`
+	return r.query(ctx, query, sql.Named("sageCode", codigoEmpresa))
+}
+
+// GetActive retrieves the articulos of one empresa that are not obsolete
+func (r *ArticuloRepository) GetActive(ctx context.Context, codigoEmpresa int) ([]*models.Articulo, error) {
+	query := `
+		SELECT` + articuloColumns + r.from() + `
+		WHERE a.CodigoEmpresa = @sageCode
+			AND ISNULL(a.ObsoletoLc, 0) = 0
+		ORDER BY a.CodigoArticulo
+	`
+	return r.query(ctx, query, sql.Named("sageCode", codigoEmpresa))
+}
+
+// GetByCodigo retrieves one articulo of an empresa by its SKU, or
+// ErrArticuloNotFound
+func (r *ArticuloRepository) GetByCodigo(ctx context.Context, codigoEmpresa int, codigoArticulo string) (*models.Articulo, error) {
+	query := `
+		SELECT` + articuloColumns + r.from() + `
+		WHERE a.CodigoEmpresa = @sageCode
+			AND a.CodigoArticulo = @codigoArticulo
+	`
+	articulos, err := r.query(ctx, query,
+		sql.Named("sageCode", codigoEmpresa),
+		sql.Named("codigoArticulo", codigoArticulo))
+	if err != nil {
+		return nil, err
+	}
+	if len(articulos) == 0 {
+		return nil, fmt.Errorf("articulo %s of empresa %d: %w", codigoArticulo, codigoEmpresa, ErrArticuloNotFound)
+	}
+	return articulos[0], nil
+}
+
+// Stream calls fn with each articulo of one empresa as it is read, so a
+// large catalog need not be held in memory. It stops at the first error fn
+// returns, and returns it.
+func (r *ArticuloRepository) Stream(ctx context.Context, codigoEmpresa int, fn func(*models.Articulo) error) error {
+	query := `
+		SELECT` + articuloColumns + r.from() + `
+		WHERE a.CodigoEmpresa = @sageCode
+		ORDER BY a.CodigoArticulo
+	`
+	return r.each(ctx, query, fn, sql.Named("sageCode", codigoEmpresa))
+}
+
+// query runs an articulos query and collects the articulos it returns
+func (r *ArticuloRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.Articulo, error) {
+	var articulos []*models.Articulo
+	err := r.each(ctx, query, func(articulo *models.Articulo) error {
+		articulos = append(articulos, articulo)
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return articulos, nil
+}
+
+// each runs an articulos query and calls fn with every valid row, skipping
+// rows that fail to scan
+func (r *ArticuloRepository) each(ctx context.Context, query string, fn func(*models.Articulo) error, args ...interface{}) error {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query articulos: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		articulo := &models.Articulo{}
+		err := articulo.ScanFromDB(rows)
+		if err != nil {
+			log.Printf("Warning: failed to scan articulo row: %v", err)
+			continue
+		}
+
+		if !articulo.IsValid() {
+			continue
+		}
+		if err := fn(articulo); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over articulo rows: %w", err)
+	}
+
+	return nil
+}
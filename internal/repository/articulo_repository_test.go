@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+var articuloRowColumns = []string{"CodigoEmpresa", "CodigoArticulo", "DescripcionArticulo", "PrecioVenta", "CodigoIva", "Iva", "UnidadMedida2_", "Activo"}
+
+func TestArticuloGetByEmpresa(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith(
+		"FROM [dbo].[Articulos] a",
+		"LEFT JOIN [dbo].[TiposIva] t ON t.CodigoIva = a.CodigoIva AND t.CodigoTerritorio = 0",
+		"WHERE a.CodigoEmpresa = @sageCode",
+		"ORDER BY a.CodigoArticulo")).
+		WithArgs(sql.Named("sageCode", 1)).
+		WillReturnRows(sqlmock.NewRows(articuloRowColumns).
+			AddRow(1, "A-1", "Tornillo", "12.3450000000", 1, 21.0, "UN", true).
+			AddRow(1, "A-2", "Tuerca", "0.1000000000", 2, 10.0, "KG", false).
+			AddRow(1, "", "Sin código", "1.0000000000", 1, 21.0, "UN", true).
+			AddRow(1, "A-3", "Roto", "1.0000000000", "IVA", 21.0, "UN", true))
+
+	articulos, err := NewArticuloRepository(db, Tables{}).GetByEmpresa(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetByEmpresa: %v", err)
+	}
+	if len(articulos) != 2 {
+		t.Fatalf("GetByEmpresa returned %d articulos, want 2: the one without SKU and the one failing to scan are skipped", len(articulos))
+	}
+	if a := articulos[0]; a.Precio != "12.3450000000" || a.IVA != 21 || !a.Activo {
+		t.Errorf("articulo A-1 = %+v, want its exact price, 21%% VAT and active", a)
+	}
+	if a := articulos[1]; a.Activo {
+		t.Errorf("obsolete articulo A-2 read as active")
+	}
+}
+
+func TestArticuloGetActive(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("WHERE a.CodigoEmpresa = @sageCode", "AND ISNULL(a.ObsoletoLc, 0) = 0")).
+		WithArgs(sql.Named("sageCode", 1)).
+		WillReturnRows(sqlmock.NewRows(articuloRowColumns))
+
+	articulos, err := NewArticuloRepository(db, Tables{}).GetActive(context.Background(), 1)
+	if err != nil || len(articulos) != 0 {
+		t.Errorf("GetActive = %d articulos, %v, want none and no error", len(articulos), err)
+	}
+}
+
+func TestArticuloGetByCodigo(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewArticuloRepository(db, Tables{})
+
+	mock.ExpectQuery(sqlWith("AND a.CodigoArticulo = @codigoArticulo")).
+		WithArgs(sql.Named("sageCode", 1), sql.Named("codigoArticulo", "A-1")).
+		WillReturnRows(sqlmock.NewRows(articuloRowColumns).
+			AddRow(1, "A-1", "Tornillo", "12.3450000000", 1, 21.0, "UN", true))
+	if a, err := repo.GetByCodigo(context.Background(), 1, "A-1"); err != nil || a.CodigoArticulo != "A-1" {
+		t.Errorf("GetByCodigo(A-1) = %+v, %v", a, err)
+	}
+
+	mock.ExpectQuery(sqlWith("AND a.CodigoArticulo = @codigoArticulo")).
+		WithArgs(sql.Named("sageCode", 1), sql.Named("codigoArticulo", "A-9")).
+		WillReturnRows(sqlmock.NewRows(articuloRowColumns))
+	if _, err := repo.GetByCodigo(context.Background(), 1, "A-9"); !errors.Is(err, ErrArticuloNotFound) {
+		t.Errorf("GetByCodigo(A-9) error = %v, want ErrArticuloNotFound", err)
+	}
+}
+
+func TestArticuloStreamStops(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("FROM [dbo].[Articulos] a", "WHERE a.CodigoEmpresa = @sageCode")).
+		WithArgs(sql.Named("sageCode", 1)).
+		WillReturnRows(sqlmock.NewRows(articuloRowColumns).
+			AddRow(1, "A-1", "Tornillo", "1.0000000000", 1, 21.0, "UN", true).
+			AddRow(1, "A-2", "Tuerca", "1.0000000000", 1, 21.0, "UN", true).
+			AddRow(1, "A-3", "Arandela", "1.0000000000", 1, 21.0, "UN", true))
+
+	errFull := errors.New("full")
+	var seen []string
+	err := NewArticuloRepository(db, Tables{}).Stream(context.Background(), 1, func(a *models.Articulo) error {
+		seen = append(seen, a.CodigoArticulo)
+		if len(seen) == 2 {
+			return errFull
+		}
+		return nil
+	})
+	if !errors.Is(err, errFull) || len(seen) != 2 {
+		t.Errorf("Stream = %v after %v, want %v after two articulos", err, seen, errFull)
+	}
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// ClienteRepository handles database operations for Cliente entities
+type ClienteRepository struct {
+	db     *sql.DB
+	tables Tables
+}
+
+// NewClienteRepository creates a new repository instance, reading the tables
+// named by tables
+func NewClienteRepository(db *sql.DB, tables Tables) *ClienteRepository {
+	return &ClienteRepository{
+		db:     db,
+		tables: tables,
+	}
+}
+
+// GetAll retrieves every cliente with a tax ID from the Sage database
+func (r *ClienteRepository) GetAll(ctx context.Context) ([]*models.Cliente, error) {
+	return r.query(ctx, r.selectClientes("", r.sql().order))
+}
+
+// GetByEmpresa retrieves the clientes of one empresa; all of them when the
+// Sage product keeps a database per company
+func (r *ClienteRepository) GetByEmpresa(ctx context.Context, codigoEmpresa int) ([]*models.Cliente, error) {
+	c := r.sql()
+	if c.empresa == "" {
+		return r.GetAll(ctx)
+	}
+	return r.query(ctx, r.selectClientes(c.empresa, c.order), sql.Named("sageCode", codigoEmpresa))
+}
+
+// sql returns the cliente SQL of the query profile
+func (r *ClienteRepository) sql() clienteSQL {
+	return r.tables.sql().clientes
+}
+
+// selectClientes selects the clientes with a tax ID matching filter, a
+// condition on c or empty, sorted by order. Optional columns are read as
+// empty strings rather than NULL
+func (r *ClienteRepository) selectClientes(filter, order string) string {
+	c := r.sql()
+	query := `
+		SELECT` + c.columns + `
+		FROM ` + r.tables.Name(c.table) + ` c
+		WHERE ` + c.taxID + ` IS NOT NULL AND ` + c.taxID + ` != ''`
+	if filter != "" {
+		query += `
+			AND ` + filter
+	}
+	return query + `
+		ORDER BY ` + order
+}
+
+// query runs a clientes query, skipping rows that fail to scan
+func (r *ClienteRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.Cliente, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query clientes: %w", err)
+	}
+	defer rows.Close()
+
+	var clientes []*models.Cliente
+
+	for rows.Next() {
+		cliente := &models.Cliente{}
+		err := cliente.ScanFromDB(rows)
+		if err != nil {
+			log.Printf("Warning: failed to scan cliente row: %v", err)
+			continue
+		}
+
+		if cliente.IsValid() {
+			clientes = append(clientes, cliente)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over cliente rows: %w", err)
+	}
+
+	return clientes, nil
+}
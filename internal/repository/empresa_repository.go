@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// ErrEmpresaNotFound is returned by GetByCodigo for an empresa that does not
+// exist or has no CIF.
+var ErrEmpresaNotFound = errors.New("empresa not found")
+
+// EmpresaRepository handles database operations for Empresa entities
+type EmpresaRepository struct {
+	db     *sql.DB
+	tables Tables
+}
+
+// NewEmpresaRepository creates a new repository instance, reading the tables
+// named by tables
+func NewEmpresaRepository(db *sql.DB, tables Tables) *EmpresaRepository {
+	return &EmpresaRepository{
+		db:     db,
+		tables: tables,
+	}
+}
+
+// empresaColumns selects the Empresas columns in ScanFromDB order, which
+// reads NULL columns as empty strings.
+const empresaColumns = `
+			e.CodigoEmpresa,
+			e.Empresa AS RazonSocial,
+			e.CifDni,
+			e.Domicilio,
+			e.CodigoPostal,
+			e.Municipio,
+			e.Provincia,
+			e.Telefono,
+			e.EMail1`
+
+// GetAll retrieves every empresa with a CIF from the Sage database
+func (r *EmpresaRepository) GetAll(ctx context.Context) ([]*models.Empresa, error) {
+	query := `
+		SELECT` + empresaColumns + `
+		FROM ` + r.tables.Name("Empresas") + ` e
+		WHERE e.CifDni IS NOT NULL AND e.CifDni != ''
+		ORDER BY e.CodigoEmpresa
+	`
+	return r.query(ctx, query)
+}
+
+// GetByCode retrieves one empresa, as a single-element slice when it has a CIF
+func (r *EmpresaRepository) GetByCode(ctx context.Context, codigoEmpresa int) ([]*models.Empresa, error) {
+	query := `
+		SELECT` + empresaColumns + `
+		FROM ` + r.tables.Name("Empresas") + ` e
+		WHERE e.CifDni IS NOT NULL AND e.CifDni != ''
+			AND e.CodigoEmpresa = @sageCode
+	`
+	return r.query(ctx, query, sql.Named("sageCode", codigoEmpresa))
+}
+
+// GetByCodigo retrieves one empresa, or ErrEmpresaNotFound when it does not
+// exist or has no CIF
+func (r *EmpresaRepository) GetByCodigo(ctx context.Context, codigoEmpresa int) (*models.Empresa, error) {
+	empresas, err := r.GetByCode(ctx, codigoEmpresa)
+	if err != nil {
+		return nil, err
+	}
+	if len(empresas) == 0 {
+		return nil, fmt.Errorf("empresa %d: %w", codigoEmpresa, ErrEmpresaNotFound)
+	}
+	return empresas[0], nil
+}
+
+// Count returns the number of empresas with a CIF
+func (r *EmpresaRepository) Count(ctx context.Context) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM ` + r.tables.Name("Empresas") + ` e
+		WHERE e.CifDni IS NOT NULL AND e.CifDni != ''
+	`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count empresas: %w", err)
+	}
+	return count, nil
+}
+
+// query runs an empresas query, skipping rows that fail to scan
+func (r *EmpresaRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.Empresa, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query empresas: %w", err)
+	}
+	defer rows.Close()
+
+	var empresas []*models.Empresa
+
+	for rows.Next() {
+		empresa := &models.Empresa{}
+		err := empresa.ScanFromDB(rows)
+		if err != nil {
+			log.Printf("Warning: failed to scan empresa row: %v", err)
+			continue
+		}
+
+		if empresa.IsValid() {
+			empresas = append(empresas, empresa)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over empresa rows: %w", err)
+	}
+
+	return empresas, nil
+}
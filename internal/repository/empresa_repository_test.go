@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var empresaRowColumns = []string{"CodigoEmpresa", "RazonSocial", "CifDni", "Domicilio", "CodigoPostal", "Municipio", "Provincia", "Telefono", "EMail1"}
+
+func TestEmpresaGetAll(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("FROM [dbo].[Empresas] e", "WHERE e.CifDni IS NOT NULL AND e.CifDni != ''", "ORDER BY e.CodigoEmpresa")).
+		WillReturnRows(sqlmock.NewRows(empresaRowColumns).
+			AddRow(1, "Acme SL", "B12345674", "Calle Mayor 1", "08001", "Barcelona", "Barcelona", "930000000", "info@acme.es").
+			AddRow(2, nil, "A58818501", nil, nil, nil, nil, nil, nil).
+			AddRow("not a code", "Broken SL", "B00000000", nil, nil, nil, nil, nil, nil).
+			AddRow(3, "Sin CIF SL", nil, nil, nil, nil, nil, nil, nil))
+
+	empresas, err := NewEmpresaRepository(db, Tables{}).GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(empresas) != 2 {
+		t.Fatalf("GetAll returned %d empresas, want 2: the row failing to scan and the one without CIF are skipped", len(empresas))
+	}
+	if e := empresas[0]; e.CodigoEmpresa != 1 || e.RazonSocial != "Acme SL" || e.CIF != "B12345674" || e.Email != "info@acme.es" {
+		t.Errorf("empresa 1 = %+v", e)
+	}
+	if e := empresas[1]; e.CodigoEmpresa != 2 || e.RazonSocial != "" || e.Municipio != "" {
+		t.Errorf("empresa 2 = %+v, want its NULL columns empty", e)
+	}
+}
+
+func TestEmpresaGetAllEmpty(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("FROM [dbo].[Empresas] e")).WillReturnRows(sqlmock.NewRows(empresaRowColumns))
+
+	empresas, err := NewEmpresaRepository(db, Tables{}).GetAll(context.Background())
+	if err != nil || len(empresas) != 0 {
+		t.Errorf("GetAll = %d empresas, %v, want none and no error", len(empresas), err)
+	}
+}
+
+func TestEmpresaQueryErrors(t *testing.T) {
+	errDown := errors.New("connection reset")
+
+	t.Run("query", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(sqlWith("FROM [dbo].[Empresas] e")).WillReturnError(errDown)
+		if _, err := NewEmpresaRepository(db, Tables{}).GetAll(context.Background()); !errors.Is(err, errDown) {
+			t.Errorf("GetAll error = %v, want %v", err, errDown)
+		}
+	})
+
+	t.Run("iteration", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(sqlWith("FROM [dbo].[Empresas] e")).
+			WillReturnRows(sqlmock.NewRows(empresaRowColumns).
+				AddRow(1, "Acme SL", "B12345674", nil, nil, nil, nil, nil, nil).
+				RowError(0, errDown))
+		if _, err := NewEmpresaRepository(db, Tables{}).GetAll(context.Background()); !errors.Is(err, errDown) {
+			t.Errorf("GetAll error = %v, want %v", err, errDown)
+		}
+	})
+}
+
+func TestEmpresaGetByCodigo(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewEmpresaRepository(db, Tables{})
+
+	mock.ExpectQuery(sqlWith("FROM [dbo].[Empresas] e", "AND e.CodigoEmpresa = @sageCode")).
+		WithArgs(sql.Named("sageCode", 7)).
+		WillReturnRows(sqlmock.NewRows(empresaRowColumns).
+			AddRow(7, "Acme SL", "B12345674", nil, nil, nil, nil, nil, nil))
+	empresa, err := repo.GetByCodigo(context.Background(), 7)
+	if err != nil || empresa.CodigoEmpresa != 7 {
+		t.Errorf("GetByCodigo(7) = %+v, %v", empresa, err)
+	}
+
+	mock.ExpectQuery(sqlWith("AND e.CodigoEmpresa = @sageCode")).
+		WithArgs(sql.Named("sageCode", 8)).
+		WillReturnRows(sqlmock.NewRows(empresaRowColumns))
+	if _, err := repo.GetByCodigo(context.Background(), 8); !errors.Is(err, ErrEmpresaNotFound) {
+		t.Errorf("GetByCodigo(8) error = %v, want ErrEmpresaNotFound", err)
+	}
+}
+
+func TestEmpresaCount(t *testing.T) {
+	db, mock := newMock(t)
+	repo := NewEmpresaRepository(db, Tables{})
+
+	mock.ExpectQuery(sqlWith("SELECT COUNT(*) FROM [dbo].[Empresas] e", "WHERE e.CifDni IS NOT NULL")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	if count, err := repo.Count(context.Background()); err != nil || count != 3 {
+		t.Errorf("Count = %d, %v, want 3", count, err)
+	}
+
+	mock.ExpectQuery(sqlWith("SELECT COUNT(*)")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow("many"))
+	if _, err := repo.Count(context.Background()); err == nil {
+		t.Error("Count scanned a non-numeric count without error")
+	}
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// FacturaRepository handles database operations for Factura entities
+type FacturaRepository struct {
+	db     *sql.DB
+	tables Tables
+}
+
+// NewFacturaRepository creates a new repository instance, reading the tables
+// named by tables
+func NewFacturaRepository(db *sql.DB, tables Tables) *FacturaRepository {
+	return &FacturaRepository{
+		db:     db,
+		tables: tables,
+	}
+}
+
+// facturaColumns selects the invoice header columns in ScanFromDB order.
+// Optional columns are read as empty strings, and totals as 0, rather than
+// NULL.
+const facturaColumns = `
+			f.CodigoEmpresa,
+			f.EjercicioFactura,
+			ISNULL(f.SerieFactura, ''),
+			f.NumeroFactura,
+			f.FechaFactura,
+			ISNULL(f.CodigoCliente, ''),
+			ISNULL(f.RazonSocial, ''),
+			ISNULL(f.CifDni, ''),
+			ISNULL(f.BaseImponible, 0),
+			ISNULL(f.TotalIva, 0),
+			ISNULL(f.ImporteLiquido, 0),
+			ISNULL(f.CodigoDivisa, ''),
+			ISNULL(f.StatusContabilizado, 0)`
+
+// facturaPageSize is how many invoices a paged query reads per round trip.
+const facturaPageSize = 1000
+
+// facturaOrder orders one empresa's invoices uniquely, as paging needs.
+const facturaOrder = `
+		ORDER BY f.FechaFactura, f.EjercicioFactura, f.SerieFactura, f.NumeroFactura`
+
+// GetSince retrieves the invoices dated on or after since
+func (r *FacturaRepository) GetSince(ctx context.Context, since time.Time) ([]*models.Factura, error) {
+	query := `
+		SELECT` + facturaColumns + `
+		FROM ` + r.tables.Name("CabeceraAlbaranCliente") + ` f
+		WHERE f.NumeroFactura > 0
+			AND f.FechaFactura >= @since
+		ORDER BY f.CodigoEmpresa, f.FechaFactura, f.NumeroFactura
+	`
+	return r.query(ctx, query, sql.Named("since", since))
+}
+
+// GetByDateRange retrieves one empresa's invoices dated from from,
+// inclusive, to to, exclusive; a zero to has no upper bound
+func (r *FacturaRepository) GetByDateRange(ctx context.Context, codigoEmpresa int, from, to time.Time) ([]*models.Factura, error) {
+	query := `
+		SELECT` + facturaColumns + `
+		FROM ` + r.tables.Name("CabeceraAlbaranCliente") + ` f
+		WHERE f.NumeroFactura > 0
+			AND f.CodigoEmpresa = @sageCode
+			AND f.FechaFactura >= @from`
+	args := []interface{}{sql.Named("sageCode", codigoEmpresa), sql.Named("from", from)}
+	if !to.IsZero() {
+		query += `
+			AND f.FechaFactura < @to`
+		args = append(args, sql.Named("to", to))
+	}
+	return r.queryPaged(ctx, query+facturaOrder, args...)
+}
+
+// GetModifiedSince retrieves one empresa's invoices changed at or after
+// since. Sage stamps FechaModificacion on every save; invoices it never
+// stamped count as changed on their invoice date
+func (r *FacturaRepository) GetModifiedSince(ctx context.Context, codigoEmpresa int, since time.Time) ([]*models.Factura, error) {
+	query := `
+		SELECT` + facturaColumns + `
+		FROM ` + r.tables.Name("CabeceraAlbaranCliente") + ` f
+		WHERE f.NumeroFactura > 0
+			AND f.CodigoEmpresa = @sageCode
+			AND ISNULL(f.FechaModificacion, f.FechaFactura) >= @since` + facturaOrder
+	return r.queryPaged(ctx, query, sql.Named("sageCode", codigoEmpresa), sql.Named("since", since))
+}
+
+// queryPaged runs an ordered facturas query facturaPageSize rows at a time,
+// so a long date range does not hold one large result set open
+func (r *FacturaRepository) queryPaged(ctx context.Context, query string, args ...interface{}) ([]*models.Factura, error) {
+	paged := query + `
+		OFFSET @offset ROWS FETCH NEXT @pageSize ROWS ONLY`
+
+	var facturas []*models.Factura
+	for offset := 0; ; offset += facturaPageSize {
+		page, rows, err := r.queryPage(ctx, paged, append(args,
+			sql.Named("offset", offset), sql.Named("pageSize", facturaPageSize))...)
+		if err != nil {
+			return nil, err
+		}
+		facturas = append(facturas, page...)
+		if rows < facturaPageSize {
+			return facturas, nil
+		}
+	}
+}
+
+// query runs a facturas query, skipping rows that fail to scan
+func (r *FacturaRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.Factura, error) {
+	facturas, _, err := r.queryPage(ctx, query, args...)
+	return facturas, err
+}
+
+// queryPage runs a facturas query, skipping rows that fail to scan, and
+// also returns how many rows it read, skipped ones included
+func (r *FacturaRepository) queryPage(ctx context.Context, query string, args ...interface{}) ([]*models.Factura, int, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query facturas: %w", err)
+	}
+	defer rows.Close()
+
+	var facturas []*models.Factura
+	var count int
+
+	for rows.Next() {
+		count++
+		factura := &models.Factura{}
+		err := factura.ScanFromDB(rows)
+		if err != nil {
+			log.Printf("Warning: failed to scan factura row: %v", err)
+			continue
+		}
+
+		if factura.IsValid() {
+			facturas = append(facturas, factura)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating over factura rows: %w", err)
+	}
+
+	return facturas, count, nil
+}
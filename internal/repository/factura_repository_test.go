@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var facturaRowColumns = []string{"CodigoEmpresa", "EjercicioFactura", "SerieFactura", "NumeroFactura", "FechaFactura", "CodigoCliente", "RazonSocial", "CifDni", "BaseImponible", "TotalIva", "ImporteLiquido", "CodigoDivisa", "StatusContabilizado"}
+
+// facturaRow is a row of the facturas queries, numbered n and dated date.
+func facturaRow(n int, date time.Time) []driver.Value {
+	return []driver.Value{1, date.Year(), "A", n, date, "430001", "Acme SL", "B12345674", 100.0, 21.0, 121.0, "EUR", 0}
+}
+
+// facturaPage is the paging of the first page of a paged facturas query.
+var facturaPage = []driver.Value{sql.Named("offset", 0), sql.Named("pageSize", facturaPageSize)}
+
+// TestFacturasByDateRange checks the range includes invoices dated on from
+// and leaves out those dated on to.
+func TestFacturasByDateRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("WHERE f.NumeroFactura > 0", "AND f.CodigoEmpresa = @sageCode",
+		"AND f.FechaFactura >= @from", "AND f.FechaFactura < @to",
+		"ORDER BY f.FechaFactura, f.EjercicioFactura, f.SerieFactura, f.NumeroFactura",
+		"OFFSET @offset ROWS FETCH NEXT @pageSize ROWS ONLY")).
+		WithArgs(append([]driver.Value{sql.Named("sageCode", 1), sql.Named("from", from), sql.Named("to", to)}, facturaPage...)...).
+		WillReturnRows(sqlmock.NewRows(facturaRowColumns).
+			AddRow(facturaRow(1, from)...).
+			AddRow(facturaRow(2, to.Add(-time.Second))...))
+
+	facturas, err := NewFacturaRepository(db, Tables{}).GetByDateRange(context.Background(), 1, from, to)
+	if err != nil {
+		t.Fatalf("GetByDateRange: %v", err)
+	}
+	if len(facturas) != 2 || !facturas[0].FechaFactura.Equal(from) {
+		t.Errorf("GetByDateRange = %+v, want the invoices of January", facturas)
+	}
+}
+
+// TestFacturasByDateRangeOpen checks a zero to leaves the range without an
+// upper bound.
+func TestFacturasByDateRangeOpen(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, mock, queries := recordQueries(t)
+	mock.ExpectQuery("").
+		WithArgs(append([]driver.Value{sql.Named("sageCode", 1), sql.Named("from", from)}, facturaPage...)...).
+		WillReturnRows(sqlmock.NewRows(facturaRowColumns))
+
+	if _, err := NewFacturaRepository(db, Tables{}).GetByDateRange(context.Background(), 1, from, time.Time{}); err != nil {
+		t.Fatalf("GetByDateRange: %v", err)
+	}
+	if query := (*queries)[0]; strings.Contains(query, "@to") || !strings.Contains(query, "f.FechaFactura >= @from") {
+		t.Errorf("open range query bounds the dates wrongly:\n%s", query)
+	}
+}
+
+func TestFacturasPaged(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	full := sqlmock.NewRows(facturaRowColumns)
+	for n := 1; n <= facturaPageSize; n++ {
+		full.AddRow(facturaRow(n, from)...)
+	}
+
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("OFFSET @offset ROWS")).
+		WithArgs(append([]driver.Value{sql.Named("sageCode", 1), sql.Named("from", from)}, facturaPage...)...).
+		WillReturnRows(full)
+	mock.ExpectQuery(sqlWith("OFFSET @offset ROWS")).
+		WithArgs(sql.Named("sageCode", 1), sql.Named("from", from), sql.Named("offset", facturaPageSize), sql.Named("pageSize", facturaPageSize)).
+		WillReturnRows(sqlmock.NewRows(facturaRowColumns).AddRow(facturaRow(facturaPageSize+1, from)...))
+
+	facturas, err := NewFacturaRepository(db, Tables{}).GetByDateRange(context.Background(), 1, from, time.Time{})
+	if err != nil {
+		t.Fatalf("GetByDateRange: %v", err)
+	}
+	if len(facturas) != facturaPageSize+1 {
+		t.Errorf("GetByDateRange returned %d invoices over two pages, want %d", len(facturas), facturaPageSize+1)
+	}
+}
+
+// TestFacturasNullTotals checks NULL totals and estado are read as 0: the
+// query replaces them, as the driver cannot scan NULL into a number.
+func TestFacturasNullTotals(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("ISNULL(f.BaseImponible, 0)", "ISNULL(f.TotalIva, 0)", "ISNULL(f.ImporteLiquido, 0)",
+		"ISNULL(f.StatusContabilizado, 0)")).
+		WillReturnRows(sqlmock.NewRows(facturaRowColumns).
+			AddRow(1, 2024, "", 7, since, "", "", "", 0.0, 0.0, 0.0, "", 0))
+
+	facturas, err := NewFacturaRepository(db, Tables{}).GetSince(context.Background(), since)
+	if err != nil {
+		t.Fatalf("GetSince: %v", err)
+	}
+	if len(facturas) != 1 {
+		t.Fatalf("GetSince returned %d invoices, want the one without totals", len(facturas))
+	}
+	if f := facturas[0]; f.BaseImponible != 0 || f.TotalIva != 0 || f.Importe != 0 || f.Estado != 0 {
+		t.Errorf("invoice without totals = %+v, want them 0", f)
+	}
+}
+
+// TestFacturasModifiedSince checks invoices are picked by FechaModificacion,
+// or their date when Sage never stamped it, and read with their estado.
+func TestFacturasModifiedSince(t *testing.T) {
+	since := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	posted := facturaRow(9, since)
+	posted[12] = -1
+
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("AND f.CodigoEmpresa = @sageCode", "AND ISNULL(f.FechaModificacion, f.FechaFactura) >= @since",
+		"OFFSET @offset ROWS")).
+		WithArgs(append([]driver.Value{sql.Named("sageCode", 2), sql.Named("since", since)}, facturaPage...)...).
+		WillReturnRows(sqlmock.NewRows(facturaRowColumns).AddRow(posted...))
+
+	facturas, err := NewFacturaRepository(db, Tables{}).GetModifiedSince(context.Background(), 2, since)
+	if err != nil {
+		t.Fatalf("GetModifiedSince: %v", err)
+	}
+	if len(facturas) != 1 || facturas[0].Estado != -1 || facturas[0].Number() != "1-2024-A9" {
+		t.Errorf("GetModifiedSince = %+v, want invoice 1-2024-A9 posted (estado -1)", facturas)
+	}
+}
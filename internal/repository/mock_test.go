@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newMock returns a database whose queries are checked against the
+// expectations set on the mock, all of which must be met by the end of the
+// test.
+func newMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return db, mock
+}
+
+// sqlWith returns a pattern for sqlmock matching a query that contains the
+// fragments in order.
+func sqlWith(fragments ...string) string {
+	quoted := make([]string, len(fragments))
+	for i, fragment := range fragments {
+		quoted[i] = regexp.QuoteMeta(strings.Join(strings.Fields(fragment), " "))
+	}
+	return "(?s)" + strings.Join(quoted, ".*")
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Query profiles, one per Sage product whose schema the queries are
+// written for.
+const (
+	ProfileSage200 = "sage200" // Sage 200, the default
+	ProfileSage50  = "sage50"  // Sage 50c
+)
+
+// Profiles lists the supported query profiles.
+var Profiles = []string{ProfileSage200, ProfileSage50}
+
+// ErrNotInProfile is returned by the queries of an entity the Sage product
+// of the query profile does not keep.
+var ErrNotInProfile = errors.New("not kept by this Sage product")
+
+// profile holds the SQL that differs between the Sage products, side by
+// side. Only the socio and cliente queries differ; the other repositories
+// read the same tables under every profile.
+type profile struct {
+	name string
+
+	// socios is set when the product has the socio tables; their queries
+	// are built by SocioRepository.latestSocios.
+	socios bool
+
+	clientes clienteSQL
+}
+
+// clienteSQL is the SQL of the cliente queries, reading table as c.
+type clienteSQL struct {
+	table   string
+	columns string // In Cliente.ScanFromDB order
+	taxID   string // The tax ID column, which clientes must have
+
+	// empresa is the condition on @sageCode selecting the clientes of an
+	// empresa; empty when a database holds a single company's.
+	empresa string
+	order   string
+}
+
+var profiles = map[string]*profile{
+	ProfileSage200: {
+		name:   ProfileSage200,
+		socios: true,
+		clientes: clienteSQL{
+			table: "Clientes",
+			columns: `
+			c.CodigoEmpresa,
+			c.CodigoCliente,
+			ISNULL(c.RazonSocial, ''),
+			c.CifDni,
+			ISNULL(c.EMail1, ''),
+			ISNULL(c.Telefono, ''),
+			ISNULL(c.Domicilio, ''),
+			ISNULL(c.CodigoPostal, ''),
+			ISNULL(c.Municipio, ''),
+			ISNULL(c.Provincia, '')`,
+			taxID:   "c.CifDni",
+			empresa: "c.CodigoEmpresa = @sageCode",
+			order:   "c.CodigoEmpresa, c.CodigoCliente",
+		},
+	},
+
+	// Sage 50c keeps a database per company, with no empresa code on its
+	// rows, and no socio tables.
+	ProfileSage50: {
+		name: ProfileSage50,
+		clientes: clienteSQL{
+			table: "clientes",
+			columns: `
+			0,
+			RTRIM(c.CODIGO),
+			ISNULL(c.NOMBRE, ''),
+			c.CIF,
+			ISNULL(c.EMAIL, ''),
+			ISNULL(c.TELEFONO, ''),
+			ISNULL(c.DIRECCION, ''),
+			ISNULL(c.CODPOST, ''),
+			ISNULL(c.POBLACION, ''),
+			ISNULL(c.PROVINCIA, '')`,
+			taxID: "c.CIF",
+			order: "c.CODIGO",
+		},
+	},
+}
+
+// ValidProfile reports whether name is one of Profiles.
+func ValidProfile(name string) bool {
+	_, ok := profiles[name]
+	return ok
+}
+
+// notInProfile returns the error of a query for entity, which the product
+// of p does not keep.
+func (p *profile) notInProfile(entity string) error {
+	return fmt.Errorf("%s: %w (query profile %s)", entity, ErrNotInProfile, p.name)
+}
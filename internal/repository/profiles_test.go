@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+var clienteRowColumns = []string{"CodigoEmpresa", "CodigoCliente", "RazonSocial", "CifDni", "EMail1", "Telefono", "Domicilio", "CodigoPostal", "Municipio", "Provincia"}
+
+func TestValidProfile(t *testing.T) {
+	for _, name := range Profiles {
+		if !ValidProfile(name) {
+			t.Errorf("ValidProfile(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"", "sage100", "SAGE200"} {
+		if ValidProfile(name) {
+			t.Errorf("ValidProfile(%q) = true, want false", name)
+		}
+	}
+}
+
+func TestTablesProfile(t *testing.T) {
+	tests := []struct {
+		tables Tables
+		want   string
+	}{
+		{Tables{}, ProfileSage200},
+		{NewTables("", ProfileSage200), ProfileSage200},
+		{NewTables("", ProfileSage50), ProfileSage50},
+		{NewTables("", "sage100"), ProfileSage200},
+	}
+	for _, tt := range tests {
+		if got := tt.tables.Profile(); got != tt.want {
+			t.Errorf("Profile() of %q = %s, want %s", tt.tables.profile, got, tt.want)
+		}
+	}
+}
+
+func TestClientesSage200(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("c.CodigoEmpresa, c.CodigoCliente,", "FROM [dbo].[Clientes] c",
+		"WHERE c.CifDni IS NOT NULL AND c.CifDni != ''", "AND c.CodigoEmpresa = @sageCode",
+		"ORDER BY c.CodigoEmpresa, c.CodigoCliente")).
+		WithArgs(sql.Named("sageCode", 2)).
+		WillReturnRows(sqlmock.NewRows(clienteRowColumns).
+			AddRow(2, "430001", "Acme SL", "B12345674", "", "", "", "", "", ""))
+
+	clientes, err := NewClienteRepository(db, NewTables("", ProfileSage200)).GetByEmpresa(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("GetByEmpresa: %v", err)
+	}
+	if len(clientes) != 1 || clientes[0].CodigoEmpresa != 2 || clientes[0].CodigoCliente != "430001" {
+		t.Errorf("GetByEmpresa = %+v, want cliente 430001 of empresa 2", clientes)
+	}
+}
+
+func TestClientesSage50(t *testing.T) {
+	db, mock := newMock(t)
+	// A Sage 50c database holds one company, so all its clientes are read
+	// without an empresa condition.
+	mock.ExpectQuery(sqlWith("SELECT 0, RTRIM(c.CODIGO), ISNULL(c.NOMBRE, ''), c.CIF,", "FROM [dbo].[clientes] c",
+		"WHERE c.CIF IS NOT NULL AND c.CIF != '' ORDER BY c.CODIGO")).
+		WithoutArgs().
+		WillReturnRows(sqlmock.NewRows(clienteRowColumns).
+			AddRow(0, "430001", "Acme SL", "B12345674", "", "", "", "", "", ""))
+
+	clientes, err := NewClienteRepository(db, NewTables("", ProfileSage50)).GetByEmpresa(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("GetByEmpresa: %v", err)
+	}
+	if len(clientes) != 1 || clientes[0].CodigoCliente != "430001" || clientes[0].CIF != "B12345674" {
+		t.Errorf("GetByEmpresa = %+v, want cliente 430001", clientes)
+	}
+}
+
+// TestSociosNotInSage50 checks the socio methods fail with ErrNotInProfile
+// under sage50, without querying the database.
+func TestSociosNotInSage50(t *testing.T) {
+	ctx := context.Background()
+	db, _ := newMock(t)
+	r := NewSocioRepository(db, NewTables("", ProfileSage50))
+
+	calls := map[string]func() error{
+		"GetAll": func() error {
+			_, err := r.GetAll(ctx)
+			return err
+		},
+		"GetAllByEmpresa": func() error {
+			_, err := r.GetAllByEmpresa(ctx, 1)
+			return err
+		},
+		"GetByDNIs": func() error {
+			_, err := r.GetByDNIs(ctx, []string{"12345678Z"})
+			return err
+		},
+		"GetModifiedSince": func() error {
+			_, err := r.GetModifiedSince(ctx, time.Now())
+			return err
+		},
+		"Count": func() error {
+			_, err := r.Count(ctx)
+			return err
+		},
+		"TracksModifications": func() error {
+			_, err := r.TracksModifications(ctx)
+			return err
+		},
+		"UpdateFields": func() error {
+			return r.UpdateFields(ctx, &models.Socio{DNI: "12345678Z"}, []string{models.FieldCargo})
+		},
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, ErrNotInProfile) {
+			t.Errorf("%s error = %v, want ErrNotInProfile", name, err)
+		}
+	}
+}
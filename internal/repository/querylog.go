@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryStats summarizes the queries a repository ran, so a slow run can be
+// put down to Sage or to Bitrix24.
+type QueryStats struct {
+	Queries  int64  `json:"queries"` // Query attempts, including retries
+	Rows     int64  `json:"rows"`    // Rows read or updated
+	Failed   int64  `json:"failed"`
+	Slow     int64  `json:"slow"`     // Over the slow-query threshold
+	Duration string `json:"duration"` // Total time spent querying
+}
+
+// queryLog times and counts the queries of a repository, logging each one
+// when it has a logger and those over slow as warnings.
+type queryLog struct {
+	logger *log.Logger
+	slow   time.Duration
+
+	mu       sync.Mutex
+	stats    QueryStats
+	duration time.Duration
+}
+
+// WithQueryLog logs every query through logger, with its parameter names
+// (values are left out), duration and row count; a nil logger logs none.
+// Queries slower than slow are logged as warnings, through the standard
+// logger when logger is nil; 0 disables the threshold.
+func WithQueryLog(logger *log.Logger, slow time.Duration) SocioOption {
+	return func(r *SocioRepository) {
+		r.log = &queryLog{logger: logger, slow: slow}
+	}
+}
+
+// record counts a query attempt named what that took d and read rows.
+func (q *queryLog) record(what string, args []interface{}, d time.Duration, rows int, err error) {
+	q.mu.Lock()
+	q.stats.Queries++
+	q.stats.Rows += int64(rows)
+	q.duration += d
+	if err != nil {
+		q.stats.Failed++
+	}
+	slow := q.slow > 0 && d > q.slow
+	if slow {
+		q.stats.Slow++
+	}
+	q.mu.Unlock()
+
+	entry := "SQL " + what
+	if params := paramNames(args); params != "" {
+		entry += " (" + params + ")"
+	}
+	if err != nil {
+		entry += fmt.Sprintf(" failed after %s: %v", d, err)
+	} else {
+		entry += fmt.Sprintf(": %d rows in %s", rows, d)
+	}
+	switch {
+	case slow && q.logger != nil:
+		q.logger.Printf("Warning: slow %s (over %s)", entry, q.slow)
+	case slow:
+		log.Printf("Warning: slow %s (over %s)", entry, q.slow)
+	case q.logger != nil:
+		q.logger.Printf("%s", entry)
+	}
+}
+
+// Add returns the sum of s and other, e.g. of the databases of a
+// multi-company installation.
+func (s QueryStats) Add(other QueryStats) QueryStats {
+	d, _ := time.ParseDuration(s.Duration)
+	otherD, _ := time.ParseDuration(other.Duration)
+	return QueryStats{
+		Queries:  s.Queries + other.Queries,
+		Rows:     s.Rows + other.Rows,
+		Failed:   s.Failed + other.Failed,
+		Slow:     s.Slow + other.Slow,
+		Duration: (d + otherD).String(),
+	}
+}
+
+// snapshot returns the counters so far.
+func (q *queryLog) snapshot() QueryStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := q.stats
+	stats.Duration = q.duration.String()
+	return stats
+}
+
+// paramNames lists the names of the named arguments, as @name.
+func paramNames(args []interface{}) string {
+	var names []string
+	for _, arg := range args {
+		if named, ok := arg.(sql.NamedArg); ok {
+			names = append(names, "@"+named.Name)
+		}
+	}
+	if len(names) > 5 {
+		names = append(names[:5], "…")
+	}
+	return strings.Join(names, ", ")
+}
+
+// timed runs fn, a single query attempt reading the rows it returns, and
+// records it in the query log.
+func (r *SocioRepository) timed(what string, args []interface{}, fn func() (rows int, err error)) error {
+	start := time.Now()
+	rows, err := fn()
+	r.log.record(what, args, time.Since(start), rows, err)
+	return err
+}
+
+// oneRow is the outcome of a query scanning a single row.
+func oneRow(err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// QueryStats returns the counters of the queries the repository ran.
+func (r *SocioRepository) QueryStats() QueryStats {
+	return r.log.snapshot()
+}
@@ -0,0 +1,335 @@
+// Package repositorytest provides in-memory repositories, so the sync can be
+// exercised without a Sage SQL Server.
+package repositorytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+	"github.com/arduriki/sage-bitrix-sync/internal/repository"
+)
+
+// Socios is an in-memory socio repository. It behaves like
+// repository.SocioRepository: only the latest valid row of each socio of an
+// empresa is returned, ordered by DNI and empresa, and UpdateFields writes the socio's row in its empresa. It also
+// implements the sync package's SocioSource, SocioStreamer, ModifiedSource
+// and DNISource. Socios returned are copies, so callers may change them.
+type Socios struct {
+	mu       sync.Mutex
+	rows     []*models.Socio
+	modified map[*models.Socio]time.Time
+	fail     map[string]error
+	failNext map[string]error
+	calls    map[string]int
+}
+
+var _ repository.SocioReader = (*Socios)(nil)
+
+// Method names for Fail, FailNext and Calls.
+const (
+	MethodGetAll              = "GetAll"
+	MethodGetAllByEmpresa     = "GetAllByEmpresa"
+	MethodGetByDNIs           = "GetByDNIs"
+	MethodGetAllDNIs          = "GetAllDNIs"
+	MethodGetDNIsByEmpresa    = "GetDNIsByEmpresa"
+	MethodGetModifiedSince    = "GetModifiedSince"
+	MethodTracksModifications = "TracksModifications"
+	MethodCount               = "Count"
+	MethodUpdateFields        = "UpdateFields"
+)
+
+// NewSocios creates a repository holding the given rows, all modified at
+// the zero time.
+func NewSocios(rows ...*models.Socio) *Socios {
+	f := &Socios{
+		modified: make(map[*models.Socio]time.Time),
+		fail:     make(map[string]error),
+		failNext: make(map[string]error),
+		calls:    make(map[string]int),
+	}
+	for _, row := range rows {
+		f.Add(row, time.Time{})
+	}
+	return f
+}
+
+// LoadSocios creates a repository from a JSON fixture holding an array of
+// socios, as models.Socio marshals them; see testdata/socios.json.
+func LoadSocios(path string) (*Socios, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read socio fixture: %w", err)
+	}
+	var rows []*models.Socio
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse socio fixture %s: %w", path, err)
+	}
+	return NewSocios(rows...), nil
+}
+
+// Add adds a copy of row, last modified at modified.
+func (f *Socios) Add(row *models.Socio, modified time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *row
+	f.rows = append(f.rows, &copied)
+	f.modified[&copied] = modified
+}
+
+// Fail makes every call of method return err, until called again with nil.
+func (f *Socios) Fail(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.fail, method)
+		return
+	}
+	f.fail[method] = err
+}
+
+// FailNext makes only the next call of method return err, e.g. to check
+// that a transient error is retried.
+func (f *Socios) FailNext(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failNext[method] = err
+}
+
+// Calls returns how many times method was called.
+func (f *Socios) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// Rows returns copies of every row, valid or not, in the order added.
+func (f *Socios) Rows() []*models.Socio {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rows := make([]*models.Socio, len(f.rows))
+	for i, row := range f.rows {
+		copied := *row
+		rows[i] = &copied
+	}
+	return rows
+}
+
+func (f *Socios) GetAll(ctx context.Context) ([]*models.Socio, error) {
+	return f.find(ctx, MethodGetAll, func(*models.Socio) bool { return true })
+}
+
+func (f *Socios) GetAllByEmpresa(ctx context.Context, codigoEmpresa int) ([]*models.Socio, error) {
+	return f.find(ctx, MethodGetAllByEmpresa, func(s *models.Socio) bool { return s.CodigoEmpresa == codigoEmpresa })
+}
+
+func (f *Socios) GetByDNIs(ctx context.Context, dnis []string) ([]*models.Socio, error) {
+	wanted := make(map[string]bool, len(dnis))
+	for _, dni := range dnis {
+		wanted[dni] = true
+	}
+	return f.find(ctx, MethodGetByDNIs, func(s *models.Socio) bool { return wanted[s.DNI] })
+}
+
+// GetAllDNIs returns the normalized DNIs of the socios GetAll returns,
+// sorted and without duplicates.
+func (f *Socios) GetAllDNIs(ctx context.Context) ([]string, error) {
+	return f.dnis(ctx, MethodGetAllDNIs, func(*models.Socio) bool { return true })
+}
+
+// GetDNIsByEmpresa returns the DNIs of the socios of one empresa, like
+// GetAllDNIs.
+func (f *Socios) GetDNIsByEmpresa(ctx context.Context, codigoEmpresa int) ([]string, error) {
+	return f.dnis(ctx, MethodGetDNIsByEmpresa, func(s *models.Socio) bool { return s.CodigoEmpresa == codigoEmpresa })
+}
+
+// dnis returns the normalized DNIs of the latest valid rows matching keep.
+func (f *Socios) dnis(ctx context.Context, method string, keep func(*models.Socio) bool) ([]string, error) {
+	if err := f.call(ctx, method); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	seen := make(map[string]bool)
+	var dnis []string
+	for _, row := range f.latest(keep) {
+		if dni := models.NormalizeDNI(row.DNI); dni != "" && !seen[dni] {
+			seen[dni] = true
+			dnis = append(dnis, dni)
+		}
+	}
+	sort.Strings(dnis)
+	return dnis, nil
+}
+
+// GetModifiedSince returns the socios with a row modified at or after
+// since, like GetAll.
+func (f *Socios) GetModifiedSince(ctx context.Context, since time.Time) ([]*models.Socio, error) {
+	f.mu.Lock()
+	changed := make(map[string]bool)
+	for row, modified := range f.modified {
+		if !modified.Before(since) {
+			changed[row.DNI] = true
+		}
+	}
+	f.mu.Unlock()
+	return f.find(ctx, MethodGetModifiedSince, func(s *models.Socio) bool { return changed[s.DNI] })
+}
+
+// TracksModifications always reports true, unless failed.
+func (f *Socios) TracksModifications(ctx context.Context) (bool, error) {
+	if err := f.call(ctx, MethodTracksModifications); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetAllStream hands off what GetAll returns, counting as a GetAll call.
+func (f *Socios) GetAllStream(ctx context.Context, fn func(*models.Socio) error) error {
+	socios, err := f.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	return each(socios, fn)
+}
+
+// GetAllByEmpresaStream hands off what GetAllByEmpresa returns, counting as a
+// GetAllByEmpresa call.
+func (f *Socios) GetAllByEmpresaStream(ctx context.Context, codigoEmpresa int, fn func(*models.Socio) error) error {
+	socios, err := f.GetAllByEmpresa(ctx, codigoEmpresa)
+	if err != nil {
+		return err
+	}
+	return each(socios, fn)
+}
+
+// Count returns the number of socios GetAll returns.
+func (f *Socios) Count(ctx context.Context) (int, error) {
+	if err := f.call(ctx, MethodCount); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.latest(func(*models.Socio) bool { return true })), nil
+}
+
+// UpdateFields writes the given fields of socio to every row with its DNI
+// in its empresa, refusing the fields models.Socio.SetField does not take.
+func (f *Socios) UpdateFields(ctx context.Context, socio *models.Socio, fields []string) error {
+	if err := f.call(ctx, MethodUpdateFields); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, row := range f.rows {
+		if row.DNI != socio.DNI || row.CodigoEmpresa != socio.CodigoEmpresa {
+			continue
+		}
+		for _, field := range fields {
+			switch field {
+			case models.FieldCargo:
+				row.CargoAdministrador = socio.CargoAdministrador
+			case models.FieldParticipacion:
+				row.PorParticipacion = socio.PorParticipacion
+			case models.FieldAdministrador:
+				row.Administrador = socio.Administrador
+			default:
+				return fmt.Errorf("field %q cannot be written back to Sage", field)
+			}
+		}
+		f.modified[row] = time.Now()
+	}
+	return nil
+}
+
+// find returns copies of the latest valid rows matching keep.
+func (f *Socios) find(ctx context.Context, method string, keep func(*models.Socio) bool) ([]*models.Socio, error) {
+	if err := f.call(ctx, method); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	found := f.latest(keep)
+	for i, row := range found {
+		copied := *row
+		found[i] = &copied
+	}
+	return found, nil
+}
+
+// latest returns the latest valid row matching keep of each socio of an
+// empresa, picked like the SQL queries, sorted by DNI and empresa.
+func (f *Socios) latest(keep func(*models.Socio) bool) []*models.Socio {
+	type key struct {
+		dni     string
+		empresa int
+	}
+	picked := make(map[key]int)
+	var found []*models.Socio
+	for _, row := range f.rows {
+		if !row.IsValid() || !keep(row) {
+			continue
+		}
+		k := key{row.DNI, row.CodigoEmpresa}
+		i, seen := picked[k]
+		switch {
+		case !seen:
+			picked[k] = len(found)
+			found = append(found, row)
+		case newer(row, found[i]):
+			found[i] = row
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].DNI != found[j].DNI {
+			return found[i].DNI < found[j].DNI
+		}
+		return found[i].CodigoEmpresa < found[j].CodigoEmpresa
+	})
+	return found
+}
+
+// newer reports whether row a comes before row b in the ROW_NUMBER order
+// of the SQL queries.
+func newer(a, b *models.Socio) bool {
+	switch {
+	case a.Ejercicio != b.Ejercicio:
+		return a.Ejercicio > b.Ejercicio
+	case a.PorParticipacion != b.PorParticipacion:
+		return a.PorParticipacion > b.PorParticipacion
+	case a.Administrador != b.Administrador:
+		return a.Administrador
+	default:
+		return a.CargoAdministrador < b.CargoAdministrador
+	}
+}
+
+// each hands socios to fn one at a time, stopping at its first error.
+func each(socios []*models.Socio, fn func(*models.Socio) error) error {
+	for _, socio := range socios {
+		if err := fn(socio); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// call counts a call of method and returns the error it should fail with.
+func (f *Socios) call(ctx context.Context, method string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[method]++
+	if err, ok := f.failNext[method]; ok {
+		delete(f.failNext, method)
+		return err
+	}
+	return f.fail[method]
+}
@@ -0,0 +1,163 @@
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+func loadFixture(t *testing.T) *Socios {
+	t.Helper()
+	socios, err := LoadSocios("testdata/socios.json")
+	if err != nil {
+		t.Fatalf("LoadSocios: %v", err)
+	}
+	return socios
+}
+
+// dnis lists the DNI and empresa of each socio, in order.
+func dnis(socios []*models.Socio) string {
+	var s []string
+	for _, socio := range socios {
+		s = append(s, fmt.Sprintf("%s/%d", socio.DNI, socio.CodigoEmpresa))
+	}
+	return fmt.Sprint(s)
+}
+
+func TestGetAllLatestRows(t *testing.T) {
+	socios, err := loadFixture(t).GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if got, want := dnis(socios), "[12345678Z/1 B12345674/2 X1234567L/1]"; got != want {
+		t.Errorf("GetAll = %s, want %s", got, want)
+	}
+	if socios[0].Ejercicio != 2024 || socios[0].PorParticipacion != 60 {
+		t.Errorf("GetAll kept the %d row of %s, want the latest, 2024", socios[0].Ejercicio, socios[0].DNI)
+	}
+}
+
+func TestGetAllByEmpresaAndDNIs(t *testing.T) {
+	ctx := context.Background()
+	f := loadFixture(t)
+
+	byEmpresa, err := f.GetAllByEmpresa(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetAllByEmpresa: %v", err)
+	}
+	if got, want := dnis(byEmpresa), "[B12345674/2]"; got != want {
+		t.Errorf("GetAllByEmpresa(2) = %s, want %s", got, want)
+	}
+
+	byDNI, err := f.GetByDNIs(ctx, []string{"X1234567L", "00000000T"})
+	if err != nil {
+		t.Fatalf("GetByDNIs: %v", err)
+	}
+	if got, want := dnis(byDNI), "[X1234567L/1]"; got != want {
+		t.Errorf("GetByDNIs = %s, want %s", got, want)
+	}
+
+	all, err := f.GetAllDNIs(ctx)
+	if err != nil {
+		t.Fatalf("GetAllDNIs: %v", err)
+	}
+	if got, want := fmt.Sprint(all), "[12345678Z B12345674 X1234567L]"; got != want {
+		t.Errorf("GetAllDNIs = %s, want %s", got, want)
+	}
+
+	count, err := f.Count(ctx)
+	if err != nil || count != 3 {
+		t.Errorf("Count = %d, %v, want 3", count, err)
+	}
+}
+
+func TestReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	f := loadFixture(t)
+
+	socios, _ := f.GetAll(ctx)
+	socios[0].RazonSocialEmpleado = "Changed"
+
+	again, _ := f.GetAll(ctx)
+	if again[0].RazonSocialEmpleado == "Changed" {
+		t.Error("changing a returned socio changed the repository")
+	}
+}
+
+func TestFailAndFailNext(t *testing.T) {
+	ctx := context.Background()
+	f := loadFixture(t)
+	errDown := errors.New("database down")
+
+	f.FailNext(MethodGetAll, errDown)
+	if _, err := f.GetAll(ctx); !errors.Is(err, errDown) {
+		t.Errorf("first GetAll error = %v, want %v", err, errDown)
+	}
+	if _, err := f.GetAll(ctx); err != nil {
+		t.Errorf("second GetAll error = %v, want nil", err)
+	}
+
+	f.Fail(MethodCount, errDown)
+	for i := 0; i < 2; i++ {
+		if _, err := f.Count(ctx); !errors.Is(err, errDown) {
+			t.Errorf("Count error = %v, want %v", err, errDown)
+		}
+	}
+	f.Fail(MethodCount, nil)
+	if _, err := f.Count(ctx); err != nil {
+		t.Errorf("Count error after clearing = %v, want nil", err)
+	}
+
+	if got := f.Calls(MethodGetAll); got != 2 {
+		t.Errorf("Calls(GetAll) = %d, want 2", got)
+	}
+	if got := f.Calls(MethodCount); got != 3 {
+		t.Errorf("Calls(Count) = %d, want 3", got)
+	}
+}
+
+func TestGetModifiedSince(t *testing.T) {
+	ctx := context.Background()
+	f := loadFixture(t)
+	since := time.Now()
+
+	changed, err := f.GetModifiedSince(ctx, since)
+	if err != nil {
+		t.Fatalf("GetModifiedSince: %v", err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("GetModifiedSince = %s before any change, want none", dnis(changed))
+	}
+
+	f.Add(&models.Socio{CodigoEmpresa: 1, DNI: "X1234567L", PorParticipacion: 45, RazonSocialEmpleado: "Smith, John", Ejercicio: 2025}, since.Add(time.Second))
+	changed, err = f.GetModifiedSince(ctx, since)
+	if err != nil {
+		t.Fatalf("GetModifiedSince: %v", err)
+	}
+	if got, want := dnis(changed), "[X1234567L/1]"; got != want || changed[0].PorParticipacion != 45 {
+		t.Errorf("GetModifiedSince = %s, want %s with the 2025 row", got, want)
+	}
+}
+
+func TestUpdateFields(t *testing.T) {
+	ctx := context.Background()
+	f := loadFixture(t)
+
+	socio := &models.Socio{CodigoEmpresa: 1, DNI: "12345678Z", CargoAdministrador: "Presidenta"}
+	if err := f.UpdateFields(ctx, socio, []string{models.FieldCargo}); err != nil {
+		t.Fatalf("UpdateFields: %v", err)
+	}
+	for _, row := range f.Rows() {
+		if row.DNI == "12345678Z" && row.CargoAdministrador != "Presidenta" {
+			t.Errorf("row %d of %s has cargo %q, want Presidenta", row.Ejercicio, row.DNI, row.CargoAdministrador)
+		}
+	}
+
+	if err := f.UpdateFields(ctx, socio, []string{"dni"}); err == nil {
+		t.Error("UpdateFields(dni) succeeded, want an error")
+	}
+}
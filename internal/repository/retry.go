@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"syscall"
+	"time"
+)
+
+// ErrQueryTimeout is returned when a query outlives the repository's query
+// timeout. It is transient: the lock holding the query up may be gone on
+// the next attempt.
+var ErrQueryTimeout = errors.New("query timed out")
+
+// DefaultQueryTimeout is how long a query attempt may take by default.
+const DefaultQueryTimeout = 60 * time.Second
+
+// RetryPolicy decides how often a query failing with a transient error is
+// attempted again, waiting BaseDelay, then twice as long each time, up to
+// MaxDelay.
+type RetryPolicy struct {
+	Retries   int // Attempts after the first; 0 disables retrying
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy rides out a VPN dropping for a second or two.
+var DefaultRetryPolicy = RetryPolicy{Retries: 2, BaseDelay: 500 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+// transientSQLErrors are the SQL Server error numbers worth retrying.
+var transientSQLErrors = map[int32]bool{
+	-2:    true, // Timeout expired
+	233:   true, // Connection closed by the server
+	1205:  true, // Deadlock victim
+	1222:  true, // Lock request timeout
+	10053: true, // Connection aborted
+	10054: true, // Connection reset by peer
+	10060: true, // Connection timed out
+	40197: true, // Azure SQL: service error, reconnect
+	40501: true, // Azure SQL: service busy
+	40613: true, // Azure SQL: database unavailable
+}
+
+// sqlError is implemented by the SQL Server driver's server errors.
+type sqlError interface {
+	SQLErrorNumber() int32
+}
+
+// IsTransientError reports whether a failed query may succeed if run
+// again: the connection dropped or timed out, or the server picked it as a
+// deadlock victim. Syntax, permission and other server errors are not
+// transient, nor is the caller's context being done.
+func IsTransientError(err error) bool {
+	if errors.Is(err, ErrQueryTimeout) {
+		return true
+	}
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var sqlErr sqlError
+	if errors.As(err, &sqlErr) {
+		return transientSQLErrors[sqlErr.SQLErrorNumber()]
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE):
+		return true
+	case errors.As(err, &netErr):
+		return netErr.Timeout()
+	}
+	return false
+}
+
+// permanentError stops withRetry from retrying the error it wraps.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// permanent marks err as not to be retried, e.g. once a stream has handed
+// rows to its caller.
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// withQueryTimeout runs fn with ctx limited to timeout (0 leaves it alone),
+// reporting a failure caused by that limit, rather than by ctx, as
+// ErrQueryTimeout.
+func withQueryTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	queryCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(queryCtx)
+	if err == nil || ctx.Err() != nil || !errors.Is(queryCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	timedOut := fmt.Errorf("%w after %s: %v", ErrQueryTimeout, timeout, err)
+	var perm permanentError
+	if errors.As(err, &perm) {
+		return permanent(timedOut)
+	}
+	return timedOut
+}
+
+// withRetry runs fn, running it again after a backoff while it fails with
+// a transient error and the policy allows. fn must be safe to run again.
+func withRetry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	delay := policy.BaseDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if err == nil || attempt >= policy.Retries || !IsTransientError(err) {
+			return err
+		}
+
+		log.Printf("Warning: transient Sage error, retrying in %s: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, policy.MaxDelay)
+	}
+}
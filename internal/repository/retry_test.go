@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// serverError is a SQL Server error as the driver reports it.
+type serverError struct{ number int32 }
+
+func (e serverError) Error() string         { return fmt.Sprintf("mssql: error %d", e.number) }
+func (e serverError) SQLErrorNumber() int32 { return e.number }
+
+// fastRetries retries as the default policy does, without the waits.
+var fastRetries = RetryPolicy{Retries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+func TestIsTransientError(t *testing.T) {
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: &net.DNSError{IsTimeout: true}}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{driver.ErrBadConn, true},
+		{io.EOF, true},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{syscall.EPIPE, true},
+		{timeout, true},
+		{fmt.Errorf("%w after 1m", ErrQueryTimeout), true},
+		{serverError{1205}, true}, // Deadlock victim
+		{serverError{-2}, true},   // Timeout expired
+		{serverError{102}, false}, // Syntax error
+		{serverError{229}, false}, // Permission denied
+		{serverError{208}, false}, // Invalid object name
+		{context.Canceled, false},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), false},
+		{errors.New("sql: Scan error"), false},
+	}
+	for _, tt := range tests {
+		if got := IsTransientError(tt.err); got != tt.want {
+			t.Errorf("IsTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// TestRetryTransient fails the query of each method with transient errors,
+// then lets it succeed.
+func TestRetryTransient(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		query string
+		rows  func() *sqlmock.Rows
+		run   func(*SocioRepository) error
+	}{
+		{"GetAll", "FROM [dbo].[Personas] p", func() *sqlmock.Rows {
+			return sqlmock.NewRows(socioRowColumns).AddRow(socioRow("12345678Z")...)
+		}, func(r *SocioRepository) error {
+			socios, err := r.GetAll(ctx)
+			if err == nil && len(socios) != 1 {
+				err = fmt.Errorf("got %d socios, want 1", len(socios))
+			}
+			return err
+		}},
+		{"GetByDNI", "AND p.Dni = @p1", func() *sqlmock.Rows {
+			return sqlmock.NewRows(socioRowColumns).AddRow(socioRow("12345678Z")...)
+		}, func(r *SocioRepository) error {
+			socio, err := r.GetByDNI(ctx, "12345678Z")
+			if err == nil && socio == nil {
+				err = errors.New("socio not found")
+			}
+			return err
+		}},
+		{"Count", "SELECT COUNT(*) FROM (", func() *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"count"}).AddRow(3)
+		}, func(r *SocioRepository) error {
+			count, err := r.Count(ctx)
+			if err == nil && count != 3 {
+				err = fmt.Errorf("count %d, want 3", count)
+			}
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock(t)
+			mock.ExpectQuery(sqlWith(tt.query)).WillReturnError(fmt.Errorf("read tcp: %w", syscall.ECONNRESET))
+			mock.ExpectQuery(sqlWith(tt.query)).WillReturnError(serverError{1205})
+			mock.ExpectQuery(sqlWith(tt.query)).WillReturnRows(tt.rows())
+
+			if err := tt.run(NewSocioRepository(db, Tables{}, WithRetryPolicy(fastRetries))); err != nil {
+				t.Errorf("%s after two transient errors: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	db, mock := newMock(t)
+	for i := 0; i <= fastRetries.Retries; i++ {
+		mock.ExpectQuery(sqlWith("SELECT COUNT(*) FROM (")).WillReturnError(syscall.ECONNRESET)
+	}
+
+	_, err := NewSocioRepository(db, Tables{}, WithRetryPolicy(fastRetries)).Count(context.Background())
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Count error = %v, want the connection reset once out of retries", err)
+	}
+}
+
+// TestRetryNotTransient checks syntax and permission errors fail the query
+// at once.
+func TestRetryNotTransient(t *testing.T) {
+	for _, number := range []int32{102, 229} {
+		db, mock := newMock(t)
+		mock.ExpectQuery(sqlWith("SELECT COUNT(*) FROM (")).WillReturnError(serverError{number})
+
+		_, err := NewSocioRepository(db, Tables{}, WithRetryPolicy(fastRetries)).Count(context.Background())
+		if !errors.Is(err, serverError{number}) {
+			t.Errorf("Count error = %v, want SQL error %d", err, number)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{Retries: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 15 * time.Millisecond}
+	var attempts []time.Time
+	err := withRetry(context.Background(), policy, func() error {
+		attempts = append(attempts, time.Now())
+		return driver.ErrBadConn
+	})
+	if !errors.Is(err, driver.ErrBadConn) || len(attempts) != 4 {
+		t.Fatalf("withRetry = %v after %d attempts, want ErrBadConn after 4", err, len(attempts))
+	}
+	for i, floor := range []time.Duration{10 * time.Millisecond, 15 * time.Millisecond, 15 * time.Millisecond} {
+		if wait := attempts[i+1].Sub(attempts[i]); wait < floor {
+			t.Errorf("wait before retry %d = %s, want at least %s", i+1, wait, floor)
+		}
+	}
+
+	// A permanent error is returned as is, without retrying.
+	attempts = nil
+	err = withRetry(context.Background(), policy, func() error {
+		attempts = append(attempts, time.Now())
+		return permanent(io.EOF)
+	})
+	if err != io.EOF || len(attempts) != 1 {
+		t.Errorf("withRetry of a permanent error = %v after %d attempts, want EOF after 1", err, len(attempts))
+	}
+}
+
+// TestRetryStream checks a stream is retried while nothing has reached its
+// callback, and not once a socio has, so none is handed over twice.
+func TestRetryStream(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("FROM [dbo].[Personas] p")).WillReturnError(serverError{10054})
+	mock.ExpectQuery(sqlWith("FROM [dbo].[Personas] p")).
+		WillReturnRows(sqlmock.NewRows(socioRowColumns).
+			AddRow(socioRow("12345678Z")...).
+			AddRow(socioRow("X1234567L")...).
+			RowError(1, syscall.ECONNRESET))
+
+	var streamed []string
+	err := NewSocioRepository(db, Tables{}, WithRetryPolicy(fastRetries)).GetAllStream(context.Background(), func(socio *models.Socio) error {
+		streamed = append(streamed, socio.DNI)
+		return nil
+	})
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("GetAllStream error = %v, want the connection reset after the first socio", err)
+	}
+	if len(streamed) != 1 || streamed[0] != "12345678Z" {
+		t.Errorf("streamed %v, want 12345678Z once", streamed)
+	}
+}
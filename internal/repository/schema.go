@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultSchema is the schema Sage creates its tables in.
+const DefaultSchema = "dbo"
+
+// schemaPattern matches the schema names accepted for the Sage tables:
+// regular SQL Server identifiers, which never need quoting to be typed.
+var schemaPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_@$#]{0,127}$`)
+
+// ValidSchema reports whether name can be used as the schema of the Sage
+// tables.
+func ValidSchema(name string) bool {
+	return schemaPattern.MatchString(name)
+}
+
+// Tables names the Sage tables in the queries of every repository, so all of
+// them read the schema the tables are in, and picks the SQL of the Sage
+// product they belong to. The zero value names the Sage 200 tables of
+// DefaultSchema.
+type Tables struct {
+	schema  string
+	profile string
+}
+
+// NewTables names the tables of schema, or of DefaultSchema when empty, in
+// the SQL of query profile, one of Profiles; empty means ProfileSage200.
+// Check the schema with ValidSchema first: Name quotes it, so a name that
+// fails the check only ever names a table that does not exist. Check the
+// profile with ValidProfile: an unknown one reads Sage 200 tables.
+func NewTables(schema, profile string) Tables {
+	return Tables{schema: schema, profile: profile}
+}
+
+// Schema returns the schema the tables are in, for INFORMATION_SCHEMA
+// lookups.
+func (t Tables) Schema() string {
+	if t.schema == "" {
+		return DefaultSchema
+	}
+	return t.schema
+}
+
+// Profile returns the name of the query profile.
+func (t Tables) Profile() string {
+	return t.sql().name
+}
+
+// sql returns the SQL of the query profile.
+func (t Tables) sql() *profile {
+	if p, ok := profiles[t.profile]; ok {
+		return p
+	}
+	return profiles[ProfileSage200]
+}
+
+// Name returns table qualified with the schema, both quoted, e.g.
+// [dbo].[Personas].
+func (t Tables) Name(table string) string {
+	return quoteIdentifier(t.Schema()) + "." + quoteIdentifier(table)
+}
+
+// quoteIdentifier quotes a SQL Server identifier in brackets.
+func quoteIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
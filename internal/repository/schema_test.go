@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+func TestTablesName(t *testing.T) {
+	tests := []struct {
+		tables Tables
+		want   string
+	}{
+		{Tables{}, "[dbo].[Personas]"},
+		{NewTables("", ""), "[dbo].[Personas]"},
+		{NewTables("sage", ""), "[sage].[Personas]"},
+		{NewTables("a]b", ""), "[a]]b].[Personas]"},
+	}
+	for _, tt := range tests {
+		if got := tt.tables.Name("Personas"); got != tt.want {
+			t.Errorf("Name(Personas) in schema %q = %s, want %s", tt.tables.schema, got, tt.want)
+		}
+	}
+}
+
+func TestValidSchema(t *testing.T) {
+	for _, name := range []string{"dbo", "sage", "_x", "Sage_2024", "a@b$c#"} {
+		if !ValidSchema(name) {
+			t.Errorf("ValidSchema(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"", "1sage", "sa ge", "sa]ge", "sage;DROP", "dbo.x", strings.Repeat("a", 129)} {
+		if ValidSchema(name) {
+			t.Errorf("ValidSchema(%q) = true, want false", name)
+		}
+	}
+}
+
+// errStop fails a query once it has been recorded.
+var errStop = errors.New("stop")
+
+// recordQueries returns a database failing every query with errStop after
+// appending its SQL to the returned slice.
+func recordQueries(t *testing.T) (*sql.DB, sqlmock.Sqlmock, *[]string) {
+	t.Helper()
+	var queries []string
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(func(_, actual string) error {
+		queries = append(queries, actual)
+		return nil
+	})))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, mock, &queries
+}
+
+// TestQueriesUseSchema runs a query of every repository with a custom
+// schema and checks the tables it reads are all in it.
+func TestQueriesUseSchema(t *testing.T) {
+	ctx := context.Background()
+	socio := &models.Socio{CodigoEmpresa: 1, DNI: "12345678Z"}
+
+	tests := []struct {
+		name   string
+		tables []string
+		run    func(*sql.DB, Tables) error
+	}{
+		{"empresas", []string{"Empresas"}, func(db *sql.DB, tables Tables) error {
+			_, err := NewEmpresaRepository(db, tables).GetAll(ctx)
+			return err
+		}},
+		{"empresa count", []string{"Empresas"}, func(db *sql.DB, tables Tables) error {
+			_, err := NewEmpresaRepository(db, tables).Count(ctx)
+			return err
+		}},
+		{"articulos", []string{"Articulos", "TiposIva"}, func(db *sql.DB, tables Tables) error {
+			_, err := NewArticuloRepository(db, tables).GetAll(ctx)
+			return err
+		}},
+		{"clientes", []string{"Clientes"}, func(db *sql.DB, tables Tables) error {
+			_, err := NewClienteRepository(db, tables).GetByEmpresa(ctx, 1)
+			return err
+		}},
+		{"facturas", []string{"CabeceraAlbaranCliente"}, func(db *sql.DB, tables Tables) error {
+			_, err := NewFacturaRepository(db, tables).GetSince(ctx, time.Now())
+			return err
+		}},
+		{"socios", socioTables, func(db *sql.DB, tables Tables) error {
+			_, err := NewSocioRepository(db, tables).GetAll(ctx)
+			return err
+		}},
+		{"socio DNIs", socioTables, func(db *sql.DB, tables Tables) error {
+			_, err := NewSocioRepository(db, tables).GetAllDNIs(ctx)
+			return err
+		}},
+		{"modified socios", socioTables, func(db *sql.DB, tables Tables) error {
+			_, err := NewSocioRepository(db, tables).GetModifiedSince(ctx, time.Now())
+			return err
+		}},
+		{"socio update", []string{"CargosFiscalHistorico", "Personas"}, func(db *sql.DB, tables Tables) error {
+			return NewSocioRepository(db, tables).UpdateFields(ctx, socio, []string{models.FieldCargo})
+		}},
+	}
+
+	for _, schema := range []string{"", "Sage_2024"} {
+		want := "[dbo]."
+		if schema != "" {
+			want = "[" + schema + "]."
+		}
+		for _, tt := range tests {
+			t.Run(tt.name+" in "+want, func(t *testing.T) {
+				db, mock, queries := recordQueries(t)
+				if tt.name == "socio update" {
+					mock.ExpectBegin()
+					mock.ExpectExec("").WillReturnError(errStop)
+				} else {
+					mock.ExpectQuery("").WillReturnError(errStop)
+				}
+
+				if err := tt.run(db, NewTables(schema, "")); !errors.Is(err, errStop) {
+					t.Fatalf("query error = %v, want %v", err, errStop)
+				}
+				if len(*queries) != 1 {
+					t.Fatalf("ran %d queries, want 1", len(*queries))
+				}
+				query := (*queries)[0]
+				for _, table := range tt.tables {
+					if !strings.Contains(query, want+"["+table+"]") {
+						t.Errorf("query does not read %s%s:\n%s", want, table, query)
+					}
+				}
+				if strings.Count(query, "].[") != strings.Count(query, want) {
+					t.Errorf("query reads tables outside %s:\n%s", want, query)
+				}
+			})
+		}
+	}
+}
+
+// TestSchemaLookupsUseSchema checks the INFORMATION_SCHEMA lookups ask for
+// the custom schema.
+func TestSchemaLookupsUseSchema(t *testing.T) {
+	ctx := context.Background()
+	tables := NewTables("Sage_2024", "")
+	schemaArgs := []driver.Value{sql.Named("schema", "Sage_2024"),
+		sql.Named("t1", "Personas"), sql.Named("t2", "SociosHistorico"), sql.Named("t3", "CargosFiscalHistorico")}
+
+	t.Run("modification tracking", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(sqlWith("FROM INFORMATION_SCHEMA.COLUMNS", "AND TABLE_SCHEMA = @schema")).
+			WithArgs(append([]driver.Value{sql.Named("column", ModifiedColumn)}, schemaArgs...)...).
+			WillReturnRows(sqlmock.NewRows([]string{"tables"}).AddRow(3))
+
+		tracks, err := NewSocioRepository(db, tables).TracksModifications(ctx)
+		if err != nil || !tracks {
+			t.Errorf("TracksModifications = %v, %v, want true", tracks, err)
+		}
+	})
+
+	t.Run("health check", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(sqlWith("FROM INFORMATION_SCHEMA.COLUMNS c", "WHERE c.TABLE_SCHEMA = @schema")).
+			WithArgs(schemaArgs...).
+			WillReturnRows(sqlmock.NewRows([]string{"db", "table", "column"}).AddRow("SAGE", nil, nil))
+
+		report, err := NewSocioRepository(db, tables).HealthCheck(ctx)
+		if err != nil {
+			t.Fatalf("HealthCheck: %v", err)
+		}
+		if report.Schema != "Sage_2024" {
+			t.Errorf("HealthCheck schema = %q, want Sage_2024", report.Schema)
+		}
+	})
+
+	t.Run("empresa names", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(sqlWith("FROM INFORMATION_SCHEMA.TABLES", "WHERE TABLE_SCHEMA = @schema")).
+			WithArgs(sql.Named("schema", "Sage_2024"), sql.Named("table", "Empresas")).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(sqlWith("FROM [Sage_2024].[Personas] p", "LEFT JOIN [Sage_2024].[Empresas] e")).
+			WillReturnRows(sqlmock.NewRows([]string{"CodigoEmpresa", "Empresa", "Socios"}).AddRow(1, "Acme SL", 3))
+
+		breakdown, err := NewSocioRepository(db, tables).EmpresaBreakdown(ctx)
+		if err != nil {
+			t.Fatalf("EmpresaBreakdown: %v", err)
+		}
+		if len(breakdown) != 1 || breakdown[0].Socios != 3 {
+			t.Errorf("EmpresaBreakdown = %+v, want 3 socios in empresa 1", breakdown)
+		}
+	})
+}
@@ -5,6 +5,10 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/microsoft/go-mssqldb" // SQL Server driver
 	"github.com/arduriki/sage-bitrix-sync/internal/models"
@@ -13,49 +17,254 @@ import (
 // SocioRepository handles database operations for Socio entities
 // This is similar to your SocioRepository class in .NET
 type SocioRepository struct {
-	db *sql.DB
+	db              *sql.DB
+	tables          Tables
+	retry           RetryPolicy
+	queryTimeout    time.Duration
+	readUncommitted bool
+	log             *queryLog
 }
 
-// NewSocioRepository creates a new repository instance
+// SocioReader is the read side of a socio repository, so the code reading
+// socios can run against repositorytest.Socios instead of SQL Server.
+// SocioRepository implements it.
+type SocioReader interface {
+	GetAll(ctx context.Context) ([]*models.Socio, error)
+	GetAllByEmpresa(ctx context.Context, codigoEmpresa int) ([]*models.Socio, error)
+	GetModifiedSince(ctx context.Context, since time.Time) ([]*models.Socio, error)
+	Count(ctx context.Context) (int, error)
+}
+
+var _ SocioReader = (*SocioRepository)(nil)
+
+// SocioOption configures a SocioRepository.
+type SocioOption func(*SocioRepository)
+
+// WithRetryPolicy changes how queries failing with a transient error are
+// retried; see IsTransientError.
+func WithRetryPolicy(policy RetryPolicy) SocioOption {
+	return func(r *SocioRepository) {
+		r.retry = policy
+	}
+}
+
+// WithQueryTimeout gives up on each query attempt after d, with
+// ErrQueryTimeout, whatever the caller's deadline; 0 disables. For the
+// streams it bounds the whole read, callbacks included.
+func WithQueryTimeout(d time.Duration) SocioOption {
+	return func(r *SocioRepository) {
+		r.queryTimeout = d
+	}
+}
+
+// WithReadUncommitted reads the socio tables with NOLOCK hints, so the
+// queries take no shared locks and never block Sage users writing them, at
+// the cost of possibly reading uncommitted or half-moved rows. Writes are
+// not affected.
+func WithReadUncommitted() SocioOption {
+	return func(r *SocioRepository) {
+		r.readUncommitted = true
+	}
+}
+
+// NewSocioRepository creates a new repository instance, reading the tables
+// named by tables
 // In Go, we use constructor functions instead of constructors
-func NewSocioRepository(db *sql.DB) *SocioRepository {
-	return &SocioRepository{
-		db: db,
+func NewSocioRepository(db *sql.DB, tables Tables, opts ...SocioOption) *SocioRepository {
+	r := &SocioRepository{
+		db:           db,
+		tables:       tables,
+		retry:        DefaultRetryPolicy,
+		queryTimeout: DefaultQueryTimeout,
+		log:          &queryLog{},
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
+	return r
+}
+
+// attempt runs fn, retrying it on transient errors, each attempt with the
+// query timeout applied to the context fn is given. It fails with
+// ErrNotInProfile when the Sage product has no socio tables
+func (r *SocioRepository) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := r.inProfile(); err != nil {
+		return err
+	}
+	return withRetry(ctx, r.retry, func() error {
+		return withQueryTimeout(ctx, r.queryTimeout, fn)
+	})
+}
+
+// latestSocios selects the socios matching filter, an extra condition on
+// p, sh or cfh starting with AND, which reads other tables with r.hint(). The historical tables hold a row per
+// period, so each is narrowed to the latest row of each persona in each
+// empresa on its own: the one of the highest Ejercicio, ties broken on the
+// values so the pick does not depend on the plan SQL Server chooses. A cargo
+// is thus the latest one even when it changed in another year than the
+// participación.
+func (r *SocioRepository) latestSocios(filter string) string {
+	return `
+		SELECT CodigoEmpresa, PorParticipacion, Administrador, CargoAdministrador, DNI, RazonSocialEmpleado, Ejercicio
+		FROM (
+			SELECT
+				sh.CodigoEmpresa,
+				sh.PorParticipacion,
+				cfh.Administrador,
+				cfh.CargoAdministrador,
+				p.Dni as DNI,
+				p.RazonSocialEmpleado,
+				sh.Ejercicio,
+				ROW_NUMBER() OVER (
+					PARTITION BY p.GuidPersona, sh.CodigoEmpresa
+					ORDER BY sh.Ejercicio DESC, sh.PorParticipacion DESC
+				) AS Periodo
+			FROM
+				` + r.table("Personas") + ` p` + r.hint() + `
+				INNER JOIN ` + r.table("SociosHistorico") + ` sh` + r.hint() + ` ON p.GuidPersona = sh.GuidPersona
+				INNER JOIN (
+					SELECT
+						GuidPersona,
+						CodigoEmpresa,
+						Administrador,
+						CargoAdministrador,
+						ROW_NUMBER() OVER (
+							PARTITION BY GuidPersona, CodigoEmpresa
+							ORDER BY Ejercicio DESC, Administrador DESC, CargoAdministrador
+						) AS Periodo
+					FROM ` + r.table("CargosFiscalHistorico") + r.hint() + `
+				) cfh ON cfh.GuidPersona = p.GuidPersona AND cfh.CodigoEmpresa = sh.CodigoEmpresa AND cfh.Periodo = 1
+			WHERE
+				p.Dni IS NOT NULL AND p.Dni != ''
+				` + filter + `
+		) socios
+		WHERE Periodo = 1`
+}
+
+// inProfile fails with ErrNotInProfile when the Sage product of the query
+// profile has no socio tables.
+func (r *SocioRepository) inProfile() error {
+	if p := r.tables.sql(); !p.socios {
+		return p.notInProfile("socios")
+	}
+	return nil
+}
+
+// table names a Sage table for the socio queries.
+func (r *SocioRepository) table(name string) string {
+	return r.tables.Name(name)
+}
+
+// hint is the table hint of the socio reads: NOLOCK with
+// WithReadUncommitted, none otherwise.
+func (r *SocioRepository) hint() string {
+	if r.readUncommitted {
+		return " WITH (NOLOCK)"
+	}
+	return ""
+}
+
+// socioOrder sorts the socio queries.
+const socioOrder = `
+		ORDER BY DNI, CodigoEmpresa`
+
+// allSocios matches your actual Sage database structure from SocioRepository.cs
+func (r *SocioRepository) allSocios() string {
+	return r.latestSocios("") + socioOrder
+}
+
+// empresaSocios is allSocios for the socios of one empresa
+func (r *SocioRepository) empresaSocios() string {
+	return r.latestSocios("AND sh.CodigoEmpresa = @sageCode") + socioOrder
 }
 
 // GetAll retrieves all socios from the Sage database
-// This matches your actual C# query with the proper JOINs
 func (r *SocioRepository) GetAll(ctx context.Context) ([]*models.Socio, error) {
-	// This query matches your actual Sage database structure from SocioRepository.cs
-	query := `
-		SELECT 
-			sh.CodigoEmpresa,
-			sh.PorParticipacion,
-			cfh.Administrador,
-			cfh.CargoAdministrador,
-			p.Dni as DNI,
-			p.RazonSocialEmpleado
-		FROM 
-			Personas p
-			INNER JOIN SociosHistorico sh ON p.GuidPersona = sh.GuidPersona
-			INNER JOIN CargosFiscalHistorico cfh ON p.GuidPersona = cfh.GuidPersona
-		WHERE 
-			p.Dni IS NOT NULL AND p.Dni != ''
-		ORDER BY p.Dni
-	`
+	return r.query(ctx, "socios", r.allSocios())
+}
+
+// GetAllStream calls fn with each socio as it is read, so the whole result
+// is never held in memory. It stops at the first error fn returns, or when
+// ctx is done, and returns that error.
+func (r *SocioRepository) GetAllStream(ctx context.Context, fn func(*models.Socio) error) error {
+	return r.stream(ctx, fn, "socios", r.allSocios())
+}
+
+// GetAllByEmpresa retrieves the socios of one empresa, for Sage databases
+// holding several companies
+func (r *SocioRepository) GetAllByEmpresa(ctx context.Context, codigoEmpresa int) ([]*models.Socio, error) {
+	return r.query(ctx, fmt.Sprintf("socios of empresa %d", codigoEmpresa), r.empresaSocios(),
+		sql.Named("sageCode", codigoEmpresa))
+}
+
+// GetAllByEmpresaStream is GetAllStream for the socios of one empresa
+func (r *SocioRepository) GetAllByEmpresaStream(ctx context.Context, codigoEmpresa int, fn func(*models.Socio) error) error {
+	return r.stream(ctx, fn, fmt.Sprintf("socios of empresa %d", codigoEmpresa), r.empresaSocios(),
+		sql.Named("sageCode", codigoEmpresa))
+}
+
+// query runs a socios query, retrying it on transient errors, and collects
+// the socios it returns; what names them in errors
+func (r *SocioRepository) query(ctx context.Context, what, query string, args ...interface{}) ([]*models.Socio, error) {
+	var socios []*models.Socio
+	err := r.attempt(ctx, func(ctx context.Context) error {
+		socios = nil
+		return r.each(ctx, func(socio *models.Socio) error {
+			socios = append(socios, socio)
+			return nil
+		}, what, query, args...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return socios, nil
+}
+
+// stream runs a socios query, handing each socio to fn. A transient error
+// is retried only until the first socio was handed off, so fn never sees
+// a socio twice
+func (r *SocioRepository) stream(ctx context.Context, fn func(*models.Socio) error, what, query string, args ...interface{}) error {
+	return r.attempt(ctx, func(ctx context.Context) error {
+		handed := false
+		err := r.each(ctx, func(socio *models.Socio) error {
+			handed = true
+			return permanent(fn(socio))
+		}, what, query, args...)
+		if handed {
+			return permanent(err)
+		}
+		return err
+	})
+}
+
+// each runs a socios query once, scanning rows one at a time and handing
+// the valid socios to fn, skipping rows that fail to scan. The query is
+// recorded in the query log with the rows read
+func (r *SocioRepository) each(ctx context.Context, fn func(*models.Socio) error, what, query string, args ...interface{}) error {
+	return r.timed(what, args, func() (int, error) {
+		read := 0
+		err := r.scan(ctx, func(socio *models.Socio) error {
+			read++
+			return fn(socio)
+		}, what, query, args...)
+		return read, err
+	})
+}
 
+// scan runs a socios query for each
+func (r *SocioRepository) scan(ctx context.Context, fn func(*models.Socio) error, what, query string, args ...interface{}) error {
 	// Execute query with context for timeout control
-	rows, err := r.db.QueryContext(ctx, query)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query socios: %w", err)
+		return fmt.Errorf("failed to query %s: %w", what, err)
 	}
 	defer rows.Close() // Always close rows when done
 
-	var socios []*models.Socio
-
-	// Iterate through results
 	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		socio := &models.Socio{}
 
 		// Scan row data into struct
@@ -65,54 +274,206 @@ func (r *SocioRepository) GetAll(ctx context.Context) ([]*models.Socio, error) {
 			continue // Skip invalid rows but continue processing
 		}
 
-		// Only add valid socios
-		if socio.IsValid() {
-			socios = append(socios, socio)
+		// Only hand off valid socios
+		if !socio.IsValid() {
+			continue
+		}
+		if err := fn(socio); err != nil {
+			return err
 		}
 	}
 
 	// Check for iteration errors
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over socio rows: %w", err)
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over socio rows: %w", err)
 	}
+	return nil
+}
 
-	return socios, nil
+// ModifiedColumn is the column stamping when a row of each socio table was
+// last changed, where the Sage installation has one.
+const ModifiedColumn = "FechaModificacion"
+
+// socioTables are the tables the socio queries read.
+var socioTables = []string{"Personas", "SociosHistorico", "CargosFiscalHistorico"}
+
+// TracksModifications reports whether every socio table has ModifiedColumn,
+// so GetModifiedSince can be used
+func (r *SocioRepository) TracksModifications(ctx context.Context) (bool, error) {
+	query := `
+		SELECT COUNT(DISTINCT TABLE_NAME)
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE COLUMN_NAME = @column
+			AND TABLE_SCHEMA = @schema
+			AND TABLE_NAME IN (@t1, @t2, @t3)
+	`
+
+	args := []interface{}{
+		sql.Named("column", ModifiedColumn),
+		sql.Named("schema", r.tables.Schema()),
+		sql.Named("t1", socioTables[0]),
+		sql.Named("t2", socioTables[1]),
+		sql.Named("t3", socioTables[2]),
+	}
+
+	var tables int
+	err := r.attempt(ctx, func(ctx context.Context) error {
+		return r.timed(ModifiedColumn+" columns", args, func() (int, error) {
+			return oneRow(r.db.QueryRowContext(ctx, query, args...).Scan(&tables))
+		})
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s columns: %w", ModifiedColumn, err)
+	}
+
+	return tables == len(socioTables), nil
+}
+
+// socioSchema lists the columns the socio queries read, by table, in the
+// order of socioTables.
+var socioSchema = map[string][]string{
+	"Personas":              {"GuidPersona", "Dni", "RazonSocialEmpleado"},
+	"SociosHistorico":       {"GuidPersona", "CodigoEmpresa", "PorParticipacion", "Ejercicio"},
+	"CargosFiscalHistorico": {"GuidPersona", "CodigoEmpresa", "Administrador", "CargoAdministrador", "Ejercicio"},
+}
+
+// HealthReport is the outcome of SocioRepository.HealthCheck.
+type HealthReport struct {
+	Database       string   `json:"database"` // The database connected to
+	Schema         string   `json:"schema"`   // The schema the tables were looked for in
+	MissingTables  []string `json:"missing_tables,omitempty"`
+	MissingColumns []string `json:"missing_columns,omitempty"` // As Table.Column, of the tables present
+}
+
+// Healthy reports whether every table and column the socio queries read
+// is present.
+func (h *HealthReport) Healthy() bool {
+	return len(h.MissingTables) == 0 && len(h.MissingColumns) == 0
+}
+
+// String describes what is missing and what to check.
+func (h *HealthReport) String() string {
+	if h.Healthy() {
+		return fmt.Sprintf("database %s has the Sage socio tables in schema %s", h.Database, h.Schema)
+	}
+	var missing []string
+	if len(h.MissingTables) > 0 {
+		missing = append(missing, "tables "+strings.Join(h.MissingTables, ", "))
+	}
+	if len(h.MissingColumns) > 0 {
+		missing = append(missing, "columns "+strings.Join(h.MissingColumns, ", "))
+	}
+	hint := "check the Sage version is supported"
+	if len(h.MissingTables) == len(socioTables) {
+		hint = "check SAGE_DB_NAME is the Sage company database and SAGE_DB_SCHEMA the schema of its tables"
+	}
+	return fmt.Sprintf("database %s lacks %s in schema %s; %s", h.Database, strings.Join(missing, " and "), h.Schema, hint)
+}
+
+// HealthCheck pings the database and checks through INFORMATION_SCHEMA
+// that the socio tables and the columns read from them exist, so a wrong
+// database or an unsupported Sage version is told apart from a failing
+// query. The error is only set when the checks could not be run
+func (r *SocioRepository) HealthCheck(ctx context.Context) (*HealthReport, error) {
+	query := `
+		SELECT DB_NAME(), c.TABLE_NAME, c.COLUMN_NAME
+		FROM INFORMATION_SCHEMA.COLUMNS c
+		WHERE c.TABLE_SCHEMA = @schema
+			AND c.TABLE_NAME IN (@t1, @t2, @t3)
+		UNION ALL
+		SELECT DB_NAME(), NULL, NULL
+	`
+
+	args := []interface{}{
+		sql.Named("schema", r.tables.Schema()),
+		sql.Named("t1", socioTables[0]),
+		sql.Named("t2", socioTables[1]),
+		sql.Named("t3", socioTables[2]),
+	}
+
+	report := &HealthReport{Schema: r.tables.Schema()}
+	present := make(map[string]map[string]bool)
+	err := r.attempt(ctx, func(ctx context.Context) error {
+		if err := r.db.PingContext(ctx); err != nil {
+			return err
+		}
+		clear(present)
+		return r.timed("socio schema", args, func() (int, error) {
+			rows, err := r.db.QueryContext(ctx, query, args...)
+			if err != nil {
+				return 0, err
+			}
+			defer rows.Close()
+			read := 0
+			for rows.Next() {
+				var table, column sql.NullString
+				if err := rows.Scan(&report.Database, &table, &column); err != nil {
+					return read, err
+				}
+				read++
+				if !table.Valid {
+					continue
+				}
+				if present[table.String] == nil {
+					present[table.String] = make(map[string]bool)
+				}
+				present[table.String][column.String] = true
+			}
+			return read, rows.Err()
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the Sage schema: %w", err)
+	}
+
+	for _, table := range socioTables {
+		columns, ok := present[table]
+		if !ok {
+			report.MissingTables = append(report.MissingTables, table)
+			continue
+		}
+		for _, column := range socioSchema[table] {
+			if !columns[column] {
+				report.MissingColumns = append(report.MissingColumns, table+"."+column)
+			}
+		}
+	}
+	return report, nil
 }
 
-// GetByDNI retrieves a specific socio by DNI
+// GetModifiedSince retrieves the socios with a row changed at or after
+// since in any socio table, with their latest row like GetAll. Check
+// TracksModifications first; the query fails without the column
+func (r *SocioRepository) GetModifiedSince(ctx context.Context, since time.Time) ([]*models.Socio, error) {
+	query := r.latestSocios(`AND (
+					p.FechaModificacion >= @since
+					OR EXISTS (SELECT 1 FROM `+r.table("SociosHistorico")+` m`+r.hint()+`
+						WHERE m.GuidPersona = p.GuidPersona AND m.FechaModificacion >= @since)
+					OR EXISTS (SELECT 1 FROM `+r.table("CargosFiscalHistorico")+` m`+r.hint()+`
+						WHERE m.GuidPersona = p.GuidPersona AND m.FechaModificacion >= @since)
+				)`) + socioOrder
+
+	return r.query(ctx, "socios modified since "+since.Format(time.RFC3339), query, sql.Named("since", since))
+}
+
+// GetByDNI retrieves a specific socio by DNI, its latest row in the first
+// of its empresas
 // This matches your actual database structure with proper JOINs
 func (r *SocioRepository) GetByDNI(ctx context.Context, dni string) (*models.Socio, error) {
 	if dni == "" {
 		return nil, fmt.Errorf("DNI cannot be empty")
 	}
 
-	query := `
-		SELECT 
-			sh.CodigoEmpresa,
-			sh.PorParticipacion,
-			cfh.Administrador,
-			cfh.CargoAdministrador,
-			p.Dni as DNI,
-			p.RazonSocialEmpleado
-		FROM 
-			Personas p
-			INNER JOIN SociosHistorico sh ON p.GuidPersona = sh.GuidPersona
-			INNER JOIN CargosFiscalHistorico cfh ON p.GuidPersona = cfh.GuidPersona
-		WHERE 
-			p.Dni = @p1
-	`
+	query := r.latestSocios("AND p.Dni = @p1") + socioOrder
 
-	row := r.db.QueryRowContext(ctx, query, sql.Named("p1", dni))
+	args := []interface{}{sql.Named("p1", dni)}
 
 	socio := &models.Socio{}
-	err := row.Scan(
-		&socio.CodigoEmpresa,
-		&socio.PorParticipacion,
-		&socio.Administrador,
-		&socio.CargoAdministrador,
-		&socio.DNI,
-		&socio.RazonSocialEmpleado,
-	)
+	err := r.attempt(ctx, func(ctx context.Context) error {
+		return r.timed("socio by DNI", args, func() (int, error) {
+			return oneRow(socio.ScanFromDB(r.db.QueryRowContext(ctx, query, args...)))
+		})
+	})
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -124,88 +485,424 @@ func (r *SocioRepository) GetByDNI(ctx context.Context, dni string) (*models.Soc
 	return socio, nil
 }
 
+// GetAllDNIs returns the DNIs of the socios GetAll returns, normalized
+// with models.NormalizeDNI, sorted and without duplicates. Only the DNI
+// column is read, so checking which socios exist skips the full join
+func (r *SocioRepository) GetAllDNIs(ctx context.Context) ([]string, error) {
+	return r.dnis(ctx, "socio DNIs", "")
+}
+
+// GetDNIsByEmpresa returns the DNIs of the socios of one empresa, like
+// GetAllDNIs
+func (r *SocioRepository) GetDNIsByEmpresa(ctx context.Context, codigoEmpresa int) ([]string, error) {
+	return r.dnis(ctx, fmt.Sprintf("socio DNIs of empresa %d", codigoEmpresa), "AND sh.CodigoEmpresa = @sageCode",
+		sql.Named("sageCode", codigoEmpresa))
+}
+
+// dnis selects the DNIs of the personas with rows in both historical
+// tables for the same empresa, as the socio queries do, sh matching filter
+func (r *SocioRepository) dnis(ctx context.Context, what, filter string, args ...interface{}) ([]string, error) {
+	query := `
+		SELECT DISTINCT p.Dni
+		FROM ` + r.table("Personas") + ` p` + r.hint() + `
+		WHERE p.Dni IS NOT NULL AND p.Dni != ''
+			AND EXISTS (SELECT 1 FROM ` + r.table("SociosHistorico") + ` sh` + r.hint() + `
+				WHERE sh.GuidPersona = p.GuidPersona ` + filter + `
+					AND EXISTS (SELECT 1 FROM ` + r.table("CargosFiscalHistorico") + ` cfh` + r.hint() + `
+						WHERE cfh.GuidPersona = p.GuidPersona AND cfh.CodigoEmpresa = sh.CodigoEmpresa))
+	`
+
+	seen := make(map[string]bool)
+	err := r.attempt(ctx, func(ctx context.Context) error {
+		clear(seen)
+		return r.timed(what, args, func() (int, error) {
+			rows, err := r.db.QueryContext(ctx, query, args...)
+			if err != nil {
+				return 0, err
+			}
+			defer rows.Close()
+			read := 0
+			for rows.Next() {
+				var dni string
+				if err := rows.Scan(&dni); err != nil {
+					return read, err
+				}
+				read++
+				if dni = models.NormalizeDNI(dni); dni != "" {
+					seen[dni] = true
+				}
+			}
+			return read, rows.Err()
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", what, err)
+	}
+
+	dnis := make([]string, 0, len(seen))
+	for dni := range seen {
+		dnis = append(dnis, dni)
+	}
+	sort.Strings(dnis)
+	return dnis, nil
+}
+
+// dniChunk is how many DNIs a query takes as parameters. SQL Server
+// refuses statements with over 2,100 parameters, and long IN lists plan
+// poorly well before that.
+const dniChunk = 500
+
+// dniParams builds the IN list placeholders and arguments of dnis.
+func dniParams(dnis []string) (string, []interface{}) {
+	// Build placeholders for the IN clause using SQL Server syntax
+	placeholders := make([]string, len(dnis))
+	args := make([]interface{}, len(dnis))
+	for i, dni := range dnis {
+		placeholders[i] = fmt.Sprintf("@p%d", i+1)
+		args[i] = sql.Named(fmt.Sprintf("p%d", i+1), dni)
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
+// dniKey compares DNIs the way the default, case-insensitive Sage
+// collation does, ignoring trailing spaces.
+func dniKey(dni string) string {
+	return strings.ToUpper(strings.TrimRight(dni, " "))
+}
+
+// GetByDNIs retrieves the socios with the given DNIs, for syncing only a
+// few. Long lists are queried dniChunk DNIs at a time
+func (r *SocioRepository) GetByDNIs(ctx context.Context, dnis []string) ([]*models.Socio, error) {
+	if len(dnis) == 0 {
+		return nil, nil
+	}
+
+	type key struct {
+		dni     string
+		empresa int
+	}
+	seen := make(map[key]bool)
+	var socios []*models.Socio
+	for start := 0; start < len(dnis); start += dniChunk {
+		placeholders, args := dniParams(dnis[start:min(start+dniChunk, len(dnis))])
+		query := r.latestSocios(fmt.Sprintf("AND p.Dni IN (%s)", placeholders)) + socioOrder
+
+		chunk, err := r.query(ctx, "socios by DNI", query, args...)
+		if err != nil {
+			return nil, err
+		}
+		// A DNI listed in two spellings of one collation key matches the
+		// same socio from two chunks.
+		for _, socio := range chunk {
+			k := key{socio.DNI, socio.CodigoEmpresa}
+			if !seen[k] {
+				seen[k] = true
+				socios = append(socios, socio)
+			}
+		}
+	}
+
+	if len(dnis) > dniChunk {
+		sort.SliceStable(socios, func(i, j int) bool {
+			if socios[i].DNI != socios[j].DNI {
+				return socios[i].DNI < socios[j].DNI
+			}
+			return socios[i].CodigoEmpresa < socios[j].CodigoEmpresa
+		})
+	}
+	return socios, nil
+}
+
 // GetAllExcept retrieves all socios except those with specified DNIs
 // This is equivalent to your GetAllExcept() method in .NET
+// A NOT IN list cannot be split across queries, so past dniChunk DNIs all
+// socios are read and the excluded ones left out here
 func (r *SocioRepository) GetAllExcept(ctx context.Context, excludeDNIs []string) ([]*models.Socio, error) {
 	if len(excludeDNIs) == 0 {
 		return r.GetAll(ctx) // If no exclusions, return all
 	}
 
-	// Build placeholders for the IN clause using SQL Server syntax
-	placeholders := ""
-	args := make([]interface{}, len(excludeDNIs))
-	for i, dni := range excludeDNIs {
-		if i > 0 {
-			placeholders += ", "
+	if len(excludeDNIs) <= dniChunk {
+		placeholders, args := dniParams(excludeDNIs)
+		query := r.latestSocios(fmt.Sprintf("AND p.Dni NOT IN (%s)", placeholders)) + socioOrder
+
+		return r.query(ctx, "socios excluding DNIs", query, args...)
+	}
+
+	excluded := make(map[string]bool, len(excludeDNIs))
+	for _, dni := range excludeDNIs {
+		excluded[dniKey(dni)] = true
+	}
+	socios, err := r.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	kept := socios[:0]
+	for _, socio := range socios {
+		if !excluded[dniKey(socio.DNI)] {
+			kept = append(kept, socio)
 		}
-		placeholders += fmt.Sprintf("@p%d", i+1)
-		args[i] = sql.Named(fmt.Sprintf("p%d", i+1), dni)
 	}
+	return kept, nil
+}
 
-	query := fmt.Sprintf(`
-		SELECT 
-			sh.CodigoEmpresa,
-			sh.PorParticipacion,
-			cfh.Administrador,
-			cfh.CargoAdministrador,
-			p.Dni as DNI,
-			p.RazonSocialEmpleado
-		FROM 
-			Personas p
-			INNER JOIN SociosHistorico sh ON p.GuidPersona = sh.GuidPersona
-			INNER JOIN CargosFiscalHistorico cfh ON p.GuidPersona = cfh.GuidPersona
-		WHERE 
-			p.Dni IS NOT NULL 
-			AND p.Dni != ''
-			AND p.Dni NOT IN (%s)
-		ORDER BY p.Dni
-	`, placeholders)
+// Count returns the total number of socios in the database, as many as
+// GetAll returns
+func (r *SocioRepository) Count(ctx context.Context) (int, error) {
+	query := "SELECT COUNT(*) FROM (" + r.latestSocios("") + ") counted"
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	var count int
+	err := r.attempt(ctx, func(ctx context.Context) error {
+		return r.timed("socio count", nil, func() (int, error) {
+			return oneRow(r.db.QueryRowContext(ctx, query).Scan(&count))
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to query socios excluding DNIs: %w", err)
+		return 0, fmt.Errorf("failed to count socios: %w", err)
 	}
-	defer rows.Close()
 
-	var socios []*models.Socio
+	return count, nil
+}
 
-	for rows.Next() {
-		socio := &models.Socio{}
-		err := socio.ScanFromDB(rows)
-		if err != nil {
-			log.Printf("Warning: failed to scan socio row: %v", err)
-			continue
-		}
+// CountAllByEmpresa returns the number of socios of one empresa, counted
+// like Count; an empresa without socios counts 0
+func (r *SocioRepository) CountAllByEmpresa(ctx context.Context, codigoEmpresa int) (int, error) {
+	query := "SELECT COUNT(*) FROM (" + r.latestSocios("AND sh.CodigoEmpresa = @sageCode") + ") counted"
 
-		if socio.IsValid() {
-			socios = append(socios, socio)
-		}
+	args := []interface{}{sql.Named("sageCode", codigoEmpresa)}
+
+	var count int
+	err := r.attempt(ctx, func(ctx context.Context) error {
+		return r.timed(fmt.Sprintf("socio count of empresa %d", codigoEmpresa), args, func() (int, error) {
+			return oneRow(r.db.QueryRowContext(ctx, query, args...).Scan(&count))
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count socios of empresa %d: %w", codigoEmpresa, err)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over socio rows: %w", err)
+	return count, nil
+}
+
+// EmpresaSocios is how many socios one Sage empresa has, as
+// SocioRepository.EmpresaBreakdown reports it.
+type EmpresaSocios struct {
+	CodigoEmpresa int    `json:"codigo_empresa"`
+	Empresa       string `json:"empresa,omitempty"` // Its name in Empresas, when the database has the table
+	Socios        int    `json:"socios"`
+}
+
+// CountByEmpresa returns the number of socios of each empresa that has
+// any, counted like Count, by CodigoEmpresa
+func (r *SocioRepository) CountByEmpresa(ctx context.Context) (map[int]int, error) {
+	empresas, err := r.perEmpresa(ctx, false)
+	if err != nil {
+		return nil, err
 	}
+	counts := make(map[int]int, len(empresas))
+	for _, empresa := range empresas {
+		counts[empresa.CodigoEmpresa] = empresa.Socios
+	}
+	return counts, nil
+}
 
-	return socios, nil
+// EmpresaBreakdown returns the socios of each empresa like CountByEmpresa,
+// sorted by CodigoEmpresa and named after the Empresas table when the
+// database has one, to choose the company mapping of a new client
+func (r *SocioRepository) EmpresaBreakdown(ctx context.Context) ([]EmpresaSocios, error) {
+	named, err := r.hasTable(ctx, "Empresas")
+	if err != nil {
+		return nil, err
+	}
+	return r.perEmpresa(ctx, named)
 }
 
-// Count returns the total number of socios in the database
-func (r *SocioRepository) Count(ctx context.Context) (int, error) {
+// perEmpresa counts the socios grouped by empresa, joining Empresas for
+// their names when named is set
+func (r *SocioRepository) perEmpresa(ctx context.Context, named bool) ([]EmpresaSocios, error) {
+	name, join := "NULL", ""
+	if named {
+		name = "e.Empresa"
+		join = `
+			LEFT JOIN ` + r.table("Empresas") + ` e` + r.hint() + ` ON e.CodigoEmpresa = c.CodigoEmpresa`
+	}
 	query := `
-		SELECT COUNT(*) 
-		FROM Personas p
-			INNER JOIN SociosHistorico sh ON p.GuidPersona = sh.GuidPersona
-			INNER JOIN CargosFiscalHistorico cfh ON p.GuidPersona = cfh.GuidPersona
-		WHERE p.Dni IS NOT NULL AND p.Dni != ''
+		SELECT c.CodigoEmpresa, ` + name + `, c.Socios
+		FROM (
+			SELECT CodigoEmpresa, COUNT(*) AS Socios
+			FROM (` + r.latestSocios("") + `) latest
+			GROUP BY CodigoEmpresa
+		) c` + join + `
+		ORDER BY c.CodigoEmpresa`
+
+	var empresas []EmpresaSocios
+	err := r.attempt(ctx, func(ctx context.Context) error {
+		empresas = empresas[:0]
+		return r.timed("socio count per empresa", nil, func() (int, error) {
+			rows, err := r.db.QueryContext(ctx, query)
+			if err != nil {
+				return 0, err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var empresa EmpresaSocios
+				var nombre sql.NullString
+				if err := rows.Scan(&empresa.CodigoEmpresa, &nombre, &empresa.Socios); err != nil {
+					return len(empresas), err
+				}
+				empresa.Empresa = strings.TrimSpace(nombre.String)
+				empresas = append(empresas, empresa)
+			}
+			return len(empresas), rows.Err()
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count socios per empresa: %w", err)
+	}
+
+	return empresas, nil
+}
+
+// hasTable reports whether the schema of the Sage tables has a table of
+// that name
+func (r *SocioRepository) hasTable(ctx context.Context, table string) (bool, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM INFORMATION_SCHEMA.TABLES
+		WHERE TABLE_SCHEMA = @schema
+			AND TABLE_NAME = @table
 	`
 
+	args := []interface{}{sql.Named("schema", r.tables.Schema()), sql.Named("table", table)}
+
 	var count int
-	err := r.db.QueryRowContext(ctx, query).Scan(&count)
+	err := r.attempt(ctx, func(ctx context.Context) error {
+		return r.timed("table "+table, args, func() (int, error) {
+			return oneRow(r.db.QueryRowContext(ctx, query, args...).Scan(&count))
+		})
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to count socios: %w", err)
+		return false, fmt.Errorf("failed to look up table %s: %w", table, err)
 	}
 
-	return count, nil
+	return count > 0, nil
+}
+
+// DatabasesLike returns the names of the online user databases of the
+// server matching the LIKE pattern, sorted, for installations keeping a
+// Sage database per company
+func (r *SocioRepository) DatabasesLike(ctx context.Context, pattern string) ([]string, error) {
+	query := `
+		SELECT name
+		FROM sys.databases
+		WHERE name LIKE @pattern
+			AND database_id > 4
+			AND state_desc = 'ONLINE'
+		ORDER BY name
+	`
+
+	args := []interface{}{sql.Named("pattern", pattern)}
+
+	var names []string
+	err := r.attempt(ctx, func(ctx context.Context) error {
+		names = names[:0]
+		return r.timed("databases like "+pattern, args, func() (int, error) {
+			rows, err := r.db.QueryContext(ctx, query, args...)
+			if err != nil {
+				return 0, err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var name string
+				if err := rows.Scan(&name); err != nil {
+					return len(names), err
+				}
+				names = append(names, name)
+			}
+			return len(names), rows.Err()
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases like %q: %w", pattern, err)
+	}
+
+	return names, nil
+}
+
+// socioColumns maps each field that may be written back to Sage to its
+// table and column. Fields not listed here are never written.
+var socioColumns = map[string]struct{ table, column string }{
+	models.FieldCargo:         {"CargosFiscalHistorico", "CargoAdministrador"},
+	models.FieldParticipacion: {"SociosHistorico", "PorParticipacion"},
+	models.FieldAdministrador: {"CargosFiscalHistorico", "Administrador"},
+}
+
+// UpdateFields writes the given fields of a socio back to the Sage tables,
+// for the persona with its DNI in its empresa. All tables are updated in one
+// transaction; fields outside socioColumns are refused.
+func (r *SocioRepository) UpdateFields(ctx context.Context, socio *models.Socio, fields []string) error {
+	if err := r.inProfile(); err != nil {
+		return err
+	}
+	values := map[string]interface{}{
+		models.FieldCargo:         socio.CargoAdministrador,
+		models.FieldParticipacion: socio.PorParticipacion,
+		models.FieldAdministrador: socio.Administrador,
+	}
+
+	// Group the SET clauses by table, keeping a stable statement order.
+	var tables []string
+	sets := make(map[string][]string)
+	args := []interface{}{sql.Named("dni", socio.DNI), sql.Named("sageCode", socio.CodigoEmpresa)}
+	for _, field := range fields {
+		col, ok := socioColumns[field]
+		if !ok {
+			return fmt.Errorf("field %q cannot be written back to Sage", field)
+		}
+		if _, seen := sets[col.table]; !seen {
+			tables = append(tables, col.table)
+		}
+		param := "p" + strconv.Itoa(len(args))
+		sets[col.table] = append(sets[col.table], fmt.Sprintf("t.%s = @%s", col.column, param))
+		args = append(args, sql.Named(param, values[field]))
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin socio update: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		query := fmt.Sprintf(`
+			UPDATE t SET %s
+			FROM %s t
+				INNER JOIN %s p ON p.GuidPersona = t.GuidPersona
+			WHERE p.Dni = @dni AND t.CodigoEmpresa = @sageCode
+		`, strings.Join(sets[table], ", "), r.table(table), r.table("Personas"))
+
+		var res sql.Result
+		err := r.timed("update of "+table, args, func() (n int, err error) {
+			res, err = tx.ExecContext(ctx, query, args...)
+			if err == nil {
+				if affected, err := res.RowsAffected(); err == nil {
+					n = int(affected)
+				}
+			}
+			return n, err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update %s of socio %s: %w", table, socio.DNI, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return fmt.Errorf("no %s row for socio %s in empresa %d", table, socio.DNI, socio.CodigoEmpresa)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit socio update: %w", err)
+	}
+	return nil
 }
 
 // Close closes the database connection
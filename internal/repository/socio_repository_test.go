@@ -0,0 +1,384 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	_ "modernc.org/sqlite"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+var socioRowColumns = []string{"CodigoEmpresa", "PorParticipacion", "Administrador", "CargoAdministrador", "DNI", "RazonSocialEmpleado", "Ejercicio"}
+
+// socioRow is a full row of the socio queries, in socioRowColumns order.
+func socioRow(dni string) []driver.Value {
+	return []driver.Value{1, 25.5, true, "Consejero", dni, "García López, Ana", 2024}
+}
+
+func TestSocioScanNullColumns(t *testing.T) {
+	for i, column := range socioRowColumns {
+		t.Run(column, func(t *testing.T) {
+			db, mock := newMock(t)
+			row := socioRow("12345678Z")
+			row[i] = nil
+			mock.ExpectQuery(sqlWith("FROM [dbo].[Personas] p")).
+				WillReturnRows(sqlmock.NewRows(socioRowColumns).AddRow(row...))
+
+			socios, err := NewSocioRepository(db, Tables{}).GetAll(context.Background())
+			if err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+
+			// A socio without DNI cannot be matched and is left out.
+			if column == "DNI" {
+				if len(socios) != 0 {
+					t.Errorf("GetAll returned %d socios for a NULL DNI, want none", len(socios))
+				}
+				return
+			}
+			if len(socios) != 1 {
+				t.Fatalf("GetAll returned %d socios, want the row with NULL %s", len(socios), column)
+			}
+			socio := socios[0]
+			if fmt.Sprint(socio.NullColumns) != "["+column+"]" {
+				t.Errorf("NullColumns = %v, want [%s]", socio.NullColumns, column)
+			}
+			zero := map[string]bool{
+				"CodigoEmpresa":       socio.CodigoEmpresa == 0,
+				"PorParticipacion":    socio.PorParticipacion == 0,
+				"Administrador":       !socio.Administrador,
+				"CargoAdministrador":  socio.CargoAdministrador == "",
+				"RazonSocialEmpleado": socio.RazonSocialEmpleado == "",
+				"Ejercicio":           socio.Ejercicio == 0,
+			}
+			if !zero[column] {
+				t.Errorf("NULL %s read as %+v, want its zero value", column, socio)
+			}
+		})
+	}
+}
+
+func TestSocioScanWithoutNulls(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("FROM [dbo].[Personas] p")).
+		WillReturnRows(sqlmock.NewRows(socioRowColumns).
+			AddRow(socioRow("12345678Z")...).
+			AddRow("not a code", 1.0, false, "", "X1234567L", "Smith, John", 2024))
+
+	socios, err := NewSocioRepository(db, Tables{}).GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(socios) != 1 {
+		t.Fatalf("GetAll returned %d socios, want 1: the row failing to scan is skipped", len(socios))
+	}
+	if s := socios[0]; s.NullColumns != nil || s.PorParticipacion != 25.5 || !s.Administrador || s.CargoAdministrador != "Consejero" {
+		t.Errorf("GetAll = %+v", s)
+	}
+}
+
+// historyDB returns a SQLite database holding the Sage socio tables in a
+// dbo schema, filled by statements, to run the socio queries on rather
+// than only match their SQL.
+func historyDB(t *testing.T, statements ...string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open SQLite: %v", err)
+	}
+	// Each connection would get its own in-memory database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	schema := []string{
+		"ATTACH DATABASE ':memory:' AS dbo",
+		"CREATE TABLE dbo.Personas (GuidPersona TEXT, Dni TEXT, RazonSocialEmpleado TEXT)",
+		"CREATE TABLE dbo.SociosHistorico (GuidPersona TEXT, CodigoEmpresa INTEGER, Ejercicio INTEGER, PorParticipacion REAL)",
+		"CREATE TABLE dbo.CargosFiscalHistorico (GuidPersona TEXT, CodigoEmpresa INTEGER, Ejercicio INTEGER, Administrador INTEGER, CargoAdministrador TEXT)",
+	}
+	for _, statement := range append(schema, statements...) {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	return db
+}
+
+// history is a persona whose participación changed in 2024 and whose cargo
+// changed in 2023: she stopped being the administradora and became a vocal.
+// Empresa 2 only has an older cargo of hers.
+var history = []string{
+	"INSERT INTO dbo.Personas VALUES ('ana', '12345678Z', 'García López, Ana'), ('john', 'X1234567L', 'Smith, John')",
+	`INSERT INTO dbo.SociosHistorico VALUES
+		('ana', 1, 2022, 10), ('ana', 1, 2023, 10), ('ana', 1, 2024, 25),
+		('ana', 2, 2024, 5),
+		('john', 1, 2024, 40)`,
+	`INSERT INTO dbo.CargosFiscalHistorico VALUES
+		('ana', 1, 2021, 1, 'Administradora'), ('ana', 1, 2023, 0, 'Vocal'),
+		('ana', 2, 2020, 1, 'Consejera'),
+		('john', 1, 2024, 0, 'Consejero')`,
+}
+
+// TestSocioQueriesKeepLatestRow runs each socio query on a history and
+// checks each socio comes back once, with its latest participación and its
+// latest cargo, each from the year it last changed in.
+func TestSocioQueriesKeepLatestRow(t *testing.T) {
+	ctx := context.Background()
+	type latest struct {
+		participacion float64
+		admin         bool
+		cargo         string
+		ejercicio     int
+	}
+	want := map[string]latest{
+		"12345678Z/1": {25, false, "Vocal", 2024},
+		"12345678Z/2": {5, true, "Consejera", 2024},
+		"X1234567L/1": {40, false, "Consejero", 2024},
+	}
+
+	tests := []struct {
+		name string
+		keys []string
+		run  func(r *SocioRepository) ([]*models.Socio, error)
+	}{
+		{"GetAll", []string{"12345678Z/1", "12345678Z/2", "X1234567L/1"}, func(r *SocioRepository) ([]*models.Socio, error) {
+			return r.GetAll(ctx)
+		}},
+		{"GetAllByEmpresa", []string{"12345678Z/1", "X1234567L/1"}, func(r *SocioRepository) ([]*models.Socio, error) {
+			return r.GetAllByEmpresa(ctx, 1)
+		}},
+		{"GetByDNIs", []string{"12345678Z/1", "12345678Z/2"}, func(r *SocioRepository) ([]*models.Socio, error) {
+			return r.GetByDNIs(ctx, []string{"12345678Z"})
+		}},
+		{"GetAllExcept", []string{"12345678Z/1", "12345678Z/2"}, func(r *SocioRepository) ([]*models.Socio, error) {
+			return r.GetAllExcept(ctx, []string{"X1234567L"})
+		}},
+		{"GetByDNI", []string{"12345678Z/1"}, func(r *SocioRepository) ([]*models.Socio, error) {
+			socio, err := r.GetByDNI(ctx, "12345678Z")
+			return []*models.Socio{socio}, err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socios, err := tt.run(NewSocioRepository(historyDB(t, history...), Tables{}))
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			var keys []string
+			for _, socio := range socios {
+				key := fmt.Sprintf("%s/%d", socio.DNI, socio.CodigoEmpresa)
+				keys = append(keys, key)
+				got := latest{socio.PorParticipacion, socio.Administrador, socio.CargoAdministrador, socio.Ejercicio}
+				if got != want[key] {
+					t.Errorf("%s read %s as %+v, want %+v", tt.name, key, got, want[key])
+				}
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(tt.keys) {
+				t.Errorf("%s returned %v, want %v once each", tt.name, keys, tt.keys)
+			}
+		})
+	}
+}
+
+func TestSocioCountsKeepLatestRow(t *testing.T) {
+	repo := NewSocioRepository(historyDB(t, history...), Tables{})
+
+	if count, err := repo.Count(context.Background()); err != nil || count != 3 {
+		t.Errorf("Count = %d, %v, want 3", count, err)
+	}
+	counts, err := repo.CountByEmpresa(context.Background())
+	if err != nil || counts[1] != 2 || counts[2] != 1 {
+		t.Errorf("CountByEmpresa = %v, %v, want 2 socios in empresa 1 and 1 in empresa 2", counts, err)
+	}
+	dnis, err := repo.GetAllDNIs(context.Background())
+	if err != nil || fmt.Sprint(dnis) != "[12345678Z X1234567L]" {
+		t.Errorf("GetAllDNIs = %v, %v, want both personas", dnis, err)
+	}
+}
+
+func TestSocioReadsEjercicio(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("SELECT CodigoEmpresa, PorParticipacion, Administrador, CargoAdministrador, DNI, RazonSocialEmpleado, Ejercicio")).
+		WillReturnRows(sqlmock.NewRows(socioRowColumns).AddRow(socioRow("12345678Z")...))
+
+	socios, err := NewSocioRepository(db, Tables{}).GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(socios) != 1 || socios[0].Ejercicio != 2024 {
+		t.Errorf("GetAll = %+v, want the 2024 row with its Ejercicio", socios)
+	}
+}
+
+// testDNIs returns n distinct DNIs.
+func testDNIs(n int) []string {
+	dnis := make([]string, n)
+	for i := range dnis {
+		dnis[i] = fmt.Sprintf("%08dZ", i)
+	}
+	return dnis
+}
+
+// inList returns the placeholders of a chunk of n DNIs, as in the query.
+func inList(n int) string {
+	list, _ := dniParams(make([]string, n))
+	return "(" + list + ")"
+}
+
+func TestGetByDNIsChunks(t *testing.T) {
+	tests := []struct {
+		dnis   int
+		chunks []int // Size of each query
+	}{
+		{0, nil},
+		{1, []int{1}},
+		{dniChunk, []int{dniChunk}},
+		{dniChunk + 1, []int{dniChunk, 1}},
+		{2*dniChunk + 200, []int{dniChunk, dniChunk, 200}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.dnis), func(t *testing.T) {
+			db, mock := newMock(t)
+			for _, size := range tt.chunks {
+				// Every chunk finds the same socio, which is returned once.
+				mock.ExpectQuery(sqlWith("AND p.Dni IN " + inList(size) + " ) socios")).
+					WillReturnRows(sqlmock.NewRows(socioRowColumns).AddRow(socioRow("12345678Z")...))
+			}
+
+			socios, err := NewSocioRepository(db, Tables{}).GetByDNIs(context.Background(), testDNIs(tt.dnis))
+			if err != nil {
+				t.Fatalf("GetByDNIs: %v", err)
+			}
+			want := 1
+			if tt.dnis == 0 {
+				want = 0
+			}
+			if len(socios) != want {
+				t.Errorf("GetByDNIs returned %d socios, want %d", len(socios), want)
+			}
+		})
+	}
+}
+
+func TestGetByDNIsMergesChunksInOrder(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("AND p.Dni IN " + inList(dniChunk))).
+		WillReturnRows(sqlmock.NewRows(socioRowColumns).AddRow(socioRow("X1234567L")...))
+	mock.ExpectQuery(sqlWith("AND p.Dni IN " + inList(1))).
+		WillReturnRows(sqlmock.NewRows(socioRowColumns).AddRow(socioRow("12345678Z")...))
+
+	socios, err := NewSocioRepository(db, Tables{}).GetByDNIs(context.Background(), testDNIs(dniChunk+1))
+	if err != nil {
+		t.Fatalf("GetByDNIs: %v", err)
+	}
+	if len(socios) != 2 || socios[0].DNI != "12345678Z" || socios[1].DNI != "X1234567L" {
+		t.Errorf("GetByDNIs = %+v, want both socios sorted by DNI", socios)
+	}
+}
+
+func TestGetAllExceptChunks(t *testing.T) {
+	// noFilter matches the socio queries without a condition on p.Dni.
+	noFilter := sqlWith("p.Dni IS NOT NULL AND p.Dni != '' ) socios")
+
+	t.Run("none", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(noFilter).
+			WillReturnRows(sqlmock.NewRows(socioRowColumns).AddRow(socioRow("12345678Z")...))
+		socios, err := NewSocioRepository(db, Tables{}).GetAllExcept(context.Background(), nil)
+		if err != nil || len(socios) != 1 {
+			t.Errorf("GetAllExcept(nil) = %d socios, %v, want 1", len(socios), err)
+		}
+	})
+
+	t.Run("one chunk", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(sqlWith("AND p.Dni NOT IN " + inList(dniChunk) + " ) socios")).
+			WillReturnRows(sqlmock.NewRows(socioRowColumns).AddRow(socioRow("12345678Z")...))
+		socios, err := NewSocioRepository(db, Tables{}).GetAllExcept(context.Background(), testDNIs(dniChunk))
+		if err != nil || len(socios) != 1 {
+			t.Errorf("GetAllExcept = %d socios, %v, want 1", len(socios), err)
+		}
+	})
+
+	t.Run("over a chunk", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(noFilter).
+			WillReturnRows(sqlmock.NewRows(socioRowColumns).
+				AddRow(socioRow("00000001Z")...).
+				AddRow(socioRow("12345678Z")...).
+				AddRow(socioRow("X1234567L")...))
+
+		// Excluded DNIs match as the Sage collation does.
+		exclude := append(testDNIs(dniChunk), "12345678z ")
+		socios, err := NewSocioRepository(db, Tables{}).GetAllExcept(context.Background(), exclude)
+		if err != nil {
+			t.Fatalf("GetAllExcept: %v", err)
+		}
+		if len(socios) != 1 || socios[0].DNI != "X1234567L" {
+			t.Errorf("GetAllExcept = %+v, want only X1234567L", socios)
+		}
+	})
+}
+
+func TestCountByEmpresa(t *testing.T) {
+	db, mock := newMock(t)
+	mock.ExpectQuery(sqlWith("SELECT c.CodigoEmpresa, NULL, c.Socios", "GROUP BY CodigoEmpresa", "ORDER BY c.CodigoEmpresa")).
+		WithoutArgs().
+		WillReturnRows(sqlmock.NewRows([]string{"CodigoEmpresa", "Empresa", "Socios"}).
+			AddRow(1, nil, 12).
+			AddRow(3, nil, 4))
+
+	counts, err := NewSocioRepository(db, Tables{}).CountByEmpresa(context.Background())
+	if err != nil {
+		t.Fatalf("CountByEmpresa: %v", err)
+	}
+	if len(counts) != 2 || counts[1] != 12 || counts[3] != 4 {
+		t.Errorf("CountByEmpresa = %v, want 12 socios in empresa 1 and 4 in empresa 3", counts)
+	}
+}
+
+func TestEmpresaWithoutSocios(t *testing.T) {
+	ctx := context.Background()
+	filter := sqlWith("AND sh.CodigoEmpresa = @sageCode")
+
+	t.Run("GetAllByEmpresa", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(filter).WithArgs(sql.Named("sageCode", 7)).WillReturnRows(sqlmock.NewRows(socioRowColumns))
+
+		socios, err := NewSocioRepository(db, Tables{}).GetAllByEmpresa(ctx, 7)
+		if err != nil || len(socios) != 0 {
+			t.Errorf("GetAllByEmpresa of an empresa without socios = %d socios, %v, want none", len(socios), err)
+		}
+	})
+
+	t.Run("GetAllByEmpresaStream", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(filter).WithArgs(sql.Named("sageCode", 7)).WillReturnRows(sqlmock.NewRows(socioRowColumns))
+
+		handed := 0
+		err := NewSocioRepository(db, Tables{}).GetAllByEmpresaStream(ctx, 7, func(*models.Socio) error {
+			handed++
+			return nil
+		})
+		if err != nil || handed != 0 {
+			t.Errorf("GetAllByEmpresaStream of an empresa without socios handed %d socios, %v, want none", handed, err)
+		}
+	})
+
+	t.Run("CountAllByEmpresa", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(sqlWith("SELECT COUNT(*) FROM (", "AND sh.CodigoEmpresa = @sageCode")).
+			WithArgs(sql.Named("sageCode", 7)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		count, err := NewSocioRepository(db, Tables{}).CountAllByEmpresa(ctx, 7)
+		if err != nil || count != 0 {
+			t.Errorf("CountAllByEmpresa of an empresa without socios = %d, %v, want 0", count, err)
+		}
+	})
+}
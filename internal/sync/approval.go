@@ -0,0 +1,450 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// Errors of ApprovePlan and ApplyPlan.
+var (
+	ErrPlanNotFound    = errors.New("plan not found")
+	ErrPlanExpired     = errors.New("plan expired")
+	ErrPlanNotApproved = errors.New("plan not approved")
+	ErrPlanApplied     = errors.New("plan already applied")
+)
+
+// IssuePlanConflict marks a planned action not applied because its socio
+// changed in Sage or Bitrix24 since the plan was made.
+const IssuePlanConflict = "plan_conflict"
+
+// StoredPlan is the plan of a socios run made with WithApproval, kept until
+// it is applied or expires.
+type StoredPlan struct {
+	RunID     string    `json:"run_id"` // Of the planning run
+	ClientID  string    `json:"client_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	ApprovedBy   string     `json:"approved_by,omitempty"`
+	ApprovedAt   *time.Time `json:"approved_at,omitempty"`
+	AppliedAt    *time.Time `json:"applied_at,omitempty"`
+	AppliedRunID string     `json:"applied_run_id,omitempty"`
+
+	Plan *SyncPlan `json:"plan"`
+
+	// SageHashes holds the content hash of the Sage socio of each planned
+	// action, by normalized DNI; DNIs not in Sage are absent.
+	SageHashes map[string]string `json:"sage_hashes"`
+}
+
+// WithApproval makes SyncSocios plan the run as a dry run would, without
+// write-back, and keep the plan under the run ID for ApprovePlan and
+// ApplyPlan.
+func WithApproval() SyncOption {
+	return func(o *syncOptions) {
+		o.approval = true
+	}
+}
+
+// planConfig returns the configuration of a run planned for approval.
+func planConfig(cfg *config.Config) *config.Config {
+	planned := *cfg
+	planned.Sync.DryRun = true
+	planned.Sync.WriteBackFields = nil
+	return &planned
+}
+
+// planPath returns the file of the plan of a run.
+func planPath(cfg *config.Config, runID string) string {
+	return filepath.Join(cfg.Sync.PlanDir, safePathPart(runID)+".json")
+}
+
+// savePlan keeps the plan of an approval run, with the hashes of the Sage
+// socios it was made from, and discards the expired plans.
+func (s *Service) savePlan(cfg *config.Config, result *SyncResult, sageSocios []*models.Socio) error {
+	s.expirePlans(cfg)
+
+	hashes := sageHashes(sageSocios)
+	planned := &StoredPlan{
+		RunID:      result.RunID,
+		ClientID:   result.ClientID,
+		CreatedAt:  time.Now(),
+		Plan:       result.Plan,
+		SageHashes: make(map[string]string),
+	}
+	planned.ExpiresAt = planned.CreatedAt.Add(time.Duration(cfg.Sync.PlanExpiryHours) * time.Hour)
+	for _, action := range result.Plan.Actions {
+		dni := models.NormalizeDNI(action.DNI)
+		if hash, ok := hashes[dni]; ok {
+			planned.SageHashes[dni] = hash
+		}
+	}
+
+	if err := os.MkdirAll(cfg.Sync.PlanDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create plan directory: %w", err)
+	}
+	if err := writePlan(cfg, planned); err != nil {
+		return err
+	}
+	s.logger.Printf("📋 Plan of run %s saved until %s; approve it before applying", planned.RunID, planned.ExpiresAt.Format("02/01 15:04"))
+	return nil
+}
+
+// LoadPlan returns the stored plan of a run.
+func (s *Service) LoadPlan(cfg *config.Config, runID string) (*StoredPlan, error) {
+	data, err := os.ReadFile(planPath(cfg, runID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: run %s", ErrPlanNotFound, runID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var planned StoredPlan
+	if err := json.Unmarshal(data, &planned); err != nil {
+		return nil, fmt.Errorf("failed to parse plan of run %s: %w", runID, err)
+	}
+	return &planned, nil
+}
+
+// ApprovePlan records that approver accepted the plan of a run.
+func (s *Service) ApprovePlan(cfg *config.Config, runID, approver string) (*StoredPlan, error) {
+	planned, err := s.pendingPlan(cfg, runID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	planned.ApprovedBy, planned.ApprovedAt = approver, &now
+	if err := writePlan(cfg, planned); err != nil {
+		return nil, err
+	}
+	s.logger.Printf("✅ Plan of run %s approved by %s", runID, approver)
+	return planned, nil
+}
+
+// pendingPlan returns the plan of a run if it can still be applied.
+func (s *Service) pendingPlan(cfg *config.Config, runID string) (*StoredPlan, error) {
+	planned, err := s.LoadPlan(cfg, runID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case planned.ClientID != cfg.Company.BitrixCode:
+		return nil, fmt.Errorf("%w: run %s is of client %s", ErrPlanNotFound, runID, planned.ClientID)
+	case planned.AppliedAt != nil:
+		return nil, fmt.Errorf("%w: run %s, by run %s", ErrPlanApplied, runID, planned.AppliedRunID)
+	case time.Now().After(planned.ExpiresAt):
+		return nil, fmt.Errorf("%w: run %s, on %s", ErrPlanExpired, runID, planned.ExpiresAt.Format("02/01 15:04"))
+	}
+	return planned, nil
+}
+
+// ApplyPlan executes the approved plan of a run, and only that: socios
+// Sage or Bitrix24 changed since the plan was made are not touched but
+// failed as conflicts, to be picked up by the next sync.
+func (s *Service) ApplyPlan(ctx context.Context, cfg *config.Config, runID string) (*SyncResult, error) {
+	planned, err := s.pendingPlan(cfg, runID)
+	if err != nil {
+		return nil, err
+	}
+	if planned.ApprovedAt == nil {
+		return nil, fmt.Errorf("%w: run %s", ErrPlanNotApproved, runID)
+	}
+
+	result := &SyncResult{
+		Entity:     config.EntitySocios,
+		ClientID:   cfg.Company.BitrixCode,
+		StartTime:  time.Now(),
+		Errors:     make([]Issue, 0),
+		CreatedIDs: make(map[string]int),
+
+		SkippedByReason: make(map[string]int),
+	}
+	if cfg.Sync.CollectDetails {
+		result.Details = make([]ItemResult, 0)
+	}
+	result.timeouts = DefaultTimeouts
+
+	ctx, s = s.beginRun(ctx, cfg, result)
+	defer result.runLog.close(result)
+	defer s.notifyRun(ctx, cfg, result)
+	defer s.recordMetrics(result)
+	defer s.afterSync(ctx, cfg, result)
+	result.progress = newProgressReporter(nil, s.logger)
+	s.logger.Printf("🚀 Applying the plan of run %s for client %s (run %s)", runID, result.ClientID, result.RunID)
+
+	lock, err := acquireLock(cfg, result.RunID, s.logger)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	defer lock.release()
+	if err := s.beforeSync(ctx, cfg, result); err != nil {
+		return s.completeResult(result, err)
+	}
+
+	result.progress.enter(PhaseConnecting)
+	connectCtx, cancelConnect := phaseContext(ctx, result.timeouts.SageConnect)
+	socioRepo, release, err := s.openSource(connectCtx, cfg, s.logger)
+	err = phaseError(connectCtx, ctx, "Sage connection", result.timeouts.SageConnect, err)
+	cancelConnect()
+	if err != nil {
+		return s.completeResult(result, fmt.Errorf("failed to connect to Sage: %w", err))
+	}
+	defer release()
+
+	bitrixClient, err := s.newTarget(cfg, s.logger)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	defer func() {
+		result.ThrottleWait = bitrixClient.ThrottleWait().String()
+		result.APIStats = bitrixClient.Stats()
+		result.addClientWarnings(bitrixClient.Warnings())
+	}()
+	if cfg.Bitrix.EntityTypeID == 0 {
+		cache := bitrix.NewDiscoveryCache(cfg.Bitrix.DiscoveryCachePath)
+		if _, err := bitrixClient.ResolveEntityType(ctx, cache); err != nil {
+			s.logger.Printf("⚠️  %v, using entity type %d", err, bitrixClient.EntityTypeID())
+		}
+	}
+	if err := bitrixClient.TestConnection(ctx); err != nil {
+		return s.completeResult(result, bitrixError("failed to connect to Bitrix24", err))
+	}
+	if err := bitrixClient.ValidateFields(ctx); err != nil {
+		return s.completeResult(result, bitrixError("Bitrix24 field validation failed", err))
+	}
+
+	// Read the planned socios again to tell which changed since planning.
+	result.progress.enter(PhaseFetchingSage)
+	var actions []PlannedAction
+	var dnis []string
+	for _, action := range planned.Plan.Actions {
+		if action.Action == PlanSkip {
+			continue
+		}
+		actions = append(actions, action)
+		dnis = append(dnis, models.NormalizeDNI(action.DNI))
+	}
+	queryCtx, cancelQuery := phaseContext(ctx, result.timeouts.SageQuery)
+	rows, err := socioRepo.GetByDNIs(queryCtx, dnis)
+	err = phaseError(queryCtx, ctx, "Sage query", result.timeouts.SageQuery, err)
+	cancelQuery()
+	if err != nil {
+		return s.completeResult(result, fmt.Errorf("failed to fetch socios from Sage: %w", err))
+	}
+	if code, ok := cfg.Company.SageEmpresa(); ok {
+		rows = slices.DeleteFunc(rows, func(socio *models.Socio) bool { return socio.CodigoEmpresa != code })
+	}
+	current := latestRows(rows)
+	if err := bitrixClient.ResolveCompanies(ctx, rows); err != nil {
+		return s.completeResult(result, bitrixError("failed to resolve Bitrix24 companies", err))
+	}
+
+	state := s.loadState(cfg, bitrixClient)
+	if state != nil {
+		defer s.saveState(cfg, state)
+	}
+
+	result.progress.enter(PhaseSyncing)
+	result.progress.start(len(actions))
+	result.SociosProcessed = len(actions)
+	for _, action := range actions {
+		if ctx.Err() != nil {
+			return s.completeResult(result, fmt.Errorf("sync cancelled: %w", ctx.Err()))
+		}
+		if err := s.applyAction(ctx, bitrixClient, planned, action, current, state, result); err != nil {
+			return s.completeResult(result, err)
+		}
+		result.progress.advance(1)
+	}
+
+	now := time.Now()
+	planned.AppliedAt, planned.AppliedRunID = &now, result.RunID
+	if err := writePlan(cfg, planned); err != nil {
+		return s.completeResult(result, err)
+	}
+
+	result.progress.enter(PhaseDone)
+	result.Success = len(result.Errors) == 0
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	s.logger.Printf("🏁 Applied the plan of run %s: %d created, %d updated, %d deactivated, %d deleted, %d conflicts",
+		runID, result.SociosCreated, result.SociosUpdated, result.SociosDeactivated, result.SociosDeleted+result.DuplicatesDeleted, result.PlanConflicts)
+	return result, nil
+}
+
+// applyAction executes one planned action unless its socio changed since
+// planning. The returned error is only set for transient failures that
+// should abort the run.
+func (s *Service) applyAction(ctx context.Context, bitrixClient SocioTarget, planned *StoredPlan, action PlannedAction, current map[string]*models.Socio, state *clientState, result *SyncResult) error {
+	dni := models.NormalizeDNI(action.DNI)
+	socio := current[dni]
+
+	// conflict fails the action, leaving the socio to the next sync.
+	conflict := func(why string) error {
+		msg := fmt.Sprintf("Socio %s not %sd: %s since the plan was made", action.DNI, action.Action, why)
+		s.logger.Printf("⚔️  %s", msg)
+		result.PlanConflicts++
+		result.SociosFailed++
+		result.addError(IssuePlanConflict, action.DNI, msg)
+		result.addDetail(ItemResult{DNI: action.DNI, Action: ItemFailed, BitrixID: action.BitrixID, Error: msg})
+		return nil
+	}
+	// failed records a per-item error, or aborts on a transient one.
+	failed := func(err error) error {
+		if IsTransient(err) {
+			return bitrixError("", err)
+		}
+		msg := fmt.Sprintf("Failed to %s socio %s: %v", action.Action, action.DNI, err)
+		s.logger.Printf("❌ %s", msg)
+		result.SociosFailed++
+		result.addItemError(action.DNI, msg, fmt.Sprintf("%s: %v", action.Action, err))
+		result.addDetail(ItemResult{DNI: action.DNI, Action: ItemFailed, BitrixID: action.BitrixID, Error: err.Error()})
+		return nil
+	}
+
+	planHash, wasInSage := planned.SageHashes[dni]
+	switch {
+	case socio == nil && wasInSage:
+		return conflict("it was removed from Sage")
+	case socio != nil && !wasInSage:
+		return conflict("it was added to Sage")
+	case socio != nil && socio.ContentHash() != planHash:
+		return conflict("it changed in Sage")
+	case socio == nil && (action.Action == PlanCreate || action.Action == PlanUpdate):
+		return conflict("it went missing from Sage")
+	}
+
+	switch action.Action {
+	case PlanCreate:
+		if _, err := bitrixClient.GetSocioByDNI(ctx, action.DNI); err == nil {
+			return conflict("it was created in Bitrix24")
+		} else if !errors.Is(err, bitrix.ErrNotFound) {
+			return failed(err)
+		}
+		id, err := bitrixClient.CreateSocio(ctx, socio)
+		if err != nil {
+			return failed(err)
+		}
+		r := socioResult{outcome: outcomeCreated, createdID: id}
+		r.apply(result, socio.DNI)
+		if state != nil {
+			r.record(state, socio)
+		}
+
+	case PlanUpdate:
+		item, err := bitrixClient.GetSocioByID(ctx, action.BitrixID)
+		if errors.Is(err, bitrix.ErrNotFound) {
+			return conflict("its item was deleted in Bitrix24")
+		} else if err != nil {
+			return failed(err)
+		}
+		changes := bitrixClient.Changes(item, socio)
+		if !slices.Equal(redactChanges(s.redactor, changes), action.Changes) {
+			return conflict("its item changed in Bitrix24")
+		}
+		s.rollback.record(bitrixClient, PlanUpdate, item, socio)
+		if err := bitrixClient.UpdateSocio(ctx, action.BitrixID, socio); err != nil {
+			return failed(err)
+		}
+		if err := bitrixClient.CommentChanges(ctx, action.BitrixID, redactChanges(s.redactor, changes)); err != nil {
+			s.logger.Printf("⚠️  %v", err)
+		}
+		r := socioResult{outcome: outcomeUpdated, bitrixID: action.BitrixID, changes: changes}
+		r.apply(result, socio.DNI)
+		if state != nil {
+			r.record(state, socio)
+		}
+
+	case PlanDeactivate, PlanDelete:
+		item, err := bitrixClient.GetSocioByID(ctx, action.BitrixID)
+		if errors.Is(err, bitrix.ErrNotFound) {
+			return conflict("its item was deleted in Bitrix24")
+		} else if err != nil {
+			return failed(err)
+		}
+		if action.Action == PlanDeactivate {
+			if err := bitrixClient.DeactivateSocio(ctx, action.BitrixID); err != nil {
+				return failed(err)
+			}
+			result.SociosDeactivated++
+			result.addDetail(ItemResult{DNI: action.DNI, Action: ItemDeactivated, BitrixID: action.BitrixID})
+			return nil
+		}
+		s.rollback.record(bitrixClient, PlanDelete, item, socio)
+		if err := bitrixClient.DeleteSocio(ctx, action.BitrixID); err != nil {
+			return failed(err)
+		}
+		if strings.HasPrefix(action.Reason, "duplicate") {
+			result.DuplicatesDeleted++
+		} else {
+			result.SociosDeleted++
+		}
+		result.addDetail(ItemResult{DNI: action.DNI, Action: ItemDeleted, BitrixID: action.BitrixID})
+
+	default:
+		return failed(fmt.Errorf("action %q cannot be applied from a plan", action.Action))
+	}
+	return nil
+}
+
+// expirePlans discards the plans not applied before they expired.
+func (s *Service) expirePlans(cfg *config.Config) {
+	paths, _ := filepath.Glob(filepath.Join(cfg.Sync.PlanDir, "*.json"))
+	for _, path := range paths {
+		runID := strings.TrimSuffix(filepath.Base(path), ".json")
+		planned, err := s.LoadPlan(cfg, runID)
+		if err != nil || planned.AppliedAt != nil || time.Now().Before(planned.ExpiresAt) {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			s.logger.Printf("🗑️  Discarded the unapplied plan of run %s", runID)
+		}
+	}
+}
+
+// writePlan saves a plan, replacing the previous version.
+func writePlan(cfg *config.Config, planned *StoredPlan) error {
+	data, err := json.MarshalIndent(planned, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	path := planPath(cfg, planned.RunID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// latestRows returns the row of each socio a sync would use, by normalized
+// DNI, as collapseSageRows picks them.
+func latestRows(socios []*models.Socio) map[string]*models.Socio {
+	latest := make(map[string]*models.Socio, len(socios))
+	for _, socio := range socios {
+		dni := models.NormalizeDNI(socio.DNI)
+		if kept, ok := latest[dni]; dni != "" && (!ok || newerRow(socio, kept)) {
+			latest[dni] = socio
+		}
+	}
+	return latest
+}
+
+// sageHashes returns the content hash of latestRows.
+func sageHashes(socios []*models.Socio) map[string]string {
+	hashes := make(map[string]string, len(socios))
+	for dni, socio := range latestRows(socios) {
+		hashes[dni] = socio.ContentHash()
+	}
+	return hashes
+}
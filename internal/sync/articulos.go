@@ -0,0 +1,268 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+	"github.com/arduriki/sage-bitrix-sync/internal/repository"
+)
+
+// SyncArticulos performs the Sage articulos → Bitrix24 product catalog sync,
+// matching products by the SKU held in BitrixConfig.ProductSKUProperty. Name,
+// price, VAT rate and the active flag follow Sage; products whose articulo
+// became obsolete or was removed from Sage are deactivated, the latter within
+// SyncConfig.MaxDeletePercent. The catalog is listed page by page and writes
+// are sent in /batch requests. The Socios* counters of the result count
+// products.
+func (s *Service) SyncArticulos(ctx context.Context, cfg *config.Config, syncOpts ...SyncOption) (*SyncResult, error) {
+	var options syncOptions
+	for _, opt := range syncOpts {
+		opt(&options)
+	}
+
+	result := &SyncResult{
+		Entity:     config.EntityArticulos,
+		ClientID:   cfg.Company.BitrixCode,
+		StartTime:  time.Now(),
+		Errors:     make([]Issue, 0),
+		CreatedIDs: make(map[string]int),
+
+		SkippedByReason: make(map[string]int),
+	}
+	if cfg.Sync.CollectDetails {
+		result.Details = make([]ItemResult, 0)
+	}
+
+	ctx, s = s.beginRun(ctx, cfg, result)
+	defer result.runLog.close(result)
+	defer s.notifyRun(ctx, cfg, result)
+	defer s.recordMetrics(result)
+	defer s.afterSync(ctx, cfg, result)
+	result.progress = newProgressReporter(options.progress, s.logger)
+
+	s.logger.Printf("🚀 Starting articulos sync for client: %s (run %s)", result.ClientID, result.RunID)
+	if cfg.Sync.DryRun {
+		result.DryRun = true
+		result.Plan = &SyncPlan{}
+		s.logger.Printf("🧪 Dry run: changes are planned, nothing is written to Bitrix24")
+	}
+
+	if err := s.beforeSync(ctx, cfg, result); err != nil {
+		return s.completeResult(result, err)
+	}
+
+	// Step 1: Connect to Sage database.
+	result.progress.enter(PhaseConnecting)
+	db, release, err := s.connectSage(ctx, cfg, options.timeouts.withDefaults())
+	if err != nil {
+		return s.completeResult(result, fmt.Errorf("failed to connect to Sage: %w", err))
+	}
+	defer release()
+
+	// Step 2: Create repositories and clients.
+	articuloRepo := repository.NewArticuloRepository(db, cfg.SageDB.Tables())
+	opts, err := s.bitrixOptions(cfg)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	bitrixClient, err := bitrix.NewClientValidated(cfg.Bitrix.Endpoint, s.logger, opts...)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	defer func() {
+		result.ThrottleWait = bitrixClient.ThrottleWait().String()
+		result.APIStats = bitrixClient.Stats()
+		result.addClientWarnings(bitrixClient.Warnings())
+	}()
+
+	if err := bitrixClient.TestConnection(ctx); err != nil {
+		return s.completeResult(result, bitrixError("failed to connect to Bitrix24", err))
+	}
+
+	// Step 3: Get the articulos from Sage.
+	result.progress.enter(PhaseFetchingSage)
+	var articulos []*models.Articulo
+	if code, ok := cfg.Company.SageEmpresa(); ok {
+		s.logger.Printf("📊 Fetching articulos of empresa %d from Sage database...", code)
+		articulos, err = articuloRepo.GetByEmpresa(ctx, code)
+	} else {
+		s.logger.Printf("📊 Fetching articulos from Sage database...")
+		articulos, err = articuloRepo.GetAll(ctx)
+	}
+	if err != nil {
+		return s.completeResult(result, fmt.Errorf("failed to fetch articulos from Sage: %w", err))
+	}
+	s.logger.Printf("✅ Found %d articulos in Sage", len(articulos))
+	result.SociosProcessed = len(articulos)
+	result.progress.start(len(articulos))
+
+	// Step 4: Get the products and VAT rates from Bitrix24.
+	result.progress.enter(PhaseFetchingBitrix)
+	s.logger.Printf("📊 Fetching products from Bitrix24...")
+	products, err := bitrixClient.ListProducts(ctx)
+	if err != nil {
+		return s.completeResult(result, bitrixError("failed to fetch products from Bitrix24", err))
+	}
+	s.logger.Printf("✅ Found %d products with a SKU in Bitrix24", len(products))
+	vatRates, err := bitrixClient.VATRates(ctx)
+	if err != nil {
+		return s.completeResult(result, bitrixError("failed to fetch VAT rates from Bitrix24", err))
+	}
+
+	// Step 5: Work out what each articulo needs. The same SKU can appear
+	// under several empresas; the first one wins.
+	result.progress.enter(PhaseSyncing)
+	budget := &errorBudget{maxConsecutive: cfg.Sync.MaxErrors, maxRate: cfg.Sync.MaxErrorRate}
+	var writes []crmWrite
+	inSage := make(map[string]bool, len(articulos))
+	missingVAT := make(map[string]bool)
+	for _, articulo := range articulos {
+		sku := articulo.CodigoArticulo
+		if inSage[sku] {
+			socioResult{outcome: outcomeSkipped, skip: SkipDuplicateSKU, reason: "duplicate SKU"}.apply(result, sku)
+			result.progress.advance(1)
+			continue
+		}
+		inSage[sku] = true
+
+		vatID, ok := vatRates[bitrix.VATKey(articulo.IVA)]
+		if !ok {
+			missingVAT[bitrix.VATKey(articulo.IVA)] = true
+		}
+
+		product, exists := products[sku]
+		if !exists {
+			switch {
+			case !articulo.Activo:
+				socioResult{outcome: outcomeSkipped, skip: SkipObsolete, reason: "obsolete in Sage"}.apply(result, sku)
+				result.progress.advance(1)
+			case cfg.Sync.DryRun:
+				socioResult{outcome: outcomeCreated, reason: "not in Bitrix24"}.apply(result, sku)
+				result.progress.advance(1)
+			default:
+				writes = append(writes, crmWrite{
+					key:    sku,
+					label:  "articulo " + sku,
+					fields: bitrixClient.ProductFields(articulo, vatID),
+				})
+			}
+			continue
+		}
+
+		changes := bitrixClient.ProductChanges(product, articulo, vatID)
+		switch {
+		case len(changes) == 0:
+			socioResult{outcome: outcomeSkipped, skip: SkipUnchanged, bitrixID: product.ID, reason: "unchanged"}.apply(result, sku)
+			result.progress.advance(1)
+		case cfg.Sync.DryRun:
+			socioResult{outcome: outcomeUpdated, bitrixID: product.ID, changes: changes}.apply(result, sku)
+			result.progress.advance(1)
+		default:
+			writes = append(writes, crmWrite{
+				key:      sku,
+				label:    "articulo " + sku,
+				bitrixID: product.ID,
+				changes:  changes,
+				fields:   bitrixClient.ProductFields(articulo, vatID),
+			})
+		}
+	}
+	for rate := range missingVAT {
+		s.logger.Printf("⚠️  No Bitrix24 VAT rate of %s%%, products with it keep their VAT", rate)
+	}
+
+	// Step 6: Deactivate the active products whose articulo left Sage.
+	removed, err := s.removedProducts(cfg, products, inSage, result)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	result.progress.start(len(articulos) + len(removed))
+	for _, product := range removed {
+		if cfg.Sync.DryRun {
+			socioResult{outcome: outcomeDeactivated, bitrixID: product.ID, reason: "not in Sage"}.apply(result, product.SKU)
+			result.progress.advance(1)
+			continue
+		}
+		writes = append(writes, crmWrite{
+			key:        product.SKU,
+			label:      "product " + product.SKU,
+			bitrixID:   product.ID,
+			fields:     bitrix.DeactivateProductFields(),
+			deactivate: true,
+		})
+	}
+
+	// Step 7: Send the writes in batches.
+	if err := s.writeBatches(ctx, bitrixClient, bitrix.EntityProduct, writes, result, budget); err != nil {
+		return s.completeResult(result, err)
+	}
+
+	if result.Plan != nil {
+		result.Plan.sort()
+	}
+
+	// Step 8: Complete successfully.
+	result.progress.enter(PhaseDone)
+	result.Success = len(result.Errors) == 0
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime).String()
+
+	if result.DryRun {
+		s.logger.Printf("🧪 Dry run completed, counts below are planned")
+	} else if result.Success {
+		s.logger.Printf("🎉 Articulos sync completed successfully!")
+	} else {
+		s.logger.Printf("⚠️  Articulos sync completed with %d errors", len(result.Errors))
+	}
+	s.logger.Printf("   📊 Processed: %d articulos", result.SociosProcessed)
+	s.logger.Printf("   ✨ Created: %d products", result.SociosCreated)
+	s.logger.Printf("   📝 Updated: %d products", result.SociosUpdated)
+	s.logger.Printf("   ⏭️  Skipped: %d products%s", result.SociosSkipped, skipBreakdown(result.SkippedByReason))
+	s.logger.Printf("   💤 Deactivated: %d products", result.SociosDeactivated)
+	s.logger.Printf("   ❌ Failed: %d", result.SociosFailed)
+	s.logger.Printf("   ⏱️  Duration: %s", result.Duration)
+
+	return result, nil
+}
+
+// removedProducts returns the active products whose SKU is no longer in
+// Sage, sorted by SKU. Like socio deletions, more than MaxDeletePercent of
+// the catalog is refused unless forced, and only warned about in a dry run.
+func (s *Service) removedProducts(cfg *config.Config, products map[string]*bitrix.BitrixProduct, inSage map[string]bool, result *SyncResult) ([]*bitrix.BitrixProduct, error) {
+	// An empty Sage read is far more likely a problem than a wiped catalog.
+	if len(inSage) == 0 {
+		return nil, nil
+	}
+
+	var removed []*bitrix.BitrixProduct
+	for sku, product := range products {
+		if product.Active && !inSage[sku] {
+			removed = append(removed, product)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].SKU < removed[j].SKU })
+
+	s.logger.Printf("🧹 %d Bitrix24 products are no longer in Sage", len(removed))
+	if len(removed)*100 > cfg.Sync.MaxDeletePercent*len(products) {
+		switch {
+		case cfg.Sync.ForceDeletions:
+			s.logger.Printf("⚠️  Over the %d%% limit, continuing because deletions are forced", cfg.Sync.MaxDeletePercent)
+		case cfg.Sync.DryRun:
+			result.Plan.Warnings = append(result.Plan.Warnings, fmt.Sprintf(
+				"%d of %d products missing from Sage exceeds the %d%% limit; a real run would refuse to deactivate them",
+				len(removed), len(products), cfg.Sync.MaxDeletePercent))
+		default:
+			return nil, fmt.Errorf("%w: refusing to deactivate %d of %d products (limit %d%%); set SYNC_FORCE_DELETIONS=true if intended",
+				ErrDeletionThreshold, len(removed), len(products), cfg.Sync.MaxDeletePercent)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,114 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// backoffEntry is the backoff of one client.
+type backoffEntry struct {
+	Failures  int       `json:"failures"` // Consecutive failed scheduled runs
+	RetryAt   time.Time `json:"retry_at"`
+	LastError string    `json:"last_error"`
+}
+
+// RunBackoff spaces out the scheduled runs of clients whose last runs
+// failed, so an unreachable Sage server is not retried every interval: after
+// each consecutive failure the wait doubles, from twice the client's interval
+// up to a maximum, and a success resets it. It is kept in a JSON file so a
+// restart does not reset it. Manual runs should not consult it.
+type RunBackoff struct {
+	path string // Empty keeps the backoff in memory
+	max  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*backoffEntry
+}
+
+// NewRunBackoff loads the backoff kept in path, waiting at most max between
+// attempts. A missing file starts without backoff.
+func NewRunBackoff(path string, max time.Duration) (*RunBackoff, error) {
+	b := &RunBackoff{path: path, max: max, now: time.Now, clients: make(map[string]*backoffEntry)}
+	if path == "" {
+		return b, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run backoff: %w", err)
+	}
+	if err := json.Unmarshal(data, &b.clients); err != nil {
+		return nil, fmt.Errorf("failed to parse run backoff %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// RetryAt returns when the client's next scheduled run may start, and
+// whether that is still to come.
+func (b *RunBackoff) RetryAt(clientID string) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry := b.clients[clientID]
+	if entry == nil {
+		return time.Time{}, false
+	}
+	return entry.RetryAt, b.now().Before(entry.RetryAt)
+}
+
+// Failed records a failed scheduled run of a client synced every interval
+// and returns when the next one may start.
+func (b *RunBackoff) Failed(clientID string, interval time.Duration, runErr string) (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry := b.clients[clientID]
+	if entry == nil {
+		entry = &backoffEntry{}
+		b.clients[clientID] = entry
+	}
+	entry.Failures++
+	entry.LastError = runErr
+
+	wait := max(interval, time.Minute)
+	for range entry.Failures {
+		if wait >= b.max {
+			break
+		}
+		wait *= 2
+	}
+	entry.RetryAt = b.now().Add(min(wait, b.max))
+	return entry.RetryAt, b.save()
+}
+
+// Succeeded clears the backoff of a client.
+func (b *RunBackoff) Succeeded(clientID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.clients[clientID]; !ok {
+		return nil
+	}
+	delete(b.clients, clientID)
+	return b.save()
+}
+
+// save writes the backoff file, if any.
+func (b *RunBackoff) save() error {
+	if b.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(b.clients)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run backoff: %w", err)
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write run backoff: %w", err)
+	}
+	return os.Rename(tmp, b.path)
+}
@@ -0,0 +1,211 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestBackoff returns a backoff kept in path, on clock.
+func newTestBackoff(t *testing.T, path string, max time.Duration, clock *fakeClock) *RunBackoff {
+	t.Helper()
+	b, err := NewRunBackoff(path, max)
+	if err != nil {
+		t.Fatalf("NewRunBackoff: %v", err)
+	}
+	b.now = clock.Now
+	return b
+}
+
+func TestRunBackoffDoublesUpToMax(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBackoff(t, "", 2*time.Hour, clock)
+
+	for i, want := range []time.Duration{20 * time.Minute, 40 * time.Minute, 80 * time.Minute, 2 * time.Hour, 2 * time.Hour} {
+		retryAt, err := b.Failed("acme", 10*time.Minute, "Sage unreachable")
+		if err != nil {
+			t.Fatalf("Failed: %v", err)
+		}
+		if got := retryAt.Sub(clock.Now()); got != want {
+			t.Errorf("failure %d waits %s, want %s", i+1, got, want)
+		}
+	}
+
+	if err := b.Succeeded("acme"); err != nil {
+		t.Fatalf("Succeeded: %v", err)
+	}
+	if _, wait := b.RetryAt("acme"); wait {
+		t.Error("client still backing off after a success")
+	}
+	retryAt, _ := b.Failed("acme", 10*time.Minute, "Sage unreachable")
+	if got := retryAt.Sub(clock.Now()); got != 20*time.Minute {
+		t.Errorf("first failure after a success waits %s, want 20m", got)
+	}
+}
+
+func TestRunBackoffShortInterval(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBackoff(t, "", time.Hour, clock)
+
+	// Clients synced more often than every minute back off from a minute.
+	retryAt, _ := b.Failed("acme", 0, "Sage unreachable")
+	if got := retryAt.Sub(clock.Now()); got != 2*time.Minute {
+		t.Errorf("failure with no interval waits %s, want 2m", got)
+	}
+}
+
+func TestRunBackoffRetryAt(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBackoff(t, "", time.Hour, clock)
+
+	if _, wait := b.RetryAt("acme"); wait {
+		t.Error("client without failures backing off")
+	}
+	retryAt, _ := b.Failed("acme", 10*time.Minute, "Sage unreachable")
+
+	clock.Advance(19 * time.Minute)
+	if got, wait := b.RetryAt("acme"); !wait || !got.Equal(retryAt) {
+		t.Errorf("RetryAt a minute early = %s, %v, want %s, true", got, wait, retryAt)
+	}
+	clock.Advance(time.Minute)
+	if _, wait := b.RetryAt("acme"); wait {
+		t.Error("client still backing off at its retry time")
+	}
+	if _, wait := b.RetryAt("globex"); wait {
+		t.Error("backoff of one client applied to another")
+	}
+}
+
+func TestRunBackoffSurvivesRestart(t *testing.T) {
+	clock := newFakeClock()
+	path := filepath.Join(t.TempDir(), "backoff.json")
+
+	b := newTestBackoff(t, path, time.Hour, clock)
+	b.Failed("acme", 10*time.Minute, "Sage unreachable")
+	retryAt, _ := b.Failed("acme", 10*time.Minute, "Sage unreachable")
+
+	restarted := newTestBackoff(t, path, time.Hour, clock)
+	if got, wait := restarted.RetryAt("acme"); !wait || !got.Equal(retryAt) {
+		t.Errorf("RetryAt after a restart = %s, %v, want %s, true", got, wait, retryAt)
+	}
+	// The failures count on from where they were.
+	next, _ := restarted.Failed("acme", 10*time.Minute, "Sage unreachable")
+	if got := next.Sub(clock.Now()); got != 60*time.Minute {
+		t.Errorf("third failure waits %s, want 1h", got)
+	}
+}
+
+// TestSyncAllBackoff runs a schedule of SyncAll runs of a client whose Sage
+// server is down, then back, on a fake clock.
+func TestSyncAllBackoff(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBackoff(t, filepath.Join(t.TempDir(), "backoff.json"), time.Hour, clock)
+
+	var (
+		mu   sync.Mutex
+		down = true
+		runs int
+	)
+	source := &fakeSource{socios: []*models.Socio{testSocio(1)}}
+	service := NewService(log.New(io.Discard, "", 0),
+		WithSourceFactory(func(context.Context, *config.Config, *log.Logger) (SocioSource, func() error, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			runs++
+			if down {
+				return nil, nil, errors.New("Sage unreachable")
+			}
+			return source, func() error { return nil }, nil
+		}),
+		WithTargetFactory(func(*config.Config, *log.Logger) (SocioTarget, error) {
+			return newFakeTarget(t), nil
+		}))
+
+	cfg := testConfig()
+	cfg.Sync.Entities = []string{config.EntitySocios}
+	cfg.Sync.IntervalMinutes = 10
+	scheduled := SyncAllOptions{Backoff: b}
+
+	// run runs SyncAll at the clock's time and returns the client's report.
+	run := func(opts SyncAllOptions) ClientReport {
+		t.Helper()
+		report, err := service.SyncAll(context.Background(), []*config.Config{cfg}, opts)
+		if err != nil {
+			t.Fatalf("SyncAll: %v", err)
+		}
+		return report.Clients[0]
+	}
+
+	client := run(scheduled)
+	if client.Outcome != OutcomeFailed || client.RetryAt == nil || !client.RetryAt.Equal(clock.Now().Add(20*time.Minute)) {
+		t.Fatalf("first run = %s retrying at %v, want failed retrying in 20m", client.Outcome, client.RetryAt)
+	}
+	if !strings.HasSuffix(client.Error, "(retrying at 09:20)") {
+		t.Errorf("first run error = %q, want it to end in (retrying at 09:20)", client.Error)
+	}
+
+	clock.Advance(10 * time.Minute)
+	client = run(scheduled)
+	if client.Outcome != OutcomeSkipped || client.Error != "retrying at 09:20" {
+		t.Errorf("run while backing off = %s %q, want skipped, retrying at 09:20", client.Outcome, client.Error)
+	}
+	if runs != 1 {
+		t.Errorf("Sage was reached %d times, want once: the run backing off must not start", runs)
+	}
+
+	// A manual run is not held back.
+	if client := run(SyncAllOptions{}); client.Outcome != OutcomeFailed || runs != 2 {
+		t.Errorf("manual run = %s after %d runs, want failed, run regardless", client.Outcome, runs)
+	}
+	if retryAt, _ := b.RetryAt("test"); !retryAt.Equal(clock.Now().Add(10 * time.Minute)) {
+		t.Errorf("manual run moved the retry time to %s", retryAt)
+	}
+
+	clock.Advance(10 * time.Minute)
+	client = run(scheduled)
+	if client.Outcome != OutcomeFailed || client.RetryAt == nil || !client.RetryAt.Equal(clock.Now().Add(40*time.Minute)) {
+		t.Errorf("second failure = %s retrying at %v, want failed retrying in 40m", client.Outcome, client.RetryAt)
+	}
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	clock.Advance(40 * time.Minute)
+	if client := run(scheduled); client.Outcome != OutcomeSuccess || client.RetryAt != nil {
+		t.Errorf("run once Sage is back = %s retrying at %v, want success", client.Outcome, client.RetryAt)
+	}
+	if _, wait := b.RetryAt("test"); wait {
+		t.Error("client still backing off after a successful run")
+	}
+}
@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+)
+
+// listCheckpoint is one page of an interrupted Bitrix24 listing. The
+// checkpoint file holds one per line, so saving a page is a cheap append.
+type listCheckpoint struct {
+	RunID        string               `json:"run_id,omitempty"` // Run that fetched the page
+	Portal       string               `json:"portal"`
+	EntityTypeID int                  `json:"entity_type_id"`
+	Cursor       bitrix.ListCursor    `json:"cursor"`
+	Items        []bitrix.BitrixSocio `json:"items"`
+}
+
+// checkpointStore persists listing progress in a JSON lines file.
+type checkpointStore struct {
+	path   string
+	maxAge time.Duration
+}
+
+// load returns the items fetched so far and the last page's checkpoint,
+// whose cursor to resume from, if the file holds a checkpoint for the same portal and entity type taken
+// within maxAge. Anything else is discarded: a stale cursor could miss items
+// added since.
+func (cs *checkpointStore) load(portal string, entityTypeID int) ([]bitrix.BitrixSocio, *listCheckpoint, error) {
+	f, err := os.Open(cs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open list checkpoint: %w", err)
+	}
+	defer f.Close()
+
+	var items []bitrix.BitrixSocio
+	var last *listCheckpoint
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var cp listCheckpoint
+		if err := json.Unmarshal(scanner.Bytes(), &cp); err != nil {
+			// A line cut short by the interruption ends the usable part.
+			break
+		}
+		if cp.Portal != portal || cp.EntityTypeID != entityTypeID {
+			return nil, nil, cs.clear()
+		}
+		items = append(items, cp.Items...)
+		cp.Items = nil
+		last = &cp
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read list checkpoint: %w", err)
+	}
+
+	if last == nil || time.Since(last.Cursor.At) > cs.maxAge {
+		return nil, nil, cs.clear()
+	}
+	return items, last, nil
+}
+
+// append adds a page to the checkpoint file.
+func (cs *checkpointStore) append(cp listCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(cs.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// clear removes the checkpoint file.
+func (cs *checkpointStore) clear() error {
+	if err := os.Remove(cs.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove list checkpoint: %w", err)
+	}
+	return nil
+}
+
+// listBitrixSocios lists the portal's socios. With a checkpoint file
+// configured, progress is saved after every page and a recent interrupted
+// listing is resumed instead of started over.
+func (s *Service) listBitrixSocios(ctx context.Context, cfg *config.Config, client SocioTarget) ([]bitrix.BitrixSocio, error) {
+	if cfg.Bitrix.ListCheckpointPath == "" {
+		return client.ListSocios(ctx)
+	}
+
+	store := &checkpointStore{
+		path:   cfg.Bitrix.ListCheckpointPath,
+		maxAge: time.Duration(cfg.Bitrix.ListCheckpointMaxAgeMinutes) * time.Minute,
+	}
+	portal, entityTypeID := client.PortalHost(), client.EntityTypeID()
+
+	resumed, last, err := store.load(portal, entityTypeID)
+	if err != nil {
+		s.logger.Printf("⚠️  %v, listing from the start", err)
+		resumed, last = nil, nil
+	}
+
+	var opts []bitrix.ListOption
+	if last != nil {
+		s.logger.Printf("⏩ Resuming Bitrix24 listing after %d items (checkpoint from %s, run %s)",
+			last.Cursor.Fetched, last.Cursor.At.Format(time.RFC3339), last.RunID)
+		opts = append(opts, bitrix.ResumeFrom(last.Cursor))
+	}
+	runID := bitrix.RunIDFromContext(ctx)
+	opts = append(opts, bitrix.WithProgress(func(page []bitrix.BitrixSocio, cursor bitrix.ListCursor) {
+		cp := listCheckpoint{RunID: runID, Portal: portal, EntityTypeID: entityTypeID, Cursor: cursor, Items: page}
+		if err := store.append(cp); err != nil {
+			s.logger.Printf("⚠️  Failed to save list checkpoint: %v", err)
+		}
+	}))
+
+	// On failure the checkpoint is kept for the next run.
+	socios, err := client.ListSocios(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.clear(); err != nil {
+		s.logger.Printf("⚠️  %v", err)
+	}
+
+	// Items already in the checkpoint may show up again if they moved pages.
+	seen := make(map[int]bool, len(resumed)+len(socios))
+	all := make([]bitrix.BitrixSocio, 0, len(resumed)+len(socios))
+	for _, socio := range append(resumed, socios...) {
+		if !seen[socio.ID] {
+			seen[socio.ID] = true
+			all = append(all, socio)
+		}
+	}
+	return all, nil
+}
@@ -0,0 +1,200 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+	"github.com/arduriki/sage-bitrix-sync/internal/repository"
+)
+
+// SyncClientes performs the Sage clientes → Bitrix24 sync. Clientes with a
+// company CIF upsert companies matched by BitrixConfig.CompanyCIFField;
+// individuals upsert contacts matched by BitrixConfig.ContactTaxIDField when
+// it is set, companies otherwise. Sage holds thousands of clientes, so the
+// Bitrix24 records are listed page by page up front and writes are sent in
+// /batch requests. The Socios* counters of the result count clientes.
+func (s *Service) SyncClientes(ctx context.Context, cfg *config.Config, syncOpts ...SyncOption) (*SyncResult, error) {
+	var options syncOptions
+	for _, opt := range syncOpts {
+		opt(&options)
+	}
+
+	result := &SyncResult{
+		Entity:     config.EntityClientes,
+		ClientID:   cfg.Company.BitrixCode,
+		StartTime:  time.Now(),
+		Errors:     make([]Issue, 0),
+		CreatedIDs: make(map[string]int),
+
+		SkippedByReason: make(map[string]int),
+	}
+	if cfg.Sync.CollectDetails {
+		result.Details = make([]ItemResult, 0)
+	}
+
+	ctx, s = s.beginRun(ctx, cfg, result)
+	defer result.runLog.close(result)
+	defer s.notifyRun(ctx, cfg, result)
+	defer s.recordMetrics(result)
+	defer s.afterSync(ctx, cfg, result)
+	result.progress = newProgressReporter(options.progress, s.logger)
+
+	s.logger.Printf("🚀 Starting clientes sync for client: %s (run %s)", result.ClientID, result.RunID)
+	if cfg.Sync.DryRun {
+		result.DryRun = true
+		result.Plan = &SyncPlan{}
+		s.logger.Printf("🧪 Dry run: changes are planned, nothing is written to Bitrix24")
+	}
+
+	if err := s.beforeSync(ctx, cfg, result); err != nil {
+		return s.completeResult(result, err)
+	}
+
+	// Step 1: Connect to Sage database.
+	result.progress.enter(PhaseConnecting)
+	db, release, err := s.connectSage(ctx, cfg, options.timeouts.withDefaults())
+	if err != nil {
+		return s.completeResult(result, fmt.Errorf("failed to connect to Sage: %w", err))
+	}
+	defer release()
+
+	// Step 2: Create repositories and clients.
+	clienteRepo := repository.NewClienteRepository(db, cfg.SageDB.Tables())
+	opts, err := s.bitrixOptions(cfg)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	bitrixClient, err := bitrix.NewClientValidated(cfg.Bitrix.Endpoint, s.logger, opts...)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	defer func() {
+		result.ThrottleWait = bitrixClient.ThrottleWait().String()
+		result.APIStats = bitrixClient.Stats()
+		result.addClientWarnings(bitrixClient.Warnings())
+	}()
+
+	if err := bitrixClient.TestConnection(ctx); err != nil {
+		return s.completeResult(result, bitrixError("failed to connect to Bitrix24", err))
+	}
+
+	// Step 3: Get the clientes from Sage.
+	result.progress.enter(PhaseFetchingSage)
+	var clientes []*models.Cliente
+	if code, ok := cfg.Company.SageEmpresa(); ok {
+		s.logger.Printf("📊 Fetching clientes of empresa %d from Sage database...", code)
+		clientes, err = clienteRepo.GetByEmpresa(ctx, code)
+	} else {
+		s.logger.Printf("📊 Fetching clientes from Sage database...")
+		clientes, err = clienteRepo.GetAll(ctx)
+	}
+	if err != nil {
+		return s.completeResult(result, fmt.Errorf("failed to fetch clientes from Sage: %w", err))
+	}
+	s.logger.Printf("✅ Found %d clientes in Sage", len(clientes))
+	result.SociosProcessed = len(clientes)
+	result.progress.start(len(clientes))
+
+	// Step 4: Get the companies and contacts from Bitrix24.
+	result.progress.enter(PhaseFetchingBitrix)
+	existing := make(map[string]map[string]*bitrix.BitrixCompany)
+	s.logger.Printf("📊 Fetching companies from Bitrix24...")
+	if existing[bitrix.EntityCompany], err = bitrixClient.ListCompanies(ctx); err != nil {
+		return s.completeResult(result, bitrixError("failed to fetch companies from Bitrix24", err))
+	}
+	s.logger.Printf("✅ Found %d companies with a CIF in Bitrix24", len(existing[bitrix.EntityCompany]))
+	if cfg.Bitrix.ContactTaxIDField != "" {
+		s.logger.Printf("📊 Fetching contacts from Bitrix24...")
+		if existing[bitrix.EntityContact], err = bitrixClient.ListContacts(ctx); err != nil {
+			return s.completeResult(result, bitrixError("failed to fetch contacts from Bitrix24", err))
+		}
+		s.logger.Printf("✅ Found %d contacts with a NIF in Bitrix24", len(existing[bitrix.EntityContact]))
+	}
+
+	// Step 5: Work out what each cliente needs. The same tax ID can appear
+	// under several empresas; the first one wins.
+	result.progress.enter(PhaseSyncing)
+	budget := &errorBudget{maxConsecutive: cfg.Sync.MaxErrors, maxRate: cfg.Sync.MaxErrorRate}
+	writes := make(map[string][]crmWrite)
+	seen := make(map[string]bool, len(clientes))
+	for _, cliente := range clientes {
+		key := bitrix.NormalizeCIF(cliente.CIF)
+		if seen[key] {
+			socioResult{outcome: outcomeSkipped, skip: SkipDuplicateDNI, reason: "duplicate tax ID"}.apply(result, key)
+			result.progress.advance(1)
+			continue
+		}
+		seen[key] = true
+
+		entity := bitrixClient.ClienteEntity(cliente)
+		record, exists := existing[entity][key]
+		if !exists {
+			if cfg.Sync.DryRun {
+				socioResult{outcome: outcomeCreated, reason: "not in Bitrix24"}.apply(result, key)
+				result.progress.advance(1)
+				continue
+			}
+			writes[entity] = append(writes[entity], crmWrite{
+				key:    key,
+				label:  "cliente " + cliente.CodigoCliente,
+				fields: bitrixClient.ClienteFields(entity, cliente, nil),
+			})
+			continue
+		}
+
+		changes := bitrixClient.ClienteChanges(record, cliente)
+		switch {
+		case len(changes) == 0:
+			socioResult{outcome: outcomeSkipped, skip: SkipUnchanged, bitrixID: record.ID, reason: "unchanged"}.apply(result, key)
+			result.progress.advance(1)
+		case cfg.Sync.DryRun:
+			socioResult{outcome: outcomeUpdated, bitrixID: record.ID, changes: changes}.apply(result, key)
+			result.progress.advance(1)
+		default:
+			writes[entity] = append(writes[entity], crmWrite{
+				key:      key,
+				label:    "cliente " + cliente.CodigoCliente,
+				bitrixID: record.ID,
+				changes:  changes,
+				fields:   bitrixClient.ClienteFields(entity, cliente, record),
+			})
+		}
+	}
+
+	// Step 6: Send the writes in batches, companies first.
+	for _, entity := range []string{bitrix.EntityCompany, bitrix.EntityContact} {
+		if err := s.writeBatches(ctx, bitrixClient, entity, writes[entity], result, budget); err != nil {
+			return s.completeResult(result, err)
+		}
+	}
+
+	if result.Plan != nil {
+		result.Plan.sort()
+	}
+
+	// Step 7: Complete successfully.
+	result.progress.enter(PhaseDone)
+	result.Success = len(result.Errors) == 0
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime).String()
+
+	if result.DryRun {
+		s.logger.Printf("🧪 Dry run completed, counts below are planned")
+	} else if result.Success {
+		s.logger.Printf("🎉 Clientes sync completed successfully!")
+	} else {
+		s.logger.Printf("⚠️  Clientes sync completed with %d errors", len(result.Errors))
+	}
+	s.logger.Printf("   📊 Processed: %d clientes", result.SociosProcessed)
+	s.logger.Printf("   ✨ Created: %d", result.SociosCreated)
+	s.logger.Printf("   📝 Updated: %d", result.SociosUpdated)
+	s.logger.Printf("   ⏭️  Skipped: %d%s", result.SociosSkipped, skipBreakdown(result.SkippedByReason))
+	s.logger.Printf("   ❌ Failed: %d", result.SociosFailed)
+	s.logger.Printf("   ⏱️  Duration: %s", result.Duration)
+
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// editGrace is how long after a socio was synced a Bitrix24 modification is
+// still taken for the sync's own write.
+const editGrace = time.Minute
+
+// Sides of a conflict, for FieldConflict.Winner.
+const (
+	WinnerSage   = "sage"
+	WinnerBitrix = "bitrix"
+)
+
+// FieldConflict is a field edited in Bitrix24 since the last sync whose value
+// differs from Sage's, and the side whose value was kept.
+type FieldConflict struct {
+	Field  string `json:"field"`
+	Sage   string `json:"sage"`
+	Bitrix string `json:"bitrix"`
+	Winner string `json:"winner"`
+}
+
+// bitrixEdited reports whether the Bitrix item was modified since the socio
+// was last synced. Socios not in the state fall back to comparing with the
+// Sage modification time, when there is one.
+func bitrixEdited(item *bitrix.BitrixSocio, socio *models.Socio, state *clientState) bool {
+	if item.UpdatedTime == nil {
+		return false
+	}
+	if state != nil {
+		if synced, ok := state.lookup(socio.DNI); ok {
+			return item.UpdatedTime.After(synced.SyncedAt.Add(editGrace))
+		}
+	}
+	return bitrixIsNewer(item, socio)
+}
+
+// bitrixIsNewer reports whether the Bitrix item was modified after the Sage
+// record. Unknown timestamps on either side never count as newer.
+func bitrixIsNewer(bitrixSocio *bitrix.BitrixSocio, sageSocio *models.Socio) bool {
+	if bitrixSocio.UpdatedTime == nil || sageSocio.UpdatedAt == nil {
+		return false
+	}
+	return bitrixSocio.UpdatedTime.After(*sageSocio.UpdatedAt)
+}
+
+// conflictWinner settles a conflict on a socio by the configured policy.
+// newest_wins compares the modification times when Sage has one; otherwise
+// Bitrix24 is newer if the socio is unchanged in Sage since the last sync,
+// and Sage wins when both sides changed.
+func conflictWinner(cfg *config.Config, item *bitrix.BitrixSocio, socio *models.Socio, state *clientState) string {
+	switch cfg.Sync.ConflictPolicy {
+	case config.ConflictBitrixWins:
+		return WinnerBitrix
+	case config.ConflictNewestWins:
+		if socio.UpdatedAt != nil {
+			if bitrixIsNewer(item, socio) {
+				return WinnerBitrix
+			}
+			return WinnerSage
+		}
+		if state != nil && state.unchanged(socio.DNI, socio.ContentHash()) {
+			return WinnerBitrix
+		}
+	}
+	return WinnerSage
+}
+
+// fieldConflicts returns the changes a sync would make to a Bitrix item
+// edited since the last sync as conflicts, all settled the same way, or nil
+// when the item was not edited.
+func fieldConflicts(cfg *config.Config, item *bitrix.BitrixSocio, socio *models.Socio, changes []bitrix.FieldChange, state *clientState) []FieldConflict {
+	if len(changes) == 0 || !bitrixEdited(item, socio, state) {
+		return nil
+	}
+	side := conflictWinner(cfg, item, socio, state)
+	conflicts := make([]FieldConflict, len(changes))
+	for i, change := range changes {
+		conflicts[i] = FieldConflict{Field: change.Field, Sage: change.New, Bitrix: change.Old, Winner: side}
+	}
+	return conflicts
+}
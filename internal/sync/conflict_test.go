@@ -0,0 +1,43 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+)
+
+func TestConflictWinnerNewestWins(t *testing.T) {
+	cfg := testConfig()
+	cfg.Sync.ConflictPolicy = config.ConflictNewestWins
+	earlier, later := time.Now().Add(-time.Hour), time.Now()
+
+	tests := []struct {
+		name           string
+		sage, bitrix   *time.Time
+		unchangedState bool
+		want           string
+	}{
+		{"bitrix newer", &earlier, &later, false, WinnerBitrix},
+		{"sage newer", &later, &earlier, false, WinnerSage},
+		{"bitrix time unknown", &earlier, nil, false, WinnerSage},
+		{"sage time unknown, sage unchanged", nil, &later, true, WinnerBitrix},
+		{"sage time unknown, both changed", nil, &later, false, WinnerSage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socio := testSocio(1)
+			socio.UpdatedAt = tt.sage
+			item := bitrixItem(1, socio)
+			item.UpdatedTime = tt.bitrix
+
+			state := &clientState{Items: make(map[string]stateItem)}
+			if tt.unchangedState {
+				state.record(socio.DNI, socio.ContentHash(), 1)
+			}
+			if got := conflictWinner(cfg, &item, socio, state); got != tt.want {
+				t.Errorf("conflictWinner = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
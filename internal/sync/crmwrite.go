@@ -0,0 +1,91 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+)
+
+// crmWrite is a create or update of a standard CRM record (company, contact,
+// deal) waiting to be sent in a batch.
+type crmWrite struct {
+	key      string // Tax ID or invoice number the outcome is keyed by
+	label    string // Names the Sage record in error messages
+	bitrixID int    // Record to update; 0 creates one
+	changes  []bitrix.FieldChange
+	fields   map[string]interface{}
+
+	deactivate bool // The update deactivates a record discontinued in Sage
+}
+
+// writeBatches sends writes to Bitrix24 in /batch requests of
+// bitrix.MaxBatchCommands and applies each outcome to result. The returned
+// error is only set for cancellation, a transient failure of a whole batch
+// or an exhausted error budget.
+func (s *Service) writeBatches(ctx context.Context, bitrixClient *bitrix.Client, entity string, writes []crmWrite, result *SyncResult, budget *errorBudget) error {
+	for start := 0; start < len(writes); start += bitrix.MaxBatchCommands {
+		if ctx.Err() != nil {
+			return fmt.Errorf("sync cancelled: %w", ctx.Err())
+		}
+		end := min(start+bitrix.MaxBatchCommands, len(writes))
+		if err := s.writeBatch(ctx, bitrixClient, entity, writes[start:end], result, budget); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBatch sends a single batch of writes.
+func (s *Service) writeBatch(ctx context.Context, bitrixClient *bitrix.Client, entity string, batch []crmWrite, result *SyncResult, budget *errorBudget) error {
+	crmWrites := make([]bitrix.CRMWrite, len(batch))
+	for i, w := range batch {
+		crmWrites[i] = bitrix.CRMWrite{Key: w.key, ID: w.bitrixID, Fields: w.fields}
+	}
+
+	s.logger.Printf("📦 Writing %d %s records to Bitrix24...", len(batch), entity)
+	writeResults, err := bitrixClient.BatchWrite(ctx, entity, crmWrites)
+	if err != nil {
+		if IsTransient(err) {
+			return bitrixError("", err)
+		}
+		// The whole batch was rejected: every write in it failed the same way.
+		writeResults = make([]bitrix.CRMWriteResult, len(crmWrites))
+		for i, w := range crmWrites {
+			writeResults[i] = bitrix.CRMWriteResult{Key: w.Key, ID: w.ID, Err: err}
+		}
+	}
+
+	for i, w := range batch {
+		wr := writeResults[i]
+		r := socioResult{outcome: outcomeCreated, createdID: wr.ID}
+		action := "create"
+		switch {
+		case w.deactivate:
+			r = socioResult{outcome: outcomeDeactivated, bitrixID: w.bitrixID}
+			action = "deactivate"
+		case w.bitrixID > 0:
+			r = socioResult{outcome: outcomeUpdated, bitrixID: w.bitrixID, changes: w.changes}
+			action = "update"
+		}
+		if wr.Err != nil {
+			errorMsg := fmt.Sprintf("Failed to %s %s of %s (%s): %v", action, entity, w.label, w.key, wr.Err)
+			s.logger.Printf("❌ %s", errorMsg)
+			r = socioResult{
+				outcome:    outcomeFailed,
+				errorMsg:   errorMsg,
+				errorCause: fmt.Sprintf("%s %s: %v", action, entity, wr.Err),
+				err:        wr.Err,
+				unexpected: errors.Is(wr.Err, bitrix.ErrUnexpectedResponse),
+				bitrixID:   w.bitrixID,
+			}
+		}
+		r.apply(result, w.key)
+		result.progress.advance(1)
+		if err := budget.add(r.outcome); err != nil {
+			return err
+		}
+	}
+	return nil
+}
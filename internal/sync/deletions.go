@@ -0,0 +1,168 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// ErrDeletionThreshold is returned when a run would mark or delete more
+// Bitrix items than SyncConfig.MaxDeletePercent allows.
+var ErrDeletionThreshold = errors.New("too many socios missing from Sage")
+
+// sageDNIs returns the normalized DNIs of the socios in Sage, in the empresa
+// synced when there is one. A DNISource is asked for them with a query
+// reading only the DNIs, so a socio whose row failed to scan is not taken
+// for removed; the DNIs of sageSocios are always included. Should that
+// query fail, only sageSocios are used.
+func (s *Service) sageDNIs(ctx context.Context, cfg *config.Config, socioRepo SocioSource, sageSocios []*models.Socio, result *SyncResult) map[string]bool {
+	inSage := make(map[string]bool, len(sageSocios))
+	for _, socio := range sageSocios {
+		inSage[models.NormalizeDNI(socio.DNI)] = true
+	}
+
+	source, ok := socioRepo.(DNISource)
+	if !ok {
+		return inSage
+	}
+	queryCtx, cancel := phaseContext(ctx, result.timeouts.SageQuery)
+	defer cancel()
+	var dnis []string
+	var err error
+	if code, scoped := cfg.Company.SageEmpresa(); scoped {
+		dnis, err = source.GetDNIsByEmpresa(queryCtx, code)
+	} else {
+		dnis, err = source.GetAllDNIs(queryCtx)
+	}
+	if err != nil {
+		s.logger.Printf("⚠️  Could not list the Sage DNIs, checking removals against the socios read: %v", err)
+		return inSage
+	}
+	for _, dni := range dnis {
+		inSage[dni] = true
+	}
+	return inSage
+}
+
+// reconcileDeletions applies the deletion policy to Bitrix items whose DNI,
+// normalized, is not in inSage. Items without a DNI were not created by the
+// sync and are left alone, and so are, when syncing a single empresa, items
+// that do not record that empresa: they may belong to another company in
+// the database.
+func (s *Service) reconcileDeletions(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, inSage map[string]bool, bitrixSocios []bitrix.BitrixSocio, result *SyncResult) error {
+	policy := cfg.Sync.DeletionPolicy
+	if policy == config.DeletionPolicyIgnore {
+		return nil
+	}
+
+	code, scoped := cfg.Company.SageEmpresa()
+
+	var removed []bitrix.BitrixSocio
+	tracked := 0
+	for _, item := range bitrixSocios {
+		dni := models.NormalizeDNI(item.DNI)
+		if dni == "" || (scoped && item.Empresa != code) {
+			continue
+		}
+		tracked++
+		if inSage[dni] {
+			continue
+		}
+		if policy == config.DeletionPolicyMark && bitrixClient.IsInactive(&item) {
+			continue
+		}
+		removed = append(removed, item)
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	s.logger.Printf("🧹 %d Bitrix24 socios are no longer in Sage (policy: %s)", len(removed), policy)
+
+	if len(removed)*100 > cfg.Sync.MaxDeletePercent*tracked {
+		switch {
+		case cfg.Sync.ForceDeletions:
+			s.logger.Printf("⚠️  Over the %d%% limit, continuing because deletions are forced", cfg.Sync.MaxDeletePercent)
+		case cfg.Sync.DryRun:
+			result.Plan.Warnings = append(result.Plan.Warnings, fmt.Sprintf(
+				"%d of %d items missing from Sage exceeds the %d%% limit; a real run would refuse to %s them",
+				len(removed), tracked, cfg.Sync.MaxDeletePercent, policy))
+		default:
+			return fmt.Errorf("%w: refusing to %s %d of %d items (limit %d%%); set SYNC_FORCE_DELETIONS=true if intended",
+				ErrDeletionThreshold, policy, len(removed), tracked, cfg.Sync.MaxDeletePercent)
+		}
+	}
+
+	if cfg.Sync.DryRun {
+		planRemoved(policy, removed, result)
+		return nil
+	}
+
+	if policy == config.DeletionPolicyDelete {
+		return s.deleteRemoved(ctx, bitrixClient, removed, result)
+	}
+
+	for _, item := range removed {
+		err := bitrixClient.DeactivateSocio(ctx, item.ID)
+		if IsTransient(err) {
+			return bitrixError("", err)
+		}
+		if err != nil && !errors.Is(err, bitrix.ErrNotFound) {
+			errorMsg := fmt.Sprintf("Failed to deactivate socio %s (item %d): %v", item.DNI, item.ID, err)
+			s.logger.Printf("❌ %s", errorMsg)
+			result.addError(IssueItemFailed, item.DNI, errorMsg)
+			result.addDetail(ItemResult{DNI: item.DNI, Action: ItemFailed, BitrixID: item.ID, Error: err.Error()})
+			continue
+		}
+		result.SociosDeactivated++
+		result.addDetail(ItemResult{DNI: item.DNI, Action: ItemDeactivated, BitrixID: item.ID})
+	}
+	return nil
+}
+
+// deleteRemoved deletes the items of socios removed from Sage in batches.
+func (s *Service) deleteRemoved(ctx context.Context, bitrixClient SocioTarget, removed []bitrix.BitrixSocio, result *SyncResult) error {
+	ids := make([]int, len(removed))
+	dnis := make(map[int]string, len(removed))
+	for i, item := range removed {
+		ids[i] = item.ID
+		dnis[item.ID] = item.DNI
+		s.rollback.record(bitrixClient, PlanDelete, &removed[i], nil)
+	}
+
+	results, err := bitrixClient.BatchDeleteSocios(ctx, ids)
+	for _, r := range results {
+		if r.Err != nil {
+			errorMsg := fmt.Sprintf("Failed to delete socio %s (item %d): %v", dnis[r.ID], r.ID, r.Err)
+			result.addError(IssueItemFailed, dnis[r.ID], errorMsg)
+			result.addDetail(ItemResult{DNI: dnis[r.ID], Action: ItemFailed, BitrixID: r.ID, Error: r.Err.Error()})
+			continue
+		}
+		result.SociosDeleted++
+		result.addDetail(ItemResult{DNI: dnis[r.ID], Action: ItemDeleted, BitrixID: r.ID})
+	}
+	if err != nil {
+		return bitrixError("failed to delete socios removed from Sage", err)
+	}
+	return nil
+}
+
+// planRemoved records the items a dry run would mark or delete.
+func planRemoved(policy string, removed []bitrix.BitrixSocio, result *SyncResult) {
+	action := PlanDeactivate
+	if policy == config.DeletionPolicyDelete {
+		action = PlanDelete
+	}
+	for _, item := range removed {
+		result.Plan.add(PlannedAction{DNI: item.DNI, Action: action, BitrixID: item.ID, Reason: "not in Sage"})
+		if action == PlanDelete {
+			result.SociosDeleted++
+		} else {
+			result.SociosDeactivated++
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+	"github.com/arduriki/sage-bitrix-sync/internal/repository"
+)
+
+// SocioSource is the Sage side of the socios sync. *repository.SocioRepository
+// implements it.
+type SocioSource interface {
+	GetAll(ctx context.Context) ([]*models.Socio, error)
+	GetAllByEmpresa(ctx context.Context, codigoEmpresa int) ([]*models.Socio, error)
+	GetByDNIs(ctx context.Context, dnis []string) ([]*models.Socio, error)
+	UpdateFields(ctx context.Context, socio *models.Socio, fields []string) error
+}
+
+// SocioStreamer is a SocioSource that can hand off its socios one at a time,
+// used instead of GetAll and GetAllByEmpresa when SyncConfig.StreamSage is set.
+// *repository.SocioRepository implements it.
+type SocioStreamer interface {
+	GetAllStream(ctx context.Context, fn func(*models.Socio) error) error
+	GetAllByEmpresaStream(ctx context.Context, codigoEmpresa int, fn func(*models.Socio) error) error
+}
+
+// ModifiedSource is a SocioSource that can fetch only the socios changed
+// since a point in time, for incremental runs. *repository.SocioRepository
+// implements it, for Sage databases whose socio tables stamp modifications.
+type ModifiedSource interface {
+	TracksModifications(ctx context.Context) (bool, error)
+	GetModifiedSince(ctx context.Context, since time.Time) ([]*models.Socio, error)
+}
+
+// DNISource is a SocioSource that can list the normalized DNIs of its
+// socios without reading their other columns, to tell which Bitrix24 items
+// lost their socio. *repository.SocioRepository implements it.
+type DNISource interface {
+	GetAllDNIs(ctx context.Context) ([]string, error)
+	GetDNIsByEmpresa(ctx context.Context, codigoEmpresa int) ([]string, error)
+}
+
+// QueryCounter is a SocioSource that counts the queries it runs.
+// *repository.SocioRepository implements it.
+type QueryCounter interface {
+	QueryStats() repository.QueryStats
+}
+
+// sageStats returns the query counters of source, or nil when it does not
+// count them.
+func sageStats(source SocioSource) *repository.QueryStats {
+	counter, ok := source.(QueryCounter)
+	if !ok {
+		return nil
+	}
+	stats := counter.QueryStats()
+	return &stats
+}
+
+// SocioTarget is the Bitrix24 side of the socios sync. *bitrix.Client
+// implements it; a fake can embed one for the methods that only compare.
+type SocioTarget interface {
+	// Setup and reporting.
+	TestConnection(ctx context.Context) error
+	ResolveEntityType(ctx context.Context, cache *bitrix.DiscoveryCache) (int, error)
+	ValidateFields(ctx context.Context) error
+	ValidateStage(ctx context.Context) error
+	EntityTypeID() int
+	PortalHost() string
+	Stats() bitrix.APIStats
+	ThrottleWait() time.Duration
+	Warnings() []bitrix.Warning
+
+	// Reads.
+	ListSocios(ctx context.Context, opts ...bitrix.ListOption) ([]bitrix.BitrixSocio, error)
+	GetSocioByDNI(ctx context.Context, dni string) (*bitrix.BitrixSocio, error)
+	GetSocioByID(ctx context.Context, id int) (*bitrix.BitrixSocio, error)
+	ResolveCompanies(ctx context.Context, socios []*models.Socio) error
+
+	// Writes.
+	CreateSocio(ctx context.Context, socio *models.Socio) (int, error)
+	UpdateSocio(ctx context.Context, bitrixID int, socio *models.Socio) error
+	DeleteSocio(ctx context.Context, bitrixID int) error
+	DeactivateSocio(ctx context.Context, bitrixID int) error
+	BatchDeleteSocios(ctx context.Context, ids []int) ([]bitrix.BatchDeleteResult, error)
+	CommentChanges(ctx context.Context, bitrixID int, changes []bitrix.FieldChange) error
+
+	// Comparison, without API calls.
+	OwnsSocio(bs *bitrix.BitrixSocio) bool
+	IsInactive(bs *bitrix.BitrixSocio) bool
+	Changes(bitrixSocio *bitrix.BitrixSocio, sageSocio *models.Socio) []bitrix.FieldChange
+	SocioFieldValues(item *bitrix.BitrixSocio) map[string]string
+	ExpectedFieldValues(socio *models.Socio) map[string]string
+}
+
+// SourceFactory opens the SocioSource of a run, giving up when ctx is done;
+// release is called when the run is over.
+type SourceFactory func(ctx context.Context, cfg *config.Config, logger *log.Logger) (source SocioSource, release func() error, err error)
+
+// TargetFactory creates the SocioTarget of a run.
+type TargetFactory func(cfg *config.Config, logger *log.Logger) (SocioTarget, error)
+
+// ServiceOption configures a Service.
+type ServiceOption func(*Service)
+
+// WithSourceFactory replaces how the socios sync reaches Sage.
+func WithSourceFactory(f SourceFactory) ServiceOption {
+	return func(s *Service) {
+		s.openSource = f
+	}
+}
+
+// WithPortalCoordinator makes the Bitrix24 clients of every pipeline share
+// the rate limit and circuit breaker of their portal through p, so clients
+// of one portal synced in parallel keep to its limit together.
+func WithPortalCoordinator(p *bitrix.PortalCoordinator) ServiceOption {
+	return func(s *Service) {
+		s.portals = p
+	}
+}
+
+// WithTargetFactory replaces how the socios sync reaches Bitrix24.
+func WithTargetFactory(f TargetFactory) ServiceOption {
+	return func(s *Service) {
+		s.newTarget = f
+	}
+}
+
+// openSageSource connects to the Sage database configured in cfg through
+// the service's SageConnector, or to each of its databases when there are
+// several.
+func (s *Service) openSageSource(ctx context.Context, cfg *config.Config, logger *log.Logger) (SocioSource, func() error, error) {
+	if cfg.SageDB.MultiDatabase() {
+		return s.openMultiSource(ctx, cfg, logger)
+	}
+	db, release, err := s.openSage(ctx, cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newSocioRepository(cfg, db, logger), release, nil
+}
+
+// newSocioRepository creates the repository of the Sage database db, with
+// the retries, query timeout, isolation and query logging configured in
+// cfg; queries are logged through logger.
+func newSocioRepository(cfg *config.Config, db *sql.DB, logger *log.Logger) *repository.SocioRepository {
+	policy := repository.DefaultRetryPolicy
+	policy.Retries = cfg.SageDB.QueryRetries
+	opts := []repository.SocioOption{
+		repository.WithRetryPolicy(policy),
+		repository.WithQueryTimeout(time.Duration(cfg.SageDB.QueryTimeoutSeconds) * time.Second),
+	}
+	if cfg.SageDB.ReadUncommitted {
+		opts = append(opts, repository.WithReadUncommitted())
+	}
+	queryLogger := logger
+	if !cfg.SageDB.LogQueries {
+		queryLogger = nil
+	}
+	opts = append(opts, repository.WithQueryLog(queryLogger, time.Duration(cfg.SageDB.SlowQueryMillis)*time.Millisecond))
+	return repository.NewSocioRepository(db, cfg.SageDB.Tables(), opts...)
+}
+
+// newBitrixTarget creates the Bitrix24 client configured in cfg.
+func (s *Service) newBitrixTarget(cfg *config.Config, logger *log.Logger) (SocioTarget, error) {
+	opts, err := s.bitrixOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := bitrix.NewClientValidated(cfg.Bitrix.Endpoint, logger, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,67 @@
+package sync
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+)
+
+// Redactor returns how a field value is shown in item results, plans,
+// reports and timeline comments, e.g. masked for a sensitive field. It must
+// be deterministic. No socio field is sensitive today.
+type Redactor func(field, value string) string
+
+// WithRedactor masks the field values of every run's diffs through fn.
+func WithRedactor(fn Redactor) ServiceOption {
+	return func(s *Service) {
+		s.redactor = fn
+	}
+}
+
+// redactChanges returns changes as redact shows them.
+func redactChanges(redact Redactor, changes []bitrix.FieldChange) []bitrix.FieldChange {
+	if redact == nil || len(changes) == 0 {
+		return changes
+	}
+	redacted := make([]bitrix.FieldChange, len(changes))
+	for i, c := range changes {
+		redacted[i] = bitrix.FieldChange{Field: c.Field, Old: redact(c.Field, c.Old), New: redact(c.Field, c.New)}
+	}
+	return redacted
+}
+
+// redactConflicts returns conflicts as redact shows them.
+func redactConflicts(redact Redactor, conflicts []FieldConflict) []FieldConflict {
+	if redact == nil || len(conflicts) == 0 {
+		return conflicts
+	}
+	redacted := make([]FieldConflict, len(conflicts))
+	for i, c := range conflicts {
+		redacted[i] = c
+		redacted[i].Sage = redact(c.Field, c.Sage)
+		redacted[i].Bitrix = redact(c.Field, c.Bitrix)
+	}
+	return redacted
+}
+
+// WriteChangesCSV writes the field changes of the run's updates, real or
+// planned, one row per field. It needs the item details, so the run must
+// collect them (SyncConfig.CollectDetails).
+func (r *SyncResult) WriteChangesCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"run_id", "client_id", "dry_run", "dni", "bitrix_id", "field", "old", "new"}); err != nil {
+		return err
+	}
+	for _, d := range r.Details {
+		for _, c := range d.Changes {
+			row := []string{r.RunID, r.ClientID, strconv.FormatBool(r.DryRun), d.DNI, strconv.Itoa(d.BitrixID), c.Field, c.Old, c.New}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,200 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+	"github.com/arduriki/sage-bitrix-sync/internal/repository"
+)
+
+// SyncEmpresas performs the Sage empresas → Bitrix24 companies sync, matching
+// companies by the CIF held in BitrixConfig.CompanyCIFField. The Socios*
+// counters of the result count companies.
+func (s *Service) SyncEmpresas(ctx context.Context, cfg *config.Config, syncOpts ...SyncOption) (*SyncResult, error) {
+	var options syncOptions
+	for _, opt := range syncOpts {
+		opt(&options)
+	}
+
+	result := &SyncResult{
+		Entity:     config.EntityEmpresas,
+		ClientID:   cfg.Company.BitrixCode,
+		StartTime:  time.Now(),
+		Errors:     make([]Issue, 0),
+		CreatedIDs: make(map[string]int),
+
+		SkippedByReason: make(map[string]int),
+	}
+	if cfg.Sync.CollectDetails {
+		result.Details = make([]ItemResult, 0)
+	}
+
+	ctx, s = s.beginRun(ctx, cfg, result)
+	defer result.runLog.close(result)
+	defer s.notifyRun(ctx, cfg, result)
+	defer s.recordMetrics(result)
+	defer s.afterSync(ctx, cfg, result)
+	result.progress = newProgressReporter(options.progress, s.logger)
+
+	s.logger.Printf("🚀 Starting empresas sync for client: %s (run %s)", result.ClientID, result.RunID)
+	if cfg.Sync.DryRun {
+		result.DryRun = true
+		result.Plan = &SyncPlan{}
+		s.logger.Printf("🧪 Dry run: changes are planned, nothing is written to Bitrix24")
+	}
+
+	if err := s.beforeSync(ctx, cfg, result); err != nil {
+		return s.completeResult(result, err)
+	}
+
+	// Step 1: Connect to Sage database.
+	result.progress.enter(PhaseConnecting)
+	db, release, err := s.connectSage(ctx, cfg, options.timeouts.withDefaults())
+	if err != nil {
+		return s.completeResult(result, fmt.Errorf("failed to connect to Sage: %w", err))
+	}
+	defer release()
+
+	// Step 2: Create repositories and clients.
+	empresaRepo := repository.NewEmpresaRepository(db, cfg.SageDB.Tables())
+	opts, err := s.bitrixOptions(cfg)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	bitrixClient, err := bitrix.NewClientValidated(cfg.Bitrix.Endpoint, s.logger, opts...)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	defer func() {
+		result.ThrottleWait = bitrixClient.ThrottleWait().String()
+		result.APIStats = bitrixClient.Stats()
+		result.addClientWarnings(bitrixClient.Warnings())
+	}()
+
+	if err := bitrixClient.TestConnection(ctx); err != nil {
+		return s.completeResult(result, bitrixError("failed to connect to Bitrix24", err))
+	}
+
+	// Step 3: Get the empresas from Sage.
+	result.progress.enter(PhaseFetchingSage)
+	var empresas []*models.Empresa
+	if code, ok := cfg.Company.SageEmpresa(); ok {
+		s.logger.Printf("📊 Fetching empresa %d from Sage database...", code)
+		empresas, err = empresaRepo.GetByCode(ctx, code)
+	} else {
+		s.logger.Printf("📊 Fetching empresas from Sage database...")
+		empresas, err = empresaRepo.GetAll(ctx)
+	}
+	if err != nil {
+		return s.completeResult(result, fmt.Errorf("failed to fetch empresas from Sage: %w", err))
+	}
+	s.logger.Printf("✅ Found %d empresas in Sage", len(empresas))
+	result.SociosProcessed = len(empresas)
+	result.progress.start(len(empresas))
+
+	// Step 4: Get the companies from Bitrix24.
+	result.progress.enter(PhaseFetchingBitrix)
+	s.logger.Printf("📊 Fetching companies from Bitrix24...")
+	companies, err := bitrixClient.ListCompanies(ctx)
+	if err != nil {
+		return s.completeResult(result, bitrixError("failed to fetch companies from Bitrix24", err))
+	}
+	s.logger.Printf("✅ Found %d companies with a CIF in Bitrix24", len(companies))
+
+	// Step 5: Create or update each empresa's company.
+	result.progress.enter(PhaseSyncing)
+	budget := &errorBudget{maxConsecutive: cfg.Sync.MaxErrors, maxRate: cfg.Sync.MaxErrorRate}
+	for _, empresa := range empresas {
+		if ctx.Err() != nil {
+			return s.completeResult(result, fmt.Errorf("sync cancelled: %w", ctx.Err()))
+		}
+
+		r, err := s.syncEmpresa(ctx, cfg, bitrixClient, empresa, companies)
+		if err != nil {
+			return s.completeResult(result, bitrixError("", err))
+		}
+		r.apply(result, empresa.CIF)
+		result.progress.advance(1)
+		if err := budget.add(r.outcome); err != nil {
+			return s.completeResult(result, err)
+		}
+	}
+
+	if result.Plan != nil {
+		result.Plan.sort()
+	}
+
+	// Step 6: Complete successfully.
+	result.progress.enter(PhaseDone)
+	result.Success = len(result.Errors) == 0
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime).String()
+
+	if result.DryRun {
+		s.logger.Printf("🧪 Dry run completed, counts below are planned")
+	} else if result.Success {
+		s.logger.Printf("🎉 Empresas sync completed successfully!")
+	} else {
+		s.logger.Printf("⚠️  Empresas sync completed with %d errors", len(result.Errors))
+	}
+	s.logger.Printf("   📊 Processed: %d empresas", result.SociosProcessed)
+	s.logger.Printf("   ✨ Created: %d companies", result.SociosCreated)
+	s.logger.Printf("   📝 Updated: %d companies", result.SociosUpdated)
+	s.logger.Printf("   ⏭️  Skipped: %d companies%s", result.SociosSkipped, skipBreakdown(result.SkippedByReason))
+	s.logger.Printf("   ⏱️  Duration: %s", result.Duration)
+
+	return result, nil
+}
+
+// syncEmpresa creates or updates the Bitrix24 company of one Sage empresa,
+// keyed by CIF in the result. The returned error is only set for transient
+// failures that should abort the run.
+func (s *Service) syncEmpresa(ctx context.Context, cfg *config.Config, bitrixClient *bitrix.Client, empresa *models.Empresa, companies map[string]*bitrix.BitrixCompany) (socioResult, error) {
+	failed := func(action string, companyID int, err error) (socioResult, error) {
+		if IsTransient(err) {
+			return socioResult{}, err
+		}
+		errorMsg := fmt.Sprintf("Failed to %s company of empresa %d (CIF %s): %v", action, empresa.CodigoEmpresa, empresa.CIF, err)
+		s.logger.Printf("❌ %s", errorMsg)
+		return socioResult{
+			outcome:    outcomeFailed,
+			errorMsg:   errorMsg,
+			errorCause: fmt.Sprintf("%s: %v", action, err),
+			err:        err,
+			unexpected: errors.Is(err, bitrix.ErrUnexpectedResponse),
+			bitrixID:   companyID,
+		}, nil
+	}
+
+	company, exists := companies[bitrix.NormalizeCIF(empresa.CIF)]
+	if !exists {
+		if cfg.Sync.DryRun {
+			return socioResult{outcome: outcomeCreated, reason: "not in Bitrix24"}, nil
+		}
+		id, err := bitrixClient.CreateCompanyFromEmpresa(ctx, empresa)
+		if err != nil {
+			return failed("create", 0, err)
+		}
+		// Another empresa with the same CIF updates this company instead.
+		companies[bitrix.NormalizeCIF(empresa.CIF)] = &bitrix.BitrixCompany{ID: id}
+		return socioResult{outcome: outcomeCreated, createdID: id}, nil
+	}
+
+	changes := bitrixClient.CompanyChanges(company, empresa)
+	if len(changes) == 0 {
+		s.logger.Printf("⏭️  Company unchanged: CIF=%s", empresa.CIF)
+		return socioResult{outcome: outcomeSkipped, skip: SkipUnchanged, bitrixID: company.ID, reason: "unchanged"}, nil
+	}
+	if cfg.Sync.DryRun {
+		return socioResult{outcome: outcomeUpdated, bitrixID: company.ID, changes: changes}, nil
+	}
+	if err := bitrixClient.UpdateCompanyFromEmpresa(ctx, company, empresa); err != nil {
+		return failed("update", company.ID, err)
+	}
+	return socioResult{outcome: outcomeUpdated, bitrixID: company.ID, changes: changes}, nil
+}
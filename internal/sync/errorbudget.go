@@ -0,0 +1,65 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrErrorThreshold is returned when a run is aborted because too many socios
+// failed, which usually means every further call would fail the same way
+// (a revoked webhook token, a removed field).
+var ErrErrorThreshold = errors.New("error threshold exceeded")
+
+// minErrorRateSample is how many socios must be handled before the error
+// rate is checked, so one early failure does not abort the run.
+const minErrorRateSample = 20
+
+// errorBudget tracks item failures against SyncConfig.MaxErrors and
+// MaxErrorRate. Zero limits are disabled. Callers serialize it.
+type errorBudget struct {
+	maxConsecutive int
+	maxRate        float64
+
+	consecutive int
+	failed      int
+	handled     int
+}
+
+// add counts an item outcome and returns an ErrErrorThreshold error once a
+// limit is exceeded.
+func (b *errorBudget) add(outcome itemOutcome) error {
+	switch outcome {
+	case outcomeAborted:
+		return nil
+	case outcomeFailed:
+		b.consecutive++
+		b.failed++
+	default:
+		b.consecutive = 0
+	}
+	b.handled++
+
+	if b.maxConsecutive > 0 && b.consecutive >= b.maxConsecutive {
+		return fmt.Errorf("%w: aborted after %d consecutive failures", ErrErrorThreshold, b.consecutive)
+	}
+	if b.maxRate > 0 && b.handled >= minErrorRateSample && float64(b.failed) > b.maxRate*float64(b.handled) {
+		return fmt.Errorf("%w: aborted after %d of %d socios failed", ErrErrorThreshold, b.failed, b.handled)
+	}
+	return nil
+}
+
+// addItemError records the error of a failed socio. Consecutive failures with
+// the same cause collapse into one entry with an occurrence count, and without
+// a DNI, so a run failing on every socio does not list the same error
+// hundreds of times.
+func (r *SyncResult) addItemError(dni, errorMsg, cause string) {
+	last := len(r.Errors) - 1
+	if cause != "" && cause == r.lastCause && last >= 0 && last == r.lastCauseIndex {
+		r.lastCauseCount++
+		r.Errors[last].DNI = ""
+		r.Errors[last].Message = fmt.Sprintf("%s (%d socios failed the same way)", r.lastCauseMsg, r.lastCauseCount)
+		return
+	}
+	r.addError(IssueItemFailed, dni, errorMsg)
+	r.lastCause, r.lastCauseMsg, r.lastCauseCount, r.lastCauseIndex = cause, errorMsg, 1, len(r.Errors)-1
+}
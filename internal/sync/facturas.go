@@ -0,0 +1,273 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+	"github.com/arduriki/sage-bitrix-sync/internal/repository"
+)
+
+// dealEntityTypeID is the CRM entity type ID of deals, under which the
+// facturas sync keeps its state.
+const dealEntityTypeID = 2
+
+// SyncFacturas performs the Sage facturas → Bitrix24 deals sync. Each
+// invoice creates or updates the deal holding its number in
+// BitrixConfig.DealInvoiceField, with its amount, currency and date, bound
+// to the company (or contact) of its cliente when one is found by tax ID.
+// With a state file, only invoices dated since the last successful run are
+// read; otherwise the backfill window is. The Socios* counters of the result
+// count facturas.
+func (s *Service) SyncFacturas(ctx context.Context, cfg *config.Config, syncOpts ...SyncOption) (*SyncResult, error) {
+	var options syncOptions
+	for _, opt := range syncOpts {
+		opt(&options)
+	}
+
+	result := &SyncResult{
+		Entity:     config.EntityFacturas,
+		ClientID:   cfg.Company.BitrixCode,
+		StartTime:  time.Now(),
+		Errors:     make([]Issue, 0),
+		CreatedIDs: make(map[string]int),
+
+		SkippedByReason: make(map[string]int),
+	}
+	if cfg.Sync.CollectDetails {
+		result.Details = make([]ItemResult, 0)
+	}
+
+	ctx, s = s.beginRun(ctx, cfg, result)
+	defer result.runLog.close(result)
+	defer s.notifyRun(ctx, cfg, result)
+	defer s.recordMetrics(result)
+	defer s.afterSync(ctx, cfg, result)
+	result.progress = newProgressReporter(options.progress, s.logger)
+
+	s.logger.Printf("🚀 Starting facturas sync for client: %s (run %s)", result.ClientID, result.RunID)
+	if cfg.Sync.DryRun {
+		result.DryRun = true
+		result.Plan = &SyncPlan{}
+		s.logger.Printf("🧪 Dry run: changes are planned, nothing is written to Bitrix24")
+	}
+
+	if err := s.beforeSync(ctx, cfg, result); err != nil {
+		return s.completeResult(result, err)
+	}
+
+	// Step 1: Connect to Sage database.
+	result.progress.enter(PhaseConnecting)
+	db, release, err := s.connectSage(ctx, cfg, options.timeouts.withDefaults())
+	if err != nil {
+		return s.completeResult(result, fmt.Errorf("failed to connect to Sage: %w", err))
+	}
+	defer release()
+
+	// Step 2: Create repositories and clients.
+	facturaRepo := repository.NewFacturaRepository(db, cfg.SageDB.Tables())
+	opts, err := s.bitrixOptions(cfg)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	bitrixClient, err := bitrix.NewClientValidated(cfg.Bitrix.Endpoint, s.logger, opts...)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	defer func() {
+		result.ThrottleWait = bitrixClient.ThrottleWait().String()
+		result.APIStats = bitrixClient.Stats()
+		result.addClientWarnings(bitrixClient.Warnings())
+	}()
+
+	if err := bitrixClient.TestConnection(ctx); err != nil {
+		return s.completeResult(result, bitrixError("failed to connect to Bitrix24", err))
+	}
+
+	// Step 3: Get the facturas from Sage, since the last run or for the
+	// backfill window.
+	result.progress.enter(PhaseFetchingSage)
+	state := s.loadFacturasState(cfg, bitrixClient)
+	since := s.facturasSince(cfg, state)
+	var facturas []*models.Factura
+	if code, ok := cfg.Company.SageEmpresa(); ok {
+		s.logger.Printf("📊 Fetching facturas of empresa %d since %s from Sage database...", code, since.Format("2006-01-02"))
+		facturas, err = facturaRepo.GetByDateRange(ctx, code, since, time.Time{})
+	} else {
+		s.logger.Printf("📊 Fetching facturas since %s from Sage database...", since.Format("2006-01-02"))
+		facturas, err = facturaRepo.GetSince(ctx, since)
+	}
+	if err != nil {
+		return s.completeResult(result, fmt.Errorf("failed to fetch facturas from Sage: %w", err))
+	}
+	s.logger.Printf("✅ Found %d facturas in Sage", len(facturas))
+	result.SociosProcessed = len(facturas)
+	result.progress.start(len(facturas))
+
+	// Step 4: Get the matching deals, and the companies and contacts to bind
+	// them to, from Bitrix24.
+	result.progress.enter(PhaseFetchingBitrix)
+	invoices := make([]string, len(facturas))
+	for i, factura := range facturas {
+		invoices[i] = factura.Number()
+	}
+	s.logger.Printf("📊 Fetching deals from Bitrix24...")
+	deals, err := bitrixClient.GetDealsByInvoice(ctx, invoices)
+	if err != nil {
+		return s.completeResult(result, bitrixError("failed to fetch deals from Bitrix24", err))
+	}
+	s.logger.Printf("✅ Found %d of them as deals in Bitrix24", len(deals))
+
+	var companies, contacts map[string]*bitrix.BitrixCompany
+	if cfg.Bitrix.CompanyCIFField != "" {
+		if companies, err = bitrixClient.ListCompanies(ctx); err != nil {
+			return s.completeResult(result, bitrixError("failed to fetch companies from Bitrix24", err))
+		}
+	} else {
+		s.logger.Printf("⚠️  BITRIX_COMPANY_CIF_FIELD is not set, deals will not be bound to companies")
+	}
+	if cfg.Bitrix.ContactTaxIDField != "" {
+		if contacts, err = bitrixClient.ListContacts(ctx); err != nil {
+			return s.completeResult(result, bitrixError("failed to fetch contacts from Bitrix24", err))
+		}
+	}
+
+	// Step 5: Work out what each factura needs.
+	result.progress.enter(PhaseSyncing)
+	budget := &errorBudget{maxConsecutive: cfg.Sync.MaxErrors, maxRate: cfg.Sync.MaxErrorRate}
+	var writes []crmWrite
+	unbound := 0
+	for _, factura := range facturas {
+		key := factura.Number()
+		var companyID, contactID int
+		if company, ok := companies[bitrix.NormalizeCIF(factura.CIF)]; ok {
+			companyID = company.ID
+		} else if contact, ok := contacts[bitrix.NormalizeCIF(factura.CIF)]; ok {
+			contactID = contact.ID
+		} else {
+			unbound++
+		}
+
+		deal, exists := deals[key]
+		if !exists {
+			if cfg.Sync.DryRun {
+				socioResult{outcome: outcomeCreated, reason: "not in Bitrix24"}.apply(result, key)
+				result.progress.advance(1)
+				continue
+			}
+			writes = append(writes, crmWrite{
+				key:    key,
+				label:  "factura " + key,
+				fields: bitrixClient.DealFields(factura, companyID, contactID),
+			})
+			continue
+		}
+
+		changes := bitrixClient.DealChanges(deal, factura, companyID, contactID)
+		switch {
+		case len(changes) == 0:
+			socioResult{outcome: outcomeSkipped, skip: SkipUnchanged, bitrixID: deal.ID, reason: "unchanged"}.apply(result, key)
+			result.progress.advance(1)
+		case cfg.Sync.DryRun:
+			socioResult{outcome: outcomeUpdated, bitrixID: deal.ID, changes: changes}.apply(result, key)
+			result.progress.advance(1)
+		default:
+			writes = append(writes, crmWrite{
+				key:      key,
+				label:    "factura " + key,
+				bitrixID: deal.ID,
+				changes:  changes,
+				fields:   bitrixClient.DealFields(factura, companyID, contactID),
+			})
+		}
+	}
+	if unbound > 0 {
+		s.logger.Printf("⚠️  %d facturas have no company or contact in Bitrix24 for their cliente", unbound)
+	}
+
+	// Step 6: Send the writes in batches.
+	if err := s.writeBatches(ctx, bitrixClient, bitrix.EntityDeal, writes, result, budget); err != nil {
+		return s.completeResult(result, err)
+	}
+
+	if result.Plan != nil {
+		result.Plan.sort()
+	}
+
+	// Step 7: Remember the run, unless something failed: the next run then
+	// reads from the same date again.
+	if state != nil && result.SociosFailed == 0 {
+		state.LastFull = result.StartTime
+		s.saveFacturasState(cfg, state)
+	}
+
+	// Step 8: Complete successfully.
+	result.progress.enter(PhaseDone)
+	result.Success = len(result.Errors) == 0
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime).String()
+
+	if result.DryRun {
+		s.logger.Printf("🧪 Dry run completed, counts below are planned")
+	} else if result.Success {
+		s.logger.Printf("🎉 Facturas sync completed successfully!")
+	} else {
+		s.logger.Printf("⚠️  Facturas sync completed with %d errors", len(result.Errors))
+	}
+	s.logger.Printf("   📊 Processed: %d facturas", result.SociosProcessed)
+	s.logger.Printf("   ✨ Created: %d deals", result.SociosCreated)
+	s.logger.Printf("   📝 Updated: %d deals", result.SociosUpdated)
+	s.logger.Printf("   ⏭️  Skipped: %d deals%s", result.SociosSkipped, skipBreakdown(result.SkippedByReason))
+	s.logger.Printf("   ❌ Failed: %d", result.SociosFailed)
+	s.logger.Printf("   ⏱️  Duration: %s", result.Duration)
+
+	return result, nil
+}
+
+// facturasStateKey is the state file entry of a client's facturas sync.
+func facturasStateKey(cfg *config.Config) string {
+	return cfg.Company.BitrixCode + "/" + config.EntityFacturas
+}
+
+// loadFacturasState returns the facturas sync state, whose LastFull is the
+// start of the last successful run, or nil when no state file is configured
+// or the run is a dry run.
+func (s *Service) loadFacturasState(cfg *config.Config, bitrixClient *bitrix.Client) *clientState {
+	if cfg.Sync.StatePath == "" || cfg.Sync.DryRun {
+		return nil
+	}
+
+	store := &stateStore{path: cfg.Sync.StatePath}
+	state, err := store.load(facturasStateKey(cfg), bitrixClient.PortalHost(), dealEntityTypeID)
+	if err != nil {
+		s.logger.Printf("⚠️  %v, backfilling facturas", err)
+	}
+	return state
+}
+
+// saveFacturasState writes the facturas sync state back.
+func (s *Service) saveFacturasState(cfg *config.Config, state *clientState) {
+	store := &stateStore{path: cfg.Sync.StatePath}
+	if err := store.save(facturasStateKey(cfg), state); err != nil {
+		s.logger.Printf("⚠️  %v", err)
+	}
+}
+
+// facturasSince returns the earliest invoice date to sync: the day of the
+// last successful run less the lookback, or the backfill window when there
+// is no such run or a full sync was requested.
+func (s *Service) facturasSince(cfg *config.Config, state *clientState) time.Time {
+	today := time.Now().Truncate(24 * time.Hour)
+	switch {
+	case state == nil || state.LastFull.IsZero():
+		s.logger.Printf("🔁 No facturas sync on record, backfilling %d days", cfg.Sync.FacturasBackfillDays)
+	case cfg.Sync.ForceFull:
+		s.logger.Printf("🔁 Full sync requested, backfilling %d days", cfg.Sync.FacturasBackfillDays)
+	default:
+		return state.LastFull.Truncate(24*time.Hour).AddDate(0, 0, -cfg.Sync.FacturasLookbackDays)
+	}
+	return today.AddDate(0, 0, -cfg.Sync.FacturasBackfillDays)
+}
@@ -0,0 +1,273 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// testDNI returns a valid DNI for n, so validation lets the socio through.
+func testDNI(n int) string {
+	const letters = "TRWAGMYFPDXBNJZSQVHLCKE"
+	return fmt.Sprintf("%08d%c", n, letters[n%23])
+}
+
+// testSocio returns a valid Sage socio with DNI testDNI(n).
+func testSocio(n int) *models.Socio {
+	return &models.Socio{
+		CodigoEmpresa:       1,
+		PorParticipacion:    10,
+		CargoAdministrador:  "Consejero",
+		DNI:                 testDNI(n),
+		RazonSocialEmpleado: "Socio " + strconv.Itoa(n),
+	}
+}
+
+// testConfig returns the configuration of a run against the fakes: every
+// file the sync could write is off, and all empresas are synced.
+func testConfig() *config.Config {
+	return &config.Config{
+		Company: config.CompanyMappingConfig{BitrixCode: "test", SageCode: config.AllCompanies},
+		Bitrix:  config.BitrixConfig{EntityTypeID: bitrix.EntityTypeSocios},
+		Sync: config.SyncConfig{
+			Concurrency:       1,
+			ConflictPolicy:    config.ConflictSageWins,
+			DeletionPolicy:    config.DeletionPolicyIgnore,
+			MaxDeletePercent:  100,
+			ValidationPolicy:  config.ValidationWarn,
+			FullIntervalHours: 24,
+		},
+	}
+}
+
+// testService returns a Service syncing source into target, logging nothing.
+func testService(source SocioSource, target SocioTarget) *Service {
+	return NewService(log.New(io.Discard, "", 0),
+		WithSourceFactory(func(context.Context, *config.Config, *log.Logger) (SocioSource, func() error, error) {
+			return source, func() error { return nil }, nil
+		}),
+		WithTargetFactory(func(*config.Config, *log.Logger) (SocioTarget, error) {
+			return target, nil
+		}))
+}
+
+// fakeSource is a SocioSource serving a fixed list of socios, as fresh
+// copies on every read like a database would.
+type fakeSource struct {
+	socios []*models.Socio
+
+	mu      sync.Mutex
+	updated map[string][]string // Fields written back, by DNI
+}
+
+func (f *fakeSource) copies(keep func(*models.Socio) bool) []*models.Socio {
+	var socios []*models.Socio
+	for _, socio := range f.socios {
+		if keep(socio) {
+			c := *socio
+			socios = append(socios, &c)
+		}
+	}
+	return socios
+}
+
+func (f *fakeSource) GetAll(ctx context.Context) ([]*models.Socio, error) {
+	return f.copies(func(*models.Socio) bool { return true }), nil
+}
+
+func (f *fakeSource) GetAllByEmpresa(ctx context.Context, codigoEmpresa int) ([]*models.Socio, error) {
+	return f.copies(func(s *models.Socio) bool { return s.CodigoEmpresa == codigoEmpresa }), nil
+}
+
+func (f *fakeSource) GetByDNIs(ctx context.Context, dnis []string) ([]*models.Socio, error) {
+	wanted := make(map[string]bool, len(dnis))
+	for _, dni := range dnis {
+		wanted[models.NormalizeDNI(dni)] = true
+	}
+	return f.copies(func(s *models.Socio) bool { return wanted[models.NormalizeDNI(s.DNI)] }), nil
+}
+
+func (f *fakeSource) UpdateFields(ctx context.Context, socio *models.Socio, fields []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.updated == nil {
+		f.updated = make(map[string][]string)
+	}
+	f.updated[socio.DNI] = fields
+	return nil
+}
+
+// fakeTarget is a SocioTarget keeping the Bitrix24 items in memory. The
+// comparisons are those of the embedded client, which is never asked to
+// reach the portal.
+type fakeTarget struct {
+	*bitrix.Client
+
+	// writeDelay is how long each write takes, to keep workers overlapping.
+	writeDelay time.Duration
+
+	// failWrites fails the writes of the socios with these normalized DNIs.
+	failWrites map[string]error
+
+	mu          sync.Mutex
+	items       map[int]bitrix.BitrixSocio
+	nextID      int
+	created     []string // Normalized DNIs, in call order
+	updated     []int
+	deleted     []int
+	deactivated []int
+}
+
+func newFakeTarget(t testing.TB) *fakeTarget {
+	t.Helper()
+	return &fakeTarget{
+		Client: bitrix.NewClient("https://test.bitrix24.es/rest/1/"+t.Name(), log.New(io.Discard, "", 0)),
+		items:  make(map[int]bitrix.BitrixSocio),
+		nextID: 100,
+	}
+}
+
+// bitrixItem returns the item a sync of socio would write, with ID id.
+func bitrixItem(id int, socio *models.Socio) bitrix.BitrixSocio {
+	cargo := socio.CargoAdministrador
+	if cargo == "" {
+		cargo = "No especificado"
+	}
+	admin := "N"
+	if socio.Administrador {
+		admin = "Y"
+	}
+	return bitrix.BitrixSocio{
+		ID:                  id,
+		Title:               socio.RazonSocialEmpleado,
+		EntityTypeID:        bitrix.EntityTypeSocios,
+		DNI:                 models.NormalizeDNI(socio.DNI),
+		Cargo:               cargo,
+		Administrador:       admin,
+		Participacion:       strconv.FormatFloat(socio.PorParticipacion, 'f', 2, 64),
+		RazonSocialEmpleado: socio.RazonSocialEmpleado,
+		Empresa:             socio.CodigoEmpresa,
+	}
+}
+
+// add stores an item as already in Bitrix24.
+func (f *fakeTarget) add(item bitrix.BitrixSocio) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items[item.ID] = item
+}
+
+func (f *fakeTarget) TestConnection(ctx context.Context) error { return nil }
+func (f *fakeTarget) ValidateFields(ctx context.Context) error { return nil }
+func (f *fakeTarget) ValidateStage(ctx context.Context) error  { return nil }
+
+func (f *fakeTarget) ResolveEntityType(ctx context.Context, cache *bitrix.DiscoveryCache) (int, error) {
+	return f.EntityTypeID(), nil
+}
+
+func (f *fakeTarget) ListSocios(ctx context.Context, opts ...bitrix.ListOption) ([]bitrix.BitrixSocio, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	items := make([]bitrix.BitrixSocio, 0, len(f.items))
+	for _, item := range f.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+func (f *fakeTarget) GetSocioByDNI(ctx context.Context, dni string) (*bitrix.BitrixSocio, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, item := range f.items {
+		if models.NormalizeDNI(item.DNI) == models.NormalizeDNI(dni) {
+			return &item, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeTarget) GetSocioByID(ctx context.Context, id int) (*bitrix.BitrixSocio, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item, ok := f.items[id]
+	if !ok {
+		return nil, bitrix.ErrNotFound
+	}
+	return &item, nil
+}
+
+// write waits writeDelay and returns the error set for the socio, if any.
+func (f *fakeTarget) write(ctx context.Context, dni string) error {
+	if f.writeDelay > 0 {
+		select {
+		case <-time.After(f.writeDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return f.failWrites[models.NormalizeDNI(dni)]
+}
+
+func (f *fakeTarget) CreateSocio(ctx context.Context, socio *models.Socio) (int, error) {
+	if err := f.write(ctx, socio.DNI); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	f.items[f.nextID] = bitrixItem(f.nextID, socio)
+	f.created = append(f.created, models.NormalizeDNI(socio.DNI))
+	return f.nextID, nil
+}
+
+func (f *fakeTarget) UpdateSocio(ctx context.Context, bitrixID int, socio *models.Socio) error {
+	if err := f.write(ctx, socio.DNI); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items[bitrixID] = bitrixItem(bitrixID, socio)
+	f.updated = append(f.updated, bitrixID)
+	return nil
+}
+
+func (f *fakeTarget) DeleteSocio(ctx context.Context, bitrixID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.items, bitrixID)
+	f.deleted = append(f.deleted, bitrixID)
+	return nil
+}
+
+func (f *fakeTarget) DeactivateSocio(ctx context.Context, bitrixID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item := f.items[bitrixID]
+	item.Active = "N"
+	f.items[bitrixID] = item
+	f.deactivated = append(f.deactivated, bitrixID)
+	return nil
+}
+
+func (f *fakeTarget) BatchDeleteSocios(ctx context.Context, ids []int) ([]bitrix.BatchDeleteResult, error) {
+	results := make([]bitrix.BatchDeleteResult, len(ids))
+	for i, id := range ids {
+		results[i] = bitrix.BatchDeleteResult{ID: id, Err: f.DeleteSocio(ctx, id)}
+	}
+	return results, nil
+}
+
+func (f *fakeTarget) CommentChanges(ctx context.Context, bitrixID int, changes []bitrix.FieldChange) error {
+	return nil
+}
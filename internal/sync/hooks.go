@@ -0,0 +1,218 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+)
+
+// RunInfo identifies the run a hook is called for.
+type RunInfo struct {
+	RunID    string `json:"run_id"`
+	ClientID string `json:"client_id"`
+	Entity   string `json:"entity"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+// BeforeSyncFunc is called before a run reads Sage. An error is recorded as a
+// warning and, with HooksConfig.BeforeFailureAborts, fails the run.
+type BeforeSyncFunc func(ctx context.Context, run RunInfo) error
+
+// AfterSyncFunc is called with the final result of a run, failed or not. An
+// error is recorded as a warning.
+type AfterSyncFunc func(ctx context.Context, run RunInfo, result *SyncResult) error
+
+// ItemSyncedFunc is called with the outcome of each item of a run. It is
+// called while the run's workers wait, so it should return quickly.
+type ItemSyncedFunc func(run RunInfo, item ItemResult)
+
+// WithBeforeSync registers a hook called before every run.
+func WithBeforeSync(fn BeforeSyncFunc) ServiceOption {
+	return func(s *Service) {
+		s.beforeHooks = append(s.beforeHooks, fn)
+	}
+}
+
+// WithAfterSync registers a hook called after every run.
+func WithAfterSync(fn AfterSyncFunc) ServiceOption {
+	return func(s *Service) {
+		s.afterHooks = append(s.afterHooks, fn)
+	}
+}
+
+// WithOnItemSynced registers a hook called for every item of every run.
+func WithOnItemSynced(fn ItemSyncedFunc) ServiceOption {
+	return func(s *Service) {
+		s.itemHooks = append(s.itemHooks, fn)
+	}
+}
+
+// Hook events, sent to configured hooks.
+const (
+	HookBeforeSync = "before_sync"
+	HookAfterSync  = "after_sync"
+)
+
+// hookPayload is what configured hooks receive: the JSON body of a URL
+// hook, or the standard input of a command hook.
+type hookPayload struct {
+	Event string `json:"event"`
+	RunInfo
+	Result *SyncResult `json:"result,omitempty"`
+}
+
+// runInfo returns the RunInfo of result's run.
+func runInfo(result *SyncResult) RunInfo {
+	return RunInfo{RunID: result.RunID, ClientID: result.ClientID, Entity: result.Entity, DryRun: result.DryRun}
+}
+
+// beforeSync runs the registered and configured before-sync hooks. Failures
+// are recorded as warnings; the first one is returned when
+// HooksConfig.BeforeFailureAborts is set, without running the rest.
+func (s *Service) beforeSync(ctx context.Context, cfg *config.Config, result *SyncResult) error {
+	run := runInfo(result)
+	hooks := append([]BeforeSyncFunc(nil), s.beforeHooks...)
+	for _, hook := range configuredHooks(cfg, cfg.Hooks.BeforeCommand, cfg.Hooks.BeforeURL) {
+		hooks = append(hooks, func(ctx context.Context, run RunInfo) error {
+			return hook(ctx, hookPayload{Event: HookBeforeSync, RunInfo: run})
+		})
+	}
+
+	for _, hook := range hooks {
+		err := hook(ctx, run)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("before-sync hook failed: %w", err)
+		s.logger.Printf("⚠️  %v", err)
+		result.addWarning(IssueHookFailed, "", err.Error())
+		if cfg.Hooks.BeforeFailureAborts {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterSync runs the registered and configured after-sync hooks with the
+// final result. It is deferred by each pipeline, so it also runs for failed
+// runs; failures are recorded as warnings.
+func (s *Service) afterSync(ctx context.Context, cfg *config.Config, result *SyncResult) {
+	ctx = context.WithoutCancel(ctx)
+	run := runInfo(result)
+	hooks := append([]AfterSyncFunc(nil), s.afterHooks...)
+	for _, hook := range configuredHooks(cfg, cfg.Hooks.AfterCommand, cfg.Hooks.AfterURL) {
+		hooks = append(hooks, func(ctx context.Context, run RunInfo, result *SyncResult) error {
+			return hook(ctx, hookPayload{Event: HookAfterSync, RunInfo: run, Result: result})
+		})
+	}
+
+	for _, hook := range hooks {
+		if err := hook(ctx, run, result); err != nil {
+			err = fmt.Errorf("after-sync hook failed: %w", err)
+			s.logger.Printf("⚠️  %v", err)
+			result.addWarning(IssueHookFailed, "", err.Error())
+		}
+	}
+}
+
+// itemHook returns the function calling the item hooks of result's run, or
+// nil when none is registered.
+func (s *Service) itemHook(result *SyncResult) func(ItemResult) {
+	if len(s.itemHooks) == 0 {
+		return nil
+	}
+	hooks := s.itemHooks
+	return func(item ItemResult) {
+		run := runInfo(result)
+		for _, hook := range hooks {
+			hook(run, item)
+		}
+	}
+}
+
+// configuredHooks returns the given command and URL hooks, each bounded by
+// HooksConfig.TimeoutSeconds.
+func configuredHooks(cfg *config.Config, command, url string) []func(context.Context, hookPayload) error {
+	timeout := time.Duration(cfg.Hooks.TimeoutSeconds) * time.Second
+	var hooks []func(context.Context, hookPayload) error
+	if command != "" {
+		hooks = append(hooks, func(ctx context.Context, payload hookPayload) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return runCommandHook(ctx, command, payload)
+		})
+	}
+	if url != "" {
+		hooks = append(hooks, func(ctx context.Context, payload hookPayload) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return postHook(ctx, url, payload)
+		})
+	}
+	return hooks
+}
+
+// runCommandHook runs a command hook. The command line is split on spaces
+// and run without a shell; the payload is passed as JSON on standard input
+// and the run as SYNC_* environment variables.
+func runCommandHook(ctx context.Context, command string, payload hookPayload) error {
+	args := strings.Fields(command)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode hook payload: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"SYNC_EVENT="+payload.Event,
+		"SYNC_RUN_ID="+payload.RunID,
+		"SYNC_CLIENT_ID="+payload.ClientID,
+		"SYNC_ENTITY="+payload.Entity,
+		"SYNC_DRY_RUN="+strconv.FormatBool(payload.DryRun),
+	)
+	if payload.Result != nil {
+		cmd.Env = append(cmd.Env, "SYNC_SUCCESS="+strconv.FormatBool(payload.Result.Success))
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s: %w: %s", args[0], err, msg)
+		}
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	return nil
+}
+
+// postHook POSTs the payload as JSON to a URL hook, which must answer 2xx.
+func postHook(ctx context.Context, url string, payload hookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode hook payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create hook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s answered %s: %s", url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// loadState returns the client's incremental sync state, or nil when no
+// state file is configured or the run is a dry run.
+func (s *Service) loadState(cfg *config.Config, bitrixClient SocioTarget) *clientState {
+	if cfg.Sync.DryRun {
+		return nil
+	}
+	return s.readState(cfg, bitrixClient)
+}
+
+// readState loads the client's state regardless of the dry run setting, or
+// returns nil when no state file is configured.
+func (s *Service) readState(cfg *config.Config, bitrixClient SocioTarget) *clientState {
+	if cfg.Sync.StatePath == "" {
+		return nil
+	}
+
+	store := &stateStore{path: cfg.Sync.StatePath}
+	state, err := store.load(cfg.Company.BitrixCode, bitrixClient.PortalHost(), bitrixClient.EntityTypeID())
+	if err != nil {
+		s.logger.Printf("⚠️  %v, starting from an empty state", err)
+	}
+	if len(cfg.Sync.WriteBackFields) > 0 {
+		state.fieldValues = bitrixClient.ExpectedFieldValues
+	}
+	return state
+}
+
+// saveState writes the client's state back; failing to do so only costs
+// the next run its shortcut.
+func (s *Service) saveState(cfg *config.Config, state *clientState) {
+	store := &stateStore{path: cfg.Sync.StatePath}
+	if err := store.save(cfg.Company.BitrixCode, state); err != nil {
+		s.logger.Printf("⚠️  %v", err)
+	}
+}
+
+// useIncremental reports whether this run may skip the full reconciliation:
+// there is state with a recent enough full sync and no full run was requested.
+func (s *Service) useIncremental(cfg *config.Config, state *clientState) bool {
+	switch {
+	case state == nil:
+		return false
+	case cfg.Sync.ForceFull:
+		s.logger.Printf("🔁 Full sync requested")
+		return false
+	case state.LastFull.IsZero():
+		s.logger.Printf("🔁 No full sync on record, running one")
+		return false
+	case time.Since(state.LastFull) >= time.Duration(cfg.Sync.FullIntervalHours)*time.Hour:
+		s.logger.Printf("🔁 Last full sync was %s ago, running one", time.Since(state.LastFull).Round(time.Minute))
+		return false
+	}
+	return true
+}
+
+// modifiedOverlap is how long before the cursor changes are fetched again,
+// covering clock differences between this host and whatever stamps the Sage
+// rows. Socios fetched twice are skipped by their hash.
+const modifiedOverlap = 15 * time.Minute
+
+// modificationTracking returns the source as a ModifiedSource when it is
+// one and the Sage schema stamps modifications, or nil, in which case every
+// run reads all the socios.
+func (s *Service) modificationTracking(ctx context.Context, source SocioSource) ModifiedSource {
+	modified, ok := source.(ModifiedSource)
+	if !ok {
+		return nil
+	}
+	tracked, err := modified.TracksModifications(ctx)
+	if err != nil {
+		s.logger.Printf("⚠️  %v, reading all socios", err)
+		return nil
+	}
+	if !tracked {
+		return nil
+	}
+	return modified
+}
+
+// fetchModified fetches the socios changed since the cursor, in the mapped
+// empresa if there is one.
+func (s *Service) fetchModified(ctx context.Context, cfg *config.Config, modified ModifiedSource, cursor time.Time) ([]*models.Socio, error) {
+	since := cursor.Add(-modifiedOverlap)
+	s.logger.Printf("📊 Fetching socios changed since %s from Sage database...", since.Format(time.RFC3339))
+	socios, err := modified.GetModifiedSince(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	code, ok := cfg.Company.SageEmpresa()
+	if !ok {
+		return socios, nil
+	}
+	inEmpresa := socios[:0]
+	for _, socio := range socios {
+		if socio.CodigoEmpresa == code {
+			inEmpresa = append(inEmpresa, socio)
+		}
+	}
+	return inEmpresa, nil
+}
+
+// syncIncremental syncs only the socios whose Sage values changed since they
+// were last synced, looking each one up in Bitrix24 instead of listing the
+// whole portal. Duplicates and socios removed from Sage are left to the next
+// full sync.
+func (s *Service) syncIncremental(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, sageSocios []*models.Socio, state *clientState, result *SyncResult) error {
+	sageSocios = result.withoutExcluded(sageSocios)
+	var changed []*models.Socio
+	for _, socio := range sageSocios {
+		if socio.DNI != "" && state.unchanged(socio.DNI, socio.ContentHash()) {
+			result.skip(SkipUnchanged, 1)
+			synced, _ := state.lookup(socio.DNI)
+			result.addDetail(ItemResult{DNI: socio.DNI, Action: ItemSkipped, BitrixID: synced.BitrixID})
+			continue
+		}
+		changed = append(changed, socio)
+	}
+	s.logger.Printf("⚡ Incremental sync: %d of %d socios changed since the last run", len(changed), len(sageSocios))
+	result.progress.advance(len(sageSocios) - len(changed))
+	return s.syncByLookup(ctx, cfg, bitrixClient, changed, state, result)
+}
+
+// syncByLookup syncs the given socios, looking each one up in Bitrix24.
+func (s *Service) syncByLookup(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, sageSocios []*models.Socio, state *clientState, result *SyncResult) error {
+	result.progress.enter(PhaseFetchingBitrix)
+
+	bitrixMap := make(map[string]*bitrix.BitrixSocio)
+	toSync := make([]*models.Socio, 0, len(sageSocios))
+	failed := 0
+	for _, socio := range sageSocios {
+		if dni := models.NormalizeDNI(socio.DNI); dni != "" {
+			item, err := s.lookupSocio(ctx, bitrixClient, socio.DNI, state)
+			if IsTransient(err) {
+				return bitrixError("", err)
+			}
+			if err != nil {
+				errorMsg := fmt.Sprintf("Failed to look up socio %s: %v", socio.DNI, err)
+				s.logger.Printf("❌ %s", errorMsg)
+				result.addError(IssueItemFailed, socio.DNI, errorMsg)
+				result.addDetail(ItemResult{DNI: socio.DNI, Action: ItemFailed, Error: err.Error()})
+				failed++
+				continue
+			}
+			if item != nil {
+				bitrixMap[dni] = item
+			}
+		}
+		toSync = append(toSync, socio)
+	}
+
+	if err := bitrixClient.ResolveCompanies(ctx, toSync); err != nil {
+		return bitrixError("failed to resolve Bitrix24 companies", err)
+	}
+
+	result.progress.enter(PhaseSyncing)
+	result.progress.advance(failed)
+	return s.processSocios(ctx, cfg, bitrixClient, toSync, bitrixMap, state, result)
+}
+
+// lookupSocio finds the Bitrix item of a socio, by the ID remembered in the
+// state if it still holds that DNI, else by DNI. A stale mapping is dropped
+// from the state; syncing the socio records the right one. A missing item
+// is nil.
+func (s *Service) lookupSocio(ctx context.Context, bitrixClient SocioTarget, dni string, state *clientState) (*bitrix.BitrixSocio, error) {
+	if synced, _ := state.lookup(dni); synced.BitrixID > 0 {
+		item, err := bitrixClient.GetSocioByID(ctx, synced.BitrixID)
+		if err == nil && models.NormalizeDNI(item.DNI) == models.NormalizeDNI(dni) && bitrixClient.OwnsSocio(item) {
+			return item, nil
+		}
+		if err != nil && !errors.Is(err, bitrix.ErrNotFound) {
+			return nil, err
+		}
+		s.logger.Printf("🩹 Item %d no longer holds socio %s, looking it up by DNI", synced.BitrixID, dni)
+		state.forget(dni)
+	}
+
+	item, err := bitrixClient.GetSocioByDNI(ctx, dni)
+	if errors.Is(err, bitrix.ErrNotFound) {
+		return nil, nil
+	}
+	return item, err
+}
@@ -0,0 +1,67 @@
+package sync
+
+import (
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+)
+
+// Severities of an Issue.
+const (
+	SeverityWarning = "warning" // Worth a look; the run still succeeds
+	SeverityError   = "error"   // Something failed; the run does not succeed
+)
+
+// Codes of the issues a run records, besides the bitrix.Warn* codes of the
+// warnings of its Bitrix24 client.
+const (
+	IssueRunFailed       = "run_failed"       // The run stopped early
+	IssueRunTimeout      = "run_timeout"      // The run exceeded its maximum duration
+	IssueItemFailed      = "item_failed"      // An item could not be synced, deactivated or deleted
+	IssueNotFound        = "not_found"        // Requested with WithDNIs, but not in Sage
+	IssueInvalidData     = "invalid_data"     // Sage socios failed validation
+	IssueNullData        = "null_data"        // Sage socios had NULL columns, read as empty
+	IssueDuplicateSage   = "duplicate_sage"   // DNI repeated in a Sage empresa
+	IssueDuplicateBitrix = "duplicate_bitrix" // DNI shared by several Bitrix24 items
+	IssueHookFailed      = "hook_failed"      // A before- or after-sync hook failed
+	IssueDatabaseFailed  = "database_failed"  // A Sage database of a multi-company client was left out
+)
+
+// Issue is a problem a run met. Errors make the run unsuccessful; warnings
+// are reported but allowed.
+type Issue struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	DNI      string `json:"dni,omitempty"` // Or the key of the item, for other entities
+	Message  string `json:"message"`
+}
+
+func (i Issue) String() string {
+	return i.Message
+}
+
+// addError records an error of the run.
+func (r *SyncResult) addError(code, dni, msg string) {
+	r.Errors = append(r.Errors, Issue{Severity: SeverityError, Code: code, DNI: dni, Message: msg})
+}
+
+// addWarning records a warning of the run.
+func (r *SyncResult) addWarning(code, dni, msg string) {
+	r.Warnings = append(r.Warnings, Issue{Severity: SeverityWarning, Code: code, DNI: dni, Message: msg})
+}
+
+// addClientWarnings records the warnings of the run's Bitrix24 client.
+func (r *SyncResult) addClientWarnings(warnings []bitrix.Warning) {
+	for _, w := range warnings {
+		r.addWarning(w.Code, w.DNI, w.Message)
+	}
+}
+
+// Aborted reports whether the run stopped early, as opposed to finishing
+// with failed items.
+func (r *SyncResult) Aborted() bool {
+	for _, issue := range r.Errors {
+		if issue.Code == IssueRunFailed || issue.Code == IssueRunTimeout {
+			return true
+		}
+	}
+	return false
+}
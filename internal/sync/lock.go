@@ -0,0 +1,173 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+)
+
+// ErrSyncRunning is returned when another process holds the sync lock of the
+// client.
+var ErrSyncRunning = errors.New("sync already running")
+
+// lockInfo is the content of a lock file.
+type lockInfo struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	RunID     string    `json:"run_id"`
+	Since     time.Time `json:"since"`
+	Heartbeat time.Time `json:"heartbeat"`
+}
+
+// clientLock is an advisory lock file held while a client syncs, so a
+// manual run and a scheduled one cannot write the same socios at once. Its
+// heartbeat is refreshed while held; a lock whose heartbeat is older than
+// SyncConfig.LockStaleMinutes was left by a dead process and is taken over.
+// A nil clientLock holds nothing.
+type clientLock struct {
+	path   string
+	info   lockInfo
+	stop   chan struct{}
+	done   sync.WaitGroup
+	logger *log.Logger
+}
+
+// acquireLock takes the lock of the client from SyncConfig.LockPath, failing
+// with ErrSyncRunning while another process holds it. An empty LockPath
+// disables locking.
+func acquireLock(cfg *config.Config, runID string, logger *log.Logger) (*clientLock, error) {
+	if cfg.Sync.LockPath == "" {
+		return nil, nil
+	}
+	path := strings.ReplaceAll(cfg.Sync.LockPath, "{client}", safePathPart(cfg.Company.BitrixCode))
+	staleAfter := time.Duration(cfg.Sync.LockStaleMinutes) * time.Minute
+
+	host, _ := os.Hostname()
+	now := time.Now()
+	lock := &clientLock{
+		path:   path,
+		info:   lockInfo{PID: os.Getpid(), Host: host, RunID: runID, Since: now, Heartbeat: now},
+		stop:   make(chan struct{}),
+		logger: logger,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := lock.create()
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		held, err := readLock(path)
+		if err != nil {
+			return nil, err
+		}
+		if held == nil {
+			continue // Released meanwhile
+		}
+		if time.Since(held.Heartbeat) < staleAfter || attempt > 0 {
+			return nil, fmt.Errorf("%w by PID %d on %s since %s (run %s)",
+				ErrSyncRunning, held.PID, held.Host, held.Since.Format(time.RFC3339), held.RunID)
+		}
+		logger.Printf("🔓 Taking over stale lock of PID %d on %s (last heartbeat %s)",
+			held.PID, held.Host, held.Heartbeat.Format(time.RFC3339))
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale lock: %w", err)
+		}
+	}
+
+	lock.done.Add(1)
+	go lock.heartbeat(max(staleAfter/3, time.Second))
+	logger.Printf("🔒 Holding sync lock %s", path)
+	return lock, nil
+}
+
+// create writes the lock file, failing with os.ErrExist if it is there.
+func (l *clientLock) create() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(file).Encode(l.info)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(l.path)
+	}
+	return err
+}
+
+// readLock returns the content of a lock file, or nil if there is none.
+func readLock(path string) (*lockInfo, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	var info lockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		// A lock being written or left half-written: only its age tells.
+		stat, statErr := os.Stat(path)
+		if statErr != nil {
+			return nil, nil
+		}
+		info.Since, info.Heartbeat = stat.ModTime(), stat.ModTime()
+	}
+	return &info, nil
+}
+
+// heartbeat refreshes the lock file every interval until released.
+func (l *clientLock) heartbeat(interval time.Duration) {
+	defer l.done.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			l.info.Heartbeat = now
+			data, err := json.Marshal(l.info)
+			if err == nil {
+				err = os.WriteFile(l.path, append(data, '\n'), 0o644)
+			}
+			if err != nil {
+				l.logger.Printf("⚠️  Failed to refresh sync lock: %v", err)
+			}
+		}
+	}
+}
+
+// release stops the heartbeat and removes the lock file, unless another
+// process took it over meanwhile.
+func (l *clientLock) release() {
+	if l == nil {
+		return
+	}
+	close(l.stop)
+	l.done.Wait()
+
+	held, err := readLock(l.path)
+	if err != nil || held == nil || held.PID != l.info.PID || held.RunID != l.info.RunID {
+		return
+	}
+	if err := os.Remove(l.path); err != nil {
+		l.logger.Printf("⚠️  Failed to remove sync lock: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// MappingReport is the outcome of RebuildMapping.
+type MappingReport struct {
+	ClientID   string `json:"client_id"`
+	Listed     int    `json:"listed"`     // Bitrix24 socios of the client
+	Kept       int    `json:"kept"`       // Mappings that were right
+	Added      int    `json:"added"`      // Items with no mapping yet
+	Repaired   int    `json:"repaired"`   // Mappings pointing at the wrong item
+	Removed    int    `json:"removed"`    // Mappings whose item is gone
+	Duplicates int    `json:"duplicates"` // DNIs on several items, mapped to the newest
+}
+
+// RebuildMapping lists the client's Bitrix24 socios and makes the DNI →
+// item ID mapping of the incremental state match them, without touching
+// Sage or Bitrix24. Items added or repaired have no synced hash, so the next
+// run compares them once by ID; the time of the last full sync is kept, as
+// nothing was reconciled.
+func (s *Service) RebuildMapping(ctx context.Context, cfg *config.Config) (*MappingReport, error) {
+	if cfg.Sync.StatePath == "" {
+		return nil, errors.New("rebuilding the mapping needs SYNC_STATE_PATH")
+	}
+	report := &MappingReport{ClientID: cfg.Company.BitrixCode}
+	s.logger.Printf("🗺️  Rebuilding the DNI mapping of client %s", report.ClientID)
+
+	bitrixClient, err := s.newTarget(cfg, s.logger)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Bitrix.EntityTypeID == 0 {
+		cache := bitrix.NewDiscoveryCache(cfg.Bitrix.DiscoveryCachePath)
+		if _, err := bitrixClient.ResolveEntityType(ctx, cache); err != nil {
+			s.logger.Printf("⚠️  %v, using entity type %d", err, bitrixClient.EntityTypeID())
+		}
+	}
+	if err := bitrixClient.TestConnection(ctx); err != nil {
+		return nil, bitrixError("failed to connect to Bitrix24", err)
+	}
+
+	listCtx, cancel := phaseContext(ctx, DefaultTimeouts.BitrixList)
+	items, err := s.listBitrixSocios(listCtx, cfg, bitrixClient)
+	err = phaseError(listCtx, ctx, "Bitrix24 listing", DefaultTimeouts.BitrixList, err)
+	cancel()
+	if err != nil {
+		return nil, bitrixError("failed to fetch socios from Bitrix24", err)
+	}
+
+	// Map each DNI to its item, the newest one for duplicates.
+	owned := items[:0]
+	for _, item := range items {
+		if bitrixClient.OwnsSocio(&item) {
+			owned = append(owned, item)
+		}
+	}
+	report.Listed = len(owned)
+	ids := make(map[string]int, len(owned))
+	for _, item := range owned {
+		if dni := models.NormalizeDNI(item.DNI); dni != "" {
+			ids[dni] = item.ID
+		}
+	}
+	for dni, group := range bitrix.FindDuplicates(owned) {
+		ids[dni] = group[0].ID
+		report.Duplicates++
+	}
+
+	state := s.readState(cfg, bitrixClient)
+	for dni, synced := range state.Items {
+		id, ok := ids[dni]
+		switch {
+		case !ok:
+			delete(state.Items, dni)
+			report.Removed++
+		case synced.BitrixID != id:
+			state.Items[dni] = stateItem{BitrixID: id}
+			report.Repaired++
+		default:
+			report.Kept++
+		}
+	}
+	for dni, id := range ids {
+		if _, ok := state.Items[dni]; !ok {
+			state.Items[dni] = stateItem{BitrixID: id}
+			report.Added++
+		}
+	}
+
+	store := &stateStore{path: cfg.Sync.StatePath}
+	if err := store.save(cfg.Company.BitrixCode, state); err != nil {
+		return report, fmt.Errorf("failed to save the mapping: %w", err)
+	}
+	s.logger.Printf("✅ Mapping rebuilt from %d Bitrix24 socios: %d kept, %d added, %d repaired, %d removed",
+		report.Listed, report.Kept, report.Added, report.Repaired, report.Removed)
+	return report, nil
+}
@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"time"
+)
+
+// RunMetrics is what a MetricsRecorder learns about a finished run.
+type RunMetrics struct {
+	ClientID string
+	Entity   string // One of config.SyncEntities
+	Finished time.Time
+	Duration time.Duration
+	Success  bool
+
+	Created int
+	Updated int
+	Skipped int
+	Failed  int
+
+	APIRequests  int64 // Bitrix24 REST calls, including retries
+	ThrottleWait time.Duration
+
+	SageQueries   int64 // Sage query attempts, including retries
+	SageQueryTime time.Duration
+}
+
+// MetricsRecorder receives the metrics of every run that writes to
+// Bitrix24; dry runs are not recorded. Runs of several clients may finish
+// at once, so implementations must be safe for concurrent use. See
+// metrics.Prometheus.
+type MetricsRecorder interface {
+	RecordRun(run RunMetrics)
+}
+
+// WithMetrics reports the metrics of every run to r.
+func WithMetrics(r MetricsRecorder) ServiceOption {
+	return func(s *Service) {
+		s.metrics = r
+	}
+}
+
+// recordMetrics reports a finished run to the service's MetricsRecorder.
+func (s *Service) recordMetrics(result *SyncResult) {
+	if s.metrics == nil || result.DryRun {
+		return
+	}
+	throttled, _ := time.ParseDuration(result.ThrottleWait)
+	var sageQueries int64
+	var sageQueryTime time.Duration
+	if result.SageStats != nil {
+		sageQueries = result.SageStats.Queries
+		sageQueryTime, _ = time.ParseDuration(result.SageStats.Duration)
+	}
+	s.metrics.RecordRun(RunMetrics{
+		ClientID:     result.ClientID,
+		Entity:       result.Entity,
+		Finished:     result.EndTime,
+		Duration:     result.EndTime.Sub(result.StartTime),
+		Success:      result.Success,
+		Created:      result.SociosCreated,
+		Updated:      result.SociosUpdated,
+		Skipped:      result.SociosSkipped,
+		Failed:       result.SociosFailed,
+		APIRequests:  result.APIStats.Requests,
+		ThrottleWait: throttled,
+
+		SageQueries:   sageQueries,
+		SageQueryTime: sageQueryTime,
+	})
+}
@@ -0,0 +1,249 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+	"github.com/arduriki/sage-bitrix-sync/internal/repository"
+)
+
+// DatabaseResult is the outcome of one Sage database of a multi-company
+// installation in a socios run.
+type DatabaseResult struct {
+	Name   string `json:"name"`
+	Socios int    `json:"socios"`          // Rows read, before collapsing
+	Error  string `json:"error,omitempty"` // Why its socios were left out
+}
+
+// multiSource is the SocioSource of a client with a Sage database per
+// company: it reads every database, tagging each socio with the one it came
+// from, and writes back to that database. A database that fails is left out
+// of the run and reported, so the others are still synced.
+type multiSource struct {
+	databases []*sageDatabase
+	logger    *log.Logger
+}
+
+// sageDatabase is one database of a multiSource; source is nil when it
+// could not be connected to.
+type sageDatabase struct {
+	source  SocioSource
+	release func() error
+	result  DatabaseResult
+}
+
+// openMultiSource connects to each database configured in cfg.SageDB. The
+// driver logs in to one database per connection, so each gets its own pool
+// from the service's SageConnector; a SageCache keeps them across runs. A
+// database that cannot be connected to is reported and skipped; only when
+// none can does opening fail.
+func (s *Service) openMultiSource(ctx context.Context, cfg *config.Config, logger *log.Logger) (SocioSource, func() error, error) {
+	names, err := s.sageDatabases(ctx, cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := &multiSource{logger: logger}
+	for _, name := range names {
+		database := &sageDatabase{result: DatabaseResult{Name: name}}
+		m.databases = append(m.databases, database)
+
+		dbCfg := cfg.ForDatabase(name)
+		db, release, err := s.sage.Connect(ctx, dbCfg, logger)
+		if err != nil {
+			logger.Printf("⚠️  Sage database %s unavailable: %v", name, err)
+			database.result.Error = err.Error()
+			continue
+		}
+		database.source, database.release = newSocioRepository(dbCfg, db, logger), release
+	}
+
+	if len(m.failed()) == len(names) {
+		m.release()
+		return nil, nil, fmt.Errorf("no Sage database could be connected to: %s", m.databases[0].result.Error)
+	}
+	return m, m.release, nil
+}
+
+// sageDatabases returns the databases configured in cfg.SageDB, looking
+// the pattern up in the server's database list when one is set.
+func (s *Service) sageDatabases(ctx context.Context, cfg *config.Config, logger *log.Logger) ([]string, error) {
+	if cfg.SageDB.DatabasePattern == "" {
+		return cfg.SageDB.Databases, nil
+	}
+
+	db, release, err := s.sage.Connect(ctx, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	names, err := newSocioRepository(cfg, db, logger).DatabasesLike(ctx, cfg.SageDB.DatabasePattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no Sage database matches %q", cfg.SageDB.DatabasePattern)
+	}
+	logger.Printf("🗄️  Syncing %d Sage databases matching %q: %s", len(names), cfg.SageDB.DatabasePattern, strings.Join(names, ", "))
+	return names, nil
+}
+
+func (m *multiSource) GetAll(ctx context.Context) ([]*models.Socio, error) {
+	return m.each(ctx, func(source SocioSource) ([]*models.Socio, error) {
+		return source.GetAll(ctx)
+	})
+}
+
+func (m *multiSource) GetAllByEmpresa(ctx context.Context, codigoEmpresa int) ([]*models.Socio, error) {
+	return m.each(ctx, func(source SocioSource) ([]*models.Socio, error) {
+		return source.GetAllByEmpresa(ctx, codigoEmpresa)
+	})
+}
+
+func (m *multiSource) GetByDNIs(ctx context.Context, dnis []string) ([]*models.Socio, error) {
+	return m.each(ctx, func(source SocioSource) ([]*models.Socio, error) {
+		return source.GetByDNIs(ctx, dnis)
+	})
+}
+
+// UpdateFields writes to the database the socio was read from.
+func (m *multiSource) UpdateFields(ctx context.Context, socio *models.Socio, fields []string) error {
+	for _, database := range m.databases {
+		if database.result.Name == socio.Database && database.source != nil {
+			return database.source.UpdateFields(ctx, socio, fields)
+		}
+	}
+	return fmt.Errorf("socio %s has no Sage database to write to (%q)", socio.DNI, socio.Database)
+}
+
+func (m *multiSource) GetAllDNIs(ctx context.Context) ([]string, error) {
+	return m.dnis(func(source DNISource) ([]string, error) {
+		return source.GetAllDNIs(ctx)
+	})
+}
+
+func (m *multiSource) GetDNIsByEmpresa(ctx context.Context, codigoEmpresa int) ([]string, error) {
+	return m.dnis(func(source DNISource) ([]string, error) {
+		return source.GetDNIsByEmpresa(ctx, codigoEmpresa)
+	})
+}
+
+// dnis joins the DNIs of the databases that have not failed. Unlike each,
+// it fails when any of them does: a missing database would make its socios
+// look removed.
+func (m *multiSource) dnis(fetch func(DNISource) ([]string, error)) ([]string, error) {
+	var all []string
+	for _, database := range m.databases {
+		if database.source == nil || database.result.Error != "" {
+			continue
+		}
+		source, ok := database.source.(DNISource)
+		if !ok {
+			return nil, fmt.Errorf("Sage database %s cannot list DNIs", database.result.Name)
+		}
+		dnis, err := fetch(source)
+		if err != nil {
+			return nil, fmt.Errorf("Sage database %s: %w", database.result.Name, err)
+		}
+		all = append(all, dnis...)
+	}
+	return all, nil
+}
+
+// QueryStats adds up the query counters of the databases.
+func (m *multiSource) QueryStats() repository.QueryStats {
+	var total repository.QueryStats
+	for _, database := range m.databases {
+		if counter, ok := database.source.(QueryCounter); ok {
+			total = total.Add(counter.QueryStats())
+		}
+	}
+	return total
+}
+
+// each runs fetch on every database that has not failed yet, tagging and
+// joining their socios. A database failing is recorded and skipped, unless
+// ctx is done or every database failed.
+func (m *multiSource) each(ctx context.Context, fetch func(SocioSource) ([]*models.Socio, error)) ([]*models.Socio, error) {
+	var all []*models.Socio
+	var lastErr error
+	for _, database := range m.databases {
+		if database.source == nil || database.result.Error != "" {
+			continue
+		}
+		socios, err := fetch(database.source)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			m.logger.Printf("⚠️  Sage database %s failed, syncing the others: %v", database.result.Name, err)
+			database.result.Error = err.Error()
+			lastErr = err
+			continue
+		}
+		for _, socio := range socios {
+			socio.Database = database.result.Name
+		}
+		database.result.Socios += len(socios)
+		all = append(all, socios...)
+	}
+
+	if len(m.failed()) == len(m.databases) {
+		if lastErr == nil {
+			lastErr = errors.New("every Sage database failed")
+		}
+		return nil, lastErr
+	}
+	return all, nil
+}
+
+// failed returns the names of the databases left out of the run.
+func (m *multiSource) failed() []string {
+	var names []string
+	for _, database := range m.databases {
+		if database.result.Error != "" {
+			names = append(names, database.result.Name)
+		}
+	}
+	return names
+}
+
+// release releases the connection of every database.
+func (m *multiSource) release() error {
+	var errs []error
+	for _, database := range m.databases {
+		if database.release != nil {
+			errs = append(errs, database.release())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reportDatabases records the outcome of each Sage database of a
+// multi-company source in result, each failed one as an error.
+func (s *Service) reportDatabases(source SocioSource, result *SyncResult) {
+	m, ok := source.(*multiSource)
+	if !ok {
+		return
+	}
+	for _, database := range m.databases {
+		result.Databases = append(result.Databases, database.result)
+		if database.result.Error != "" {
+			result.addError(IssueDatabaseFailed, "", fmt.Sprintf("Sage database %s: %s", database.result.Name, database.result.Error))
+		}
+	}
+}
+
+// failedDatabases returns the Sage databases of source left out of the run,
+// whose socios are missing from it without having left Sage.
+func failedDatabases(source SocioSource) []string {
+	if m, ok := source.(*multiSource); ok {
+		return m.failed()
+	}
+	return nil
+}
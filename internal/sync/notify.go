@@ -0,0 +1,73 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/notify"
+)
+
+// maxErrorLength cuts the errors and warnings listed in a summary email.
+const maxErrorLength = 300
+
+// notifyRun emails the summary of a finished run when NotifyConfig is set.
+// Sending is best effort: it is bounded by NotifyConfig.TimeoutSeconds, even
+// when ctx was cancelled, and a failure is only logged.
+func (s *Service) notifyRun(ctx context.Context, cfg *config.Config, result *SyncResult) {
+	if !cfg.Notify.Enabled() {
+		return
+	}
+	summary := runSummary(result)
+	if cfg.Notify.Mode == config.NotifyOnFailure && !summary.HasFailures() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Duration(cfg.Notify.TimeoutSeconds)*time.Second)
+	defer cancel()
+	if err := notify.Send(ctx, cfg.Notify, summary); err != nil {
+		s.logger.Printf("⚠️  Failed to email the run summary: %v", err)
+		return
+	}
+	s.logger.Printf("📧 Run summary emailed to %d recipients", len(cfg.Notify.To))
+}
+
+// runSummary builds the summary email of a run.
+func runSummary(result *SyncResult) notify.Summary {
+	summary := notify.Summary{
+		ClientID:    result.ClientID,
+		Entity:      result.Entity,
+		RunID:       result.RunID,
+		StartTime:   result.StartTime,
+		Duration:    result.Duration,
+		Success:     result.Success,
+		TimedOut:    result.TimedOut,
+		DryRun:      result.DryRun,
+		Created:     result.SociosCreated,
+		Updated:     result.SociosUpdated,
+		Skipped:     result.SociosSkipped,
+		Failed:      result.SociosFailed,
+		TotalErrors: len(result.Errors),
+		Aborted:     result.Aborted(),
+
+		TotalWarnings: len(result.Warnings),
+	}
+	summary.Errors = issueMessages(result.Errors)
+	summary.Warnings = issueMessages(result.Warnings)
+	return summary
+}
+
+// issueMessages returns the messages of the first notify.MaxErrors issues,
+// shortened to maxErrorLength.
+func issueMessages(issues []Issue) []string {
+	var messages []string
+	for _, issue := range issues[:min(len(issues), notify.MaxErrors)] {
+		msg := issue.Message
+		if len(msg) > maxErrorLength {
+			msg = strings.ToValidUTF8(msg[:maxErrorLength], "") + "…"
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
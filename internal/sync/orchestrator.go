@@ -0,0 +1,246 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+)
+
+// entityDependencies lists, for each entity, the entities that must have
+// synced before it: clientes and socios link to the companies the empresas
+// sync creates, and facturas bind to the clientes' companies.
+var entityDependencies = map[string][]string{
+	config.EntityClientes: {config.EntityEmpresas},
+	config.EntityFacturas: {config.EntityClientes},
+	config.EntitySocios:   {config.EntityEmpresas},
+}
+
+// entityOrder breaks ties between entities ready to run at the same time.
+var entityOrder = []string{
+	config.EntityEmpresas,
+	config.EntityClientes,
+	config.EntityArticulos,
+	config.EntityFacturas,
+	config.EntitySocios,
+}
+
+// entityRunners are the pipelines of each entity.
+var entityRunners = map[string]func(*Service, context.Context, *config.Config, ...SyncOption) (*SyncResult, error){
+	config.EntityEmpresas:  (*Service).SyncEmpresas,
+	config.EntityClientes:  (*Service).SyncClientes,
+	config.EntityArticulos: (*Service).SyncArticulos,
+	config.EntityFacturas:  (*Service).SyncFacturas,
+	config.EntitySocios:    (*Service).SyncSocios,
+}
+
+// EntityRun is the outcome of one entity in Orchestrate.
+type EntityRun struct {
+	Entity  string      `json:"entity"`
+	Outcome string      `json:"outcome"` // One of the Outcome* constants
+	Result  *SyncResult `json:"result,omitempty"`
+	Error   string      `json:"error,omitempty"`
+
+	err error
+}
+
+// MultiEntityResult is the combined result of the entities of one client.
+type MultiEntityResult struct {
+	ClientID  string      `json:"client_id"`
+	StartTime time.Time   `json:"start_time"`
+	EndTime   time.Time   `json:"end_time"`
+	Duration  string      `json:"duration"`
+	Outcome   string      `json:"outcome"`  // Worst entity outcome
+	Entities  []EntityRun `json:"entities"` // In the order they were started
+}
+
+// Results returns the results of the entities that ran.
+func (r *MultiEntityResult) Results() []*SyncResult {
+	var results []*SyncResult
+	for _, run := range r.Entities {
+		if run.Result != nil {
+			results = append(results, run.Result)
+		}
+	}
+	return results
+}
+
+// Err joins the errors of the failed entities.
+func (r *MultiEntityResult) Err() error {
+	var errs []error
+	for _, run := range r.Entities {
+		if run.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", run.Entity, run.err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// orderEntities sorts the enabled entities so each one comes after the
+// enabled entities it depends on. Dependencies on entities that are not
+// enabled are ignored.
+func orderEntities(enabled []string) ([]string, error) {
+	wanted := make(map[string]bool, len(enabled))
+	for _, entity := range enabled {
+		if _, ok := entityRunners[entity]; !ok {
+			return nil, fmt.Errorf("unknown entity %q", entity)
+		}
+		wanted[entity] = true
+	}
+
+	ordered := make([]string, 0, len(wanted))
+	placed := make(map[string]bool, len(wanted))
+	for len(ordered) < len(wanted) {
+		progress := false
+		for _, entity := range entityOrder {
+			if !wanted[entity] || placed[entity] {
+				continue
+			}
+			ready := true
+			for _, dep := range entityDependencies[entity] {
+				if wanted[dep] && !placed[dep] {
+					ready = false
+				}
+			}
+			if ready {
+				ordered = append(ordered, entity)
+				placed[entity] = true
+				progress = true
+			}
+		}
+		if !progress {
+			return nil, fmt.Errorf("dependency cycle among entities %v", enabled)
+		}
+	}
+	return ordered, nil
+}
+
+// SyncEntities runs Orchestrate and returns the results of the entities that
+// ran, with the errors of the failed ones.
+func (s *Service) SyncEntities(ctx context.Context, cfg *config.Config, syncOpts ...SyncOption) ([]*SyncResult, error) {
+	multi, err := s.Orchestrate(ctx, cfg, syncOpts...)
+	if multi == nil {
+		return nil, err
+	}
+	return multi.Results(), err
+}
+
+// Orchestrate syncs every entity in cfg.Sync.Entities after the entities it
+// depends on. They run one after another, or with SyncConfig.ParallelEntities
+// each as soon as its dependencies are done, sharing the client's Bitrix24
+// rate limit. An entity whose dependency failed or was skipped is skipped.
+// The entities share one Sage connection. The result is returned even when
+// entities failed, with their errors joined.
+func (s *Service) Orchestrate(ctx context.Context, cfg *config.Config, syncOpts ...SyncOption) (*MultiEntityResult, error) {
+	order, err := orderEntities(cfg.Sync.Entities)
+	if err != nil {
+		return nil, err
+	}
+	multi := &MultiEntityResult{
+		ClientID:  cfg.Company.BitrixCode,
+		StartTime: time.Now(),
+		Entities:  make([]EntityRun, len(order)),
+	}
+	index := make(map[string]int, len(order))
+	for i, entity := range order {
+		index[entity] = i
+		multi.Entities[i] = EntityRun{Entity: entity, Outcome: OutcomeSkipped}
+	}
+	if len(order) > 1 {
+		s.logger.Printf("🧭 Syncing %s", strings.Join(order, " → "))
+	}
+
+	ctx, closeSage := withSharedSage(ctx)
+	defer func() {
+		if err := closeSage(); err != nil {
+			s.logger.Printf("⚠️  Failed to close the Sage connection: %v", err)
+		}
+	}()
+
+	// run syncs the i-th entity once its dependencies are done.
+	run := func(i int) {
+		entity := order[i]
+		for _, dep := range entityDependencies[entity] {
+			j, ok := index[dep]
+			if !ok {
+				continue
+			}
+			if outcome := multi.Entities[j].Outcome; outcome == OutcomeFailed || outcome == OutcomeSkipped {
+				multi.Entities[i].Error = "skipped due to failed dependency " + dep
+				s.logger.Printf("⏭️  Skipping %s: %s", entity, multi.Entities[i].Error)
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			multi.Entities[i].Error = "not started: " + ctx.Err().Error()
+			return
+		}
+
+		result, err := entityRunners[entity](s, ctx, cfg, syncOpts...)
+		multi.Entities[i] = entityRun(entity, result, err)
+	}
+
+	if !cfg.Sync.ParallelEntities {
+		for i := range order {
+			run(i)
+		}
+	} else {
+		if cfg.Bitrix.RateLimit > 0 {
+			ctx = bitrix.WithSharedLimiter(ctx, bitrix.NewRateLimiter(cfg.Bitrix.RateLimit, cfg.Bitrix.RateBurst))
+		}
+		done := make([]chan struct{}, len(order))
+		for i := range done {
+			done[i] = make(chan struct{})
+		}
+		for i, entity := range order {
+			go func() {
+				defer close(done[i])
+				for _, dep := range entityDependencies[entity] {
+					if j, ok := index[dep]; ok {
+						<-done[j]
+					}
+				}
+				run(i)
+			}()
+		}
+		for _, ch := range done {
+			<-ch
+		}
+	}
+
+	multi.summarize()
+	if len(order) > 1 {
+		s.logger.Printf("🏁 Synced %d entities of client %s in %s: %s", len(order), multi.ClientID, multi.Duration, multi.Outcome)
+	}
+	return multi, multi.Err()
+}
+
+// entityRun builds the outcome of an entity from its sync.
+func entityRun(entity string, result *SyncResult, err error) EntityRun {
+	run := EntityRun{Entity: entity, Outcome: OutcomeSuccess, Result: result}
+	switch {
+	case err != nil:
+		run.Outcome = OutcomeFailed
+		run.Error = err.Error()
+		run.err = err
+	case result != nil && !result.Success:
+		run.Outcome = OutcomePartial
+	}
+	return run
+}
+
+// summarize fills in the result's end time and outcome.
+func (r *MultiEntityResult) summarize() {
+	r.EndTime = time.Now()
+	r.Duration = r.EndTime.Sub(r.StartTime).String()
+	r.Outcome = OutcomeSuccess
+	for _, run := range r.Entities {
+		if outcomeRank[run.Outcome] > outcomeRank[r.Outcome] {
+			r.Outcome = run.Outcome
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+)
+
+// Actions a dry run can plan.
+const (
+	PlanCreate     = "create"
+	PlanUpdate     = "update"
+	PlanSkip       = "skip"
+	PlanDelete     = "delete"
+	PlanDeactivate = "deactivate"
+	PlanWriteBack  = "write_back" // Copy Bitrix24 edits to Sage
+)
+
+// PlannedAction is one thing a dry run found the sync would do.
+type PlannedAction struct {
+	DNI      string               `json:"dni"`
+	Action   string               `json:"action"`
+	BitrixID int                  `json:"bitrix_id,omitempty"` // 0 for creates
+	Changes  []bitrix.FieldChange `json:"changes,omitempty"`   // For updates
+	Reason   string               `json:"reason,omitempty"`
+}
+
+// SyncPlan is what a dry run would have written to Bitrix24.
+type SyncPlan struct {
+	Actions  []PlannedAction `json:"actions"`
+	Warnings []string        `json:"warnings,omitempty"` // e.g. deletions over the safety threshold
+}
+
+// add records a planned action.
+func (p *SyncPlan) add(action PlannedAction) {
+	p.Actions = append(p.Actions, action)
+}
+
+// sort orders the actions by DNI, since workers record them in any order.
+func (p *SyncPlan) sort() {
+	sort.SliceStable(p.Actions, func(i, j int) bool {
+		return p.Actions[i].DNI < p.Actions[j].DNI
+	})
+}
+
+// Counts returns the number of planned actions by action.
+func (p *SyncPlan) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, a := range p.Actions {
+		counts[a.Action]++
+	}
+	return counts
+}
+
+// WriteTable prints the planned writes as an aligned table. Skipped socios
+// are left out; Counts has their number.
+func (p *SyncPlan) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tDNI\tBITRIX ID\tDETAILS")
+	for _, a := range p.Actions {
+		if a.Action == PlanSkip {
+			continue
+		}
+
+		id := "-"
+		if a.BitrixID > 0 {
+			id = fmt.Sprint(a.BitrixID)
+		}
+		details := a.Reason
+		if len(a.Changes) > 0 {
+			parts := make([]string, len(a.Changes))
+			for i, c := range a.Changes {
+				parts[i] = fmt.Sprintf("%s: %q → %q", c.Field, c.Old, c.New)
+			}
+			details = strings.Join(parts, "; ")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", a.Action, a.DNI, id, details)
+	}
+	for _, warning := range p.Warnings {
+		fmt.Fprintf(tw, "warning\t\t\t%s\n", warning)
+	}
+	return tw.Flush()
+}
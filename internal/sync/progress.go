@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"log"
+	"time"
+)
+
+// Phases reported to a ProgressFunc.
+const (
+	PhaseConnecting     = "connecting"
+	PhaseFetchingSage   = "fetching_sage"
+	PhaseFetchingBitrix = "fetching_bitrix"
+	PhaseSyncing        = "syncing"
+	PhaseDone           = "done"
+)
+
+// ProgressFunc receives the progress of a run: how many Sage socios have been
+// handled out of total, and the current phase. It is called at every phase
+// transition and after each socio, one call at a time, so it must be cheap.
+// Totals are zero until the Sage socios are known.
+type ProgressFunc func(processed, total int, phase string)
+
+// SyncOption customizes a single SyncSocios run.
+type SyncOption func(*syncOptions)
+
+type syncOptions struct {
+	progress ProgressFunc
+	timeouts Timeouts
+	maxRun   time.Duration
+	dnis     []string
+	approval bool
+}
+
+// WithProgress reports the run's progress to fn.
+func WithProgress(fn ProgressFunc) SyncOption {
+	return func(o *syncOptions) {
+		o.progress = fn
+	}
+}
+
+// progressReporter tracks a run's progress and calls the ProgressFunc. A
+// callback that panics is logged and not called again, so it can never take
+// the sync down. It also tracks where a run got without a callback, for
+// reporting a run that timed out. A nil reporter does nothing.
+type progressReporter struct {
+	fn        ProgressFunc
+	logger    *log.Logger
+	phase     string
+	processed int
+	total     int
+}
+
+func newProgressReporter(fn ProgressFunc, logger *log.Logger) *progressReporter {
+	return &progressReporter{fn: fn, logger: logger}
+}
+
+// enter moves to a new phase.
+func (p *progressReporter) enter(phase string) {
+	if p == nil {
+		return
+	}
+	p.phase = phase
+	p.notify()
+}
+
+// start sets the number of socios the run handles.
+func (p *progressReporter) start(total int) {
+	if p == nil {
+		return
+	}
+	p.total = total
+}
+
+// advance records n more handled socios. Callers serialize it.
+func (p *progressReporter) advance(n int) {
+	if p == nil || n == 0 {
+		return
+	}
+	p.processed += n
+	p.notify()
+}
+
+func (p *progressReporter) notify() {
+	if p.fn == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			p.logger.Printf("⚠️  Progress callback panicked, disabling it: %v", r)
+			p.fn = nil
+		}
+	}()
+	p.fn(p.processed, p.total, p.phase)
+}
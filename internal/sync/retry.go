@@ -0,0 +1,98 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// pendingRetry is a socio whose failure is held back from the result until
+// the retry pass has had another go at it.
+type pendingRetry struct {
+	socio  *models.Socio
+	result socioResult
+}
+
+// retryable reports whether a failed socio should wait for the retry pass.
+func retryable(cfg *config.Config, r socioResult) bool {
+	return r.outcome == outcomeFailed && cfg.Sync.RetryAttempts > 0 && bitrix.IsRetryable(r.err)
+}
+
+// failPending records the held-back failures as final.
+func failPending(pending []pendingRetry, state *clientState, result *SyncResult) {
+	for _, p := range pending {
+		p.result.apply(result, p.socio.DNI)
+		if state != nil {
+			p.result.record(state, p.socio)
+		}
+	}
+}
+
+// retryFailed re-attempts socios that failed with a retryable error, up to
+// cfg.Sync.RetryAttempts times with RetryDelaySeconds between attempts. A
+// socio that eventually succeeds counts only as created or updated; one that
+// keeps failing is recorded with its last error.
+func (s *Service) retryFailed(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, pending []pendingRetry, bitrixMap map[string]*bitrix.BitrixSocio, state *clientState, result *SyncResult) error {
+	delay := time.Duration(cfg.Sync.RetryDelaySeconds) * time.Second
+	for attempt := 1; attempt <= cfg.Sync.RetryAttempts && len(pending) > 0; attempt++ {
+		s.logger.Printf("🔁 Retrying %d failed socios in %s (attempt %d/%d)", len(pending), delay, attempt, cfg.Sync.RetryAttempts)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			failPending(pending, state, result)
+			return fmt.Errorf("sync cancelled: %w", ctx.Err())
+		}
+
+		last := attempt == cfg.Sync.RetryAttempts
+		var still []pendingRetry
+		for i, p := range pending {
+			r, err := s.retrySocio(ctx, cfg, bitrixClient, p, bitrixMap, state, result.timeouts.ItemWrite)
+			if err != nil {
+				failPending(append(still, pending[i:]...), state, result)
+				return bitrixError("", err)
+			}
+			if r.outcome == outcomeAborted {
+				r = p.result
+			}
+			if !last && retryable(cfg, r) {
+				still = append(still, pendingRetry{socio: p.socio, result: r})
+				continue
+			}
+
+			if r.outcome != outcomeFailed {
+				result.ErrorsRecovered++
+				s.logger.Printf("✅ Socio %s synced on retry", p.socio.DNI)
+			}
+			r.apply(result, p.socio.DNI)
+			if state != nil {
+				r.record(state, p.socio)
+			}
+		}
+		pending = still
+	}
+	return nil
+}
+
+// retrySocio syncs a failed socio again. A create that failed may still have
+// reached the portal, so the socio is looked up first; if the lookup fails
+// the previous failure stands until the next attempt.
+func (s *Service) retrySocio(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, p pendingRetry, bitrixMap map[string]*bitrix.BitrixSocio, state *clientState, timeout time.Duration) (socioResult, error) {
+	dni := models.NormalizeDNI(p.socio.DNI)
+	if _, exists := bitrixMap[dni]; !exists {
+		item, err := bitrixClient.GetSocioByDNI(ctx, p.socio.DNI)
+		switch {
+		case err == nil:
+			bitrixMap[dni] = item
+		case IsTransient(err):
+			return socioResult{}, err
+		case !errors.Is(err, bitrix.ErrNotFound):
+			return p.result, nil
+		}
+	}
+	return s.syncSocioWithin(ctx, cfg, bitrixClient, p.socio, bitrixMap, state, timeout)
+}
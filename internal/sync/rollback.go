@@ -0,0 +1,387 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// Errors of Rollback.
+var (
+	ErrRollbackNotFound   = errors.New("no rollback log for run")
+	ErrRollbackSuperseded = errors.New("items touched by a newer run")
+)
+
+// rollbackLine is one line of a rollback log: the header, written with the
+// first entry, or the previous values of an item about to be written.
+type rollbackLine struct {
+	Time     time.Time `json:"time"`
+	RunID    string    `json:"run_id,omitempty"` // Header only
+	ClientID string    `json:"client_id,omitempty"`
+
+	Action   string              `json:"action,omitempty"` // PlanUpdate or PlanDelete
+	BitrixID int                 `json:"bitrix_id,omitempty"`
+	DNI      string              `json:"dni,omitempty"`
+	Before   *bitrix.BitrixSocio `json:"before,omitempty"`   // The item as the run found it
+	Previous *models.Socio       `json:"previous,omitempty"` // The socio that writes it back
+}
+
+// rollbackLog records the previous values of the items a socios run
+// updates or deletes, before each write, so Rollback can undo the run. The
+// file is only created by the first write; runs that overwrite nothing
+// leave none. A nil rollbackLog records nothing.
+type rollbackLog struct {
+	path   string
+	header rollbackLine
+	logger *log.Logger
+
+	mu      sync.Mutex
+	started bool
+}
+
+// openRollbackLog prepares the rollback log of a socios run writing to
+// Bitrix24, after deleting the logs past the run log retention.
+func openRollbackLog(cfg *config.Config, result *SyncResult, logger *log.Logger) *rollbackLog {
+	if cfg.Sync.RollbackDir == "" || cfg.Sync.DryRun || result.Entity != config.EntitySocios {
+		return nil
+	}
+	if cfg.Sync.RunLogRetentionDays > 0 {
+		pruneRunLogs(filepath.Join(cfg.Sync.RollbackDir, "{client}", "{run_id}.jsonl"),
+			result.StartTime.AddDate(0, 0, -cfg.Sync.RunLogRetentionDays), logger)
+	}
+	return &rollbackLog{
+		path:   rollbackPath(cfg, result.ClientID, result.RunID),
+		header: rollbackLine{Time: result.StartTime, RunID: result.RunID, ClientID: result.ClientID},
+		logger: logger,
+	}
+}
+
+// rollbackPath returns the rollback log of a run.
+func rollbackPath(cfg *config.Config, clientID, runID string) string {
+	return filepath.Join(cfg.Sync.RollbackDir, safePathPart(clientID), safePathPart(runID)+".jsonl")
+}
+
+// record writes the previous values of an item before the run updates or
+// deletes it. base is the Sage socio being synced into it, if any; the
+// fields the item holds replace its values.
+func (rl *rollbackLog) record(bitrixClient SocioTarget, action string, item *bitrix.BitrixSocio, base *models.Socio) {
+	if rl == nil {
+		return
+	}
+	rl.write(rollbackLine{
+		Time:     time.Now(),
+		Action:   action,
+		BitrixID: item.ID,
+		DNI:      item.DNI,
+		Before:   item,
+		Previous: previousSocio(bitrixClient, item, base),
+	})
+}
+
+// write appends a line, creating the file with its header first. Failing to
+// do so is logged but never stops the run.
+func (rl *rollbackLog) write(line rollbackLine) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	lines := []rollbackLine{line}
+	if !rl.started {
+		if err := os.MkdirAll(filepath.Dir(rl.path), 0o755); err != nil {
+			rl.logger.Printf("⚠️  Failed to create rollback log directory: %v", err)
+			return
+		}
+		lines = []rollbackLine{rl.header, line}
+	}
+
+	var data []byte
+	for _, l := range lines {
+		encoded, err := json.Marshal(l)
+		if err != nil {
+			rl.logger.Printf("⚠️  Failed to encode rollback log line: %v", err)
+			return
+		}
+		data = append(append(data, encoded...), '\n')
+	}
+
+	file, err := os.OpenFile(rl.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		rl.logger.Printf("⚠️  Failed to open rollback log: %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		rl.logger.Printf("⚠️  Failed to write rollback log: %v", err)
+		return
+	}
+	rl.started = true
+}
+
+// previousSocio returns the socio whose sync writes the values item holds
+// back to it.
+func previousSocio(bitrixClient SocioTarget, item *bitrix.BitrixSocio, base *models.Socio) *models.Socio {
+	previous := &models.Socio{}
+	if base != nil {
+		*previous = *base
+	}
+	if item.DNI != "" {
+		previous.DNI = item.DNI
+	}
+	if item.Empresa > 0 {
+		previous.CodigoEmpresa = item.Empresa
+	}
+	previous.RazonSocialEmpleado = item.RazonSocialEmpleado
+	for field, value := range bitrixClient.SocioFieldValues(item) {
+		// A value Sage cannot hold, such as an empty participación, keeps
+		// that of base.
+		_ = previous.SetField(field, value)
+	}
+	return previous
+}
+
+// readRollbackLog returns the header and the entries of a rollback log.
+func readRollbackLog(path string) (rollbackLine, []rollbackLine, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return rollbackLine{}, nil, err
+	}
+	defer file.Close()
+
+	var header rollbackLine
+	var entries []rollbackLine
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line rollbackLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return rollbackLine{}, nil, fmt.Errorf("failed to parse rollback log %s: %w", path, err)
+		}
+		if line.RunID != "" {
+			header = line
+		} else {
+			entries = append(entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return rollbackLine{}, nil, fmt.Errorf("failed to read rollback log %s: %w", path, err)
+	}
+	return header, entries, nil
+}
+
+// touchedSince returns the runs of the client started after since whose
+// rollback logs touched any of ids, other than runID.
+func touchedSince(cfg *config.Config, clientID, runID string, since time.Time, ids map[int]bool) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(cfg.Sync.RollbackDir, safePathPart(clientID), "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []string
+	for _, path := range paths {
+		header, entries, err := readRollbackLog(path)
+		if err != nil {
+			return nil, err
+		}
+		if header.RunID == runID || !header.Time.After(since) {
+			continue
+		}
+		for _, entry := range entries {
+			if ids[entry.BitrixID] {
+				runs = append(runs, header.RunID)
+				break
+			}
+		}
+	}
+	return runs, nil
+}
+
+// Rollback undoes the updates and deletions of a socios run from its
+// rollback log: updated items get their previous values back through
+// UpdateSocio, and deleted ones are created again, under a new ID, unless
+// their DNI has an item again. If a newer run has written any of the same
+// items since, the rollback is refused unless force is set. The rollback is
+// a run of its own, with its own result and rollback log.
+func (s *Service) Rollback(ctx context.Context, cfg *config.Config, runID string, force bool) (*SyncResult, error) {
+	header, entries, err := readRollbackLog(rollbackPath(cfg, cfg.Company.BitrixCode, runID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w %s of client %s", ErrRollbackNotFound, runID, cfg.Company.BitrixCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[int]bool, len(entries))
+	for _, entry := range entries {
+		ids[entry.BitrixID] = true
+	}
+	newer, err := touchedSince(cfg, cfg.Company.BitrixCode, runID, header.Time, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check newer runs: %w", err)
+	}
+	if len(newer) > 0 && !force {
+		return nil, fmt.Errorf("%w: %s; force the rollback to overwrite their changes", ErrRollbackSuperseded, strings.Join(newer, ", "))
+	}
+
+	result := &SyncResult{
+		Entity:     config.EntitySocios,
+		ClientID:   cfg.Company.BitrixCode,
+		StartTime:  time.Now(),
+		Errors:     make([]Issue, 0),
+		CreatedIDs: make(map[string]int),
+		RollbackOf: runID,
+
+		SkippedByReason: make(map[string]int),
+	}
+	if cfg.Sync.CollectDetails {
+		result.Details = make([]ItemResult, 0)
+	}
+	result.timeouts = DefaultTimeouts
+
+	ctx, s = s.beginRun(ctx, cfg, result)
+	defer result.runLog.close(result)
+	defer s.notifyRun(ctx, cfg, result)
+	defer s.recordMetrics(result)
+	defer s.afterSync(ctx, cfg, result)
+	result.progress = newProgressReporter(nil, s.logger)
+	s.logger.Printf("⏪ Rolling back %d writes of run %s for client %s (run %s)", len(entries), runID, result.ClientID, result.RunID)
+	if len(newer) > 0 {
+		s.logger.Printf("⚠️  Overwriting the changes of newer runs %s", strings.Join(newer, ", "))
+	}
+
+	lock, err := acquireLock(cfg, result.RunID, s.logger)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	defer lock.release()
+	if err := s.beforeSync(ctx, cfg, result); err != nil {
+		return s.completeResult(result, err)
+	}
+
+	result.progress.enter(PhaseConnecting)
+	bitrixClient, err := s.newTarget(cfg, s.logger)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	defer func() {
+		result.ThrottleWait = bitrixClient.ThrottleWait().String()
+		result.APIStats = bitrixClient.Stats()
+		result.addClientWarnings(bitrixClient.Warnings())
+	}()
+	if cfg.Bitrix.EntityTypeID == 0 {
+		cache := bitrix.NewDiscoveryCache(cfg.Bitrix.DiscoveryCachePath)
+		if _, err := bitrixClient.ResolveEntityType(ctx, cache); err != nil {
+			s.logger.Printf("⚠️  %v, using entity type %d", err, bitrixClient.EntityTypeID())
+		}
+	}
+	if err := bitrixClient.TestConnection(ctx); err != nil {
+		return s.completeResult(result, bitrixError("failed to connect to Bitrix24", err))
+	}
+	if err := bitrixClient.ValidateFields(ctx); err != nil {
+		return s.completeResult(result, bitrixError("Bitrix24 field validation failed", err))
+	}
+
+	// Undo the last write first, so an item written twice ends up with the
+	// values from before the run.
+	result.progress.enter(PhaseSyncing)
+	result.progress.start(len(entries))
+	result.SociosProcessed = len(entries)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if ctx.Err() != nil {
+			return s.completeResult(result, fmt.Errorf("rollback cancelled: %w", ctx.Err()))
+		}
+		if err := s.undo(ctx, bitrixClient, entries[i], result); err != nil {
+			return s.completeResult(result, err)
+		}
+		result.progress.advance(1)
+	}
+
+	result.progress.enter(PhaseDone)
+	result.Success = len(result.Errors) == 0
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	s.logger.Printf("⏪ Rolled back run %s: %d restored, %d recreated, %d skipped, %d failed",
+		runID, result.SociosUpdated, result.SociosCreated, result.SociosSkipped, result.SociosFailed)
+	return result, nil
+}
+
+// undo restores one item of a rollback log. The returned error is only set
+// for transient failures that should abort the rollback.
+func (s *Service) undo(ctx context.Context, bitrixClient SocioTarget, entry rollbackLine, result *SyncResult) error {
+	// failed records a per-item error, or aborts on a transient one.
+	failed := func(err error) error {
+		if IsTransient(err) {
+			return bitrixError("", err)
+		}
+		msg := fmt.Sprintf("Failed to roll back the %s of socio %s (item %d): %v", entry.Action, entry.DNI, entry.BitrixID, err)
+		s.logger.Printf("❌ %s", msg)
+		result.SociosFailed++
+		result.addItemError(entry.DNI, msg, fmt.Sprintf("rollback %s: %v", entry.Action, err))
+		result.addDetail(ItemResult{DNI: entry.DNI, Action: ItemFailed, BitrixID: entry.BitrixID, Error: err.Error()})
+		return nil
+	}
+	// skipped leaves an item that cannot be restored.
+	skipped := func(reason string) error {
+		msg := fmt.Sprintf("Socio %s (item %d) not rolled back: %s", entry.DNI, entry.BitrixID, reason)
+		s.logger.Printf("⚠️  %s", msg)
+		result.addWarning(IssueItemFailed, entry.DNI, msg)
+		result.skip(SkipRollback, 1)
+		result.addDetail(ItemResult{DNI: entry.DNI, Action: ItemSkipped, BitrixID: entry.BitrixID, Error: reason})
+		return nil
+	}
+	if entry.Previous == nil {
+		return skipped("no previous values recorded")
+	}
+
+	switch entry.Action {
+	case PlanUpdate:
+		item, err := bitrixClient.GetSocioByID(ctx, entry.BitrixID)
+		if errors.Is(err, bitrix.ErrNotFound) {
+			return skipped("the item was deleted since")
+		} else if err != nil {
+			return failed(err)
+		}
+		changes := bitrixClient.Changes(item, entry.Previous)
+		s.rollback.record(bitrixClient, PlanUpdate, item, entry.Previous)
+		if err := bitrixClient.UpdateSocio(ctx, entry.BitrixID, entry.Previous); err != nil {
+			return failed(err)
+		}
+		result.SociosUpdated++
+		detail := ItemResult{DNI: entry.DNI, Action: ItemUpdated, BitrixID: entry.BitrixID, Changes: redactChanges(s.redactor, changes)}
+		for _, change := range changes {
+			detail.ChangedFields = append(detail.ChangedFields, change.Field)
+		}
+		result.addDetail(detail)
+
+	case PlanDelete:
+		if entry.Previous.DNI == "" {
+			return skipped("the deleted item had no DNI to recreate it by")
+		}
+		if item, err := bitrixClient.GetSocioByDNI(ctx, entry.Previous.DNI); err == nil {
+			return skipped(fmt.Sprintf("DNI already on item %d", item.ID))
+		} else if !errors.Is(err, bitrix.ErrNotFound) {
+			return failed(err)
+		}
+		id, err := bitrixClient.CreateSocio(ctx, entry.Previous)
+		if err != nil {
+			return failed(err)
+		}
+		result.SociosCreated++
+		result.CreatedIDs[entry.DNI] = id
+		result.addDetail(ItemResult{DNI: entry.DNI, Action: ItemCreated, BitrixID: id})
+
+	default:
+		return skipped(fmt.Sprintf("unknown action %q", entry.Action))
+	}
+	return nil
+}
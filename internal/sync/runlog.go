@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+)
+
+// Line types of a run log.
+const (
+	runLogHeader = "header"
+	runLogItem   = "item"
+	runLogFooter = "footer"
+)
+
+// runLogLine is one line of a run log: the header when the run starts, an
+// item per ItemResult, and the footer with the final result.
+type runLogLine struct {
+	Type     string      `json:"type"`
+	Time     time.Time   `json:"time"`
+	RunID    string      `json:"run_id,omitempty"`
+	Entity   string      `json:"entity,omitempty"`
+	ClientID string      `json:"client_id,omitempty"`
+	DryRun   bool        `json:"dry_run,omitempty"`
+	Item     *ItemResult `json:"item,omitempty"`
+	Result   *SyncResult `json:"result,omitempty"`
+}
+
+// runLog writes the JSONL audit file of one run. Every line is written
+// straight to the file, so a crashed run still leaves what it got through.
+// A nil runLog writes nothing.
+type runLog struct {
+	mu     sync.Mutex
+	file   *os.File
+	logger *log.Logger
+}
+
+// openRunLog creates the run log of a run from SyncConfig.RunLogPath and
+// writes its header, after deleting the files past their retention. Failing
+// to do so costs only the audit file, never the run.
+func openRunLog(cfg *config.Config, result *SyncResult, runID string, logger *log.Logger) *runLog {
+	if cfg.Sync.RunLogPath == "" {
+		return nil
+	}
+
+	path := runLogPath(cfg.Sync.RunLogPath, result.ClientID, result.Entity, runID, result.StartTime)
+	if cfg.Sync.RunLogRetentionDays > 0 {
+		pruneRunLogs(cfg.Sync.RunLogPath, result.StartTime.AddDate(0, 0, -cfg.Sync.RunLogRetentionDays), logger)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		logger.Printf("⚠️  Failed to create run log directory: %v", err)
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		logger.Printf("⚠️  Failed to open run log: %v", err)
+		return nil
+	}
+
+	rl := &runLog{file: file, logger: logger}
+	rl.write(runLogLine{
+		Type:     runLogHeader,
+		Time:     result.StartTime,
+		RunID:    runID,
+		Entity:   result.Entity,
+		ClientID: result.ClientID,
+		DryRun:   cfg.Sync.DryRun,
+	})
+	logger.Printf("🧾 Writing run log to %s", path)
+	return rl
+}
+
+// runLogPath fills in the placeholders of a run log path template.
+func runLogPath(template, clientID, entity, runID string, start time.Time) string {
+	return strings.NewReplacer(
+		"{client}", safePathPart(clientID),
+		"{entity}", safePathPart(entity),
+		"{run_id}", safePathPart(runID),
+		"{date}", start.Format("2006-01-02"),
+	).Replace(template)
+}
+
+// safePathPart keeps a value from reaching outside its path segment.
+func safePathPart(s string) string {
+	s = strings.NewReplacer("/", "_", `\`, "_").Replace(s)
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
+
+// pruneRunLogs deletes the run logs modified before cutoff, found by
+// matching the template with its placeholders as wildcards, so unrelated
+// files next to them are never touched.
+func pruneRunLogs(template string, cutoff time.Time, logger *log.Logger) {
+	pattern := strings.NewReplacer("{client}", "*", "{entity}", "*", "{run_id}", "*", "{date}", "*").Replace(template)
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		logger.Printf("⚠️  Failed to prune run logs: %v", err)
+		return
+	}
+
+	removed := 0
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			logger.Printf("⚠️  Failed to delete old run log: %v", err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		logger.Printf("🧹 Deleted %d run logs older than %s", removed, cutoff.Format("2006-01-02"))
+	}
+}
+
+// item writes one item line.
+func (rl *runLog) item(detail ItemResult) {
+	if rl == nil {
+		return
+	}
+	rl.write(runLogLine{Type: runLogItem, Time: time.Now(), Item: &detail})
+}
+
+// close writes the footer with the final result and closes the file.
+func (rl *runLog) close(result *SyncResult) {
+	if rl == nil {
+		return
+	}
+	rl.write(runLogLine{Type: runLogFooter, Time: time.Now(), Result: result})
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if err := rl.file.Close(); err != nil {
+		rl.logger.Printf("⚠️  Failed to close run log: %v", err)
+	}
+}
+
+// write appends a line to the file.
+func (rl *runLog) write(line runLogLine) {
+	data, err := json.Marshal(line)
+	if err != nil {
+		rl.logger.Printf("⚠️  Failed to encode run log line: %v", err)
+		return
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if _, err := rl.file.Write(append(data, '\n')); err != nil {
+		rl.logger.Printf("⚠️  Failed to write run log: %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/repository"
+)
+
+// SageConnector hands out the Sage connection of a run; release is called
+// when the run no longer needs it. The default opens a pool per run and
+// closes it afterwards.
+type SageConnector interface {
+	Connect(ctx context.Context, cfg *config.Config, logger *log.Logger) (db *sql.DB, release func() error, err error)
+}
+
+// WithSageConnector replaces how runs connect to Sage, e.g. with a SageCache.
+func WithSageConnector(c SageConnector) ServiceOption {
+	return func(s *Service) {
+		s.sage = c
+	}
+}
+
+// WithSageDB makes every run use db, which the caller keeps open and closes.
+// It suits services syncing a single client.
+func WithSageDB(db *sql.DB) ServiceOption {
+	return WithSageConnector(fixedSage{db})
+}
+
+// directSage opens a connection pool per run.
+type directSage struct{}
+
+func (directSage) Connect(ctx context.Context, cfg *config.Config, logger *log.Logger) (*sql.DB, func() error, error) {
+	db, err := connectToSage(ctx, cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, db.Close, nil
+}
+
+// fixedSage hands out a connection owned by the caller.
+type fixedSage struct {
+	db *sql.DB
+}
+
+func (f fixedSage) Connect(context.Context, *config.Config, *log.Logger) (*sql.DB, func() error, error) {
+	return f.db, func() error { return nil }, nil
+}
+
+// SageCache keeps a connection pool per Sage database open across runs, so
+// scheduled syncs do not log in to SQL Server on every run. Pools unused for
+// longer than the idle time are closed.
+type SageCache struct {
+	idle time.Duration
+
+	mu     sync.Mutex
+	pools  map[string]*cachedPool // By connection string
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+type cachedPool struct {
+	db       *sql.DB
+	inUse    int
+	lastUsed time.Time
+}
+
+// ErrSageCacheClosed is returned by a SageCache after Close.
+var ErrSageCacheClosed = errors.New("Sage connection cache closed")
+
+// NewSageCache creates a SageCache closing pools idle for longer than idle.
+// Close it on shutdown.
+func NewSageCache(idle time.Duration) *SageCache {
+	c := &SageCache{
+		idle:  idle,
+		pools: make(map[string]*cachedPool),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go c.expire(max(idle/2, time.Second))
+	return c
+}
+
+// Connect returns the cached pool of cfg's Sage database, connecting first
+// if there is none.
+func (c *SageCache) Connect(ctx context.Context, cfg *config.Config, logger *log.Logger) (*sql.DB, func() error, error) {
+	key := cfg.GetConnectionString()
+	if db, release, ok, err := c.take(key); ok || err != nil {
+		return db, release, err
+	}
+
+	db, err := connectToSage(ctx, cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		db.Close()
+		return nil, nil, ErrSageCacheClosed
+	}
+	if _, raced := c.pools[key]; !raced {
+		c.pools[key] = &cachedPool{db: db}
+		db = nil
+	}
+	c.mu.Unlock()
+	if db != nil {
+		db.Close() // Another run connected meanwhile
+	}
+
+	db, release, _, err := c.take(key)
+	return db, release, err
+}
+
+// take hands out the cached pool of key, if any.
+func (c *SageCache) take(key string) (db *sql.DB, release func() error, ok bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, nil, false, ErrSageCacheClosed
+	}
+	pool := c.pools[key]
+	if pool == nil {
+		return nil, nil, false, nil
+	}
+	pool.inUse++
+	var once sync.Once
+	return pool.db, func() error {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			pool.inUse--
+			pool.lastUsed = time.Now()
+		})
+		return nil
+	}, true, nil
+}
+
+// expire closes the idle pools every interval until Close.
+func (c *SageCache) expire(interval time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			for key, pool := range c.pools {
+				if pool.inUse == 0 && now.Sub(pool.lastUsed) > c.idle {
+					pool.db.Close()
+					delete(c.pools, key)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Close closes every pool. Runs still using one fail on their next query.
+func (c *SageCache) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	pools := c.pools
+	c.pools = nil
+	c.mu.Unlock()
+
+	close(c.stop)
+	<-c.done
+	var errs []error
+	for _, pool := range pools {
+		errs = append(errs, pool.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+type sharedSageKey struct{}
+
+// sharedSage is the Sage connection of the entities of one Orchestrate run.
+type sharedSage struct {
+	mu      sync.Mutex
+	db      *sql.DB
+	release func() error
+}
+
+// withSharedSage returns a context whose Sage connections are opened once
+// and reused, and the function releasing that connection.
+func withSharedSage(ctx context.Context) (context.Context, func() error) {
+	shared := &sharedSage{}
+	return context.WithValue(ctx, sharedSageKey{}, shared), func() error {
+		shared.mu.Lock()
+		defer shared.mu.Unlock()
+		if shared.db == nil {
+			return nil
+		}
+		err := shared.release()
+		shared.db, shared.release = nil, nil
+		return err
+	}
+}
+
+// openSage connects to the Sage database configured in cfg through the
+// service's SageConnector, reusing the connection shared through ctx, if
+// any. release gives the connection back unless it is shared.
+func (s *Service) openSage(ctx context.Context, cfg *config.Config, logger *log.Logger) (db *sql.DB, release func() error, err error) {
+	shared, _ := ctx.Value(sharedSageKey{}).(*sharedSage)
+	if shared == nil {
+		return s.sage.Connect(ctx, cfg, logger)
+	}
+
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	if shared.db == nil {
+		if shared.db, shared.release, err = s.sage.Connect(ctx, cfg, logger); err != nil {
+			return nil, nil, err
+		}
+	}
+	return shared.db, func() error { return nil }, nil
+}
+
+// CheckSage connects to the Sage database configured in cfg and checks it
+// has the tables and columns the socios sync reads, to tell a wrong
+// database or Sage version apart from a connection problem.
+func (s *Service) CheckSage(ctx context.Context, cfg *config.Config) (*repository.HealthReport, error) {
+	db, release, err := s.openSage(ctx, cfg, s.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Sage: %w", err)
+	}
+	defer release()
+	return newSocioRepository(cfg, db, s.logger).HealthCheck(ctx)
+}
+
+// SageEmpresas connects to the Sage database configured in cfg and counts
+// the socios of each of its empresas, so a new client's company mapping can
+// be chosen before the first sync.
+func (s *Service) SageEmpresas(ctx context.Context, cfg *config.Config) ([]repository.EmpresaSocios, error) {
+	db, release, err := s.openSage(ctx, cfg, s.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Sage: %w", err)
+	}
+	defer release()
+	return newSocioRepository(cfg, db, s.logger).EmpresaBreakdown(ctx)
+}
+
+// schemaChecker is a SocioSource that can check its schema.
+// *repository.SocioRepository implements it.
+type schemaChecker interface {
+	HealthCheck(ctx context.Context) (*repository.HealthReport, error)
+}
+
+// diagnoseSage adds what the Sage schema lacks to the error of a failed
+// socios query, the usual cause of a query failing on a database that
+// connects fine. Other errors are returned as they are.
+func (s *Service) diagnoseSage(ctx context.Context, source SocioSource, err error) error {
+	checker, ok := source.(schemaChecker)
+	if !ok || ctx.Err() != nil || repository.IsTransientError(err) {
+		return err
+	}
+	report, checkErr := checker.HealthCheck(ctx)
+	if checkErr != nil || report.Healthy() {
+		return err
+	}
+	return fmt.Errorf("%w (%s)", err, report)
+}
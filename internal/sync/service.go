@@ -4,176 +4,976 @@ package sync
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
 	"github.com/arduriki/sage-bitrix-sync/internal/config"
 	"github.com/arduriki/sage-bitrix-sync/internal/models"
 	"github.com/arduriki/sage-bitrix-sync/internal/repository"
+	"github.com/google/uuid"
 )
 
 // Service handles the complete synchronization process.
 type Service struct {
 	logger *log.Logger
+
+	// How the socios sync reaches Sage and Bitrix24, how every pipeline
+	// connects to Sage, and what its Bitrix24 clients share per portal.
+	openSource SourceFactory
+	newTarget  TargetFactory
+	sage       SageConnector
+	portals    *bitrix.PortalCoordinator
+
+	// Set by beginRun on the Service of a socios run writing to Bitrix24.
+	rollback *rollbackLog
+
+	// Where WithMetrics reports each run, and how WithRedactor masks values.
+	metrics  MetricsRecorder
+	redactor Redactor
+
+	// Callbacks registered with WithBeforeSync, WithAfterSync and WithOnItemSynced.
+	beforeHooks []BeforeSyncFunc
+	afterHooks  []AfterSyncFunc
+	itemHooks   []ItemSyncedFunc
 }
 
-// NewService creates a new sync service.
-func NewService(logger *log.Logger) *Service {
-	return &Service{
+// NewService creates a new sync service. By default the socios sync
+// connects to the Sage database and Bitrix24 portal configured for each
+// run; options can replace either side, or keep Sage connections open
+// across runs (see WithSageConnector).
+func NewService(logger *log.Logger, opts ...ServiceOption) *Service {
+	s := &Service{
 		logger: logger,
+		sage:   directSage{},
+	}
+	s.openSource = s.openSageSource
+	s.newTarget = s.newBitrixTarget
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
+// ErrEndpointUnavailable is returned when a run is skipped because the
+// Bitrix24 endpoint's circuit breaker is open.
+var ErrEndpointUnavailable = errors.New("Bitrix24 endpoint unavailable, skipping run")
+
 // SyncResult contains the results of a sync operation.
 type SyncResult struct {
-	ClientID        string    `json:"client_id"`
-	StartTime       time.Time `json:"start_time"`
-	EndTime         time.Time `json:"end_time"`
-	Duration        string    `json:"duration"`
-	SociosProcessed int       `json:"socios_processed"`
-	SociosCreated   int       `json:"socios_created"`
-	SociosUpdated   int       `json:"socios_updated"`
-	SociosSkipped   int       `json:"socios_skipped"`
-	Errors          []string  `json:"errors"`
-	Success         bool      `json:"success"`
+	Entity            string    `json:"entity"` // One of config.SyncEntities
+	RunID             string    `json:"run_id"` // Also sent to Bitrix24 as the X-Sync-Run-ID header
+	ClientID          string    `json:"client_id"`
+	StartTime         time.Time `json:"start_time"`
+	EndTime           time.Time `json:"end_time"`
+	Duration          string    `json:"duration"`
+	SociosProcessed   int       `json:"socios_processed"`
+	SociosCreated     int       `json:"socios_created"`
+	SociosUpdated     int       `json:"socios_updated"`
+	SociosSkipped     int       `json:"socios_skipped"` // Total of SkippedByReason
+	ThrottleWait      string    `json:"throttle_wait"`  // Time spent waiting for the Bitrix24 rate limiter
+	DuplicatesDeleted int       `json:"duplicates_deleted"`
+	SociosDeactivated int       `json:"socios_deactivated"`  // Marked as removed from Sage
+	SociosDeleted     int       `json:"socios_deleted"`      // Deleted because removed from Sage
+	SociosFailed      int       `json:"socios_failed"`       // Repeated failures share one Errors entry
+	SociosInvalid     int       `json:"socios_invalid"`      // Left out by validation, also skipped as invalid_data
+	ErrorsRecovered   int       `json:"errors_recovered"`    // Failed socios synced by the retry pass
+	SociosWrittenBack int       `json:"socios_written_back"` // Bitrix24 edits copied back to Sage
+	Conflicts         int       `json:"conflicts"`           // Fields edited in Bitrix24 that differed from Sage
+	PlanConflicts     int       `json:"plan_conflicts"`      // Planned actions ApplyPlan left out, see IssuePlanConflict
+	Errors            []Issue   `json:"errors"`
+	Warnings          []Issue   `json:"warnings,omitempty"` // Problems that do not fail the run
+	Success           bool      `json:"success"`            // The run finished without errors
+
+	// TimedOut marks a run stopped for exceeding its maximum duration (see
+	// WithMaxRunDuration), in phase TimedOutPhase; the counters are those
+	// reached by then.
+	TimedOut      bool   `json:"timed_out,omitempty"`
+	TimedOutPhase string `json:"timed_out_phase,omitempty"`
+
+	// SkippedByReason breaks SociosSkipped down by the Skip* reason keys.
+	SkippedByReason map[string]int `json:"skipped_by_reason"`
+
+	// APIStats counts the Bitrix24 REST calls the run consumed.
+	APIStats bitrix.APIStats `json:"api_stats"`
+
+	// SageStats counts the Sage queries the run made and the time they
+	// took, to tell a slow Sage from a slow Bitrix24.
+	SageStats *repository.QueryStats `json:"sage_stats,omitempty"`
+
+	// UnexpectedResponses counts failures caused by non-JSON answers (HTML
+	// pages from firewalls or edge nodes), which point at the network path.
+	UnexpectedResponses int `json:"unexpected_responses"`
+
+	// CreatedIDs maps the DNI of each created socio to its new Bitrix24 item ID.
+	CreatedIDs map[string]int `json:"created_ids,omitempty"`
+
+	// RollbackOf is the run undone by a Rollback run, whose updated and
+	// created counters are items restored and recreated.
+	RollbackOf string `json:"rollback_of,omitempty"`
+
+	// DryRun marks a run that wrote nothing: the created, updated, skipped and
+	// deleted counters are planned, not performed, and Plan lists the actions.
+	DryRun bool      `json:"dry_run"`
+	Plan   *SyncPlan `json:"plan,omitempty"`
+
+	// Incremental marks a run that only looked at socios changed since the
+	// last sync; unchanged ones are counted as skipped.
+	Incremental bool `json:"incremental"`
+
+	// ReadUncommitted is set when Sage was read without locks
+	// (SageDBConfig.ReadUncommitted), so the socios may include changes
+	// that were never committed.
+	ReadUncommitted bool `json:"read_uncommitted,omitempty"`
+
+	// Details has one record per socio touched by the run. It is only
+	// collected with SyncConfig.CollectDetails, to bound memory on huge clients,
+	// except for socios with conflicts, which are always recorded.
+	Details []ItemResult `json:"details,omitempty"`
+
+	// DNIs is the scope of a run restricted with WithDNIs; NotFound lists
+	// those without a socio in Sage.
+	DNIs     []string `json:"dnis,omitempty"`
+	NotFound []string `json:"not_found,omitempty"`
+
+	// Validation reports the Sage socios that failed the data checks.
+	Validation *ValidationReport `json:"validation,omitempty"`
+
+	// Databases has the outcome of each Sage database of a client with
+	// SageDBConfig.Databases or DatabasePattern, in their order.
+	Databases []DatabaseResult `json:"databases,omitempty"`
+
+	progress *progressReporter
+	runLog   *runLog
+	onItem   func(ItemResult) // Item hooks, see WithOnItemSynced
+	redact   Redactor         // See WithRedactor
+	timeouts Timeouts
+	excluded map[*models.Socio]bool // Socios left out by validation or as duplicates
+
+	// The last item error, for collapsing repeats (see addItemError).
+	lastCause      string
+	lastCauseMsg   string
+	lastCauseCount int
+	lastCauseIndex int
+}
+
+// Actions recorded in ItemResult.
+const (
+	ItemCreated     = "created"
+	ItemUpdated     = "updated"
+	ItemSkipped     = "skipped"
+	ItemFailed      = "failed"
+	ItemDeactivated = "deactivated"
+	ItemDeleted     = "deleted"
+	ItemWrittenBack = "written_back" // Bitrix24 edits copied to Sage
+	ItemInvalid     = "invalid"      // Failed validation, not synced
+	ItemNotFound    = "not_found"    // Requested with WithDNIs, but not in Sage
+)
+
+// Reasons for not acting on an item, the keys of SyncResult.SkippedByReason.
+const (
+	SkipUnchanged       = "unchanged"        // Bitrix24 already matches Sage
+	SkipEmptyDNI        = "empty_dni"        // No DNI to match the Bitrix24 item by
+	SkipInvalidData     = "invalid_data"     // Failed validation
+	SkipFilteredEmpresa = "filtered_empresa" // Bitrix24 item of another empresa
+	SkipDuplicateDNI    = "duplicate_dni"    // DNI or tax ID already synced in the run
+	SkipDuplicateRow    = "duplicate_row"    // Older Sage row of a socio, collapsed into the latest
+	SkipDuplicateSKU    = "duplicate_sku"    // SKU already synced in the run
+	SkipObsolete        = "obsolete"         // Discontinued in Sage and not in Bitrix24
+	SkipBitrixEdit      = "bitrix_edit_kept" // Conflict settled for the Bitrix24 edit
+	SkipRollback        = "not_rolled_back"  // Rollback found no way to restore the item
+)
+
+// ItemResult records what a run did with one socio.
+type ItemResult struct {
+	DNI           string   `json:"dni"`
+	Action        string   `json:"action"`
+	BitrixID      int      `json:"bitrix_id,omitempty"`
+	ChangedFields []string `json:"changed_fields,omitempty"`
+	Error         string   `json:"error,omitempty"`
+
+	// Changes is the old and new value of each field an update, real or
+	// planned, writes, as compared by the Bitrix24 client's Changes
+	Changes []bitrix.FieldChange `json:"changes,omitempty"`
+
+	// Conflicts lists the fields edited on both sides and which one was kept
+	Conflicts []FieldConflict `json:"conflicts,omitempty"`
+}
+
+// skip counts an item the run did not act on.
+func (r *SyncResult) skip(reason string, n int) {
+	if n == 0 {
+		return
+	}
+	if r.SkippedByReason == nil {
+		r.SkippedByReason = make(map[string]int)
+	}
+	r.SociosSkipped += n
+	r.SkippedByReason[reason] += n
+}
+
+// skipBreakdown formats the skip reasons for the summary log, as
+// " (empty_dni 2, unchanged 30)", or "" when nothing was skipped.
+func skipBreakdown(byReason map[string]int) string {
+	if len(byReason) == 0 {
+		return ""
+	}
+	reasons := make([]string, 0, len(byReason))
+	for reason, n := range byReason {
+		reasons = append(reasons, fmt.Sprintf("%s %d", reason, n))
+	}
+	sort.Strings(reasons)
+	return " (" + strings.Join(reasons, ", ") + ")"
+}
+
+// addDetail records an ItemResult if details are being collected. Conflicts
+// are always recorded, so they can be audited. The run log gets every one.
+func (r *SyncResult) addDetail(detail ItemResult) {
+	r.runLog.item(detail)
+	if r.onItem != nil {
+		r.onItem(detail)
+	}
+	if r.Details != nil || len(detail.Conflicts) > 0 {
+		r.Details = append(r.Details, detail)
+	}
 }
 
 // SyncSocios performs the complete Sage → Bitrix24 sync for socios.
-func (s *Service) SyncSocios(ctx context.Context, cfg *config.Config) (*SyncResult, error) {
+// The run is bounded by SyncConfig.MaxRunMinutes or WithMaxRunDuration; one
+// that runs out of time fails with ErrRunTimeout.
+func (s *Service) SyncSocios(ctx context.Context, cfg *config.Config, syncOpts ...SyncOption) (_ *SyncResult, err error) {
+	var options syncOptions
+	for _, opt := range syncOpts {
+		opt(&options)
+	}
+	if options.approval {
+		cfg = planConfig(cfg)
+	}
+
 	result := &SyncResult{
-		ClientID:  cfg.Company.BitrixCode,
-		StartTime: time.Now(),
-		Errors:    make([]string, 0),
+		Entity:     config.EntitySocios,
+		ClientID:   cfg.Company.BitrixCode,
+		StartTime:  time.Now(),
+		Errors:     make([]Issue, 0),
+		CreatedIDs: make(map[string]int),
+
+		SkippedByReason: make(map[string]int),
+	}
+	if cfg.Sync.CollectDetails {
+		result.Details = make([]ItemResult, 0)
 	}
+	result.timeouts = options.timeouts.withDefaults()
 
-	s.logger.Printf("🚀 Starting socios sync for client: %s", result.ClientID)
+	ctx, s = s.beginRun(ctx, cfg, result)
+	defer result.runLog.close(result)
+	defer s.notifyRun(ctx, cfg, result)
+	defer s.recordMetrics(result)
+	defer s.afterSync(ctx, cfg, result)
+	result.progress = newProgressReporter(options.progress, s.logger)
+
+	// The hooks and the notification above run outside the bound.
+	maxRun := maxRunDuration(cfg, options)
+	parent := ctx
+	ctx, cancelRun := phaseContext(ctx, maxRun)
+	defer cancelRun()
+	defer func() {
+		err = s.runTimeout(ctx, parent, maxRun, result, err)
+	}()
+
+	s.logger.Printf("🚀 Starting socios sync for client: %s (run %s)", result.ClientID, result.RunID)
+	if cfg.Sync.DryRun {
+		result.DryRun = true
+		result.Plan = &SyncPlan{}
+		s.logger.Printf("🧪 Dry run: changes are planned, nothing is written to Bitrix24")
+	}
+
+	// Only one process may write a client's socios at a time.
+	if !cfg.Sync.DryRun {
+		lock, err := acquireLock(cfg, result.RunID, s.logger)
+		if err != nil {
+			return s.completeResult(result, err)
+		}
+		defer lock.release()
+	}
+	if err := s.beforeSync(ctx, cfg, result); err != nil {
+		return s.completeResult(result, err)
+	}
 
 	// Step 1: Connect to Sage database.
-	db, err := s.connectToSage(cfg)
+	result.progress.enter(PhaseConnecting)
+	connectCtx, cancelConnect := phaseContext(ctx, result.timeouts.SageConnect)
+	socioRepo, release, err := s.openSource(connectCtx, cfg, s.logger)
+	err = phaseError(connectCtx, ctx, "Sage connection", result.timeouts.SageConnect, err)
+	cancelConnect()
 	if err != nil {
 		return s.completeResult(result, fmt.Errorf("failed to connect to Sage: %w", err))
 	}
-	defer db.Close()
+	defer release()
+	defer func() {
+		result.SageStats = sageStats(socioRepo)
+	}()
 
-	// Step 2: Create repositories and clients.
-	socioRepo := repository.NewSocioRepository(db)
-	bitrixClient := bitrix.NewClient(cfg.Bitrix.Endpoint, s.logger)
+	// Step 2: Create the Bitrix24 client.
+	bitrixClient, err := s.newTarget(cfg, s.logger)
+	if err != nil {
+		return s.completeResult(result, err)
+	}
+	defer func() {
+		result.ThrottleWait = bitrixClient.ThrottleWait().String()
+		result.APIStats = bitrixClient.Stats()
+		result.addClientWarnings(bitrixClient.Warnings())
+	}()
+
+	// Without a configured entity type, use the one discovered for this portal.
+	if cfg.Bitrix.EntityTypeID == 0 {
+		cache := bitrix.NewDiscoveryCache(cfg.Bitrix.DiscoveryCachePath)
+		if _, err := bitrixClient.ResolveEntityType(ctx, cache); err != nil {
+			s.logger.Printf("⚠️  %v, using entity type %d", err, bitrixClient.EntityTypeID())
+		}
+	}
 
 	// Step 3: Test Bitrix24 connection.
 	if err := bitrixClient.TestConnection(ctx); err != nil {
-		return s.completeResult(result, fmt.Errorf("failed to connect to Bitrix24: %w", err))
+		return s.completeResult(result, bitrixError("failed to connect to Bitrix24", err))
 	}
 
-	// Step 4: Get all socios from Sage.
-	s.logger.Printf("📊 Fetching socios from Sage database...")
-	sageSocios, err := socioRepo.GetAll(ctx)
+	// Step 3b: Make sure the mapped fields exist before writing anything.
+	if err := bitrixClient.ValidateFields(ctx); err != nil {
+		return s.completeResult(result, bitrixError("Bitrix24 field validation failed", err))
+	}
+	if err := bitrixClient.ValidateStage(ctx); err != nil {
+		return s.completeResult(result, bitrixError("Bitrix24 stage validation failed", err))
+	}
+
+	// Step 4: Get the socios of the mapped empresa from Sage, only those
+	// changed since the last run when the run is incremental and Sage
+	// stamps modifications.
+	state := s.loadState(cfg, bitrixClient)
+	if state != nil {
+		defer s.saveState(cfg, state)
+	}
+	incremental := len(options.dnis) == 0 && s.useIncremental(cfg, state)
+
+	result.progress.enter(PhaseFetchingSage)
+	if cfg.SageDB.ReadUncommitted {
+		result.ReadUncommitted = true
+		s.logger.Printf("🔓 Reading Sage without locks: uncommitted changes may be synced")
+	}
+	queryCtx, cancelQuery := phaseContext(ctx, result.timeouts.SageQuery)
+	var modified ModifiedSource
+	if state != nil && len(options.dnis) == 0 {
+		modified = s.modificationTracking(queryCtx, socioRepo)
+	}
+	fetchStart := time.Now()
+	var sageSocios []*models.Socio
+	streamer, streaming := socioRepo.(SocioStreamer)
+	streaming = streaming && cfg.Sync.StreamSage && len(options.dnis) == 0
+	if len(options.dnis) > 0 {
+		sageSocios, err = s.fetchTargeted(queryCtx, cfg, socioRepo, options.dnis, result)
+	} else if modified != nil && incremental && !state.SageCursor.IsZero() {
+		streaming = false
+		sageSocios, err = s.fetchModified(queryCtx, cfg, modified, state.SageCursor)
+	} else if streaming {
+		sageSocios, err = s.fetchStreamed(queryCtx, cfg, streamer, result)
+	} else if code, ok := cfg.Company.SageEmpresa(); ok {
+		s.logger.Printf("📊 Fetching socios of empresa %d from Sage database...", code)
+		sageSocios, err = socioRepo.GetAllByEmpresa(queryCtx, code)
+	} else {
+		s.logger.Printf("📊 Fetching socios from Sage database...")
+		sageSocios, err = socioRepo.GetAll(queryCtx)
+	}
+	err = phaseError(queryCtx, ctx, "Sage query", result.timeouts.SageQuery, err)
+	cancelQuery()
+	s.reportDatabases(socioRepo, result)
 	if err != nil {
+		err = s.diagnoseSage(ctx, socioRepo, err)
 		return s.completeResult(result, fmt.Errorf("failed to fetch socios from Sage: %w", err))
 	}
+	if !streaming {
+		sageSocios = s.collapseSageRows(sageSocios, result)
+	}
 	s.logger.Printf("✅ Found %d socios in Sage", len(sageSocios))
+	result.progress.start(len(sageSocios))
 
-	// Step 5: Get existing socios from Bitrix24.
-	s.logger.Printf("📊 Fetching existing socios from Bitrix24...")
-	bitrixSocios, err := bitrixClient.ListSocios(ctx)
-	if err != nil {
-		return s.completeResult(result, fmt.Errorf("failed to fetch socios from Bitrix24: %w", err))
+	// Step 4b: Check the Sage data before writing any of it.
+	if err := s.validate(cfg, sageSocios, result); err != nil {
+		return s.completeResult(result, err)
 	}
-	s.logger.Printf("✅ Found %d existing socios in Bitrix24", len(bitrixSocios))
+	s.excludeDuplicateDNIs(sageSocios, result)
 
-	// Step 6: Synchronize socios.
+	// Step 5: Sync only what changed since the last run when the state allows it.
 	result.SociosProcessed = len(sageSocios)
-	err = s.synchronizeSocios(ctx, bitrixClient, sageSocios, bitrixSocios, result)
-	if err != nil {
+	if len(options.dnis) > 0 {
+		if err := s.syncTargeted(ctx, cfg, bitrixClient, sageSocios, state, result); err != nil {
+			return s.completeResult(result, err)
+		}
+	} else if incremental {
+		result.Incremental = true
+		if err := s.syncIncremental(ctx, cfg, bitrixClient, sageSocios, state, result); err != nil {
+			return s.completeResult(result, err)
+		}
+	} else if err := s.syncFull(ctx, cfg, bitrixClient, socioRepo, sageSocios, state, result); err != nil {
 		return s.completeResult(result, err)
 	}
 
+	// A run that failed some socios keeps the old cursor, so their rows are
+	// fetched again next time even if Sage does not touch them.
+	if modified != nil && len(result.Errors) == 0 {
+		state.SageCursor = fetchStart
+	}
+
+	if result.Plan != nil {
+		result.Plan.sort()
+	}
+	if options.approval {
+		if err := s.savePlan(cfg, result, sageSocios); err != nil {
+			return s.completeResult(result, err)
+		}
+	}
+
 	// Step 7: Complete successfully.
-	result.Success = true
+	result.progress.enter(PhaseDone)
+	result.Success = len(result.Errors) == 0
 	result.EndTime = time.Now()
 	result.Duration = result.EndTime.Sub(result.StartTime).String()
 
-	s.logger.Printf("🎉 Sync completed successfully!")
+	if result.DryRun {
+		s.logger.Printf("🧪 Dry run completed, counts below are planned")
+	} else if result.Success {
+		s.logger.Printf("🎉 Sync completed successfully!")
+	} else {
+		s.logger.Printf("⚠️  Sync completed with %d errors", len(result.Errors))
+	}
 	s.logger.Printf("   📊 Processed: %d socios", result.SociosProcessed)
 	s.logger.Printf("   ✨ Created: %d socios", result.SociosCreated)
 	s.logger.Printf("   📝 Updated: %d socios", result.SociosUpdated)
-	s.logger.Printf("   ⏭️  Skipped: %d socios", result.SociosSkipped)
+	s.logger.Printf("   ⏭️  Skipped: %d socios%s", result.SociosSkipped, skipBreakdown(result.SkippedByReason))
+	if result.SociosInvalid > 0 {
+		s.logger.Printf("   🚫 Invalid: %d socios", result.SociosInvalid)
+	}
+	if result.SociosDeactivated > 0 || result.SociosDeleted > 0 {
+		s.logger.Printf("   💤 Removed from Sage: %d deactivated, %d deleted", result.SociosDeactivated, result.SociosDeleted)
+	}
 	s.logger.Printf("   ⏱️  Duration: %s", result.Duration)
+	s.logger.Printf("   🐢 Throttled: %s", bitrixClient.ThrottleWait())
+	s.logger.Printf("   📡 API calls: %d", bitrixClient.Stats().Requests)
+	if stats := sageStats(socioRepo); stats != nil {
+		s.logger.Printf("   🗄️  Sage queries: %d, %d rows in %s", stats.Queries, stats.Rows, stats.Duration)
+	}
 
 	return result, nil
 }
 
+// fetchStreamed reads the socios through streamer, collapsing the rows of
+// each socio as they arrive, so only the row kept per socio is ever held
+// rather than every historical row the query returns.
+func (s *Service) fetchStreamed(ctx context.Context, cfg *config.Config, streamer SocioStreamer, result *SyncResult) ([]*models.Socio, error) {
+	c := newRowCollapser(0)
+	add := func(socio *models.Socio) error {
+		c.add(socio)
+		return nil
+	}
+
+	var err error
+	if code, ok := cfg.Company.SageEmpresa(); ok {
+		s.logger.Printf("📊 Streaming socios of empresa %d from Sage database...", code)
+		err = streamer.GetAllByEmpresaStream(ctx, code, add)
+	} else {
+		s.logger.Printf("📊 Streaming socios from Sage database...")
+		err = streamer.GetAllStream(ctx, add)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.collapsed(c, result), nil
+}
+
+// syncFull lists every Bitrix24 socio and reconciles it with Sage, including
+// duplicates and socios removed from Sage.
+func (s *Service) syncFull(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, socioRepo SocioSource, sageSocios []*models.Socio, state *clientState, result *SyncResult) error {
+	result.progress.enter(PhaseFetchingBitrix)
+	s.logger.Printf("📊 Fetching existing socios from Bitrix24...")
+	listCtx, cancelList := phaseContext(ctx, result.timeouts.BitrixList)
+	bitrixSocios, err := s.listBitrixSocios(listCtx, cfg, bitrixClient)
+	err = phaseError(listCtx, ctx, "Bitrix24 listing", result.timeouts.BitrixList, err)
+	cancelList()
+	if err != nil {
+		return bitrixError("failed to fetch socios from Bitrix24", err)
+	}
+	s.logger.Printf("✅ Found %d existing socios in Bitrix24", len(bitrixSocios))
+
+	// Items recorded for another empresa are left to that empresa's sync.
+	owned := bitrixSocios[:0]
+	for _, item := range bitrixSocios {
+		if bitrixClient.OwnsSocio(&item) {
+			owned = append(owned, item)
+		}
+	}
+	if skipped := len(bitrixSocios) - len(owned); skipped > 0 {
+		s.logger.Printf("🏭 Ignoring %d Bitrix24 socios of other empresas", skipped)
+		result.skip(SkipFilteredEmpresa, skipped)
+	}
+	bitrixSocios = owned
+
+	// Excluded socios are not synced, but are still in Sage: they count
+	// for deletions and stay in the state.
+	toSync := result.withoutExcluded(sageSocios)
+
+	// Resolve the company of each empresa so links can be compared.
+	if err := bitrixClient.ResolveCompanies(ctx, toSync); err != nil {
+		return bitrixError("failed to resolve Bitrix24 companies", err)
+	}
+
+	result.progress.enter(PhaseSyncing)
+	if err := s.synchronizeSocios(ctx, cfg, bitrixClient, socioRepo, toSync, bitrixSocios, state, result); err != nil {
+		return err
+	}
+
+	// Handle Bitrix items whose socio is no longer in Sage. The socios of a
+	// Sage database that failed are missing without having left Sage.
+	if failed := failedDatabases(socioRepo); len(failed) > 0 {
+		s.logger.Printf("⚠️  Not removing Bitrix24 socios missing from Sage: databases %s failed", strings.Join(failed, ", "))
+		if state != nil {
+			state.LastFull = time.Now()
+		}
+		return nil
+	}
+	inSage := s.sageDNIs(ctx, cfg, socioRepo, sageSocios, result)
+	if err := s.reconcileDeletions(ctx, cfg, bitrixClient, inSage, bitrixSocios, result); err != nil {
+		return err
+	}
+
+	if state != nil {
+		state.prune(inSage)
+		state.LastFull = time.Now()
+	}
+	return nil
+}
+
 // synchronizeSocios implements the core sync logic.
-func (s *Service) synchronizeSocios(ctx context.Context, bitrixClient *bitrix.Client, sageSocios []*models.Socio, bitrixSocios []bitrix.BitrixSocio, result *SyncResult) error {
-	// Create a map of existing Bitrix socios by DNI for quick lookup.
+func (s *Service) synchronizeSocios(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, socioRepo SocioSource, sageSocios []*models.Socio, bitrixSocios []bitrix.BitrixSocio, state *clientState, result *SyncResult) error {
+	// Create a map of existing Bitrix socios by normalized DNI for quick
+	// lookup. Items colliding once normalized are handled as duplicates.
 	bitrixMap := make(map[string]*bitrix.BitrixSocio)
 	for i := range bitrixSocios {
-		if bitrixSocios[i].DNI != "" {
-			bitrixMap[bitrixSocios[i].DNI] = &bitrixSocios[i]
+		if dni := models.NormalizeDNI(bitrixSocios[i].DNI); dni != "" {
+			bitrixMap[dni] = &bitrixSocios[i]
 		}
 	}
 
-	// Process each Sage socio.
-	for _, sageSocio := range sageSocios {
-		if sageSocio.DNI == "" {
-			s.logger.Printf("⚠️  Skipping socio with empty DNI")
-			result.SociosSkipped++
-			continue
+	// Handle DNIs that appear on more than one Bitrix item.
+	if err := s.handleDuplicates(ctx, cfg, bitrixClient, bitrixSocios, bitrixMap, result); err != nil {
+		return err
+	}
+
+	// Dry runs do not load the state for syncing, but conflicts are told
+	// from it; it is not saved.
+	if state == nil && cfg.Sync.DryRun {
+		state = s.readState(cfg, bitrixClient)
+	}
+
+	// Copy Bitrix24 edits back to Sage first, so the sync does not undo them.
+	if err := s.writeBack(ctx, cfg, bitrixClient, socioRepo, sageSocios, bitrixMap, state, result); err != nil {
+		return err
+	}
+
+	return s.processSocios(ctx, cfg, bitrixClient, sageSocios, bitrixMap, state, result)
+}
+
+// itemOutcome is what happened to one Sage socio.
+type itemOutcome int
+
+const (
+	outcomeSkipped itemOutcome = iota
+	outcomeCreated
+	outcomeUpdated
+	outcomeFailed
+	outcomeDeactivated // Discontinued in Sage and deactivated in Bitrix24
+	outcomeAborted     // Interrupted by cancellation; not counted
+)
+
+// socioResult is the outcome of syncing one socio, applied to the SyncResult
+// by processSocios.
+type socioResult struct {
+	outcome    itemOutcome
+	createdID  int
+	skip       string // SyncResult.SkippedByReason key of a skipped item
+	errorMsg   string
+	errorCause string // Action and error without the DNI, to group repeats
+	err        error
+	unexpected bool // Failed on a non-JSON response
+
+	// Recorded in the plan of a dry run and in the item details.
+	bitrixID  int
+	changes   []bitrix.FieldChange
+	conflicts []FieldConflict
+	reason    string
+}
+
+// keptBitrix reports whether the item's Bitrix24 edit won over Sage.
+func (r socioResult) keptBitrix() bool {
+	return len(r.conflicts) > 0 && r.conflicts[0].Winner == WinnerBitrix
+}
+
+// record updates the incremental state: synced socios are remembered with
+// their hash, failed ones forgotten so the next run retries them. A kept
+// Bitrix24 edit leaves the state alone, so it is still told apart next run.
+func (r socioResult) record(state *clientState, socio *models.Socio) {
+	switch {
+	case r.keptBitrix():
+	case r.outcome == outcomeCreated && r.createdID > 0:
+		state.record(socio.DNI, socio.ContentHash(), r.createdID)
+		state.rememberFields(socio)
+	case (r.outcome == outcomeUpdated || r.outcome == outcomeSkipped) && r.bitrixID > 0:
+		state.record(socio.DNI, socio.ContentHash(), r.bitrixID)
+		state.rememberFields(socio)
+	case r.outcome == outcomeFailed:
+		state.forget(socio.DNI)
+	}
+}
+
+// detailActions names the ItemResult action for each outcome.
+var detailActions = map[itemOutcome]string{
+	outcomeSkipped:     ItemSkipped,
+	outcomeCreated:     ItemCreated,
+	outcomeUpdated:     ItemUpdated,
+	outcomeFailed:      ItemFailed,
+	outcomeDeactivated: ItemDeactivated,
+}
+
+// planActions names the action planned for each outcome.
+var planActions = map[itemOutcome]string{
+	outcomeSkipped:     PlanSkip,
+	outcomeCreated:     PlanCreate,
+	outcomeUpdated:     PlanUpdate,
+	outcomeDeactivated: PlanDeactivate,
+}
+
+// apply adds the item's outcome to the run result.
+func (r socioResult) apply(result *SyncResult, dni string) {
+	result.Conflicts += len(r.conflicts)
+	switch r.outcome {
+	case outcomeSkipped:
+		result.skip(r.skip, 1)
+	case outcomeCreated:
+		result.SociosCreated++
+		if r.createdID > 0 {
+			result.CreatedIDs[dni] = r.createdID
+		}
+	case outcomeUpdated:
+		result.SociosUpdated++
+	case outcomeDeactivated:
+		result.SociosDeactivated++
+	case outcomeFailed:
+		result.SociosFailed++
+		result.addItemError(dni, r.errorMsg, r.errorCause)
+		if r.unexpected {
+			result.UnexpectedResponses++
+		}
+	}
+
+	if action, ok := detailActions[r.outcome]; ok {
+		detail := ItemResult{DNI: dni, Action: action, BitrixID: r.bitrixID}
+		if r.outcome == outcomeCreated {
+			detail.BitrixID = r.createdID
+		}
+		for _, change := range r.changes {
+			detail.ChangedFields = append(detail.ChangedFields, change.Field)
+		}
+		if r.outcome == outcomeUpdated {
+			detail.Changes = redactChanges(result.redact, r.changes)
+		}
+		detail.Conflicts = redactConflicts(result.redact, r.conflicts)
+		if r.err != nil {
+			detail.Error = r.err.Error()
 		}
+		result.addDetail(detail)
+	}
 
-		// Check if socio exists in Bitrix24.
-		if bitrixSocio, exists := bitrixMap[sageSocio.DNI]; exists {
-			// Socio exists - check if update is needed
-			if bitrixClient.NeedsUpdate(bitrixSocio, sageSocio) {
-				s.logger.Printf("📝 Updating socio: DNI=%s, Name=%s", sageSocio.DNI, sageSocio.RazonSocialEmpleado)
+	if action, ok := planActions[r.outcome]; ok && result.Plan != nil {
+		result.Plan.add(PlannedAction{DNI: dni, Action: action, BitrixID: r.bitrixID, Changes: redactChanges(result.redact, r.changes), Reason: r.reason})
+	}
+}
 
-				err := bitrixClient.UpdateSocio(ctx, bitrixSocio.ID, sageSocio)
-				if err != nil {
-					errorMsg := fmt.Sprintf("Failed to update socio %s: %v", sageSocio.DNI, err)
-					s.logger.Printf("❌ %s", errorMsg)
-					result.Errors = append(result.Errors, errorMsg)
+// processSocios syncs the Sage socios with a pool of cfg.Sync.Concurrency
+// workers, recording each outcome in state if given. Item errors are recorded
+// and do not stop the others until the error budget is spent; that, a
+// transient Bitrix24 failure or cancellation stops handing out items and
+// waits for the ones in flight. Retryable failures get another go once all
+// socios were handed out (see retryFailed).
+func (s *Service) processSocios(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, sageSocios []*models.Socio, bitrixMap map[string]*bitrix.BitrixSocio, state *clientState, result *SyncResult) error {
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		fatal   error
+		aborted error
+		pending []pendingRetry
+	)
+	budget := &errorBudget{maxConsecutive: cfg.Sync.MaxErrors, maxRate: cfg.Sync.MaxErrorRate}
+	jobs := make(chan *models.Socio)
+	for range max(cfg.Sync.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sageSocio := range jobs {
+				if workerCtx.Err() != nil {
 					continue
 				}
 
-				result.SociosUpdated++
-			} else {
-				s.logger.Printf("⏭️  Socio unchanged: DNI=%s", sageSocio.DNI)
-				result.SociosSkipped++
+				r, err := s.syncSocioWithin(workerCtx, cfg, bitrixClient, sageSocio, bitrixMap, state, result.timeouts.ItemWrite)
+
+				mu.Lock()
+				if err != nil {
+					if fatal == nil {
+						fatal = err
+					}
+					cancel()
+				} else {
+					if retryable(cfg, r) {
+						pending = append(pending, pendingRetry{socio: sageSocio, result: r})
+					} else {
+						r.apply(result, sageSocio.DNI)
+						if state != nil {
+							r.record(state, sageSocio)
+						}
+					}
+					result.progress.advance(1)
+					if err := budget.add(r.outcome); err != nil && aborted == nil {
+						aborted = err
+						cancel()
+					}
+				}
+				mu.Unlock()
 			}
-		} else {
-			// Socio doesn't exist - create new one.
-			s.logger.Printf("✨ Creating new socio: DNI=%s, Name=%s", sageSocio.DNI, sageSocio.RazonSocialEmpleado)
+		}()
+	}
 
-			err := bitrixClient.CreateSocio(ctx, sageSocio)
-			if err != nil {
-				errorMsg := fmt.Sprintf("Failed to create socio %s: %v", sageSocio.DNI, err)
-				s.logger.Printf("❌ %s", errorMsg)
-				result.Errors = append(result.Errors, errorMsg)
-				continue
+feed:
+	for _, sageSocio := range sageSocios {
+		select {
+		case jobs <- sageSocio:
+		case <-workerCtx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if fatal == nil && aborted == nil && ctx.Err() == nil {
+		return s.retryFailed(ctx, cfg, bitrixClient, pending, bitrixMap, state, result)
+	}
+	failPending(pending, state, result)
+	if fatal != nil {
+		return bitrixError("", fatal)
+	}
+	if aborted != nil {
+		return aborted
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("sync cancelled: %w", ctx.Err())
+	}
+	return nil
+}
+
+// syncSocio creates or updates the Bitrix item of one Sage socio. An item
+// edited in Bitrix24 since the last sync in state is a conflict, settled by
+// SyncConfig.ConflictPolicy. The returned error is only set for transient
+// failures that should abort the run.
+func (s *Service) syncSocio(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, sageSocio *models.Socio, bitrixMap map[string]*bitrix.BitrixSocio, state *clientState) (socioResult, error) {
+	if models.NormalizeDNI(sageSocio.DNI) == "" {
+		s.logger.Printf("⚠️  Skipping socio with empty DNI")
+		return socioResult{outcome: outcomeSkipped, skip: SkipEmptyDNI, reason: "empty DNI"}, nil
+	}
+
+	// failed records a per-item error.
+	failed := func(action string, bitrixID int, err error) (socioResult, error) {
+		if IsTransient(err) {
+			return socioResult{}, err
+		}
+		if ctx.Err() != nil {
+			return socioResult{outcome: outcomeAborted}, nil
+		}
+		errorMsg := fmt.Sprintf("Failed to %s socio %s: %v", action, sageSocio.DNI, err)
+		s.logger.Printf("❌ %s", errorMsg)
+		return socioResult{
+			outcome:    outcomeFailed,
+			errorMsg:   errorMsg,
+			errorCause: fmt.Sprintf("%s: %v", action, err),
+			err:        err,
+			unexpected: errors.Is(err, bitrix.ErrUnexpectedResponse),
+			bitrixID:   bitrixID,
+		}, nil
+	}
+
+	bitrixSocio, exists := bitrixMap[models.NormalizeDNI(sageSocio.DNI)]
+	if !exists {
+		// Socio doesn't exist - create new one.
+		if cfg.Sync.DryRun {
+			return socioResult{outcome: outcomeCreated, reason: "not in Bitrix24"}, nil
+		}
+		s.logger.Printf("✨ Creating new socio: DNI=%s, Name=%s", sageSocio.DNI, sageSocio.RazonSocialEmpleado)
+
+		bitrixID, err := bitrixClient.CreateSocio(ctx, sageSocio)
+		if err != nil {
+			return failed("create", 0, err)
+		}
+		return socioResult{outcome: outcomeCreated, createdID: bitrixID}, nil
+	}
+
+	// Socio exists - check if update is needed.
+	changes := bitrixClient.Changes(bitrixSocio, sageSocio)
+	if len(changes) == 0 {
+		s.logger.Printf("⏭️  Socio unchanged: DNI=%s", sageSocio.DNI)
+		return socioResult{outcome: outcomeSkipped, skip: SkipUnchanged, bitrixID: bitrixSocio.ID, reason: "unchanged"}, nil
+	}
+	conflicts := fieldConflicts(cfg, bitrixSocio, sageSocio, changes, state)
+	if len(conflicts) > 0 {
+		s.logger.Printf("⚔️  Socio %s was edited in Bitrix24 and differs from Sage on %d fields, keeping %s (%s)",
+			sageSocio.DNI, len(conflicts), conflicts[0].Winner, cfg.Sync.ConflictPolicy)
+		if conflicts[0].Winner == WinnerBitrix {
+			return socioResult{outcome: outcomeSkipped, skip: SkipBitrixEdit, bitrixID: bitrixSocio.ID, changes: changes, conflicts: conflicts, reason: "Bitrix24 edit kept"}, nil
+		}
+	}
+
+	if cfg.Sync.DryRun {
+		return socioResult{outcome: outcomeUpdated, bitrixID: bitrixSocio.ID, changes: changes, conflicts: conflicts}, nil
+	}
+
+	s.logger.Printf("📝 Updating socio: DNI=%s, Name=%s", sageSocio.DNI, sageSocio.RazonSocialEmpleado)
+	s.rollback.record(bitrixClient, PlanUpdate, bitrixSocio, sageSocio)
+	if err := bitrixClient.UpdateSocio(ctx, bitrixSocio.ID, sageSocio); err != nil {
+		return failed("update", bitrixSocio.ID, err)
+	}
+
+	// The update went through; a failed comment is only worth a warning.
+	if err := bitrixClient.CommentChanges(ctx, bitrixSocio.ID, redactChanges(s.redactor, changes)); err != nil {
+		s.logger.Printf("⚠️  %v", err)
+	}
+	return socioResult{outcome: outcomeUpdated, bitrixID: bitrixSocio.ID, changes: changes, conflicts: conflicts}, nil
+}
+
+// syncSocioWithin is syncSocio bounded by timeout. A socio that runs out
+// of time fails the run with ErrPhaseTimeout, as a hung write would
+// otherwise be indistinguishable from a cancelled run.
+func (s *Service) syncSocioWithin(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, sageSocio *models.Socio, bitrixMap map[string]*bitrix.BitrixSocio, state *clientState, timeout time.Duration) (socioResult, error) {
+	itemCtx, cancel := phaseContext(ctx, timeout)
+	defer cancel()
+
+	r, err := s.syncSocio(itemCtx, cfg, bitrixClient, sageSocio, bitrixMap, state)
+	cause := err
+	if r.outcome == outcomeAborted && cause == nil {
+		cause = itemCtx.Err()
+	}
+	if timeoutErr := phaseError(itemCtx, ctx, "write of socio "+sageSocio.DNI, timeout, cause); errors.Is(timeoutErr, ErrPhaseTimeout) {
+		return socioResult{}, timeoutErr
+	}
+	return r, err
+}
+
+// beginRun gives the run its ID and opens its run log. The returned
+// context sends the ID to Bitrix24 with every request, and the returned
+// Service logs every line of the run prefixed with it.
+func (s *Service) beginRun(ctx context.Context, cfg *config.Config, result *SyncResult) (context.Context, *Service) {
+	result.RunID = uuid.NewString()
+
+	run := *s
+	run.logger = log.New(s.logger.Writer(), s.logger.Prefix()+"run="+result.RunID+" ", s.logger.Flags())
+	result.runLog = openRunLog(cfg, result, result.RunID, run.logger)
+	run.rollback = openRollbackLog(cfg, result, run.logger)
+	result.onItem = run.itemHook(result)
+	result.redact = s.redactor
+	return bitrix.WithRunID(ctx, result.RunID), &run
+}
+
+// handleDuplicates reports Bitrix items sharing a DNI and applies the
+// configured duplicate policy, pointing bitrixMap at the item to sync into.
+func (s *Service) handleDuplicates(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, bitrixSocios []bitrix.BitrixSocio, bitrixMap map[string]*bitrix.BitrixSocio, result *SyncResult) error {
+	duplicates := bitrix.FindDuplicates(bitrixSocios)
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	dnis := make([]string, 0, len(duplicates))
+	for dni := range duplicates {
+		dnis = append(dnis, dni)
+	}
+	sort.Strings(dnis)
+
+	for _, dni := range dnis {
+		group := duplicates[dni]
+		ids := make([]string, len(group))
+		for i, item := range group {
+			ids[i] = strconv.Itoa(item.ID)
+		}
+
+		warning := fmt.Sprintf("Duplicate DNI %s in Bitrix24 (items %s)", dni, strings.Join(ids, ", "))
+		s.logger.Printf("⚠️  %s", warning)
+		result.addWarning(IssueDuplicateBitrix, dni, warning)
+
+		if cfg.Sync.DuplicatePolicy == config.DuplicatePolicyWarn {
+			continue
+		}
+
+		// Sync into the newest item.
+		newest := group[0]
+		for i := range bitrixSocios {
+			if bitrixSocios[i].ID == newest.ID {
+				bitrixMap[dni] = &bitrixSocios[i]
+				break
 			}
+		}
 
-			result.SociosCreated++
+		if cfg.Sync.DuplicatePolicy != config.DuplicatePolicyMerge {
+			continue
 		}
 
-		// Check for context cancellation.
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("sync cancelled: %w", ctx.Err())
-		default:
-			// Continue processing.
+		// The newest item gets every field from Sage on update, so the
+		// extras can go.
+		for _, extra := range group[1:] {
+			if cfg.Sync.DryRun {
+				result.Plan.add(PlannedAction{DNI: dni, Action: PlanDelete, BitrixID: extra.ID,
+					Reason: fmt.Sprintf("duplicate of item %d", newest.ID)})
+				result.DuplicatesDeleted++
+				continue
+			}
+
+			s.rollback.record(bitrixClient, PlanDelete, &extra, nil)
+			err := bitrixClient.DeleteSocio(ctx, extra.ID)
+			if IsTransient(err) {
+				return bitrixError("", err)
+			}
+			if err != nil && !errors.Is(err, bitrix.ErrNotFound) {
+				errorMsg := fmt.Sprintf("Failed to delete duplicate %d of socio %s: %v", extra.ID, dni, err)
+				s.logger.Printf("❌ %s", errorMsg)
+				result.addError(IssueItemFailed, dni, errorMsg)
+				result.addDetail(ItemResult{DNI: dni, Action: ItemFailed, BitrixID: extra.ID, Error: err.Error()})
+				continue
+			}
+			result.DuplicatesDeleted++
+			result.addDetail(ItemResult{DNI: dni, Action: ItemDeleted, BitrixID: extra.ID})
 		}
 	}
 
 	return nil
 }
 
-// connectToSage establishes connection to Sage database.
-func (s *Service) connectToSage(cfg *config.Config) (*sql.DB, error) {
+// connectToSage establishes connection to Sage database, giving up when ctx
+// is done.
+func connectToSage(ctx context.Context, cfg *config.Config, logger *log.Logger) (*sql.DB, error) {
 	connString := cfg.GetConnectionString()
 
-	s.logger.Printf("🔌 Connecting to Sage database: %s@%s:%d/%s",
-		cfg.SageDB.Username, cfg.SageDB.Host, cfg.SageDB.Port, cfg.SageDB.Database)
+	logger.Printf("🔌 Connecting to Sage database: %s@%s:%d/%s",
+		cfg.SageDB.Login(), cfg.SageDB.Host, cfg.SageDB.Port, cfg.SageDB.Database)
 
 	db, err := sql.Open("sqlserver", connString)
 	if err != nil {
@@ -186,18 +986,148 @@ func (s *Service) connectToSage(cfg *config.Config) (*sql.DB, error) {
 	db.SetConnMaxLifetime(5 * time.Minute)
 
 	// Test the connection.
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	if err := db.PingContext(ctx); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	s.logger.Printf("✅ Connected to Sage database successfully")
+	logger.Printf("✅ Connected to Sage database successfully")
 	return db, nil
 }
 
+// bitrixOptions builds the Bitrix24 client options from configuration and
+// the service's portal coordinator.
+func (s *Service) bitrixOptions(cfg *config.Config) ([]bitrix.Option, error) {
+	listTimeout := time.Duration(cfg.Bitrix.ListTimeoutSeconds) * time.Second
+	writeTimeout := time.Duration(cfg.Bitrix.WriteTimeoutSeconds) * time.Second
+
+	opts := []bitrix.Option{
+		bitrix.WithTimeout(time.Duration(cfg.Bitrix.TimeoutSeconds) * time.Second),
+		bitrix.WithMethodTimeout("crm.item.list", listTimeout),
+		bitrix.WithMethodTimeout("crm.item.add", writeTimeout),
+		bitrix.WithMethodTimeout("crm.item.update", writeTimeout),
+		bitrix.WithMethodTimeout("crm.item.delete", writeTimeout),
+		bitrix.WithFieldMapping(cfg.Bitrix.Fields),
+		bitrix.WithSyncedFields(cfg.Bitrix.SyncedFields),
+	}
+
+	if cfg.Bitrix.EntityTypeID > 0 {
+		opts = append(opts, bitrix.WithEntityTypeID(cfg.Bitrix.EntityTypeID))
+	}
+
+	if cfg.Bitrix.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.Bitrix.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		opts = append(opts, bitrix.WithProxy(proxyURL))
+	}
+
+	if cfg.Bitrix.CAFile != "" {
+		pool, err := bitrix.LoadCAPool(cfg.Bitrix.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, bitrix.WithRootCAs(pool))
+	}
+
+	if cfg.Bitrix.InsecureSkipVerify {
+		opts = append(opts, bitrix.WithInsecureSkipVerify())
+	}
+
+	userAgent := cfg.Bitrix.UserAgent
+	if userAgent == "" {
+		userAgent = bitrix.UserAgent(cfg.Bitrix.ClientCode)
+	}
+	opts = append(opts, bitrix.WithUserAgent(userAgent))
+
+	opts = append(opts, bitrix.WithRateLimit(cfg.Bitrix.RateLimit, cfg.Bitrix.RateBurst))
+	opts = append(opts, bitrix.WithCircuitBreaker(cfg.Bitrix.BreakerThreshold,
+		time.Duration(cfg.Bitrix.BreakerCooldownSeconds)*time.Second))
+	if s.portals != nil {
+		opts = append(opts, bitrix.WithPortalCoordinator(s.portals))
+	}
+
+	if cfg.Bitrix.VerifyCreates {
+		opts = append(opts, bitrix.WithVerifyWrites(true))
+	}
+
+	if cfg.Bitrix.TitleTemplate != "" {
+		tmpl, err := models.ParseTitleTemplate(cfg.Bitrix.TitleTemplate)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, bitrix.WithTitleTemplate(tmpl))
+	}
+
+	if cfg.Bitrix.CategoryID > 0 || cfg.Bitrix.StageID != "" {
+		opts = append(opts, bitrix.WithPipeline(cfg.Bitrix.CategoryID, cfg.Bitrix.StageID, cfg.Bitrix.UpdateStage))
+	}
+
+	if cfg.Bitrix.AssignedByID > 0 {
+		opts = append(opts, bitrix.WithAssignee(cfg.Bitrix.AssignedByID, cfg.Bitrix.EnforceAssignee))
+	}
+
+	if cfg.Bitrix.TimelineComments {
+		opts = append(opts, bitrix.WithTimelineComments())
+	}
+
+	if cfg.Bitrix.ActiveField != "" || cfg.Bitrix.InactiveStageID != "" {
+		opts = append(opts, bitrix.WithDeactivation(cfg.Bitrix.ActiveField, cfg.Bitrix.InactiveStageID))
+	}
+
+	if code, _ := cfg.Company.SageEmpresa(); cfg.Bitrix.EmpresaField != "" || code > 0 {
+		opts = append(opts, bitrix.WithEmpresa(cfg.Bitrix.EmpresaField, code))
+	}
+
+	if cfg.Bitrix.CompanyCIFField != "" {
+		opts = append(opts, bitrix.WithCompanyCIFField(cfg.Bitrix.CompanyCIFField))
+	}
+	if cfg.Bitrix.ContactTaxIDField != "" {
+		opts = append(opts, bitrix.WithContactTaxIDField(cfg.Bitrix.ContactTaxIDField))
+	}
+	if cfg.Bitrix.DealInvoiceField != "" {
+		opts = append(opts, bitrix.WithDealInvoiceField(cfg.Bitrix.DealInvoiceField))
+	}
+	if cfg.Bitrix.ProductSKUProperty != "" {
+		opts = append(opts, bitrix.WithProductSKUProperty(cfg.Bitrix.ProductSKUProperty))
+	}
+
+	if cfg.Bitrix.CompanyLinkField != "" {
+		opts = append(opts, bitrix.WithCompanyLink(bitrix.CompanyLink{
+			Field:         cfg.Bitrix.CompanyLinkField,
+			CodeField:     cfg.Bitrix.CompanyCodeField,
+			CreateMissing: cfg.Bitrix.MissingCompanyPolicy == config.MissingCompanyCreate,
+		}))
+	}
+
+	return opts, nil
+}
+
+// bitrixError wraps a Bitrix24 failure with context, collapsing open-circuit
+// and portal-unavailable errors so the run reports a single clear cause.
+func bitrixError(msg string, err error) error {
+	if errors.Is(err, bitrix.ErrCircuitOpen) {
+		return fmt.Errorf("%w: %w", ErrEndpointUnavailable, err)
+	}
+	if errors.Is(err, bitrix.ErrPortalUnavailable) {
+		return fmt.Errorf("aborting sync: %w", err)
+	}
+	if msg == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// IsTransient reports whether a sync failed because Bitrix24 was temporarily
+// unreachable (open circuit, maintenance window, reset connections), or a
+// Sage query timed out, in which case the whole run should be retried later
+// with backoff.
+func IsTransient(err error) bool {
+	return errors.Is(err, bitrix.ErrCircuitOpen) || errors.Is(err, bitrix.ErrPortalUnavailable) ||
+		errors.Is(err, repository.ErrQueryTimeout)
+}
+
 // completeResult helper to complete sync result with error.
 func (s *Service) completeResult(result *SyncResult, err error) (*SyncResult, error) {
 	result.Success = false
@@ -205,10 +1135,22 @@ func (s *Service) completeResult(result *SyncResult, err error) (*SyncResult, er
 	result.Duration = result.EndTime.Sub(result.StartTime).String()
 
 	if err != nil {
+		if errors.Is(err, bitrix.ErrUnexpectedResponse) {
+			result.UnexpectedResponses++
+		}
 		errorMsg := err.Error()
-		result.Errors = append(result.Errors, errorMsg)
+		result.addError(IssueRunFailed, "", errorMsg)
 		s.logger.Printf("❌ Sync failed: %s", errorMsg)
 	}
 
 	return result, err
 }
+
+// connectSage connects to Sage within the SageConnect timeout; release is
+// called when the run is over.
+func (s *Service) connectSage(ctx context.Context, cfg *config.Config, timeouts Timeouts) (db *sql.DB, release func() error, err error) {
+	connectCtx, cancel := phaseContext(ctx, timeouts.SageConnect)
+	defer cancel()
+	db, release, err = s.openSage(connectCtx, cfg, s.logger)
+	return db, release, phaseError(connectCtx, ctx, "Sage connection", timeouts.SageConnect, err)
+}
@@ -0,0 +1,471 @@
+package sync
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+	"github.com/arduriki/sage-bitrix-sync/internal/repository/repositorytest"
+)
+
+// TestSyncSociosConcurrentState runs the worker pool over socios that are
+// both looked up in the state (edited in Bitrix24, so checked for
+// conflicts) and recorded in it; run with -race.
+func TestSyncSociosConcurrentState(t *testing.T) {
+	const n = 64
+
+	source := &fakeSource{}
+	target := newFakeTarget(t)
+	target.writeDelay = time.Millisecond
+	edited := time.Now()
+	for i := 1; i <= n; i++ {
+		socio := testSocio(i)
+		source.socios = append(source.socios, socio)
+		if i%2 == 0 {
+			item := bitrixItem(i, socio)
+			item.Title = "Edited in Bitrix24"
+			item.UpdatedTime = &edited
+			target.add(item)
+		}
+	}
+
+	cfg := testConfig()
+	cfg.Sync.Concurrency = 8
+	cfg.Sync.ConflictPolicy = config.ConflictSageWins
+	cfg.Sync.StatePath = filepath.Join(t.TempDir(), "state.json")
+
+	result, err := testService(source, target).SyncSocios(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("SyncSocios: %v", err)
+	}
+	if result.SociosCreated != n/2 || result.SociosUpdated != n/2 {
+		t.Errorf("created %d and updated %d socios, want %d each", result.SociosCreated, result.SociosUpdated, n/2)
+	}
+
+	state, err := (&stateStore{path: cfg.Sync.StatePath}).load(cfg.Company.BitrixCode, target.PortalHost(), target.EntityTypeID())
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if len(state.Items) != n {
+		t.Errorf("state holds %d socios, want %d", len(state.Items), n)
+	}
+	for _, socio := range source.socios {
+		if !state.unchanged(socio.DNI, socio.ContentHash()) {
+			t.Errorf("socio %s not recorded with its hash", socio.DNI)
+		}
+	}
+}
+
+// TestSyncSociosMatrix runs a socios sync against fakes for each way a
+// socio can end up: created, updated, skipped, failed, settled as a
+// conflict, or removed from Sage.
+func TestSyncSociosMatrix(t *testing.T) {
+	hourAgo := time.Now().Add(-time.Hour)
+	now := time.Now()
+
+	// edited is the item of socio n changed in Bitrix24 after Sage.
+	edited := func(n int) bitrix.BitrixSocio {
+		item := bitrixItem(n, testSocio(n))
+		item.Title = "Edited in Bitrix24"
+		item.UpdatedTime = &now
+		return item
+	}
+	// stale is the item of socio n with an outdated cargo.
+	stale := func(n int) bitrix.BitrixSocio {
+		item := bitrixItem(n, testSocio(n))
+		item.Cargo = "Vocal"
+		return item
+	}
+	// messy is socio n with its DNI as typed by hand into Sage.
+	messy := func(n int) *models.Socio {
+		socio := testSocio(n)
+		dni := strings.ToLower(socio.DNI)
+		socio.DNI = " " + dni[:4] + "." + dni[4:8] + "-" + dni[8:] + " "
+		return socio
+	}
+	// dashed is the item of socio n with its DNI stored unnormalized.
+	dashed := func(n int) bitrix.BitrixSocio {
+		item := bitrixItem(n, testSocio(n))
+		item.DNI = item.DNI[:8] + "-" + item.DNI[8:]
+		return item
+	}
+	// stamped is socio n as last modified in Sage an hour ago.
+	stamped := func(n int) *models.Socio {
+		socio := testSocio(n)
+		socio.UpdatedAt = &hourAgo
+		return socio
+	}
+
+	tests := []struct {
+		name   string
+		sage   []*models.Socio
+		bitrix []bitrix.BitrixSocio
+		config func(*config.Config)
+		fail   map[string]error
+
+		created, updated, skipped, failed, deactivated, deleted, conflicts int
+		skipReason                                                         string
+	}{
+		{
+			name:    "create",
+			sage:    []*models.Socio{testSocio(1)},
+			created: 1,
+		},
+		{
+			name:    "update",
+			sage:    []*models.Socio{testSocio(1)},
+			bitrix:  []bitrix.BitrixSocio{stale(1)},
+			updated: 1,
+		},
+		{
+			name:       "skip unchanged",
+			sage:       []*models.Socio{testSocio(1)},
+			bitrix:     []bitrix.BitrixSocio{bitrixItem(1, testSocio(1))},
+			skipped:    1,
+			skipReason: SkipUnchanged,
+		},
+		{
+			name:       "messy DNI in Sage",
+			sage:       []*models.Socio{messy(1)},
+			bitrix:     []bitrix.BitrixSocio{bitrixItem(1, testSocio(1))},
+			skipped:    1,
+			skipReason: SkipUnchanged,
+		},
+		{
+			name:    "messy DNI in Bitrix24",
+			sage:    []*models.Socio{testSocio(1)},
+			bitrix:  []bitrix.BitrixSocio{dashed(1)},
+			updated: 1,
+		},
+		{
+			name:       "duplicate DNI in Sage",
+			sage:       []*models.Socio{testSocio(1), messy(1), testSocio(2)},
+			created:    2,
+			skipped:    1,
+			skipReason: SkipDuplicateDNI,
+		},
+		{
+			name:    "error",
+			sage:    []*models.Socio{testSocio(1), testSocio(2)},
+			fail:    map[string]error{testDNI(1): errors.New("rejected")},
+			created: 1,
+			failed:  1,
+		},
+		{
+			name:      "conflict sage wins",
+			sage:      []*models.Socio{stamped(1)},
+			bitrix:    []bitrix.BitrixSocio{edited(1)},
+			config:    func(cfg *config.Config) { cfg.Sync.ConflictPolicy = config.ConflictSageWins },
+			updated:   1,
+			conflicts: 1,
+		},
+		{
+			name:       "conflict bitrix wins",
+			sage:       []*models.Socio{stamped(1)},
+			bitrix:     []bitrix.BitrixSocio{edited(1)},
+			config:     func(cfg *config.Config) { cfg.Sync.ConflictPolicy = config.ConflictBitrixWins },
+			skipped:    1,
+			conflicts:  1,
+			skipReason: SkipBitrixEdit,
+		},
+		{
+			name:       "conflict newest wins",
+			sage:       []*models.Socio{stamped(1)},
+			bitrix:     []bitrix.BitrixSocio{edited(1)},
+			config:     func(cfg *config.Config) { cfg.Sync.ConflictPolicy = config.ConflictNewestWins },
+			skipped:    1,
+			conflicts:  1,
+			skipReason: SkipBitrixEdit,
+		},
+		{
+			name:       "deletion ignored",
+			sage:       []*models.Socio{testSocio(1)},
+			bitrix:     []bitrix.BitrixSocio{bitrixItem(1, testSocio(1)), bitrixItem(2, testSocio(2))},
+			skipped:    1,
+			skipReason: SkipUnchanged,
+		},
+		{
+			name:        "deletion marked",
+			sage:        []*models.Socio{testSocio(1)},
+			bitrix:      []bitrix.BitrixSocio{bitrixItem(1, testSocio(1)), bitrixItem(2, testSocio(2))},
+			config:      func(cfg *config.Config) { cfg.Sync.DeletionPolicy = config.DeletionPolicyMark },
+			skipped:     1,
+			deactivated: 1,
+			skipReason:  SkipUnchanged,
+		},
+		{
+			name:       "deletion deleted",
+			sage:       []*models.Socio{testSocio(1)},
+			bitrix:     []bitrix.BitrixSocio{bitrixItem(1, testSocio(1)), bitrixItem(2, testSocio(2))},
+			config:     func(cfg *config.Config) { cfg.Sync.DeletionPolicy = config.DeletionPolicyDelete },
+			skipped:    1,
+			deleted:    1,
+			skipReason: SkipUnchanged,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &fakeSource{socios: tt.sage}
+			target := newFakeTarget(t)
+			target.failWrites = tt.fail
+			for _, item := range tt.bitrix {
+				target.add(item)
+			}
+			cfg := testConfig()
+			if tt.config != nil {
+				tt.config(cfg)
+			}
+
+			result, err := testService(source, target).SyncSocios(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("SyncSocios: %v", err)
+			}
+
+			got := [7]int{result.SociosCreated, result.SociosUpdated, result.SociosSkipped, result.SociosFailed,
+				result.SociosDeactivated, result.SociosDeleted, result.Conflicts}
+			want := [7]int{tt.created, tt.updated, tt.skipped, tt.failed, tt.deactivated, tt.deleted, tt.conflicts}
+			if got != want {
+				t.Errorf("created, updated, skipped, failed, deactivated, deleted, conflicts = %v, want %v", got, want)
+			}
+			if tt.skipReason != "" && result.SkippedByReason[tt.skipReason] != tt.skipped {
+				t.Errorf("skipped by reason %v, want %d %s", result.SkippedByReason, tt.skipped, tt.skipReason)
+			}
+			if result.Success != (tt.failed == 0) {
+				t.Errorf("Success = %v with %d failures", result.Success, tt.failed)
+			}
+
+			// The fake records only the writes that went through.
+			if len(target.created) != tt.created || len(target.updated) != tt.updated ||
+				len(target.deactivated) != tt.deactivated || len(target.deleted) != tt.deleted {
+				t.Errorf("Bitrix24 writes: %d created, %d updated, %d deactivated, %d deleted",
+					len(target.created), len(target.updated), len(target.deactivated), len(target.deleted))
+			}
+		})
+	}
+}
+
+// fixtureSource returns the in-memory Sage repository of the shared fixture.
+func fixtureSource(t *testing.T) *repositorytest.Socios {
+	t.Helper()
+	source, err := repositorytest.LoadSocios("../repository/repositorytest/testdata/socios.json")
+	if err != nil {
+		t.Fatalf("LoadSocios: %v", err)
+	}
+	return source
+}
+
+// TestSyncSociosFromFixture syncs the fixture into an empty portal and
+// back again: each socio's latest row is created once, then left alone.
+func TestSyncSociosFromFixture(t *testing.T) {
+	source := fixtureSource(t)
+	target := newFakeTarget(t)
+	cfg := testConfig()
+
+	result, err := testService(source, target).SyncSocios(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("first SyncSocios: %v", err)
+	}
+	if result.SociosProcessed != 3 || result.SociosCreated != 3 {
+		t.Errorf("first run processed %d and created %d socios, want 3 and 3", result.SociosProcessed, result.SociosCreated)
+	}
+	if item, _ := target.GetSocioByDNI(context.Background(), "12345678Z"); item == nil || item.Participacion != "60.00" {
+		t.Errorf("socio 12345678Z synced as %+v, want its 2024 row", item)
+	}
+
+	result, err = testService(source, target).SyncSocios(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("second SyncSocios: %v", err)
+	}
+	if result.SociosSkipped != 3 || len(target.created) != 3 || len(target.updated) != 0 {
+		t.Errorf("second run skipped %d socios and wrote %d creates and %d updates in all, want 3, 3 and 0",
+			result.SociosSkipped, len(target.created), len(target.updated))
+	}
+}
+
+// TestSyncSociosSageFailure fails the run when Sage cannot be read,
+// writing nothing.
+func TestSyncSociosSageFailure(t *testing.T) {
+	source := fixtureSource(t)
+	source.Fail(repositorytest.MethodGetAll, errors.New("database down"))
+	target := newFakeTarget(t)
+
+	result, err := testService(source, target).SyncSocios(context.Background(), testConfig())
+	if err == nil || result.Success {
+		t.Fatalf("SyncSocios = success %v, %v, want a failure", result.Success, err)
+	}
+	if len(target.created) != 0 {
+		t.Errorf("%d socios created after Sage failed", len(target.created))
+	}
+}
+
+// TestSyncSociosIncremental only reads the socios modified since the last
+// run once a full run set the Sage cursor.
+func TestSyncSociosIncremental(t *testing.T) {
+	source := fixtureSource(t)
+	target := newFakeTarget(t)
+	cfg := testConfig()
+	cfg.Sync.StatePath = filepath.Join(t.TempDir(), "state.json")
+
+	if _, err := testService(source, target).SyncSocios(context.Background(), cfg); err != nil {
+		t.Fatalf("full SyncSocios: %v", err)
+	}
+
+	source.Add(&models.Socio{CodigoEmpresa: 1, DNI: "X1234567L", PorParticipacion: 45, RazonSocialEmpleado: "Smith, John", Ejercicio: 2025}, time.Now())
+	result, err := testService(source, target).SyncSocios(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("incremental SyncSocios: %v", err)
+	}
+	if !result.Incremental || result.SociosProcessed != 1 || result.SociosUpdated != 1 {
+		t.Errorf("incremental %v run processed %d and updated %d socios, want 1 and 1",
+			result.Incremental, result.SociosProcessed, result.SociosUpdated)
+	}
+	if got := source.Calls(repositorytest.MethodGetModifiedSince); got != 1 {
+		t.Errorf("GetModifiedSince called %d times, want 1", got)
+	}
+}
+
+// TestSyncSociosDNIQueryFailure checks removals against the socios read
+// when the DNI-only query fails, so no socio is taken for removed.
+func TestSyncSociosDNIQueryFailure(t *testing.T) {
+	source := fixtureSource(t)
+	source.Fail(repositorytest.MethodGetAllDNIs, errors.New("timeout"))
+	target := newFakeTarget(t)
+	for i, socio := range fixtureLatest(t, source) {
+		target.add(bitrixItem(i+1, socio))
+	}
+	cfg := testConfig()
+	cfg.Sync.DeletionPolicy = config.DeletionPolicyDelete
+
+	result, err := testService(source, target).SyncSocios(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("SyncSocios: %v", err)
+	}
+	if result.SociosDeleted != 0 || result.SociosSkipped != 3 {
+		t.Errorf("deleted %d and skipped %d socios, want 0 and 3", result.SociosDeleted, result.SociosSkipped)
+	}
+	if got := source.Calls(repositorytest.MethodGetAllDNIs); got != 1 {
+		t.Errorf("GetAllDNIs called %d times, want 1", got)
+	}
+}
+
+// fixtureLatest returns the socios the fixture repository serves.
+func fixtureLatest(t *testing.T, source *repositorytest.Socios) []*models.Socio {
+	t.Helper()
+	socios, err := source.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	return socios
+}
+
+// BenchmarkSyncSociosConcurrency creates socios in a Bitrix24 with a
+// round trip of a few milliseconds, sequentially and with worker pools of
+// growing size.
+func BenchmarkSyncSociosConcurrency(b *testing.B) {
+	const n = 100
+
+	source := &fakeSource{}
+	for i := 1; i <= n; i++ {
+		source.socios = append(source.socios, testSocio(i))
+	}
+
+	for _, workers := range []int{1, 4, 8, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cfg := testConfig()
+			cfg.Sync.Concurrency = workers
+			for i := 0; i < b.N; i++ {
+				target := newFakeTarget(b)
+				target.writeDelay = 2 * time.Millisecond
+
+				result, err := testService(source, target).SyncSocios(context.Background(), cfg)
+				if err != nil {
+					b.Fatalf("SyncSocios: %v", err)
+				}
+				if result.SociosCreated != n {
+					b.Fatalf("created %d socios, want %d", result.SociosCreated, n)
+				}
+			}
+		})
+	}
+}
+
+// TestSyncSociosDuplicateRows syncs a socio Sage returns a row of per
+// ejercicio, then syncs it again with the rows in the opposite order: the
+// latest row is created, and then left alone rather than flapping.
+func TestSyncSociosDuplicateRows(t *testing.T) {
+	older, latest := testSocio(1), testSocio(1)
+	older.Ejercicio, older.CargoAdministrador = 2023, "Vocal"
+	latest.Ejercicio = 2024
+
+	source := &fakeSource{socios: []*models.Socio{latest, older}}
+	target := newFakeTarget(t)
+	service := testService(source, target)
+
+	for run, want := range []struct{ created, skipped int }{{1, 1}, {0, 2}} {
+		result, err := service.SyncSocios(context.Background(), testConfig())
+		if err != nil {
+			t.Fatalf("run %d: SyncSocios: %v", run+1, err)
+		}
+		if result.SociosCreated != want.created || result.SociosUpdated != 0 || result.SociosSkipped != want.skipped {
+			t.Errorf("run %d created %d, updated %d and skipped %d socios, want %d, 0 and %d",
+				run+1, result.SociosCreated, result.SociosUpdated, result.SociosSkipped, want.created, want.skipped)
+		}
+		if result.SkippedByReason[SkipDuplicateRow] != 1 {
+			t.Errorf("run %d skipped %v, want 1 %s", run+1, result.SkippedByReason, SkipDuplicateRow)
+		}
+		source.socios = []*models.Socio{older, latest}
+	}
+
+	items, _ := target.ListSocios(context.Background())
+	if len(items) != 1 || items[0].Cargo != latest.CargoAdministrador {
+		t.Errorf("Bitrix24 items = %+v, want one with cargo %s", items, latest.CargoAdministrador)
+	}
+}
+
+// TestBitrixOptionsCAFile checks the client of a configuration with
+// BITRIX_CA_FILE trusts a portal whose certificate is in that file.
+func TestBitrixOptionsCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"result":{"items":[]}}`)
+	}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+
+	for _, trusted := range []bool{true, false} {
+		cfg := testConfig()
+		if trusted {
+			cfg.Bitrix.CAFile = caFile
+		}
+		opts, err := testService(nil, nil).bitrixOptions(cfg)
+		if err != nil {
+			t.Fatalf("bitrixOptions: %v", err)
+		}
+		client := bitrix.NewClient(server.URL+"/rest/1/key", log.New(io.Discard, "", 0), opts...)
+		_, err = client.ListSocios(context.Background())
+		if trusted && err != nil {
+			t.Errorf("listing with the CA file: %v", err)
+		}
+		if !trusted && !errors.Is(err, bitrix.ErrTLSVerification) {
+			t.Errorf("listing without the CA file: error = %v, want ErrTLSVerification", err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// stateItem is what the last successful sync of one socio left behind.
+type stateItem struct {
+	Hash     string    `json:"hash"` // models.Socio.ContentHash of the synced Sage values
+	BitrixID int       `json:"bitrix_id"`
+	SyncedAt time.Time `json:"synced_at"`
+
+	// Fields hashes each write-back field's synced value (see fieldHash), to
+	// tell which side edited it since.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// clientState is the incremental sync state of one client. Its methods are
+// safe for concurrent use by the sync workers; Items is only accessed
+// directly while no sync is running.
+type clientState struct {
+	Portal       string               `json:"portal"`
+	EntityTypeID int                  `json:"entity_type_id"`
+	LastFull     time.Time            `json:"last_full"`   // Last successful full reconciliation
+	SageCursor   time.Time            `json:"sage_cursor"` // When the last run without failures started reading Sage
+	Items        map[string]stateItem `json:"items"`       // By normalized DNI, see lookup
+
+	// fieldValues returns the write-back field values of a synced socio; nil
+	// when write-back is off.
+	fieldValues func(*models.Socio) map[string]string
+
+	mu sync.RWMutex // Guards Items
+}
+
+// lookup returns what the last sync of a socio left behind.
+func (cs *clientState) lookup(dni string) (stateItem, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	item, ok := cs.Items[models.NormalizeDNI(dni)]
+	return item, ok
+}
+
+// unchanged reports whether the socio was synced with this hash before.
+func (cs *clientState) unchanged(dni, hash string) bool {
+	item, ok := cs.lookup(dni)
+	return ok && item.Hash == hash
+}
+
+// record stores the outcome of a successful sync of a socio.
+func (cs *clientState) record(dni, hash string, bitrixID int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.Items[models.NormalizeDNI(dni)] = stateItem{Hash: hash, BitrixID: bitrixID, SyncedAt: time.Now()}
+}
+
+// rememberFields stores the hashes of a just-synced socio's write-back fields.
+func (cs *clientState) rememberFields(socio *models.Socio) {
+	if cs.fieldValues == nil {
+		return
+	}
+	fields := make(map[string]string)
+	for field, value := range cs.fieldValues(socio) {
+		fields[field] = fieldHash(value)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	key := models.NormalizeDNI(socio.DNI)
+	if item, ok := cs.Items[key]; ok {
+		item.Fields = fields
+		cs.Items[key] = item
+	}
+}
+
+// fieldHash hashes a field value for stateItem.Fields.
+func fieldHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+// forget drops a socio so the next run syncs it again.
+func (cs *clientState) forget(dni string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.Items, models.NormalizeDNI(dni))
+}
+
+// prune drops socios that are no longer in Sage, given by normalized DNI.
+func (cs *clientState) prune(inSage map[string]bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for dni := range cs.Items {
+		if !inSage[dni] {
+			delete(cs.Items, dni)
+		}
+	}
+}
+
+// stateStore persists the per-client incremental sync state in a JSON file.
+type stateStore struct {
+	path string
+}
+
+// load returns the state of a client. A missing file or client, or state
+// recorded for another portal or entity type, yields an empty state with no
+// full sync on record.
+func (ss *stateStore) load(clientID, portal string, entityTypeID int) (*clientState, error) {
+	fresh := &clientState{Portal: portal, EntityTypeID: entityTypeID, Items: make(map[string]stateItem)}
+
+	clients, err := ss.read()
+	if err != nil {
+		return fresh, err
+	}
+	state, ok := clients[clientID]
+	if !ok || state.Portal != portal || state.EntityTypeID != entityTypeID || state.Items == nil {
+		return fresh, nil
+	}
+	// Files written before DNIs were normalized keep them as in Sage.
+	for dni, item := range state.Items {
+		if key := models.NormalizeDNI(dni); key != dni {
+			delete(state.Items, dni)
+			state.Items[key] = item
+		}
+	}
+	return state, nil
+}
+
+// save stores a client's state, keeping the other clients' entries.
+func (ss *stateStore) save(clientID string, state *clientState) error {
+	clients, err := ss.read()
+	if err != nil {
+		clients = make(map[string]*clientState)
+	}
+	clients[clientID] = state
+
+	data, err := json.Marshal(clients)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync state: %w", err)
+	}
+
+	tmp := ss.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	return os.Rename(tmp, ss.path)
+}
+
+// read loads the state file; a missing file is an empty state.
+func (ss *stateStore) read() (map[string]*clientState, error) {
+	clients := make(map[string]*clientState)
+
+	data, err := os.ReadFile(ss.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return clients, nil
+		}
+		return clients, fmt.Errorf("failed to read sync state: %w", err)
+	}
+	if err := json.Unmarshal(data, &clients); err != nil {
+		return make(map[string]*clientState), fmt.Errorf("failed to parse sync state %s: %w", ss.path, err)
+	}
+	return clients, nil
+}
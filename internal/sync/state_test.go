@@ -0,0 +1,38 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// TestClientStateConcurrentUse hammers every clientState method from
+// several goroutines; run with -race.
+func TestClientStateConcurrentUse(t *testing.T) {
+	state := &clientState{Items: make(map[string]stateItem)}
+	state.fieldValues = func(s *models.Socio) map[string]string {
+		return map[string]string{"cargo": s.CargoAdministrador}
+	}
+
+	done := make(chan struct{})
+	for w := 0; w < 8; w++ {
+		go func(w int) {
+			defer func() { done <- struct{}{} }()
+			for i := 0; i < 100; i++ {
+				socio := testSocio(w*100 + i)
+				state.record(socio.DNI, socio.ContentHash(), i+1)
+				state.rememberFields(socio)
+				state.unchanged(socio.DNI, socio.ContentHash())
+				if i%10 == 0 {
+					state.forget(socio.DNI)
+				}
+				if i%50 == 0 {
+					state.prune(map[string]bool{models.NormalizeDNI(socio.DNI): true})
+				}
+			}
+		}(w)
+	}
+	for w := 0; w < 8; w++ {
+		<-done
+	}
+}
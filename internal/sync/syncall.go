@@ -0,0 +1,245 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+)
+
+// Outcomes of a client in SyncAll, from best to worst.
+const (
+	OutcomeSuccess = "success" // Every entity synced without errors
+	OutcomePartial = "partial" // Every entity ran, but with errors, e.g. failed items
+	OutcomeSkipped = "skipped" // Not started: FailFast, cancellation or backoff
+	OutcomeFailed  = "failed"  // An entity sync failed
+)
+
+// outcomeRank orders the outcomes for SyncAllReport.Outcome.
+var outcomeRank = map[string]int{
+	OutcomeSuccess: 0,
+	OutcomePartial: 1,
+	OutcomeSkipped: 2,
+	OutcomeFailed:  3,
+}
+
+// SyncAllOptions configures SyncAll.
+type SyncAllOptions struct {
+	// Parallelism is how many clients are synced at once; below 1 means 1
+	Parallelism int
+
+	// FailFast stops starting clients once one has failed; the ones running
+	// are left to finish
+	FailFast bool
+
+	// RateLimit caps the Bitrix24 requests per second of all clients
+	// together, on top of each client's own limit; 0 disables the cap
+	RateLimit float64
+	RateBurst int
+
+	// Backoff, when set, skips the clients whose last scheduled runs failed
+	// until their retry time, and records the outcome of the others. Leave
+	// it nil for manual runs
+	Backoff *RunBackoff
+}
+
+// ClientReport is the outcome of one client in SyncAll.
+type ClientReport struct {
+	ClientID string        `json:"client_id"`
+	Outcome  string        `json:"outcome"`
+	Results  []*SyncResult `json:"results,omitempty"` // One per entity, as from SyncEntities
+	Error    string        `json:"error,omitempty"`
+	RetryAt  *time.Time    `json:"retry_at,omitempty"` // Next attempt, when backing off
+}
+
+// SyncAllReport aggregates the runs of SyncAll.
+type SyncAllReport struct {
+	StartTime time.Time      `json:"start_time"`
+	EndTime   time.Time      `json:"end_time"`
+	Duration  string         `json:"duration"`
+	Outcome   string         `json:"outcome"` // Worst client outcome
+	Clients   []ClientReport `json:"clients"` // In the order of the configs
+
+	// Client counts by outcome.
+	Succeeded int `json:"succeeded"`
+	Partial   int `json:"partial"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+
+	// Item totals over every entity of every client.
+	Processed int `json:"processed"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Removed   int `json:"removed"` // Deactivated or deleted
+	Errors    int `json:"errors"`  // Failed items
+}
+
+// ExitCode maps the report's outcome to a process exit code: 0 when every
+// client succeeded, 2 when only items failed, 1 otherwise.
+func (r *SyncAllReport) ExitCode() int {
+	switch r.Outcome {
+	case OutcomeSuccess:
+		return 0
+	case OutcomePartial:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// SyncAll runs SyncEntities for every client configuration, opts.Parallelism
+// at a time, and aggregates the results. A failed client does not stop the
+// others unless opts.FailFast is set; the clients then left out are
+// reported as skipped. The report is returned even when clients failed; the
+// error is only set when ctx was cancelled.
+func (s *Service) SyncAll(ctx context.Context, cfgs []*config.Config, opts SyncAllOptions, syncOpts ...SyncOption) (*SyncAllReport, error) {
+	report := &SyncAllReport{
+		StartTime: time.Now(),
+		Clients:   make([]ClientReport, len(cfgs)),
+	}
+	for i, cfg := range cfgs {
+		report.Clients[i] = ClientReport{ClientID: cfg.Company.BitrixCode, Outcome: OutcomeSkipped}
+	}
+
+	if opts.RateLimit > 0 {
+		ctx = bitrix.WithSharedLimiter(ctx, bitrix.NewRateLimiter(opts.RateLimit, opts.RateBurst))
+	}
+	s.logger.Printf("🚀 Syncing %d clients, %d at a time", len(cfgs), max(opts.Parallelism, 1))
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		next    int
+		stopped bool
+	)
+	// take hands out the next client, or false once none should start.
+	take := func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if next == len(cfgs) || stopped || ctx.Err() != nil {
+			return 0, false
+		}
+		next++
+		return next - 1, true
+	}
+
+	for range max(opts.Parallelism, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, ok := take(); ok; i, ok = take() {
+				if opts.Backoff != nil {
+					if retryAt, wait := opts.Backoff.RetryAt(cfgs[i].Company.BitrixCode); wait {
+						status := "retrying at " + retryAt.Format("15:04")
+						s.logger.Printf("⏳ Client %s backing off: %s", cfgs[i].Company.BitrixCode, status)
+						mu.Lock()
+						report.Clients[i].Error = status
+						report.Clients[i].RetryAt = &retryAt
+						mu.Unlock()
+						continue
+					}
+				}
+
+				results, err := s.SyncEntities(ctx, cfgs[i], syncOpts...)
+				client := clientReport(cfgs[i], results, err)
+				if opts.Backoff != nil && ctx.Err() == nil {
+					s.recordBackoff(opts.Backoff, cfgs[i], &client)
+				}
+
+				mu.Lock()
+				report.Clients[i] = client
+				if client.Outcome == OutcomeFailed {
+					s.logger.Printf("❌ Client %s failed: %s", client.ClientID, client.Error)
+					if opts.FailFast && !stopped {
+						stopped = true
+						s.logger.Printf("⛔ Fail fast: not starting the remaining clients")
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	report.summarize()
+	s.logger.Printf("🏁 Synced %d clients in %s: %d succeeded, %d partial, %d skipped, %d failed",
+		len(cfgs), report.Duration, report.Succeeded, report.Partial, report.Skipped, report.Failed)
+
+	if ctx.Err() != nil {
+		return report, fmt.Errorf("sync cancelled: %w", ctx.Err())
+	}
+	return report, nil
+}
+
+// recordBackoff records a client's run in the backoff, annotating a failed
+// client with its retry time.
+func (s *Service) recordBackoff(backoff *RunBackoff, cfg *config.Config, client *ClientReport) {
+	if client.Outcome != OutcomeFailed {
+		if err := backoff.Succeeded(client.ClientID); err != nil {
+			s.logger.Printf("⚠️  Failed to save run backoff: %v", err)
+		}
+		return
+	}
+	interval := time.Duration(cfg.Sync.IntervalMinutes) * time.Minute
+	retryAt, err := backoff.Failed(client.ClientID, interval, client.Error)
+	if err != nil {
+		s.logger.Printf("⚠️  Failed to save run backoff: %v", err)
+	}
+	client.RetryAt = &retryAt
+	client.Error += " (retrying at " + retryAt.Format("15:04") + ")"
+}
+
+// clientReport builds the report of one client from its SyncEntities run.
+func clientReport(cfg *config.Config, results []*SyncResult, err error) ClientReport {
+	client := ClientReport{ClientID: cfg.Company.BitrixCode, Outcome: OutcomeSuccess, Results: results}
+	if err != nil {
+		client.Outcome = OutcomeFailed
+		client.Error = err.Error()
+		return client
+	}
+	for _, result := range results {
+		if !result.Success {
+			client.Outcome = OutcomePartial
+		}
+	}
+	return client
+}
+
+// summarize fills in the report's end time, counts, totals and outcome.
+func (r *SyncAllReport) summarize() {
+	r.EndTime = time.Now()
+	r.Duration = r.EndTime.Sub(r.StartTime).String()
+	r.Outcome = OutcomeSuccess
+
+	for _, client := range r.Clients {
+		switch client.Outcome {
+		case OutcomeSuccess:
+			r.Succeeded++
+		case OutcomePartial:
+			r.Partial++
+		case OutcomeSkipped:
+			r.Skipped++
+		case OutcomeFailed:
+			r.Failed++
+		}
+		if outcomeRank[client.Outcome] > outcomeRank[r.Outcome] {
+			r.Outcome = client.Outcome
+		}
+
+		for _, result := range client.Results {
+			if result == nil {
+				continue
+			}
+			r.Processed += result.SociosProcessed
+			r.Created += result.SociosCreated
+			r.Updated += result.SociosUpdated
+			r.Unchanged += result.SkippedByReason[SkipUnchanged]
+			r.Removed += result.SociosDeactivated + result.SociosDeleted
+			r.Errors += result.SociosFailed
+		}
+	}
+}
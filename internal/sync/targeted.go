@@ -0,0 +1,84 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// WithDNIs restricts the socios sync to the socios with these DNIs, for
+// resyncing a few after fixing them in Sage. They are synced even if
+// unchanged since the last run, looked up in Bitrix24 one by one instead of
+// listing the portal; duplicates and deletions are left to the next full
+// sync.
+func WithDNIs(dnis ...string) SyncOption {
+	return func(o *syncOptions) {
+		o.dnis = dnis
+	}
+}
+
+// fetchTargeted fetches the Sage socios with the requested DNIs, in the
+// mapped empresa if there is one. Requested DNIs without a socio are
+// recorded in SyncResult.NotFound.
+func (s *Service) fetchTargeted(ctx context.Context, cfg *config.Config, socioRepo SocioSource, dnis []string, result *SyncResult) ([]*models.Socio, error) {
+	// Ask for the DNIs as given and normalized, since Sage may hold either.
+	wanted := make(map[string]bool, len(dnis))
+	var query []string
+	for _, dni := range dnis {
+		normalized := models.NormalizeDNI(dni)
+		if normalized == "" {
+			continue
+		}
+		if !wanted[normalized] {
+			wanted[normalized] = true
+			result.DNIs = append(result.DNIs, dni)
+			query = append(query, normalized)
+		}
+		if dni != normalized && !slices.Contains(query, dni) {
+			query = append(query, dni)
+		}
+	}
+
+	s.logger.Printf("🎯 Fetching %d socios by DNI from Sage database...", len(result.DNIs))
+	found, err := socioRepo.GetByDNIs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	code, filtered := cfg.Company.SageEmpresa()
+	var socios []*models.Socio
+	matched := make(map[string]bool, len(wanted))
+	for _, socio := range found {
+		normalized := models.NormalizeDNI(socio.DNI)
+		if !wanted[normalized] || (filtered && socio.CodigoEmpresa != code) {
+			continue
+		}
+		matched[normalized] = true
+		socios = append(socios, socio)
+	}
+
+	for _, dni := range result.DNIs {
+		if matched[models.NormalizeDNI(dni)] {
+			continue
+		}
+		result.NotFound = append(result.NotFound, dni)
+		warning := fmt.Sprintf("Socio %s not found in Sage", dni)
+		if filtered {
+			warning = fmt.Sprintf("Socio %s not found in Sage empresa %d", dni, code)
+		}
+		s.logger.Printf("⚠️  %s", warning)
+		result.addWarning(IssueNotFound, dni, warning)
+		result.addDetail(ItemResult{DNI: dni, Action: ItemNotFound})
+	}
+	return socios, nil
+}
+
+// syncTargeted syncs the socios fetched by fetchTargeted, unchanged or not.
+func (s *Service) syncTargeted(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, sageSocios []*models.Socio, state *clientState, result *SyncResult) error {
+	sageSocios = result.withoutExcluded(sageSocios)
+	s.logger.Printf("🎯 Targeted sync of %d socios", len(sageSocios))
+	return s.syncByLookup(ctx, cfg, bitrixClient, sageSocios, state, result)
+}
@@ -0,0 +1,122 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+)
+
+// ErrPhaseTimeout is returned when a phase of a run exceeds its Timeouts
+// bound.
+var ErrPhaseTimeout = errors.New("phase timed out")
+
+// ErrRunTimeout is returned when a run exceeds its maximum duration, see
+// WithMaxRunDuration.
+var ErrRunTimeout = errors.New("run timed out")
+
+// Timeouts bounds the phases of a run, independently of the caller's
+// context. Zero fields take the DefaultTimeouts value; negative ones leave
+// the phase unbounded.
+type Timeouts struct {
+	SageConnect time.Duration // Opening and pinging the Sage database
+	SageQuery   time.Duration // Reading the socios from Sage
+	BitrixList  time.Duration // Listing the socios of the portal
+	ItemWrite   time.Duration // Creating or updating one socio, retries included
+}
+
+// DefaultTimeouts are the bounds used for the phases not set in WithTimeouts.
+var DefaultTimeouts = Timeouts{
+	SageConnect: 10 * time.Second,
+	SageQuery:   5 * time.Minute,
+	BitrixList:  30 * time.Minute,
+	ItemWrite:   2 * time.Minute,
+}
+
+// WithTimeouts bounds the phases of the run.
+func WithTimeouts(t Timeouts) SyncOption {
+	return func(o *syncOptions) {
+		o.timeouts = t
+	}
+}
+
+// withDefaults fills the zero fields from DefaultTimeouts.
+func (t Timeouts) withDefaults() Timeouts {
+	pick := func(d, def time.Duration) time.Duration {
+		if d == 0 {
+			return def
+		}
+		return d
+	}
+	return Timeouts{
+		SageConnect: pick(t.SageConnect, DefaultTimeouts.SageConnect),
+		SageQuery:   pick(t.SageQuery, DefaultTimeouts.SageQuery),
+		BitrixList:  pick(t.BitrixList, DefaultTimeouts.BitrixList),
+		ItemWrite:   pick(t.ItemWrite, DefaultTimeouts.ItemWrite),
+	}
+}
+
+// phaseContext returns a child of ctx that expires after d, or is only
+// cancelled with ctx when d is negative.
+func phaseContext(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d < 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// phaseError turns err into a phase-specific ErrPhaseTimeout when the phase
+// context ran out while its parent is still live; other errors are returned
+// as they are.
+func phaseError(phaseCtx, parent context.Context, phase string, d time.Duration, err error) error {
+	if err != nil && errors.Is(phaseCtx.Err(), context.DeadlineExceeded) && parent.Err() == nil {
+		return fmt.Errorf("%s took longer than %s: %w", phase, d, ErrPhaseTimeout)
+	}
+	return err
+}
+
+// WithMaxRunDuration bounds the whole socios run, overriding
+// SyncConfig.MaxRunMinutes; a negative d leaves it unbounded.
+func WithMaxRunDuration(d time.Duration) SyncOption {
+	return func(o *syncOptions) {
+		o.maxRun = d
+	}
+}
+
+// maxRunDuration returns the bound of a run: the WithMaxRunDuration one if
+// given, else the client's, negative when unbounded.
+func maxRunDuration(cfg *config.Config, options syncOptions) time.Duration {
+	if options.maxRun != 0 {
+		return options.maxRun
+	}
+	if cfg.Sync.MaxRunMinutes <= 0 {
+		return -1
+	}
+	return time.Duration(cfg.Sync.MaxRunMinutes) * time.Minute
+}
+
+// runTimeout turns the error of a run whose runCtx ran out while its
+// parent is still live into an ErrRunTimeout saying how far the run got,
+// and marks the result as timed out, in place of the run_failed error. The
+// counters so far are kept.
+func (s *Service) runTimeout(runCtx, parent context.Context, d time.Duration, result *SyncResult, err error) error {
+	if err == nil || !errors.Is(runCtx.Err(), context.DeadlineExceeded) || parent.Err() != nil {
+		return err
+	}
+	result.TimedOut = true
+	var processed, total int
+	if p := result.progress; p != nil {
+		result.TimedOutPhase, processed, total = p.phase, p.processed, p.total
+	}
+	timeoutErr := fmt.Errorf("run took longer than %s, stopped while %s after %d of %d socios: %w",
+		d, result.TimedOutPhase, processed, total, ErrRunTimeout)
+	// The timeout replaces the run_failed error it caused.
+	if last := len(result.Errors) - 1; last >= 0 && result.Errors[last].Code == IssueRunFailed {
+		result.Errors = result.Errors[:last]
+	}
+	result.addError(IssueRunTimeout, "", timeoutErr.Error())
+	s.logger.Printf("⏰ %v", timeoutErr)
+	return timeoutErr
+}
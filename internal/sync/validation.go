@@ -0,0 +1,270 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// ErrValidationThreshold is returned when more Sage socios fail validation
+// than SyncConfig.MaxInvalidPercent allows under the abort policy.
+var ErrValidationThreshold = errors.New("too many invalid socios in Sage")
+
+// Validation rules, the keys of ValidationReport.Rules.
+const (
+	RuleTaxID         = "tax_id"        // DNI is not a valid NIF, NIE or CIF
+	RuleParticipacion = "participacion" // PorParticipacion outside 0–100
+	RuleRazonSocial   = "razon_social"  // Empty RazonSocialEmpleado
+)
+
+// RuleViolations lists the socios that broke one rule.
+type RuleViolations struct {
+	Count int      `json:"count"`
+	DNIs  []string `json:"dnis"`
+}
+
+// ValidationReport is the outcome of checking the Sage socios before a run.
+type ValidationReport struct {
+	Policy  string                     `json:"policy"`
+	Checked int                        `json:"checked"`
+	Invalid int                        `json:"invalid"` // Socios breaking at least one rule
+	Rules   map[string]*RuleViolations `json:"rules,omitempty"`
+
+	// NullRows counts the socios with columns NULL in Sage, read as zero
+	// values; NullColumns counts them by column. They are not invalid for
+	// that alone.
+	NullRows    int            `json:"null_rows"`
+	NullColumns map[string]int `json:"null_columns,omitempty"`
+}
+
+// InvalidPercent is the share of the checked socios that were invalid.
+func (r *ValidationReport) InvalidPercent() float64 {
+	if r.Checked == 0 {
+		return 0
+	}
+	return float64(r.Invalid) * 100 / float64(r.Checked)
+}
+
+// socioRules are the checks run on every Sage socio, in report order.
+var socioRules = []struct {
+	name  string
+	valid func(*models.Socio) bool
+}{
+	{RuleTaxID, func(s *models.Socio) bool { return models.ValidTaxID(s.DNI) }},
+	{RuleParticipacion, func(s *models.Socio) bool { return s.PorParticipacion >= 0 && s.PorParticipacion <= 100 }},
+	{RuleRazonSocial, func(s *models.Socio) bool { return strings.TrimSpace(s.RazonSocialEmpleado) != "" }},
+}
+
+// validateSocios checks the socios against socioRules, returning the report
+// and the rules broken by each invalid socio.
+func validateSocios(socios []*models.Socio, policy string) (*ValidationReport, map[*models.Socio][]string) {
+	report := &ValidationReport{Policy: policy, Checked: len(socios), Rules: make(map[string]*RuleViolations)}
+	invalid := make(map[*models.Socio][]string)
+	for _, socio := range socios {
+		if len(socio.NullColumns) > 0 {
+			if report.NullColumns == nil {
+				report.NullColumns = make(map[string]int)
+			}
+			report.NullRows++
+			for _, column := range socio.NullColumns {
+				report.NullColumns[column]++
+			}
+		}
+		for _, rule := range socioRules {
+			if rule.valid(socio) {
+				continue
+			}
+			violations := report.Rules[rule.name]
+			if violations == nil {
+				violations = &RuleViolations{DNIs: make([]string, 0)}
+				report.Rules[rule.name] = violations
+			}
+			violations.Count++
+			violations.DNIs = append(violations.DNIs, socio.DNI)
+			invalid[socio] = append(invalid[socio], rule.name)
+		}
+	}
+	report.Invalid = len(invalid)
+	return report, invalid
+}
+
+// validate checks the Sage socios of a run and applies
+// SyncConfig.ValidationPolicy. With warn, invalid socios are only reported;
+// otherwise they are recorded as invalid and left out of the sync, and with
+// abort the run fails when they exceed SyncConfig.MaxInvalidPercent.
+func (s *Service) validate(cfg *config.Config, sageSocios []*models.Socio, result *SyncResult) error {
+	policy := cfg.Sync.ValidationPolicy
+	if policy == "" {
+		policy = config.ValidationWarn
+	}
+	report, invalid := validateSocios(sageSocios, policy)
+	result.Validation = report
+	if report.NullRows > 0 {
+		warning := fmt.Sprintf("%d Sage socios have NULL columns, read as empty%s", report.NullRows, skipBreakdown(report.NullColumns))
+		s.logger.Printf("⚠️  %s", warning)
+		result.addWarning(IssueNullData, "", warning)
+	}
+	if report.Invalid == 0 {
+		s.logger.Printf("✅ All %d Sage socios passed validation", report.Checked)
+		return nil
+	}
+
+	warning := fmt.Sprintf("%d of %d Sage socios failed validation (policy: %s)", report.Invalid, report.Checked, policy)
+	s.logger.Printf("⚠️  %s", warning)
+	result.addWarning(IssueInvalidData, "", warning)
+	for _, rule := range socioRules {
+		if violations := report.Rules[rule.name]; violations != nil {
+			s.logger.Printf("   🔎 %s: %d", rule.name, violations.Count)
+		}
+	}
+
+	switch policy {
+	case config.ValidationWarn:
+		return nil
+	case config.ValidationAbort:
+		if report.InvalidPercent() > float64(cfg.Sync.MaxInvalidPercent) {
+			return fmt.Errorf("%w: %d of %d socios (%.1f%%) over the %d%% limit",
+				ErrValidationThreshold, report.Invalid, report.Checked, report.InvalidPercent(), cfg.Sync.MaxInvalidPercent)
+		}
+	}
+
+	for _, socio := range sageSocios {
+		if rules, ok := invalid[socio]; ok {
+			result.SociosInvalid++
+			result.exclude(socio, SkipInvalidData, ItemInvalid, "invalid "+strings.Join(rules, ", "))
+		}
+	}
+	return nil
+}
+
+// collapseSageRows keeps one row per socio of each empresa. The historical
+// tables of Sage hold a row per period; the repository already returns only
+// the latest, but a SocioSource may not, so a socio can come back several
+// times with different values. The row of the latest Ejercicio is kept, and
+// rows of the same Ejercicio are told apart by their content, so
+// the pick never depends on the order Sage returned them in. The collapsed
+// rows are skipped as duplicate_row.
+func (s *Service) collapseSageRows(sageSocios []*models.Socio, result *SyncResult) []*models.Socio {
+	c := newRowCollapser(len(sageSocios))
+	for _, socio := range sageSocios {
+		c.add(socio)
+	}
+	return s.collapsed(c, result)
+}
+
+// rowCollapser collapses Sage rows one at a time, as collapseSageRows does,
+// so a streamed query only ever holds one row per socio.
+type rowCollapser struct {
+	latest    map[rowKey]int
+	collapsed []*models.Socio
+	rows      int
+}
+
+// rowKey identifies a socio of an empresa of a Sage database.
+type rowKey struct {
+	database string
+	empresa  int
+	dni      string
+}
+
+func newRowCollapser(size int) *rowCollapser {
+	return &rowCollapser{
+		latest:    make(map[rowKey]int, size),
+		collapsed: make([]*models.Socio, 0, size),
+	}
+}
+
+// add keeps socio unless a newer row of the same socio was already added.
+func (c *rowCollapser) add(socio *models.Socio) {
+	c.rows++
+	k := rowKey{socio.Database, socio.CodigoEmpresa, socio.DNI}
+	i, seen := c.latest[k]
+	if !seen {
+		c.latest[k] = len(c.collapsed)
+		c.collapsed = append(c.collapsed, socio)
+		return
+	}
+	if newerRow(socio, c.collapsed[i]) {
+		c.collapsed[i] = socio
+	}
+}
+
+// collapsed returns the rows c kept, reporting the others as skipped.
+func (s *Service) collapsed(c *rowCollapser, result *SyncResult) []*models.Socio {
+	if n := c.rows - len(c.collapsed); n > 0 {
+		s.logger.Printf("🧹 Collapsed %d older Sage rows of the same socios", n)
+		result.skip(SkipDuplicateRow, n)
+	}
+	return c.collapsed
+}
+
+// newerRow reports whether row a should be kept over row b of the same socio.
+func newerRow(a, b *models.Socio) bool {
+	if a.Ejercicio != b.Ejercicio {
+		return a.Ejercicio > b.Ejercicio
+	}
+	return a.ContentHash() < b.ContentHash()
+}
+
+// excludeDuplicateDNIs leaves out the Sage socios whose DNI, once
+// normalized, was already seen in the same empresa: they would all sync
+// into one Bitrix24 item. The first one is synced; the others are reported.
+func (s *Service) excludeDuplicateDNIs(sageSocios []*models.Socio, result *SyncResult) {
+	type key struct {
+		empresa int
+		dni     string
+	}
+	first := make(map[key]*models.Socio, len(sageSocios))
+	for _, socio := range sageSocios {
+		k := key{socio.CodigoEmpresa, models.NormalizeDNI(socio.DNI)}
+		if k.dni == "" || result.excluded[socio] {
+			continue
+		}
+		kept, seen := first[k]
+		if !seen {
+			first[k] = socio
+			continue
+		}
+
+		warning := fmt.Sprintf("Duplicate DNI %s in Sage empresa %d (%q and %q)", k.dni, k.empresa, kept.DNI, socio.DNI)
+		if kept.Database != socio.Database {
+			warning = fmt.Sprintf("Duplicate DNI %s in empresa %d of Sage databases %s and %s", k.dni, k.empresa, kept.Database, socio.Database)
+		}
+		s.logger.Printf("⚠️  %s", warning)
+		result.addWarning(IssueDuplicateSage, k.dni, warning)
+		result.exclude(socio, SkipDuplicateDNI, ItemSkipped, fmt.Sprintf("duplicate of %q", kept.DNI))
+	}
+}
+
+// exclude leaves a socio out of the sync, counting it as skipped for reason
+// and recording it as action.
+func (r *SyncResult) exclude(socio *models.Socio, reason, action, detail string) {
+	if r.excluded == nil {
+		r.excluded = make(map[*models.Socio]bool)
+	}
+	r.excluded[socio] = true
+	r.skip(reason, 1)
+	r.addDetail(ItemResult{DNI: socio.DNI, Action: action, Error: detail})
+	if r.Plan != nil {
+		r.Plan.add(PlannedAction{DNI: socio.DNI, Action: PlanSkip, Reason: detail})
+	}
+	r.progress.advance(1)
+}
+
+// withoutExcluded returns the socios not left out by validation or as
+// duplicates.
+func (r *SyncResult) withoutExcluded(socios []*models.Socio) []*models.Socio {
+	if len(r.excluded) == 0 {
+		return socios
+	}
+	kept := make([]*models.Socio, 0, len(socios)-len(r.excluded))
+	for _, socio := range socios {
+		if !r.excluded[socio] {
+			kept = append(kept, socio)
+		}
+	}
+	return kept
+}
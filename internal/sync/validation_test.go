@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+func TestValidateSociosNullRows(t *testing.T) {
+	withNulls := testSocio(2)
+	withNulls.NullColumns = []string{"CargoAdministrador", "PorParticipacion"}
+	alsoNull := testSocio(3)
+	alsoNull.NullColumns = []string{"CargoAdministrador"}
+
+	report, invalid := validateSocios([]*models.Socio{testSocio(1), withNulls, alsoNull}, config.ValidationWarn)
+	if report.NullRows != 2 {
+		t.Errorf("NullRows = %d, want 2", report.NullRows)
+	}
+	if report.NullColumns["CargoAdministrador"] != 2 || report.NullColumns["PorParticipacion"] != 1 {
+		t.Errorf("NullColumns = %v, want CargoAdministrador 2 and PorParticipacion 1", report.NullColumns)
+	}
+	if len(invalid) != 0 {
+		t.Errorf("%d socios with NULL columns read as zero values failed validation, want none", len(invalid))
+	}
+}
+
+// TestCollapseSageRows feeds crafted duplicate rows of two socios, in every
+// order, and checks the latest row of each is kept.
+func TestCollapseSageRows(t *testing.T) {
+	row := func(n, ejercicio int, cargo string) *models.Socio {
+		socio := testSocio(n)
+		socio.Ejercicio = ejercicio
+		socio.CargoAdministrador = cargo
+		return socio
+	}
+	rows := []*models.Socio{
+		row(1, 2022, "Vocal"),
+		row(1, 2024, "Consejero"),
+		row(1, 2023, "Presidente"),
+		row(2, 2024, "Vocal"),
+		row(2, 2024, "Secretario"), // Same ejercicio: picked by content hash
+	}
+	// Socio 1 in another empresa is another socio.
+	other := row(1, 2021, "Vocal")
+	other.CodigoEmpresa = 2
+	rows = append(rows, other)
+
+	tie := rows[3]
+	if rows[4].ContentHash() < tie.ContentHash() {
+		tie = rows[4]
+	}
+	want := map[int]string{1: "Consejero", 2: tie.CargoAdministrador}
+
+	// Each rotation of the rows is a different scan order.
+	for shift := range rows {
+		ordered := append(append([]*models.Socio(nil), rows[shift:]...), rows[:shift]...)
+		result := &SyncResult{}
+		kept := testService(nil, nil).collapseSageRows(ordered, result)
+
+		if len(kept) != 3 {
+			t.Fatalf("rotation %d kept %d rows, want 3", shift, len(kept))
+		}
+		for _, socio := range kept {
+			if socio.CodigoEmpresa == 2 {
+				if socio != other {
+					t.Errorf("rotation %d dropped the socio of empresa 2", shift)
+				}
+				continue
+			}
+			n := 1
+			if socio.DNI == testDNI(2) {
+				n = 2
+			}
+			if socio.CargoAdministrador != want[n] {
+				t.Errorf("rotation %d kept cargo %s of socio %d, want %s", shift, socio.CargoAdministrador, n, want[n])
+			}
+		}
+		if result.SkippedByReason[SkipDuplicateRow] != 3 || result.SociosSkipped != 3 {
+			t.Errorf("rotation %d skipped %v, want 3 %s", shift, result.SkippedByReason, SkipDuplicateRow)
+		}
+	}
+}
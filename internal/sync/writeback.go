@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/bitrix"
+	"github.com/arduriki/sage-bitrix-sync/internal/config"
+	"github.com/arduriki/sage-bitrix-sync/internal/models"
+)
+
+// writeBack copies the SyncConfig.WriteBackFields that were edited in
+// Bitrix24 since the last sync back to Sage, and updates the Sage socios in
+// memory so the sync that follows leaves the edits alone. Which side changed
+// is told from the field hashes in the state: a field whose Sage value still
+// matches its hash but whose Bitrix24 value does not was edited in Bitrix24.
+// Fields edited on both sides are conflicts, settled by
+// SyncConfig.ConflictPolicy; those Sage wins are left to the sync, which
+// records them. A dry run plans the write-backs instead.
+func (s *Service) writeBack(ctx context.Context, cfg *config.Config, bitrixClient SocioTarget, socioRepo SocioSource, sageSocios []*models.Socio, bitrixMap map[string]*bitrix.BitrixSocio, state *clientState, result *SyncResult) error {
+	if len(cfg.Sync.WriteBackFields) == 0 {
+		return nil
+	}
+	if state == nil {
+		return nil
+	}
+
+	for _, socio := range sageSocios {
+		if ctx.Err() != nil {
+			return fmt.Errorf("sync cancelled: %w", ctx.Err())
+		}
+
+		item, ok := bitrixMap[models.NormalizeDNI(socio.DNI)]
+		synced, known := state.lookup(socio.DNI)
+		if !ok || !known || synced.Fields == nil {
+			continue
+		}
+
+		changes, conflicts := s.writeBackChanges(cfg, bitrixClient, socio, item, synced, state)
+		if len(changes) == 0 {
+			continue
+		}
+
+		updated := *socio
+		fields := make([]string, 0, len(changes))
+		var err error
+		for _, change := range changes {
+			if err = updated.SetField(change.Field, change.New); err != nil {
+				break
+			}
+			fields = append(fields, change.Field)
+		}
+		if err == nil && !cfg.Sync.DryRun {
+			err = socioRepo.UpdateFields(ctx, &updated, fields)
+		}
+		if err != nil {
+			errorMsg := fmt.Sprintf("Failed to write back socio %s to Sage: %v", socio.DNI, err)
+			s.logger.Printf("❌ %s", errorMsg)
+			result.addItemError(socio.DNI, errorMsg, fmt.Sprintf("write back: %v", err))
+			result.addDetail(ItemResult{DNI: socio.DNI, Action: ItemFailed, BitrixID: item.ID, Error: err.Error()})
+			continue
+		}
+
+		*socio = updated
+		result.SociosWrittenBack++
+		result.Conflicts += len(conflicts)
+		result.addDetail(ItemResult{DNI: socio.DNI, Action: ItemWrittenBack, BitrixID: item.ID, ChangedFields: fields, Conflicts: conflicts})
+		if result.Plan != nil {
+			result.Plan.add(PlannedAction{DNI: socio.DNI, Action: PlanWriteBack, BitrixID: item.ID, Changes: changes, Reason: "edited in Bitrix24"})
+			continue
+		}
+		s.logger.Printf("↩️  Wrote back %v of socio %s to Sage", fields, socio.DNI)
+	}
+	return nil
+}
+
+// writeBackChanges returns the write-back fields of a socio to copy from
+// Bitrix24 to Sage, with Old the Sage value and New the Bitrix24 one, and
+// the conflicts among them.
+func (s *Service) writeBackChanges(cfg *config.Config, bitrixClient SocioTarget, socio *models.Socio, item *bitrix.BitrixSocio, synced stateItem, state *clientState) ([]bitrix.FieldChange, []FieldConflict) {
+	bitrixValues := bitrixClient.SocioFieldValues(item)
+	sageValues := bitrixClient.ExpectedFieldValues(socio)
+
+	var changes []bitrix.FieldChange
+	var conflicts []FieldConflict
+	for _, field := range cfg.Sync.WriteBackFields {
+		bitrixValue, sageValue := bitrixValues[field], sageValues[field]
+		last, ok := synced.Fields[field]
+		if bitrixValue == sageValue || !ok || fieldHash(bitrixValue) == last {
+			// In sync, unknown, or only Sage changed: the sync handles it.
+			continue
+		}
+		if fieldHash(sageValue) != last {
+			if conflictWinner(cfg, item, socio, state) != WinnerBitrix {
+				continue
+			}
+			s.logger.Printf("⚔️  Conflict on %s of socio %s: Sage %q, Bitrix24 %q, keeping Bitrix24 (%s)",
+				field, socio.DNI, sageValue, bitrixValue, cfg.Sync.ConflictPolicy)
+			conflicts = append(conflicts, FieldConflict{Field: field, Sage: sageValue, Bitrix: bitrixValue, Winner: WinnerBitrix})
+		}
+		changes = append(changes, bitrix.FieldChange{Field: field, Old: sageValue, New: bitrixValue})
+	}
+	return changes, conflicts
+}
@@ -0,0 +1,81 @@
+package syncstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations are the schema changes of the store, applied in order. Each
+// one runs once, in a transaction, and is recorded in schema_migrations
+// under its index plus one. Only ever append to the list.
+var migrations = []string{
+	// 1: runs and their item details.
+	`
+	CREATE TABLE runs (
+		run_id      TEXT PRIMARY KEY,
+		client_id   TEXT    NOT NULL,
+		entity      TEXT    NOT NULL,
+		start_time  INTEGER NOT NULL, -- Unix milliseconds
+		end_time    INTEGER NOT NULL,
+		success     INTEGER NOT NULL,
+		dry_run     INTEGER NOT NULL,
+		timed_out   INTEGER NOT NULL,
+		created     INTEGER NOT NULL,
+		updated     INTEGER NOT NULL,
+		skipped     INTEGER NOT NULL,
+		failed      INTEGER NOT NULL,
+		errors      INTEGER NOT NULL,
+		warnings    INTEGER NOT NULL,
+		result      TEXT    NOT NULL  -- The SyncResult as JSON, without Details
+	);
+	CREATE INDEX runs_client_start ON runs (client_id, start_time);
+	CREATE INDEX runs_start ON runs (start_time);
+
+	CREATE TABLE items (
+		run_id    TEXT    NOT NULL,
+		seq       INTEGER NOT NULL,
+		dni       TEXT    NOT NULL,
+		action    TEXT    NOT NULL,
+		bitrix_id INTEGER NOT NULL,
+		error     TEXT    NOT NULL,
+		detail    TEXT    NOT NULL, -- The ItemResult as JSON
+		PRIMARY KEY (run_id, seq)
+	);
+	CREATE INDEX items_dni ON items (dni);
+	`,
+}
+
+// migrate brings the schema up to date.
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("store schema version %d is newer than this program's %d", current, len(migrations))
+	}
+
+	for version := current + 1; version <= len(migrations); version++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to start migration %d: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, migrations[version-1]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+// Package syncstore keeps the results of sync runs in an SQLite database,
+// so the run history survives restarts and is bounded only by pruning.
+// It uses modernc.org/sqlite, a pure-Go driver, so no cgo is needed.
+package syncstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/sync"
+	_ "modernc.org/sqlite" // SQLite driver, registered as "sqlite"
+)
+
+// ErrRunNotFound is returned by GetRun for an unknown run ID.
+var ErrRunNotFound = errors.New("run not found")
+
+// busyTimeout is how long a write waits for another process holding the
+// database, such as a manual run while the scheduler saves one.
+const busyTimeout = 5 * time.Second
+
+// Store is the run history. It is safe for concurrent use.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens, or creates, the store in the SQLite file at path and brings
+// its schema up to date.
+func Open(ctx context.Context, path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sync store: %w", err)
+	}
+
+	// SQLite takes one writer at a time: writers of this process queue for
+	// the single connection, those of other processes wait busyTimeout.
+	db.SetMaxOpenConns(1)
+	for _, pragma := range []string{
+		fmt.Sprintf("PRAGMA busy_timeout = %d", busyTimeout.Milliseconds()),
+		"PRAGMA journal_mode = WAL",
+	} {
+		if _, err := db.ExecContext(ctx, pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to configure sync store: %w", err)
+		}
+	}
+
+	store, err := New(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// New creates a store on an open SQLite database and brings its schema up
+// to date.
+func New(ctx context.Context, db *sql.DB) (*Store, error) {
+	if err := migrate(ctx, db); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// SaveResult stores the result of a run with its item details, replacing
+// any earlier version of the same run.
+func (s *Store) SaveResult(ctx context.Context, result *sync.SyncResult) error {
+	summary := *result
+	summary.Details = nil
+	data, err := json.Marshal(&summary)
+	if err != nil {
+		return fmt.Errorf("failed to encode run %s: %w", result.RunID, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to save run %s: %w", result.RunID, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT OR REPLACE INTO runs (
+			run_id, client_id, entity, start_time, end_time, success, dry_run, timed_out,
+			created, updated, skipped, failed, errors, warnings, result
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		result.RunID, result.ClientID, result.Entity,
+		result.StartTime.UnixMilli(), result.EndTime.UnixMilli(),
+		result.Success, result.DryRun, result.TimedOut,
+		result.SociosCreated, result.SociosUpdated, result.SociosSkipped, result.SociosFailed,
+		len(result.Errors), len(result.Warnings), string(data))
+	if err != nil {
+		return fmt.Errorf("failed to save run %s: %w", result.RunID, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM items WHERE run_id = ?`, result.RunID); err != nil {
+		return fmt.Errorf("failed to save items of run %s: %w", result.RunID, err)
+	}
+	for i, item := range result.Details {
+		detail, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("failed to encode item %s of run %s: %w", item.DNI, result.RunID, err)
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO items (run_id, seq, dni, action, bitrix_id, error, detail) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			result.RunID, i, item.DNI, item.Action, item.BitrixID, item.Error, string(detail))
+		if err != nil {
+			return fmt.Errorf("failed to save items of run %s: %w", result.RunID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save run %s: %w", result.RunID, err)
+	}
+	return nil
+}
+
+// AfterSync saves the result of every run; register it with
+// sync.WithAfterSync.
+func (s *Store) AfterSync(ctx context.Context, _ sync.RunInfo, result *sync.SyncResult) error {
+	return s.SaveResult(ctx, result)
+}
+
+// RunFilter narrows ListRuns. Zero fields do not filter.
+type RunFilter struct {
+	Entity     string
+	Since      time.Time // Runs started at or after
+	Until      time.Time // Runs started before
+	FailedOnly bool      // Runs that did not succeed
+	Limit      int       // At most this many, newest first
+}
+
+// ListRuns returns the runs of a client matching filter, newest first,
+// without their item details.
+func (s *Store) ListRuns(ctx context.Context, clientID string, filter RunFilter) ([]*sync.SyncResult, error) {
+	where := []string{"client_id = ?"}
+	args := []any{clientID}
+	if filter.Entity != "" {
+		where = append(where, "entity = ?")
+		args = append(args, filter.Entity)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "start_time >= ?")
+		args = append(args, filter.Since.UnixMilli())
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "start_time < ?")
+		args = append(args, filter.Until.UnixMilli())
+	}
+	if filter.FailedOnly {
+		where = append(where, "success = 0")
+	}
+	query := "SELECT result FROM runs WHERE " + strings.Join(where, " AND ") + " ORDER BY start_time DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*sync.SyncResult
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read run: %w", err)
+		}
+		var result sync.SyncResult
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			return nil, fmt.Errorf("failed to decode run: %w", err)
+		}
+		results = append(results, &result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	return results, nil
+}
+
+// GetRun returns a run with its item details.
+func (s *Store) GetRun(ctx context.Context, runID string) (*sync.SyncResult, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT result FROM runs WHERE run_id = ?`, runID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, runID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run %s: %w", runID, err)
+	}
+	var result sync.SyncResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		return nil, fmt.Errorf("failed to decode run %s: %w", runID, err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT detail FROM items WHERE run_id = ? ORDER BY seq`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read items of run %s: %w", runID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var detail string
+		if err := rows.Scan(&detail); err != nil {
+			return nil, fmt.Errorf("failed to read item of run %s: %w", runID, err)
+		}
+		var item sync.ItemResult
+		if err := json.Unmarshal([]byte(detail), &item); err != nil {
+			return nil, fmt.Errorf("failed to decode item of run %s: %w", runID, err)
+		}
+		result.Details = append(result.Details, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read items of run %s: %w", runID, err)
+	}
+	return &result, nil
+}
+
+// PruneOlderThan deletes the runs started more than d ago, with their
+// items, and returns how many runs it deleted.
+func (s *Store) PruneOlderThan(ctx context.Context, d time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-d).UnixMilli()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune runs: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM items WHERE run_id IN (SELECT run_id FROM runs WHERE start_time < ?)`, cutoff); err != nil {
+		return 0, fmt.Errorf("failed to prune run items: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM runs WHERE start_time < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune runs: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to prune runs: %w", err)
+	}
+	return res.RowsAffected()
+}
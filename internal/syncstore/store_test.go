@@ -0,0 +1,201 @@
+package syncstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/arduriki/sage-bitrix-sync/internal/sync"
+)
+
+// openTest opens a store in a fresh file, closed when the test ends.
+func openTest(t *testing.T, path string) *Store {
+	t.Helper()
+	store, err := Open(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// testResult returns the result of a run of client started at start.
+func testResult(runID, client string, start time.Time, success bool) *sync.SyncResult {
+	return &sync.SyncResult{
+		Entity:        "socios",
+		RunID:         runID,
+		ClientID:      client,
+		StartTime:     start,
+		EndTime:       start.Add(time.Second),
+		Success:       success,
+		SociosCreated: 1,
+		Details: []sync.ItemResult{
+			{DNI: "00000001R", Action: sync.ItemCreated, BitrixID: 10},
+			{DNI: "00000002W", Action: sync.ItemFailed, Error: "boom"},
+		},
+	}
+}
+
+func TestSaveAndGetRun(t *testing.T) {
+	ctx := context.Background()
+	store := openTest(t, filepath.Join(t.TempDir(), "runs.db"))
+
+	start := time.Now().Truncate(time.Millisecond)
+	if err := store.SaveResult(ctx, testResult("run-1", "acme", start, true)); err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+
+	run, err := store.GetRun(ctx, "run-1")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.ClientID != "acme" || !run.StartTime.Equal(start) || run.SociosCreated != 1 {
+		t.Errorf("GetRun = %s %s %d created, want acme %s 1 created", run.ClientID, run.StartTime, run.SociosCreated, start)
+	}
+	if len(run.Details) != 2 || run.Details[1].Error != "boom" {
+		t.Errorf("GetRun details = %+v, want the two saved items in order", run.Details)
+	}
+
+	if _, err := store.GetRun(ctx, "missing"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("GetRun(missing) error = %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestListRunsFilter(t *testing.T) {
+	ctx := context.Background()
+	store := openTest(t, filepath.Join(t.TempDir(), "runs.db"))
+
+	now := time.Now()
+	for i, r := range []*sync.SyncResult{
+		testResult("old", "acme", now.Add(-48*time.Hour), true),
+		testResult("failed", "acme", now.Add(-time.Hour), false),
+		testResult("latest", "acme", now, true),
+		testResult("other", "globex", now, true),
+	} {
+		if err := store.SaveResult(ctx, r); err != nil {
+			t.Fatalf("SaveResult %d: %v", i, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter RunFilter
+		want   []string
+	}{
+		{"all", RunFilter{}, []string{"latest", "failed", "old"}},
+		{"since", RunFilter{Since: now.Add(-2 * time.Hour)}, []string{"latest", "failed"}},
+		{"until", RunFilter{Until: now.Add(-2 * time.Hour)}, []string{"old"}},
+		{"failed only", RunFilter{FailedOnly: true}, []string{"failed"}},
+		{"limit", RunFilter{Limit: 1}, []string{"latest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, err := store.ListRuns(ctx, "acme", tt.filter)
+			if err != nil {
+				t.Fatalf("ListRuns: %v", err)
+			}
+			var got []string
+			for _, run := range runs {
+				got = append(got, run.RunID)
+				if run.Details != nil {
+					t.Errorf("ListRuns returned the details of run %s", run.RunID)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ListRuns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneOlderThan(t *testing.T) {
+	ctx := context.Background()
+	store := openTest(t, filepath.Join(t.TempDir(), "runs.db"))
+
+	now := time.Now()
+	store.SaveResult(ctx, testResult("old", "acme", now.Add(-48*time.Hour), true))
+	store.SaveResult(ctx, testResult("new", "acme", now, true))
+
+	pruned, err := store.PruneOlderThan(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("PruneOlderThan: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("PruneOlderThan pruned %d runs, want 1", pruned)
+	}
+	if _, err := store.GetRun(ctx, "old"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("GetRun(old) error = %v, want ErrRunNotFound", err)
+	}
+	var items int
+	store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM items WHERE run_id = 'old'`).Scan(&items)
+	if items != 0 {
+		t.Errorf("%d items of the pruned run are left", items)
+	}
+}
+
+func TestMigrateReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.db")
+	openTest(t, path).Close()
+
+	store := openTest(t, path)
+	var version int
+	if err := store.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatalf("read schema version: %v", err)
+	}
+	if version != len(migrations) {
+		t.Errorf("schema version %d, want %d", version, len(migrations))
+	}
+}
+
+// TestConcurrentWriters saves runs from a scheduler and from manual
+// triggers at the same time, each with a store of its own on the same file
+// as separate processes would, while the scheduler also prunes.
+func TestConcurrentWriters(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "runs.db")
+	scheduler := openTest(t, path)
+	manual := openTest(t, path)
+
+	const runs = 25
+	start := time.Now()
+	var wg gosync.WaitGroup
+	errs := make(chan error, 4*runs)
+	write := func(store *Store, prefix string) {
+		defer wg.Done()
+		for i := range runs {
+			r := testResult(fmt.Sprintf("%s-%d", prefix, i), "acme", start.Add(time.Duration(i)*time.Millisecond), true)
+			if err := store.SaveResult(ctx, r); err != nil {
+				errs <- err
+			}
+		}
+	}
+	wg.Add(4)
+	go write(scheduler, "scheduled")
+	go write(scheduler, "scheduled-retry")
+	go write(manual, "manual")
+	go func() {
+		defer wg.Done()
+		for range runs {
+			if _, err := scheduler.PruneOlderThan(ctx, time.Hour); err != nil {
+				errs <- err
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent write: %v", err)
+	}
+
+	listed, err := manual.ListRuns(ctx, "acme", RunFilter{})
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	if len(listed) != 3*runs {
+		t.Errorf("ListRuns returned %d runs, want %d", len(listed), 3*runs)
+	}
+}